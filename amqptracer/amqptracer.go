@@ -0,0 +1,256 @@
+// Package amqptracer provides a tracer implementation for rabbitmq/amqp091-go.
+//
+//	ch, err := conn.Channel()
+//	if err != nil {
+//		return err
+//	}
+//
+//	channel := amqptracer.NewSentryChannel(ch)
+//	err = channel.PublishWithContext(ctx, "orders", "orders.created", false, false, amqp.Publishing{
+//		ContentType: "application/json",
+//		Body:        body,
+//	})
+//
+//	deliveries, err := channel.Consume("orders", "", false, false, false, false, nil)
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = channel.HandleDeliveries(ctx, deliveries, func(ctx context.Context, delivery *amqptracer.Delivery) error {
+//		if err := processOrder(ctx, delivery.Body); err != nil {
+//			return delivery.Nack(false, true)
+//		}
+//
+//		return delivery.Ack(false)
+//	})
+package amqptracer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var integration = config.Integration{Origin: "auto.queue.amqp"}
+
+// SetEnabled turns the spans of RabbitMQ publishes and deliveries on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryAmqpTracerOption func(*Channel)
+
+func WithTags(tags map[string]string) SentryAmqpTracerOption {
+	return func(t *Channel) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryAmqpTracerOption {
+	return func(t *Channel) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the exchange or routing key, e.g. to leave out
+// heartbeat queues.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryAmqpTracerOption {
+	return func(t *Channel) {
+		t.spanSampler = sampler
+	}
+}
+
+func NewSentryChannel(channel *amqp.Channel, opts ...SentryAmqpTracerOption) *Channel {
+	c := &Channel{
+		Channel: channel,
+		tags:    make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type Channel struct {
+	*amqp.Channel
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (c *Channel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	destination := exchange
+	if destination == "" {
+		// Publishing to the default exchange routes the message straight to the queue named by the key.
+		destination = key
+	}
+
+	span := integration.StartSampledSpan(ctx, c.spanSampler, "queue.publish", destination)
+	if span == nil {
+		return c.Channel.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "rabbitmq")
+	span.SetData(semconv.MessagingDestinationName.Key(), destination)
+	span.SetData("messaging.rabbitmq.destination.routing_key", key)
+	if msg.MessageId != "" {
+		span.SetData(semconv.MessagingMessageID.Key(), msg.MessageId)
+	}
+	messaging.SetBodySize(span, len(msg.Body))
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	headers := make(amqp.Table, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[sentry.SentryTraceHeader] = span.ToSentryTrace()
+	headers[sentry.SentryBaggageHeader] = span.ToBaggage()
+	msg.Headers = headers
+
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	err := c.Channel.PublishWithContext(span.Context(), exchange, key, mandatory, immediate, msg)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return err
+}
+
+// Delivery wraps amqp.Delivery so that acknowledging it records the outcome on
+// the "queue.process" transaction of the delivery.
+type Delivery struct {
+	amqp.Delivery
+	span *sentry.Span
+}
+
+func (d *Delivery) outcome(outcome string, err error) error {
+	if d.span == nil {
+		return err
+	}
+
+	d.span.SetData("messaging.rabbitmq.ack", outcome)
+	if err != nil {
+		d.span.SetData("messaging.rabbitmq.ack.error", err.Error())
+	}
+
+	return err
+}
+
+func (d *Delivery) Ack(multiple bool) error {
+	return d.outcome("ack", d.Delivery.Ack(multiple))
+}
+
+func (d *Delivery) Nack(multiple, requeue bool) error {
+	if requeue {
+		return d.outcome("nack_requeue", d.Delivery.Nack(multiple, requeue))
+	}
+
+	return d.outcome("nack", d.Delivery.Nack(multiple, requeue))
+}
+
+func (d *Delivery) Reject(requeue bool) error {
+	if requeue {
+		return d.outcome("reject_requeue", d.Delivery.Reject(requeue))
+	}
+
+	return d.outcome("reject", d.Delivery.Reject(requeue))
+}
+
+// DeliveryHandler processes a single delivery. The provided context carries the
+// "queue.process" transaction of the delivery.
+type DeliveryHandler func(ctx context.Context, delivery *Delivery) error
+
+// HandleDeliveries hands every delivery received from deliveries to handler,
+// until either the deliveries channel is closed or ctx is done.
+func (c *Channel) HandleDeliveries(ctx context.Context, deliveries <-chan amqp.Delivery, handler DeliveryHandler) error {
+	for {
+		select {
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return nil
+			}
+
+			_ = c.ProcessDelivery(ctx, delivery, handler)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ProcessDelivery runs handler within a "queue.process" transaction continued
+// from the trace context found in the delivery headers.
+func (c *Channel) ProcessDelivery(ctx context.Context, delivery amqp.Delivery, handler DeliveryHandler) error {
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier{
+		sentry.SentryTraceHeader:   getHeader(delivery.Headers, sentry.SentryTraceHeader),
+		sentry.SentryBaggageHeader: getHeader(delivery.Headers, sentry.SentryBaggageHeader),
+	})
+
+	destination := delivery.Exchange
+	if destination == "" {
+		destination = delivery.RoutingKey
+	}
+
+	span := integration.StartTransaction(
+		ctx,
+		c.spanSampler,
+		"queue.process",
+		destination,
+		continueTrace,
+	)
+	if span == nil {
+		return handler(ctx, &Delivery{Delivery: delivery})
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "rabbitmq")
+	span.SetData(semconv.MessagingDestinationName.Key(), destination)
+	span.SetData("messaging.rabbitmq.destination.routing_key", delivery.RoutingKey)
+	if delivery.MessageId != "" {
+		span.SetData(semconv.MessagingMessageID.Key(), delivery.MessageId)
+	}
+	messaging.SetBodySize(span, len(delivery.Body))
+	span.SetData("messaging.rabbitmq.redelivered", strconv.FormatBool(delivery.Redelivered))
+	messaging.SetReceiveLatency(span, delivery.Timestamp, time.Now())
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	err := handler(span.Context(), &Delivery{Delivery: delivery, span: span})
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return err
+}
+
+func getHeader(headers amqp.Table, key string) string {
+	value, _ := headers[key].(string)
+	return value
+}
@@ -0,0 +1,159 @@
+// Package antstracer provides a tracer implementation for panjf2000/ants
+// goroutine pools.
+//
+//	p, err := ants.NewPool(100)
+//	if err != nil {
+//		return err
+//	}
+//
+//	pool := antstracer.NewSentryPool(p, "thumbnails")
+//
+//	err = pool.SubmitContext(ctx, func(ctx context.Context) {
+//		generateThumbnail(ctx, image)
+//	})
+//
+// Every task records the time it waited for a free worker as a "pool.wait"
+// span, and runs within a "pool.task" span carrying the saturation of the pool
+// at submission time. Panics are captured as exceptions before being handed
+// back to the pool's own panic handling.
+package antstracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+	"github.com/panjf2000/ants/v2"
+)
+
+var integration = config.Integration{Origin: "auto.function.ants"}
+
+// SetEnabled turns the spans of pool waits and tasks on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryAntsTracerOption func(*Pool)
+
+func WithTags(tags map[string]string) SentryAntsTracerOption {
+	return func(p *Pool) {
+		for k, v := range tags {
+			p.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryAntsTracerOption {
+	return func(p *Pool) {
+		p.tags[key] = value
+	}
+}
+
+// WithSpanSampler submits tasks for which sampler returns false, given the
+// "pool.wait" operation and the name of the pool, without any span.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryAntsTracerOption {
+	return func(p *Pool) {
+		p.spanSampler = sampler
+	}
+}
+
+func NewSentryPool(pool *ants.Pool, name string, opts ...SentryAntsTracerOption) *Pool {
+	p := &Pool{
+		Pool: pool,
+		name: name,
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Pool wraps an ants.Pool. Tasks submitted through SubmitContext are traced,
+// Submit is forwarded to the underlying pool as-is.
+type Pool struct {
+	*ants.Pool
+	name        string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (p *Pool) setData(span *sentry.Span) {
+	span.SetData("pool.name", p.name)
+	span.SetData("pool.capacity", strconv.Itoa(p.Cap()))
+	span.SetData("pool.running", strconv.Itoa(p.Running()))
+	span.SetData("pool.waiting", strconv.Itoa(p.Waiting()))
+	span.SetData("pool.free", strconv.Itoa(p.Free()))
+
+	for k, v := range p.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// SubmitContext submits task to the pool. The context given to task carries
+// its "pool.task" span and a clone of the hub of ctx.
+func (p *Pool) SubmitContext(ctx context.Context, task func(ctx context.Context)) error {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	wait := integration.StartSampledSpan(ctx, p.spanSampler, "pool.wait", p.name)
+	if wait == nil {
+		return p.Pool.Submit(func() {
+			task(ctx)
+		})
+	}
+	p.setData(wait)
+
+	submittedAt := time.Now()
+
+	err := p.Pool.Submit(func() {
+		wait.Status = sentry.SpanStatusOK
+		wait.Finish()
+
+		taskHub := hub.Clone()
+		taskCtx := sentry.SetHubOnContext(ctx, taskHub)
+
+		span := integration.StartSampledSpan(taskCtx, p.spanSampler, "pool.task", p.name)
+		if span == nil {
+			task(taskCtx)
+			return
+		}
+		p.setData(span)
+		span.SetData("pool.wait_time", strconv.FormatInt(time.Since(submittedAt).Milliseconds(), 10))
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				taskHub.RecoverWithContext(span.Context(), recovered)
+				span.Status = sentry.SpanStatusInternalError
+				span.Finish()
+
+				// Let the pool handle the panic as it would have without the
+				// tracer, with its own panic handler if any.
+				panic(recovered)
+			}
+
+			span.Status = sentry.SpanStatusOK
+			span.Finish()
+		}()
+
+		task(span.Context())
+	})
+	if err != nil {
+		wait.Status = sentry.SpanStatusInternalError
+		if errors.Is(err, ants.ErrPoolOverload) {
+			wait.Status = sentry.SpanStatusResourceExhausted
+		}
+		wait.SetData("error", err.Error())
+		wait.Finish()
+	}
+
+	return err
+}
@@ -0,0 +1,248 @@
+// Package asynqtracer provides a tracer implementation for hibiken/asynq.
+//
+//	mux := asynq.NewServeMux()
+//	mux.Use(asynqtracer.NewSentryMiddleware(
+//		// Emits Sentry Cron check-ins for the periodic task registered below.
+//		asynqtracer.WithMonitor("report:daily", "daily-report", &sentry.MonitorConfig{
+//			Schedule: sentry.CrontabSchedule("0 3 * * *"),
+//		}),
+//	))
+//	mux.HandleFunc("email:send", handleSendEmail)
+//	mux.HandleFunc("report:daily", handleDailyReport)
+//
+//	scheduler.Register("0 3 * * *", asynq.NewTask("report:daily", nil))
+//
+//	// Enqueue continues the trace of ctx within the task handler.
+//	info, err := asynqtracer.Enqueue(ctx, client, asynq.NewTask("email:send", payload))
+package asynqtracer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sentryintegration "github.com/aldy505/sentry-integration"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/hibiken/asynq"
+)
+
+// taskIDSeparator separates the trace context from the enqueue timestamp within
+// task IDs generated by Enqueue.
+const taskIDSeparator = "@"
+
+var integration = config.Integration{Origin: "auto.queue.asynq"}
+
+// SetEnabled turns the spans of asynq tasks on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryAsynqTracerOption func(*middleware)
+
+func WithTags(tags map[string]string) SentryAsynqTracerOption {
+	return func(t *middleware) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryAsynqTracerOption {
+	return func(t *middleware) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler runs tasks for which sampler returns false, given the
+// operation and the task type, without a transaction.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryAsynqTracerOption {
+	return func(t *middleware) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithMonitor emits Sentry Cron check-ins with the given monitor slug whenever
+// a task of taskType is processed. It is meant for periodic tasks registered
+// through asynq.Scheduler. The monitor config may be nil.
+func WithMonitor(taskType, slug string, config *sentry.MonitorConfig) SentryAsynqTracerOption {
+	return func(t *middleware) {
+		t.monitors[taskType] = monitor{slug: slug, config: config}
+	}
+}
+
+type monitor struct {
+	slug   string
+	config *sentry.MonitorConfig
+}
+
+type middleware struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+	monitors    map[string]monitor
+}
+
+// NewSentryMiddleware returns a middleware that runs every task within a
+// "queue.process" transaction, and captures failed tasks as exceptions.
+func NewSentryMiddleware(opts ...SentryAsynqTracerOption) asynq.MiddlewareFunc {
+	m := &middleware{
+		tags:     make(map[string]string),
+		monitors: make(map[string]monitor),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m.wrap
+}
+
+func (m *middleware) wrap(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) (err error) {
+		ctx, hub := sentryintegration.EnsureHub(ctx)
+
+		taskID, _ := asynq.GetTaskID(ctx)
+		trace, enqueuedAt := parseTaskID(taskID)
+
+		startedAt := time.Now()
+
+		span := integration.StartTransaction(
+			ctx,
+			m.spanSampler,
+			"queue.process",
+			task.Type(),
+			sentry.ContinueFromTrace(trace),
+		)
+		if span == nil {
+			return next.ProcessTask(ctx, task)
+		}
+
+		span.SetData("messaging.system", "asynq")
+		span.SetData(semconv.MessagingMessageID.Key(), taskID)
+		messaging.SetBodySize(span, len(task.Payload()))
+		if queue, ok := asynq.GetQueueName(ctx); ok {
+			span.SetData(semconv.MessagingDestinationName.Key(), queue)
+		}
+		if retryCount, ok := asynq.GetRetryCount(ctx); ok {
+			span.SetData("messaging.message.retry.count", strconv.Itoa(retryCount))
+		}
+		if maxRetry, ok := asynq.GetMaxRetry(ctx); ok {
+			span.SetData("messaging.asynq.max_retry", strconv.Itoa(maxRetry))
+		}
+		messaging.SetReceiveLatency(span, enqueuedAt, startedAt)
+
+		for k, v := range m.tags {
+			span.SetTag(k, v)
+		}
+
+		var checkInID *sentry.EventID
+		monitor, monitored := m.monitors[task.Type()]
+		if monitored {
+			checkInID = hub.CaptureCheckIn(&sentry.CheckIn{
+				MonitorSlug: monitor.slug,
+				Status:      sentry.CheckInStatusInProgress,
+			}, monitor.config)
+		}
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				hub.RecoverWithContext(ctx, recovered)
+				err = fmt.Errorf("panic: %v", recovered)
+			} else if err != nil {
+				hub.CaptureException(err)
+			}
+
+			if err != nil {
+				span.Status = sentry.SpanStatusInternalError
+				span.SetData("error", err.Error())
+			} else {
+				span.Status = sentry.SpanStatusOK
+			}
+			span.Finish()
+
+			if monitored {
+				status := sentry.CheckInStatusOK
+				if err != nil {
+					status = sentry.CheckInStatusError
+				}
+
+				checkIn := &sentry.CheckIn{
+					MonitorSlug: monitor.slug,
+					Status:      status,
+					Duration:    time.Since(startedAt),
+				}
+				if checkInID != nil {
+					checkIn.ID = *checkInID
+				}
+				hub.CaptureCheckIn(checkIn, monitor.config)
+			}
+		}()
+
+		ctx, unlabel := profiling.Label(span.Context(), span)
+		defer unlabel()
+
+		return next.ProcessTask(ctx, task)
+	})
+}
+
+// Enqueue wraps asynq.Client.EnqueueContext with a "queue.publish" span.
+//
+// Asynq tasks do not carry headers, therefore the trace context and the enqueue
+// time are encoded into the task ID, which the middleware decodes again. When
+// an explicit asynq.TaskID option is given, the task is enqueued untouched.
+func Enqueue(ctx context.Context, client *asynq.Client, task *asynq.Task, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	span := integration.StartSampledSpan(ctx, nil, "queue.publish", task.Type())
+	if span == nil {
+		return client.EnqueueContext(ctx, task, opts...)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "asynq")
+	messaging.SetBodySize(span, len(task.Payload()))
+
+	hasTaskID := false
+	for _, opt := range opts {
+		if opt.Type() == asynq.TaskIDOpt {
+			hasTaskID = true
+			break
+		}
+	}
+	if !hasTaskID {
+		opts = append(opts, asynq.TaskID(span.ToSentryTrace()+taskIDSeparator+strconv.FormatInt(time.Now().UnixMilli(), 10)))
+	}
+
+	info, err := client.EnqueueContext(span.Context(), task, opts...)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return info, err
+	}
+
+	span.Status = sentry.SpanStatusOK
+	span.SetData(semconv.MessagingDestinationName.Key(), info.Queue)
+	span.SetData(semconv.MessagingMessageID.Key(), info.ID)
+
+	return info, nil
+}
+
+// parseTaskID extracts the trace context and the enqueue time out of a task ID
+// generated by Enqueue.
+func parseTaskID(taskID string) (string, time.Time) {
+	trace, enqueuedAt, found := strings.Cut(taskID, taskIDSeparator)
+	if !found {
+		return "", time.Time{}
+	}
+
+	milliseconds, err := strconv.ParseInt(enqueuedAt, 10, 64)
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	return trace, time.UnixMilli(milliseconds)
+}
@@ -0,0 +1,148 @@
+// Package awstracer provides a tracer implementation for every AWS SDK v2
+// service client, as a smithy-go middleware.
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	if err != nil {
+//		return err
+//	}
+//
+//	awstracer.AppendMiddlewares(&cfg)
+//
+//	client := s3.NewFromConfig(cfg)
+//
+// Spans are named "Service.Operation", e.g. "S3.PutObject", and cover every
+// retry attempt of the operation.
+package awstracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.http.aws"}
+
+// SetEnabled turns the spans of AWS SDK requests on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryAWSTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryAWSTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryAWSTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the operation and the "Service.Operation" description, e.g.
+// "S3.HeadObject".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryAWSTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// AppendMiddlewares adds the tracing middleware to cfg, so every client created
+// out of it is traced.
+func AppendMiddlewares(cfg *aws.Config, opts ...SentryAWSTracerOption) {
+	cfg.APIOptions = append(cfg.APIOptions, NewSentryMiddleware(opts...))
+}
+
+// NewSentryMiddleware returns a function to be appended to the APIOptions of an
+// aws.Config, or of a single service client.
+func NewSentryMiddleware(opts ...SentryAWSTracerOption) func(*middleware.Stack) error {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("SentryAWSTracer", t.handleInitialize), middleware.Before)
+	}
+}
+
+func (t *tracer) handleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service := awsmiddleware.GetServiceID(ctx)
+	operation := awsmiddleware.GetOperationName(ctx)
+	description := service + "." + operation
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "http.client", description)
+	if span == nil {
+		return next.HandleInitialize(ctx, in)
+	}
+	defer span.Finish()
+
+	span.SetData("rpc.system", "aws-api")
+	span.SetData("rpc.service", service)
+	span.SetData("rpc.method", operation)
+	span.SetData("cloud.region", awsmiddleware.GetRegion(ctx))
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	out, metadata, err := next.HandleInitialize(span.Context(), in)
+
+	if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+		span.SetData("aws.request_id", requestID)
+	}
+	if attempts, ok := retry.GetAttemptResults(metadata); ok {
+		span.SetData("aws.attempts", strconv.Itoa(len(attempts.Results)))
+	}
+
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(responseErr.HTTPStatusCode()))
+		if responseErr.ServiceRequestID() != "" {
+			span.SetData("aws.request_id", responseErr.ServiceRequestID())
+		}
+	}
+
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		if responseErr != nil {
+			span.Status = sentry.HTTPtoSpanStatus(responseErr.HTTPStatusCode())
+		}
+		span.SetData("error", err.Error())
+
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			span.SetData("aws.error_code", apiErr.ErrorCode())
+		}
+
+		return out, metadata, err
+	}
+
+	span.Status = sentry.SpanStatusOK
+
+	return out, metadata, nil
+}
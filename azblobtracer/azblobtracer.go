@@ -0,0 +1,206 @@
+// Package azblobtracer provides a tracer implementation for the Azure Blob
+// Storage client, as an azcore pipeline policy.
+//
+//	client, err := azblob.NewClient(serviceURL, credential, &azblob.ClientOptions{
+//		ClientOptions: azcore.ClientOptions{
+//			PerCallPolicies: []policy.Policy{azblobtracer.NewSentryPolicy()},
+//		},
+//	})
+//
+// The policy is called once per operation, so a span covers every retry of the
+// operation.
+package azblobtracer
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.http.azblob"}
+
+// SetEnabled turns the spans of Azure Blob Storage requests on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryAzureBlobTracerOption func(*Policy)
+
+func WithTags(tags map[string]string) SentryAzureBlobTracerOption {
+	return func(p *Policy) {
+		for k, v := range tags {
+			p.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryAzureBlobTracerOption {
+	return func(p *Policy) {
+		p.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of requests for which sampler returns false,
+// given the operation and the "container/blob" description.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryAzureBlobTracerOption {
+	return func(p *Policy) {
+		p.spanSampler = sampler
+	}
+}
+
+// WithTracePropagationTargets restricts the injection of the sentry-trace and
+// baggage headers to URLs containing one of targets. By default, the targets
+// of config.WithTracePropagationTargets apply, or headers are injected into
+// every request.
+func WithTracePropagationTargets(targets []string) SentryAzureBlobTracerOption {
+	return func(p *Policy) {
+		p.tracePropagationTargets = targets
+	}
+}
+
+// WithKeyScrubber sets a function applied to every blob name before it is
+// recorded on a span, e.g. to strip user identifiers out of the name.
+func WithKeyScrubber(scrubber func(name string) string) SentryAzureBlobTracerOption {
+	return func(p *Policy) {
+		p.scrubKey = scrubber
+	}
+}
+
+func NewSentryPolicy(opts ...SentryAzureBlobTracerOption) policy.Policy {
+	p := &Policy{
+		scrubKey: func(name string) string { return name },
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+type Policy struct {
+	tracePropagationTargets []string
+	scrubKey                func(name string) string
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// Do implements policy.Policy.
+func (p *Policy) Do(request *policy.Request) (*http.Response, error) {
+	raw := request.Raw()
+	container, blob := blobPath(raw.URL)
+	operation := operationName(raw.Method, raw.URL.Query())
+
+	description := operation + " " + container
+	if blob != "" {
+		blob = p.scrubKey(blob)
+		description += "/" + blob
+	}
+
+	span := integration.StartSampledSpan(raw.Context(), p.spanSampler, spanOp(raw.Method, blob), description)
+	if span == nil {
+		return request.Next()
+	}
+	defer span.Finish()
+
+	span.SetData(semconv.HTTPRequestMethod.Key(), raw.Method)
+	span.SetData(semconv.ServerAddress.Key(), raw.URL.Hostname())
+	span.SetData("azure.storage.operation", operation)
+	if container != "" {
+		span.SetData("azure.storage.container", container)
+	}
+	if blob != "" {
+		span.SetData("azure.storage.blob", blob)
+	}
+	if raw.ContentLength > 0 {
+		span.SetData("http.request.body.size", strconv.FormatInt(raw.ContentLength, 10))
+	}
+
+	for k, v := range p.tags {
+		span.SetTag(k, v)
+	}
+
+	request = request.Clone(span.Context())
+	if p.shouldPropagate(raw.URL) {
+		request.Raw().Header.Set(sentry.SentryTraceHeader, span.ToSentryTrace())
+		request.Raw().Header.Set(sentry.SentryBaggageHeader, span.ToBaggage())
+	}
+
+	response, err := request.Next()
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return response, err
+	}
+
+	span.Status = sentry.HTTPtoSpanStatus(response.StatusCode)
+	span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(response.StatusCode))
+	if requestID := response.Header.Get("x-ms-request-id"); requestID != "" {
+		span.SetData("azure.request_id", requestID)
+	}
+	if clientRequestID := response.Header.Get("x-ms-client-request-id"); clientRequestID != "" {
+		span.SetData("azure.client_request_id", clientRequestID)
+	}
+	if errorCode := response.Header.Get("x-ms-error-code"); errorCode != "" {
+		span.SetData("azure.error_code", errorCode)
+	}
+	if blob != "" && (raw.Method == http.MethodGet || raw.Method == http.MethodHead) {
+		if size := response.Header.Get("Content-Length"); size != "" {
+			span.SetData("azure.storage.blob.size", size)
+		}
+	}
+
+	return response, nil
+}
+
+func (p *Policy) shouldPropagate(u *url.URL) bool {
+	return config.ShouldPropagate(p.tracePropagationTargets, u.String())
+}
+
+// blobPath splits a Blob Storage URL path into its container and blob name.
+func blobPath(u *url.URL) (container string, blob string) {
+	container, blob, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	return container, blob
+}
+
+// operationName derives a name for a Blob Storage REST API call out of its
+// method and the "comp" and "restype" query parameters, e.g. "PUT block" or
+// "GET container".
+func operationName(method string, query url.Values) string {
+	if comp := query.Get("comp"); comp != "" {
+		return method + " " + comp
+	}
+	if restype := query.Get("restype"); restype != "" {
+		return method + " " + restype
+	}
+
+	return method + " blob"
+}
+
+func spanOp(method, blob string) string {
+	if blob == "" {
+		return "http.client"
+	}
+
+	switch method {
+	case http.MethodGet:
+		return "object.get"
+	case http.MethodHead:
+		return "object.stat"
+	case http.MethodPut:
+		return "object.put"
+	case http.MethodDelete:
+		return "object.remove"
+	default:
+		return "http.client"
+	}
+}
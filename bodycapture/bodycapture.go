@@ -0,0 +1,179 @@
+// Package bodycapture records truncated HTTP request and response bodies as
+// attachments of the events captured after a failed exchange, for the HTTP
+// integrations to share.
+//
+//	roundTripper := httpclient.NewSentryRoundTripper(nil, nil, httpclient.WithBodyCapture(
+//		bodycapture.WithMaxSize(8<<10),
+//		bodycapture.WithContentTypes("application/json", "application/problem+json"),
+//	))
+//
+// Only bodies of allowed content types are recorded, after the rules of
+// package scrub are applied to them. Nothing is recorded while
+// config.WithoutPII is set, as bodies may hold anything.
+package bodycapture
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/getsentry/sentry-go"
+)
+
+// DefaultMaxSize is the number of bytes of a body recorded by default.
+const DefaultMaxSize = 4 << 10
+
+// defaultContentTypes are the media types recorded by default. A "/*" suffix
+// matches any subtype.
+var defaultContentTypes = []string{
+	"application/json",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"text/*",
+}
+
+type Option func(*Capture)
+
+// WithMaxSize records up to size bytes of every body, DefaultMaxSize by
+// default.
+func WithMaxSize(size int) Option {
+	return func(c *Capture) {
+		if size > 0 {
+			c.maxSize = size
+		}
+	}
+}
+
+// WithContentTypes replaces the media types of the bodies that are recorded,
+// e.g. "application/json" or "text/*".
+func WithContentTypes(contentTypes ...string) Option {
+	return func(c *Capture) {
+		c.contentTypes = make([]string, 0, len(contentTypes))
+		for _, contentType := range contentTypes {
+			c.contentTypes = append(c.contentTypes, strings.ToLower(contentType))
+		}
+	}
+}
+
+// Capture holds the size cap and the content type allowlist of recorded
+// bodies.
+type Capture struct {
+	maxSize      int
+	contentTypes []string
+}
+
+func New(opts ...Option) *Capture {
+	c := &Capture{
+		maxSize:      DefaultMaxSize,
+		contentTypes: defaultContentTypes,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Allowed reports whether bodies of contentType, the value of a Content-Type
+// header, are recorded.
+func (c *Capture) Allowed(contentType string) bool {
+	if c == nil || config.Get().OmitPII {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range c.contentTypes {
+		if allowed == mediaType {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Peek reads the first bytes of body, up to the size cap. It returns them
+// along with a body yielding the whole content again, closing body when
+// closed.
+func (c *Capture) Peek(body io.ReadCloser) ([]byte, io.ReadCloser) {
+	if body == nil || body == http.NoBody {
+		return nil, body
+	}
+
+	peeked, _ := io.ReadAll(io.LimitReader(body, int64(c.maxSize)+1))
+
+	return peeked, &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(peeked), body),
+		Closer: body,
+	}
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// Attachment returns an attachment named filename of body, truncated to the
+// size cap and scrubbed.
+func (c *Capture) Attachment(filename, contentType string, body []byte) *sentry.Attachment {
+	truncated := len(body) > c.maxSize
+	if truncated {
+		body = body[:c.maxSize]
+	}
+
+	payload := []byte(scrub.String(string(body)))
+	if truncated {
+		payload = append(payload, "\n[truncated]"...)
+	}
+
+	return &sentry.Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Payload:     payload,
+	}
+}
+
+// Attach adds attachments to the next event captured on hub, so that the
+// error captured after a failed exchange carries them. They are dropped once
+// release is called, e.g. when the response body is closed, so bodies do not
+// pile up on a hub serving many exchanges.
+func Attach(hub *sentry.Hub, attachments ...*sentry.Attachment) (release func()) {
+	if hub == nil || len(attachments) == 0 {
+		return func() {}
+	}
+
+	var mu sync.Mutex
+	pending := attachments
+	hub.Scope().AddEventProcessor(func(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, attachment := range pending {
+			if attachment != nil {
+				event.Attachments = append(event.Attachments, attachment)
+			}
+		}
+		pending = nil
+
+		return event
+	})
+
+	return func() {
+		mu.Lock()
+		pending = nil
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,138 @@
+// Package buntracer provides a tracer implementation for uptrace/bun.
+//
+// Spans are only created when the query context already carries a span, so
+// queries executed outside of a transaction never start one on their own.
+//
+//	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:?cache=shared")
+//	if err != nil {
+//		return err
+//	}
+//
+//	db := bun.NewDB(sqldb, sqlitedialect.New())
+//	db.AddQueryHook(buntracer.NewSentryQueryHook())
+package buntracer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/schema"
+)
+
+type spanContextKey struct{}
+
+var integration = config.Integration{Origin: "auto.db.bun"}
+
+// SetEnabled turns the spans of bun queries on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryBunTracerOption func(*QueryHook)
+
+func WithTags(tags map[string]string) SentryBunTracerOption {
+	return func(t *QueryHook) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryBunTracerOption {
+	return func(t *QueryHook) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of queries for which sampler returns false,
+// given the operation and the query.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryBunTracerOption {
+	return func(t *QueryHook) {
+		t.spanSampler = sampler
+	}
+}
+
+func NewSentryQueryHook(opts ...SentryBunTracerOption) bun.QueryHook {
+	h := &QueryHook{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+type QueryHook struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// BeforeQuery implements bun.QueryHook.
+func (h *QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if sentry.SpanFromContext(ctx) == nil {
+		return ctx
+	}
+
+	span := integration.StartSampledSpan(ctx, h.spanSampler, "db.sql.query", event.Query)
+	if span == nil {
+		return ctx
+	}
+
+	return context.WithValue(span.Context(), spanContextKey{}, span)
+}
+
+// AfterQuery implements bun.QueryHook.
+func (h *QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span, ok := ctx.Value(spanContextKey{}).(*sentry.Span)
+	if !ok || span == nil {
+		return
+	}
+
+	for k, v := range h.tags {
+		span.SetTag(k, v)
+	}
+
+	span.SetData(semconv.DBOperation.Key(), event.Operation())
+	if event.DB != nil {
+		span.SetData("db.system", dbSystem(event.DB.Dialect().Name().String()))
+	}
+	if event.IQuery != nil {
+		if tableName := event.IQuery.GetTableName(); tableName != "" {
+			span.SetData("db.sql.table", tableName)
+		}
+	}
+	if model, ok := event.Model.(interface{ Table() *schema.Table }); ok && model.Table() != nil {
+		span.SetData("bun.model", model.Table().TypeName)
+	}
+	if event.Result != nil {
+		if rowsAffected, err := event.Result.RowsAffected(); err == nil {
+			span.SetData("db.rows_affected", strconv.FormatInt(rowsAffected, 10))
+		}
+	}
+
+	if event.Err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", event.Err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// dbSystem maps bun dialect names to the db.system values Sentry expects.
+func dbSystem(name string) string {
+	switch name {
+	case "pg":
+		return "postgresql"
+	default:
+		return name
+	}
+}
@@ -0,0 +1,229 @@
+// Package cachetracer provides a tracer implementation for any cache backend
+// implementing Cache, such as homegrown caches without an integration of
+// their own.
+//
+// Spans follow Sentry's cache module conventions, "cache.get", "cache.put" and
+// "cache.remove", so the cache shows up in the Caches insights.
+//
+//	var store cachetracer.Cache[string, []byte] = &myCache{}
+//	store = cachetracer.NewSentryCache("mycache", store)
+//
+//	value, found, err := store.Get(ctx, "user:42")
+//
+// Lookups are also counted in the "cache.lookup" metric, tagged with whether
+// they hit.
+package cachetracer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/metrics"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.cache"}
+
+// SetEnabled turns the spans of cache operations on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+// Cache is a cache backend. A missing key is not an error, Get reports it by
+// returning false.
+type Cache[K comparable, V any] interface {
+	Get(ctx context.Context, key K) (V, bool, error)
+	Set(ctx context.Context, key K, value V) error
+	Delete(ctx context.Context, key K) error
+}
+
+// Sizer is implemented by caches able to tell the size of their values in
+// bytes, recorded as "cache.item_size". The size of []byte and string values
+// is known without it.
+type Sizer[V any] interface {
+	Size(value V) int
+}
+
+type SentryCacheTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryCacheTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryCacheTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of operations for which sampler returns
+// false, given the operation and the scrubbed key.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryCacheTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every cache key before it is
+// recorded on a span, e.g. to strip user identifiers out of the key.
+func WithKeyScrubber(scrubber func(key string) string) SentryCacheTracerOption {
+	return func(t *tracer) {
+		t.scrubKey = scrubber
+	}
+}
+
+type tracer struct {
+	scrubKey    func(key string) string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// NewSentryCache wraps cache, system being the name of the cache
+// implementation recorded as "db.system" on spans, and "cache.system" on
+// metrics.
+func NewSentryCache[K comparable, V any](system string, cache Cache[K, V], opts ...SentryCacheTracerOption) Cache[K, V] {
+	t := tracer{
+		scrubKey: func(key string) string { return key },
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return &sentryCache[K, V]{
+		cache:  cache,
+		system: system,
+		tracer: t,
+	}
+}
+
+type sentryCache[K comparable, V any] struct {
+	cache  Cache[K, V]
+	system string
+
+	tracer tracer
+}
+
+func (c *sentryCache[K, V]) startSpan(ctx context.Context, operation string, key K) *sentry.Span {
+	description := scrub.String(c.tracer.scrubKey(fmt.Sprint(key)))
+
+	span := integration.StartSampledSpan(ctx, c.tracer.spanSampler, operation, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", c.system)
+	span.SetData("cache.key", description)
+
+	for k, v := range c.tracer.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// size returns the size of value in bytes, reporting false when unknown.
+func (c *sentryCache[K, V]) size(value V) (int, bool) {
+	if sizer, ok := c.cache.(Sizer[V]); ok {
+		return sizer.Size(value), true
+	}
+
+	switch v := any(value).(type) {
+	case []byte:
+		return len(v), true
+	case string:
+		return len(v), true
+	default:
+		return 0, false
+	}
+}
+
+func (c *sentryCache[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	span := c.startSpan(ctx, "cache.get", key)
+	if span == nil {
+		value, found, err := c.cache.Get(ctx, key)
+		c.recordLookup(found, err)
+		return value, found, err
+	}
+	defer span.Finish()
+
+	value, found, err := c.cache.Get(span.Context(), key)
+	c.recordLookup(found, err)
+	if err != nil {
+		finish(span, err)
+		return value, found, err
+	}
+
+	span.SetData("cache.hit", strconv.FormatBool(found))
+	if found {
+		if size, ok := c.size(value); ok {
+			span.SetData("cache.item_size", strconv.Itoa(size))
+		}
+	}
+	span.Status = sentry.SpanStatusOK
+
+	return value, found, nil
+}
+
+func (c *sentryCache[K, V]) Set(ctx context.Context, key K, value V) error {
+	span := c.startSpan(ctx, "cache.put", key)
+	if span == nil {
+		return c.cache.Set(ctx, key, value)
+	}
+	defer span.Finish()
+
+	if size, ok := c.size(value); ok {
+		span.SetData("cache.item_size", strconv.Itoa(size))
+	}
+
+	err := c.cache.Set(span.Context(), key, value)
+	finish(span, err)
+
+	return err
+}
+
+func (c *sentryCache[K, V]) Delete(ctx context.Context, key K) error {
+	span := c.startSpan(ctx, "cache.remove", key)
+	if span == nil {
+		return c.cache.Delete(ctx, key)
+	}
+	defer span.Finish()
+
+	err := c.cache.Delete(span.Context(), key)
+	finish(span, err)
+
+	return err
+}
+
+// recordLookup counts a lookup in the "cache.lookup" counter, tagged with
+// whether it hit. Failed lookups are not counted, so the counter gives the
+// hit ratio of the cache.
+func (c *sentryCache[K, V]) recordLookup(found bool, err error) {
+	if err != nil || !metrics.Enabled() {
+		return
+	}
+
+	metrics.Increment("cache.lookup", 1, metrics.UnitNone, map[string]string{
+		"cache.system": c.system,
+		"cache.hit":    strconv.FormatBool(found),
+	})
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return
+	}
+
+	span.Status = sentry.SpanStatusOK
+}
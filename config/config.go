@@ -0,0 +1,360 @@
+// Package config holds global defaults shared by the integrations, so they are
+// set once at startup rather than repeated as options of every tracer.
+//
+//	config.Set(
+//		config.WithSpanOrigin("auto.sentryintegration"),
+//		config.WithMaxDescriptionLength(1024),
+//		config.WithoutPII(),
+//		config.WithoutRootSpans(),
+//		config.WithBreadcrumbFallback(),
+//		config.WithSemconvVersion(semconv.V1_26),
+//	)
+//
+// Integrations start their spans through their Integration, which records
+// their origin, e.g. "auto.db.redis", and applies the defaults to every span.
+// Without any call to Set, spans are created unconditionally, as
+// sentry.StartSpan does.
+//
+// The common defaults may also be read from environment variables, see
+// FromEnv.
+package config
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+type Option func(*Config)
+
+// WithSpanOrigin records origin as the "sentry.origin" data of every span,
+// instead of the origin of each integration, such as "auto.db.redis".
+func WithSpanOrigin(origin string) Option {
+	return func(c *Config) {
+		c.SpanOrigin = origin
+	}
+}
+
+// WithoutPII omits data that may identify a user from spans, such as URL query
+// strings.
+func WithoutPII() Option {
+	return func(c *Config) {
+		c.OmitPII = true
+	}
+}
+
+// WithMaxDescriptionLength truncates span descriptions, such as SQL queries,
+// to length bytes. A zero length disables truncation.
+func WithMaxDescriptionLength(length int) Option {
+	return func(c *Config) {
+		c.MaxDescriptionLength = length
+	}
+}
+
+// WithSampler sets a predicate deciding whether a span of operation is
+// created, e.g. to leave out "db.redis" spans of health checks.
+func WithSampler(sampler func(ctx context.Context, operation string) bool) Option {
+	return func(c *Config) {
+		c.Sampler = sampler
+	}
+}
+
+// WithCodeLocations records where every span was started from, as the
+// "code.filepath", "code.lineno" and "code.function" data. Walking the stack
+// is costly on hot paths, so it is disabled by default.
+func WithCodeLocations() Option {
+	return func(c *Config) {
+		c.CodeLocations = true
+	}
+}
+
+// WithoutRootSpans only creates spans when the context already carries one,
+// so operations executed outside of a transaction never start one on their
+// own. The transactions of incoming requests and messages, started with
+// StartTransaction, are still created.
+func WithoutRootSpans() Option {
+	return func(c *Config) {
+		c.AllowRootSpans = false
+	}
+}
+
+// WithBreadcrumbFallback records a breadcrumb of the operation and description
+// of spans that are not sent, because the trace is unsampled or because ctx
+// carries no span while root spans are not allowed. Error events keep the
+// context of what happened before them without adding to the span volume.
+func WithBreadcrumbFallback() Option {
+	return func(c *Config) {
+		c.BreadcrumbFallback = true
+	}
+}
+
+// WithSemconvVersion records span data under the keys of version of the
+// OpenTelemetry semantic conventions, e.g. "db.query.text" rather than
+// "db.statement" as of semconv.V1_26.
+func WithSemconvVersion(version semconv.Version) Option {
+	return func(c *Config) {
+		c.SemconvVersion = version
+	}
+}
+
+// WithProfilerLabels labels the goroutines of worker wrappers with the trace
+// and span IDs they run within, see package profiling.
+func WithProfilerLabels() Option {
+	return func(c *Config) {
+		c.ProfilerLabels = true
+	}
+}
+
+// WithoutStatements omits database statements, keeping the operation only,
+// e.g. "SELECT" as the description of a "db.sql.query" span.
+func WithoutStatements() Option {
+	return func(c *Config) {
+		c.OmitStatements = true
+	}
+}
+
+// WithSlowQueryThreshold makes BeforeSendTransaction drop the "db" spans
+// lasting less than threshold, keeping slow queries only. A zero threshold
+// keeps every span.
+func WithSlowQueryThreshold(threshold time.Duration) Option {
+	return func(c *Config) {
+		c.SlowQueryThreshold = threshold
+	}
+}
+
+// WithTracePropagationTargets restricts the injection of the sentry-trace and
+// baggage headers to URLs containing one of targets, for the integrations
+// that are not given targets of their own.
+func WithTracePropagationTargets(targets ...string) Option {
+	return func(c *Config) {
+		c.TracePropagationTargets = targets
+	}
+}
+
+// WithSpanSampleRate keeps spans of the integrations with probability rate,
+// between 0 and 1, on top of their span samplers.
+func WithSpanSampleRate(rate float64) Option {
+	return func(c *Config) {
+		c.SpanSampleRate = rate
+	}
+}
+
+// Config is the set of global defaults. It is read with Get and modified
+// with Set.
+type Config struct {
+	SpanOrigin           string
+	OmitPII              bool
+	MaxDescriptionLength int
+	Sampler              func(ctx context.Context, operation string) bool
+	AllowRootSpans       bool
+	CodeLocations        bool
+	BreadcrumbFallback   bool
+	SemconvVersion       semconv.Version
+	ProfilerLabels       bool
+	DebugLogger          *slog.Logger
+
+	OmitStatements          bool
+	SlowQueryThreshold      time.Duration
+	TracePropagationTargets []string
+	SpanSampleRate          float64
+	NPlusOneThreshold       int
+}
+
+func defaults() Config {
+	return Config{
+		AllowRootSpans: true,
+		SemconvVersion: semconv.Default,
+		SpanSampleRate: 1,
+	}
+}
+
+var current atomic.Pointer[Config]
+
+// Get returns the current global defaults.
+func Get() Config {
+	if c := current.Load(); c != nil {
+		return *c
+	}
+
+	return defaults()
+}
+
+// Set applies opts on top of the current global defaults. It is meant to be
+// called once at startup, before any integration is used.
+func Set(opts ...Option) {
+	c := Get()
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	current.Store(&c)
+	semconv.Use(c.SemconvVersion)
+	debugLogger.Store(c.DebugLogger)
+}
+
+// Reset restores the global defaults to their initial values.
+func Reset() {
+	current.Store(nil)
+	semconv.Use(semconv.Default)
+	debugLogger.Store(nil)
+}
+
+// Truncate shortens description to the maximum description length, without
+// splitting a multi-byte character.
+func (c Config) Truncate(description string) string {
+	if c.MaxDescriptionLength <= 0 || len(description) <= c.MaxDescriptionLength {
+		return description
+	}
+
+	end := c.MaxDescriptionLength
+	for end > 0 && !utf8.RuneStart(description[end]) {
+		end--
+	}
+
+	return description[:end]
+}
+
+// Statement returns description, or only its first word when statements are
+// omitted and operation is a database one, e.g. "db.sql.query".
+func (c Config) Statement(operation, description string) string {
+	if !c.OmitStatements || !isDatabase(operation) {
+		return description
+	}
+
+	if fields := strings.Fields(description); len(fields) > 0 {
+		return fields[0]
+	}
+
+	return description
+}
+
+func isDatabase(operation string) bool {
+	return operation == "db" || strings.HasPrefix(operation, "db.")
+}
+
+// ShouldPropagate reports whether the trace context is injected into requests
+// to url, given the targets of an integration, or else the global ones. An
+// empty list of targets propagates to every URL.
+func ShouldPropagate(targets []string, url string) bool {
+	if len(targets) == 0 {
+		targets = Get().TracePropagationTargets
+	}
+	if len(targets) == 0 {
+		return true
+	}
+
+	for _, target := range targets {
+		if strings.Contains(url, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StartSpan starts a span of operation described by description, applying
+// the global defaults and the rules of package scrub to description. It
+// returns nil when the span is not to be created, because integrations are
+// disabled, because of the sampler or because ctx carries no span while root
+// spans are not allowed.
+func StartSpan(ctx context.Context, operation, description string, opts ...sentry.SpanOption) *sentry.Span {
+	return startSpan(ctx, "", nil, false, operation, description, opts...)
+}
+
+// StartTransaction is StartSampledSpan for the transaction of an incoming
+// request or message, e.g. a "http.server" or "queue.process" span. It is
+// created even when root spans are not allowed, as it is the parent the spans
+// of the other integrations need.
+func StartTransaction(ctx context.Context, sampler func(operation, description string) bool, operation, name string, opts ...sentry.SpanOption) *sentry.Span {
+	return startSpan(ctx, "", sampler, true, operation, name, opts...)
+}
+
+// startSpan is the single path every span of the integrations is started
+// through, recording origin unless overridden by WithSpanOrigin. sampler is
+// the span sampler of the integration, run after the one of WithSampler, and
+// transaction exempts the span from WithoutRootSpans.
+func startSpan(ctx context.Context, origin string, sampler func(operation, description string) bool, transaction bool, operation, description string, opts ...sentry.SpanOption) *sentry.Span {
+	if !Enabled() {
+		logDropped(origin, operation, description, reasonDisabled)
+		return nil
+	}
+
+	c := Get()
+
+	parent := sentry.SpanFromContext(ctx)
+	if !c.AllowRootSpans && parent == nil && !transaction {
+		if c.BreadcrumbFallback {
+			addBreadcrumb(ctx, operation, c.Truncate(scrub.String(description)))
+		}
+		logDropped(origin, operation, description, reasonNoParent)
+		return nil
+	}
+
+	if c.Sampler != nil && !c.Sampler(ctx, operation) {
+		logDropped(origin, operation, description, reasonConfigSampler)
+		return nil
+	}
+
+	if !keep(c, origin, sampler, operation, description) {
+		return nil
+	}
+
+	description = c.Truncate(scrub.String(c.Statement(operation, description)))
+
+	var span *sentry.Span
+	if parent == nil {
+		span = sentry.StartSpan(ctx, operation, append([]sentry.SpanOption{sentry.WithTransactionName(description), sentry.WithDescription(description)}, opts...)...)
+	} else {
+		// Child spans have no name to sample on, setting the description
+		// afterwards spares the allocation of the options on hot paths.
+		span = sentry.StartSpan(ctx, operation, opts...)
+		if span != nil && span.Description == "" {
+			span.Description = description
+		}
+	}
+	if span == nil {
+		return nil
+	}
+	if transaction {
+		setRouteSampleRate(span)
+	}
+
+	if c.BreadcrumbFallback && !span.Sampled.Bool() {
+		addBreadcrumb(ctx, operation, description)
+	}
+
+	setOrigin(span, c.SpanOrigin, origin)
+
+	if c.CodeLocations {
+		setCodeLocation(span)
+	}
+
+	span = runBeforeSpan(ctx, origin, parent, span)
+	logCreated(origin, span)
+
+	return span
+}
+
+// addBreadcrumb records a compact breadcrumb in place of a span that is not
+// sent. Unsampled spans are still created, as they propagate the sampling
+// decision to downstream services.
+func addBreadcrumb(ctx context.Context, operation, description string) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Category: operation,
+		Message:  description,
+		Level:    sentry.LevelInfo,
+	}, nil)
+}
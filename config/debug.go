@@ -0,0 +1,74 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// WithDebugLogger logs every span the integrations create or drop at the
+// debug level of logger, along with why a span was dropped, e.g. to find out
+// why nothing shows up in Sentry. It is not meant for production use.
+func WithDebugLogger(logger *slog.Logger) Option {
+	return func(c *Config) {
+		c.DebugLogger = logger
+	}
+}
+
+// WithDebugWriter is WithDebugLogger, logging text lines to w.
+func WithDebugWriter(w io.Writer) Option {
+	return WithDebugLogger(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})))
+}
+
+// Reasons for a span not to be created, or not to be sent.
+const (
+	reasonDisabled            = "integrations disabled"
+	reasonIntegrationDisabled = "integration disabled"
+	reasonSampler             = "dropped by the span sampler of the integration"
+	reasonConfigSampler       = "dropped by the sampler of config.WithSampler"
+	reasonSampleRate          = "dropped by the rate of config.WithSpanSampleRate"
+	reasonNoParent            = "no parent span while root spans are not allowed"
+	reasonBeforeSpan          = "dropped by a BeforeSpan hook"
+	reasonUnsampled           = "unsampled, the span is created but not sent"
+)
+
+// debugLogger is the logger of the current defaults, kept aside so hot paths
+// do not have to copy them.
+var debugLogger atomic.Pointer[slog.Logger]
+
+func logDropped(origin, operation, description, reason string) {
+	logger := debugLogger.Load()
+	if logger == nil {
+		return
+	}
+
+	logger.Debug("sentry-integration: span dropped",
+		"origin", origin,
+		"operation", operation,
+		"description", description,
+		"reason", reason,
+	)
+}
+
+func logCreated(origin string, span *sentry.Span) {
+	logger := debugLogger.Load()
+	if logger == nil || span == nil {
+		return
+	}
+
+	if !span.Sampled.Bool() {
+		logDropped(origin, span.Op, span.Description, reasonUnsampled)
+		return
+	}
+
+	logger.Debug("sentry-integration: span created",
+		"origin", origin,
+		"operation", span.Op,
+		"description", span.Description,
+		"transaction", span.IsTransaction(),
+		"trace_id", span.TraceID.String(),
+		"span_id", span.SpanID.String(),
+	)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldy505/sentry-integration/semconv"
+)
+
+// FromEnv returns the options set by environment variables, so that
+// instrumentation is tuned per deployment without code changes. Options of
+// the environment take precedence when applied last:
+//
+//	envOpts, err := config.FromEnv()
+//	if err != nil {
+//		return err
+//	}
+//	config.Set(append([]config.Option{config.WithoutRootSpans()}, envOpts...)...)
+//
+// The variables are:
+//
+//	SENTRY_INTEGRATION_STATEMENTS                 false omits database statements, see WithoutStatements
+//	SENTRY_INTEGRATION_SLOW_QUERY_THRESHOLD       a duration, e.g. "100ms", see WithSlowQueryThreshold
+//	SENTRY_INTEGRATION_TRACE_PROPAGATION_TARGETS  comma-separated targets, see WithTracePropagationTargets
+//	SENTRY_INTEGRATION_SPAN_SAMPLE_RATE           a rate between 0 and 1, see WithSpanSampleRate
+//	SENTRY_INTEGRATION_PII                        false omits personal data, see WithoutPII
+//	SENTRY_INTEGRATION_MAX_DESCRIPTION_LENGTH     a length in bytes, see WithMaxDescriptionLength
+//	SENTRY_INTEGRATION_ROOT_SPANS                 false disallows root spans, see WithoutRootSpans
+//	SENTRY_INTEGRATION_CODE_LOCATIONS             true records code locations, see WithCodeLocations
+//	SENTRY_INTEGRATION_SEMCONV_VERSION            e.g. "1.26.0", see WithSemconvVersion
+//	SENTRY_INTEGRATION_N_PLUS_ONE_THRESHOLD       a number of repeats, see WithNPlusOneThreshold
+//
+// Unset and empty variables are ignored. Invalid values are reported in the
+// returned error, and left out of the options.
+func FromEnv() ([]Option, error) {
+	var opts []Option
+	var errs []error
+
+	lookupBool := func(name string, apply func(c *Config, value bool)) {
+		raw, ok := lookupEnv(name)
+		if !ok {
+			return
+		}
+
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+
+		opts = append(opts, func(c *Config) {
+			apply(c, value)
+		})
+	}
+
+	lookupBool("SENTRY_INTEGRATION_STATEMENTS", func(c *Config, value bool) {
+		c.OmitStatements = !value
+	})
+	lookupBool("SENTRY_INTEGRATION_PII", func(c *Config, value bool) {
+		c.OmitPII = !value
+	})
+	lookupBool("SENTRY_INTEGRATION_ROOT_SPANS", func(c *Config, value bool) {
+		c.AllowRootSpans = value
+	})
+	lookupBool("SENTRY_INTEGRATION_CODE_LOCATIONS", func(c *Config, value bool) {
+		c.CodeLocations = value
+	})
+
+	if raw, ok := lookupEnv("SENTRY_INTEGRATION_SLOW_QUERY_THRESHOLD"); ok {
+		threshold, err := time.ParseDuration(raw)
+		if err == nil && threshold < 0 {
+			err = errors.New("negative duration")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SENTRY_INTEGRATION_SLOW_QUERY_THRESHOLD: %w", err))
+		} else {
+			opts = append(opts, WithSlowQueryThreshold(threshold))
+		}
+	}
+
+	if raw, ok := lookupEnv("SENTRY_INTEGRATION_TRACE_PROPAGATION_TARGETS"); ok {
+		var targets []string
+		for _, target := range strings.Split(raw, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				targets = append(targets, target)
+			}
+		}
+		opts = append(opts, WithTracePropagationTargets(targets...))
+	}
+
+	if raw, ok := lookupEnv("SENTRY_INTEGRATION_SPAN_SAMPLE_RATE"); ok {
+		rate, err := strconv.ParseFloat(raw, 64)
+		if err == nil && (rate < 0 || rate > 1) {
+			err = errors.New("not between 0 and 1")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SENTRY_INTEGRATION_SPAN_SAMPLE_RATE: %w", err))
+		} else {
+			opts = append(opts, WithSpanSampleRate(rate))
+		}
+	}
+
+	if raw, ok := lookupEnv("SENTRY_INTEGRATION_MAX_DESCRIPTION_LENGTH"); ok {
+		length, err := strconv.Atoi(raw)
+		if err == nil && length < 0 {
+			err = errors.New("negative length")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SENTRY_INTEGRATION_MAX_DESCRIPTION_LENGTH: %w", err))
+		} else {
+			opts = append(opts, WithMaxDescriptionLength(length))
+		}
+	}
+
+	if raw, ok := lookupEnv("SENTRY_INTEGRATION_N_PLUS_ONE_THRESHOLD"); ok {
+		threshold, err := strconv.Atoi(raw)
+		if err == nil && threshold < 0 {
+			err = errors.New("negative threshold")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SENTRY_INTEGRATION_N_PLUS_ONE_THRESHOLD: %w", err))
+		} else {
+			opts = append(opts, WithNPlusOneThreshold(threshold))
+		}
+	}
+
+	if raw, ok := lookupEnv("SENTRY_INTEGRATION_SEMCONV_VERSION"); ok {
+		version := semconv.Version(raw)
+		if !semconv.Supported(version) {
+			errs = append(errs, fmt.Errorf("SENTRY_INTEGRATION_SEMCONV_VERSION: unsupported version %q", raw))
+		} else {
+			opts = append(opts, WithSemconvVersion(version))
+		}
+	}
+
+	return opts, errors.Join(errs...)
+}
+
+// lookupEnv returns the trimmed value of the environment variable name,
+// reporting false when it is unset or empty.
+func lookupEnv(name string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(name))
+	return value, value != ""
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// BeforeSpan is run on every span an integration starts, right after it is
+// started and before the integration sets its own data, e.g. to add tags
+// shared by the whole organization. Hooks therefore see the operation, the
+// description, the origin and what the span options set, but not data such as
+// "db.system" or the tags of the integration. Returning nil drops the span: it
+// is never finished, hence never sent, and the integration runs the operation
+// untraced. The trace context of the scope is then restored to the parent of
+// the span, though the span still counts toward the maximum number of spans
+// of its transaction.
+type BeforeSpan func(span *sentry.Span) *sentry.Span
+
+var (
+	beforeSpanMu sync.Mutex
+	beforeSpan   atomic.Pointer[[]BeforeSpan]
+)
+
+// RegisterBeforeSpan adds hooks run on every span, in the order they are
+// registered. It is meant to be called at startup, along with Set.
+func RegisterBeforeSpan(hooks ...BeforeSpan) {
+	beforeSpanMu.Lock()
+	defer beforeSpanMu.Unlock()
+
+	var registered []BeforeSpan
+	if current := beforeSpan.Load(); current != nil {
+		registered = append(registered, *current...)
+	}
+	registered = append(registered, hooks...)
+
+	beforeSpan.Store(&registered)
+}
+
+// ResetBeforeSpan removes every registered hook.
+func ResetBeforeSpan() {
+	beforeSpanMu.Lock()
+	defer beforeSpanMu.Unlock()
+
+	beforeSpan.Store(nil)
+}
+
+// runBeforeSpan runs the registered hooks on span, returning nil when one of
+// them drops it. ctx and parent are the ones span was started with.
+func runBeforeSpan(ctx context.Context, origin string, parent, span *sentry.Span) *sentry.Span {
+	hooks := beforeSpan.Load()
+	if hooks == nil || span == nil {
+		return span
+	}
+
+	operation, description := span.Op, span.Description
+	for _, hook := range *hooks {
+		if span = hook(span); span == nil {
+			restoreTraceContext(ctx, parent)
+			logDropped(origin, operation, description, reasonBeforeSpan)
+			return nil
+		}
+	}
+
+	return span
+}
+
+// restoreTraceContext sets the trace context of the scope of ctx, which
+// starting a span replaces, back to the one of parent, or removes it when
+// there is no parent.
+func restoreTraceContext(ctx context.Context, parent *sentry.Span) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	if parent == nil {
+		hub.Scope().RemoveContext("trace")
+		return
+	}
+
+	hub.Scope().SetContext("trace", sentry.TraceContext{
+		TraceID:      parent.TraceID,
+		SpanID:       parent.SpanID,
+		ParentSpanID: parent.ParentSpanID,
+		Op:           parent.Op,
+		Description:  parent.Description,
+		Status:       parent.Status,
+	}.Map())
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/getsentry/sentry-go"
+)
+
+var disabled atomic.Bool
+
+// SetEnabled turns the spans of every integration on or off at runtime, e.g.
+// to shed tracing overhead during an incident without restarting. Operations
+// keep running untraced while disabled.
+func SetEnabled(enabled bool) {
+	disabled.Store(!enabled)
+}
+
+// Enabled reports whether integrations create spans.
+func Enabled() bool {
+	return !disabled.Load()
+}
+
+// Integration is what an integration package shares across its tracers: the
+// origin of its spans, and whether it is turned on. Every package declares
+// one, and starts its spans through it.
+//
+//	var integration = config.Integration{Origin: "auto.db.redis"}
+type Integration struct {
+	// Origin is recorded as the "sentry.origin" data of every span of the
+	// integration, unless WithSpanOrigin overrides it.
+	Origin string
+
+	disabled atomic.Bool
+}
+
+// SetEnabled turns the spans of the integration on or off. The zero value is
+// on, and an Integration is off whenever SetEnabled(false) is in effect.
+func (i *Integration) SetEnabled(enabled bool) {
+	i.disabled.Store(!enabled)
+}
+
+// Enabled reports whether the integration creates spans.
+func (i *Integration) Enabled() bool {
+	return !i.disabled.Load() && Enabled()
+}
+
+// Sample is the package level Sample, also dropping every span while the
+// integration is off.
+func (i *Integration) Sample(sampler func(operation, description string) bool, operation, description string) bool {
+	if i.disabled.Load() {
+		logDropped(i.Origin, operation, description, reasonIntegrationDisabled)
+		return false
+	}
+
+	return sample(i.Origin, sampler, operation, description)
+}
+
+// StartSpan is the package level StartSpan, recording the origin of the
+// integration. It returns nil while the integration is off.
+func (i *Integration) StartSpan(ctx context.Context, operation, description string, opts ...sentry.SpanOption) *sentry.Span {
+	if i.disabled.Load() {
+		logDropped(i.Origin, operation, description, reasonIntegrationDisabled)
+		return nil
+	}
+
+	return startSpan(ctx, i.Origin, nil, false, operation, description, opts...)
+}
+
+// StartSampledSpan is the package level StartSampledSpan, recording the
+// origin of the integration. It returns nil while the integration is off.
+func (i *Integration) StartSampledSpan(ctx context.Context, sampler func(operation, description string) bool, operation, description string, opts ...sentry.SpanOption) *sentry.Span {
+	if i.disabled.Load() {
+		logDropped(i.Origin, operation, description, reasonIntegrationDisabled)
+		return nil
+	}
+
+	return startSpan(ctx, i.Origin, sampler, false, operation, description, opts...)
+}
+
+// StartTransaction is the package level StartTransaction, recording the
+// origin of the integration. It returns nil while the integration is off.
+func (i *Integration) StartTransaction(ctx context.Context, sampler func(operation, description string) bool, operation, name string, opts ...sentry.SpanOption) *sentry.Span {
+	if i.disabled.Load() {
+		logDropped(i.Origin, operation, name, reasonIntegrationDisabled)
+		return nil
+	}
+
+	return startSpan(ctx, i.Origin, sampler, true, operation, name, opts...)
+}
+
+// SetOrigin records the origin of the integration on a span it did not start
+// through StartSpan or StartSampledSpan.
+func (i *Integration) SetOrigin(span *sentry.Span) {
+	if span == nil {
+		return
+	}
+
+	setOrigin(span, Get().SpanOrigin, i.Origin)
+}
+
+// setOrigin records override as the origin of span when set, or origin.
+func setOrigin(span *sentry.Span, override, origin string) {
+	if override != "" {
+		origin = override
+	}
+
+	if origin != "" {
+		span.SetData("sentry.origin", origin)
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// WithNPlusOneThreshold makes BeforeSendTransaction flag the spans running the
+// same SQL query, literals aside, at least threshold times in a row among the
+// queries of a parent, as ORMs do when loading the relations of every row one
+// by one. The parent span gets the "db.n_plus_one" data set to true, along
+// with the "db.n_plus_one.count" of repeats and the "db.n_plus_one.query", and
+// the transaction is tagged "db.n_plus_one". A zero threshold disables the
+// detection, and so does WithoutStatements, as queries can no longer be told
+// apart.
+func WithNPlusOneThreshold(threshold int) Option {
+	return func(c *Config) {
+		c.NPlusOneThreshold = threshold
+	}
+}
+
+// nPlusOneKey groups the queries of the same parent.
+type nPlusOneKey struct {
+	parent    sentry.SpanID
+	operation string
+	query     string
+}
+
+// nPlusOneRun is the query last run by a parent, and how many times in a row.
+type nPlusOneRun struct {
+	key   nPlusOneKey
+	count int
+}
+
+// detectNPlusOne flags the parents of repeated queries of event. Spans are
+// recorded in the order they are started, so consecutive spans of a parent
+// ran one after the other.
+func detectNPlusOne(event *sentry.Event, threshold int) {
+	counts := make(map[nPlusOneKey]int)
+	runs := make(map[sentry.SpanID]nPlusOneRun)
+	parents := make(map[sentry.SpanID]*sentry.Span, len(event.Spans))
+
+	for _, span := range event.Spans {
+		parents[span.SpanID] = span
+
+		if !isQuery(span.Op) || span.Description == "" {
+			continue
+		}
+
+		key := nPlusOneKey{
+			parent:    span.ParentSpanID,
+			operation: span.Op,
+			query:     normalizeQuery(span.Description),
+		}
+
+		run := runs[span.ParentSpanID]
+		if run.key != key {
+			run = nPlusOneRun{key: key}
+		}
+		run.count++
+		runs[span.ParentSpanID] = run
+
+		if run.count > counts[key] {
+			counts[key] = run.count
+		}
+	}
+
+	for key, count := range counts {
+		if count < threshold {
+			continue
+		}
+
+		if event.Tags == nil {
+			event.Tags = make(map[string]string)
+		}
+		event.Tags["db.n_plus_one"] = "true"
+
+		// Queries of the transaction itself have no parent among the spans.
+		parent, ok := parents[key.parent]
+		if !ok {
+			continue
+		}
+
+		// Keep the most repeated query of parents having several.
+		if previous, ok := parent.Data["db.n_plus_one.count"].(string); ok {
+			if n, err := strconv.Atoi(previous); err == nil && n >= count {
+				continue
+			}
+		}
+		parent.SetData("db.n_plus_one", "true")
+		parent.SetData("db.n_plus_one.count", strconv.Itoa(count))
+		parent.SetData("db.n_plus_one.query", key.query)
+	}
+}
+
+// isQuery reports whether operation is the one of a SQL query, e.g.
+// "db.sql.query". Other database spans are left out, as their descriptions,
+// such as bare Redis commands, are the same whatever their arguments.
+func isQuery(operation string) bool {
+	return operation == "db.sql" || strings.HasPrefix(operation, "db.sql.")
+}
+
+// normalizeQuery replaces the literals of query, numbers and quoted strings,
+// with "?", and collapses its whitespace, so that queries differing only by
+// their arguments are the same.
+func normalizeQuery(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	var last byte
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch {
+		case c == '\'':
+			// Skip to the closing quote, doubled quotes being escaped ones.
+			for i++; i < len(query); i++ {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			c = '?'
+		case c >= '0' && c <= '9' && !isIdentifierEnd(last):
+			for i+1 < len(query) && (query[i+1] >= '0' && query[i+1] <= '9' || query[i+1] == '.') {
+				i++
+			}
+			c = '?'
+		case unicode.IsSpace(rune(c)):
+			space = b.Len() > 0
+			continue
+		}
+
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(c)
+		last = c
+	}
+
+	return b.String()
+}
+
+// isIdentifierEnd reports whether c, the last character written, is part of
+// an identifier or a placeholder, e.g. "table1" or "$1", whose digits are not
+// literals.
+func isIdentifierEnd(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c == ':' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,66 @@
+package config
+
+// Options are the options shared by the redistracer, rueidistracer, pgxtracer
+// and httpclient integrations. Each of them exposes them as WithTags, WithTag,
+// WithAttributes, WithSpanOperation and WithSpanSampler of its own option type,
+// with the same semantics:
+//
+//   - WithTags and WithTag add tags to every span.
+//   - WithAttributes adds data to every span, overriding the data the
+//     integration sets itself.
+//   - WithSpanOperation replaces the default operation of the spans, e.g.
+//     "db.redis".
+//   - WithSpanSampler drops the spans for which the sampler returns false,
+//     given their operation and description, as it does in every other
+//     integration.
+type Options struct {
+	Tags       map[string]string
+	Attributes map[string]interface{}
+	Operation  string
+	Sampler    func(operation, description string) bool
+}
+
+// NewOptions returns the options of an integration which spans are of
+// operation by default.
+func NewOptions(operation string) Options {
+	return Options{
+		Tags:       make(map[string]string),
+		Attributes: make(map[string]interface{}),
+		Operation:  operation,
+	}
+}
+
+// SetTags adds tags, overriding tags of the same keys.
+func (o *Options) SetTags(tags map[string]string) {
+	for k, v := range tags {
+		o.Tags[k] = v
+	}
+}
+
+// SetAttributes adds attributes, overriding attributes of the same keys.
+func (o *Options) SetAttributes(attributes map[string]interface{}) {
+	for k, v := range attributes {
+		o.Attributes[k] = v
+	}
+}
+
+// SetOperation replaces the operation of the spans, unless operation is empty.
+func (o *Options) SetOperation(operation string) {
+	if operation != "" {
+		o.Operation = operation
+	}
+}
+
+// SpanData merges data, the attributes and the tags. Attributes take
+// precedence over data of the same keys.
+func (o *Options) SpanData(data map[string]interface{}) *SpanData {
+	merged := make(map[string]interface{}, len(data)+len(o.Attributes))
+	for k, v := range data {
+		merged[k] = v
+	}
+	for k, v := range o.Attributes {
+		merged[k] = v
+	}
+
+	return NewSpanData(merged, o.Tags)
+}
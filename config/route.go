@@ -0,0 +1,84 @@
+package config
+
+import (
+	"math/rand"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Header is the header, or metadata, of an incoming request. http.Header and
+// the carriers of package propagation are headers as is.
+type Header interface {
+	Get(key string) string
+}
+
+// RouteSampler returns the sample rate, between 0 and 1, of the transaction
+// of a request to route with method, e.g. 0 for "/health" and 1 for
+// "/checkout". Server middlewares take it through their WithRouteSampler
+// option, passing the method only for HTTP requests.
+type RouteSampler func(route, method string, header Header) float64
+
+// SampleRoute returns a span option sampling the transaction of a request at
+// the rate sampler returns, instead of the TracesSampleRate or TracesSampler
+// of the client. Transactions continuing a trace which upstream already made
+// the sampling decision of keep that decision, so the option goes after the
+// one continuing the trace, and so do spans with a parent. A nil sampler
+// leaves the decision to the client. The rate is the sample rate of the
+// dynamic sampling context the transaction propagates.
+func SampleRoute(sampler RouteSampler, route, method string, header Header) sentry.SpanOption {
+	return func(span *sentry.Span) {
+		if sampler == nil || !span.IsTransaction() || span.Sampled != sentry.SampledUndefined {
+			return
+		}
+
+		rate := sampler(route, method, header)
+		switch {
+		case rate <= 0:
+			span.Sampled = sentry.SampledFalse
+		case rate >= 1:
+			span.Sampled = sentry.SampledTrue
+		case rand.Float64() < rate:
+			span.Sampled = sentry.SampledTrue
+		default:
+			span.Sampled = sentry.SampledFalse
+		}
+
+		// The client overwrites the sample rate of spans with an explicit
+		// decision, startSpan sets it back once the span is started.
+		if span.Data == nil {
+			span.Data = make(map[string]interface{})
+		}
+		span.Data[routeSampleRateKey] = rate
+	}
+}
+
+// routeSampleRateKey holds the rate SampleRoute sampled a transaction at, until
+// startSpan records it in its dynamic sampling context.
+const routeSampleRateKey = "sentry.route_sample_rate"
+
+// setRouteSampleRate freezes the dynamic sampling context of span with the
+// rate of SampleRoute, if it sampled span.
+func setRouteSampleRate(span *sentry.Span) {
+	rate, ok := span.Data[routeSampleRateKey].(float64)
+	if !ok {
+		return
+	}
+	delete(span.Data, routeSampleRateKey)
+
+	dsc := sentry.DynamicSamplingContextFromTransaction(span)
+	if !dsc.HasEntries() {
+		return
+	}
+
+	switch {
+	case rate <= 0:
+		delete(dsc.Entries, "sample_rate")
+	case rate >= 1:
+		dsc.Entries["sample_rate"] = "1"
+	default:
+		dsc.Entries["sample_rate"] = strconv.FormatFloat(rate, 'f', -1, 64)
+	}
+	dsc.Frozen = true
+	span.SetDynamicSamplingContext(dsc)
+}
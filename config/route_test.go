@@ -0,0 +1,40 @@
+package config_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/sentryintegrationtest"
+)
+
+func TestSampleRouteSampleRate(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want string
+	}{
+		{0.25, "sentry-sample_rate=0.25"},
+		{1, "sentry-sample_rate=1"},
+	}
+
+	for _, tt := range tests {
+		recorder := sentryintegrationtest.NewRecorder(t)
+
+		sampler := func(route, method string, header config.Header) float64 { return tt.rate }
+		span := integration.StartTransaction(recorder.Context(context.Background()), nil, "http.server", "GET /checkout",
+			config.SampleRoute(sampler, "/checkout", http.MethodGet, http.Header{}))
+		if span == nil {
+			t.Fatal("StartTransaction() = nil, want a transaction")
+		}
+
+		if baggage := span.ToBaggage(); !strings.Contains(baggage, tt.want) {
+			t.Errorf("baggage = %q, want %q", baggage, tt.want)
+		}
+		if _, ok := span.Data["sentry.route_sample_rate"]; ok {
+			t.Errorf("span data = %v, want the route rate removed", span.Data)
+		}
+		span.Finish()
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// SpanData is the data and tags an integration sets on every span, merged once
+// when the integration is created. Values are boxed once rather than on every
+// span.
+type SpanData struct {
+	data map[string]interface{}
+	tags map[string]string
+}
+
+// NewSpanData merges data and tags. Both maps are copied, and may be nil.
+func NewSpanData(data map[string]interface{}, tags map[string]string) *SpanData {
+	d := &SpanData{
+		data: make(map[string]interface{}, len(data)),
+		tags: make(map[string]string, len(tags)),
+	}
+
+	for k, v := range data {
+		d.data[k] = v
+	}
+
+	for k, v := range tags {
+		d.tags[k] = v
+	}
+
+	return d
+}
+
+// Apply sets the data and tags on span.
+func (d *SpanData) Apply(span *sentry.Span) {
+	if d == nil || span == nil {
+		return
+	}
+
+	if span.Data == nil {
+		span.Data = make(map[string]interface{}, len(d.data))
+	}
+	for k, v := range d.data {
+		span.Data[k] = v
+	}
+
+	if len(d.tags) == 0 {
+		return
+	}
+
+	if span.Tags == nil {
+		span.Tags = make(map[string]string, len(d.tags))
+	}
+	for k, v := range d.tags {
+		span.Tags[k] = v
+	}
+}
+
+const modulePath = "github.com/aldy505/sentry-integration/"
+
+// setCodeLocation records the first caller outside of this module and of the
+// libraries it instruments, approximated as anything under GOROOT or the
+// module cache.
+func setCodeLocation(span *sentry.Span) {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	goroot := runtime.GOROOT()
+	for {
+		frame, more := frames.Next()
+
+		internal := strings.HasPrefix(frame.Function, modulePath) ||
+			strings.Contains(frame.File, "/pkg/mod/") ||
+			(goroot != "" && strings.HasPrefix(frame.File, goroot))
+		if !internal && frame.File != "" {
+			span.SetData("code.filepath", frame.File)
+			span.SetData("code.lineno", strconv.Itoa(frame.Line))
+			span.SetData("code.function", frame.Function)
+			return
+		}
+
+		if !more {
+			return
+		}
+	}
+}
+
+// Sample reports whether sampler keeps a span of operation described by
+// description. A nil sampler keeps every span, and no span is kept while
+// integrations are disabled. Integrations take sampler through their
+// WithSpanSampler option. StartSampledSpan already samples the spans it
+// starts, Sample is for what integrations record other than spans.
+func Sample(sampler func(operation, description string) bool, operation, description string) bool {
+	return sample("", sampler, operation, description)
+}
+
+func sample(origin string, sampler func(operation, description string) bool, operation, description string) bool {
+	if !Enabled() {
+		logDropped(origin, operation, description, reasonDisabled)
+		return false
+	}
+
+	return keep(Get(), origin, sampler, operation, description)
+}
+
+// keep reports whether sampler, then the rate of WithSpanSampleRate, keep a
+// span of operation.
+func keep(c Config, origin string, sampler func(operation, description string) bool, operation, description string) bool {
+	if sampler != nil && !sampler(operation, description) {
+		logDropped(origin, operation, description, reasonSampler)
+		return false
+	}
+
+	if c.SpanSampleRate < 1 && rand.Float64() >= c.SpanSampleRate {
+		logDropped(origin, operation, description, reasonSampleRate)
+		return false
+	}
+
+	return true
+}
+
+// StartSampledSpan is StartSpan, also dropping the spans sampler drops. It
+// returns nil for them, which integrations handle as they would any nil span,
+// by running the operation untraced. Integrations take sampler through their
+// WithSpanSampler option, and it is run after the sampler of WithSampler.
+func StartSampledSpan(ctx context.Context, sampler func(operation, description string) bool, operation, description string, opts ...sentry.SpanOption) *sentry.Span {
+	return startSpan(ctx, "", sampler, false, operation, description, opts...)
+}
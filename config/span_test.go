@@ -0,0 +1,74 @@
+package config_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/sentryintegrationtest"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.db.redis"}
+
+func BenchmarkSpanDataApply(b *testing.B) {
+	data := config.NewSpanData(map[string]interface{}{
+		"db.system":      "redis",
+		"server.address": "localhost",
+		"server.port":    "6379",
+	}, map[string]string{"team": "payments"})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data.Apply(&sentry.Span{})
+	}
+}
+
+// benchmarkStart starts a child span of a transaction with start on every
+// iteration, as an integration does for every command on hot paths.
+func benchmarkStart(b *testing.B, start func(ctx context.Context) *sentry.Span, opts ...config.Option) {
+	config.Set(opts...)
+	defer config.Reset()
+
+	recorder := sentryintegrationtest.NewRecorder(b)
+	ctx, finish := recorder.StartTransaction(context.Background(), "benchmark")
+	defer finish()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start(ctx)
+	}
+}
+
+func BenchmarkStartSpan(b *testing.B) {
+	benchmarkStart(b, func(ctx context.Context) *sentry.Span {
+		return integration.StartSpan(ctx, "db.redis", "GET")
+	})
+}
+
+func BenchmarkStartSampledSpan(b *testing.B) {
+	sampler := func(operation, description string) bool {
+		return description != "PING"
+	}
+
+	benchmarkStart(b, func(ctx context.Context) *sentry.Span {
+		return integration.StartSampledSpan(ctx, sampler, "db.redis", "GET")
+	})
+}
+
+func BenchmarkStartSpanDefaults(b *testing.B) {
+	benchmarkStart(b, func(ctx context.Context) *sentry.Span {
+		return integration.StartSpan(ctx, "db.redis", "GET user:42")
+	},
+		config.WithSpanOrigin("auto.sentryintegration"),
+		config.WithMaxDescriptionLength(1024),
+		config.WithSampler(func(ctx context.Context, operation string) bool { return true }),
+	)
+}
+
+func BenchmarkStartSpanCodeLocations(b *testing.B) {
+	benchmarkStart(b, func(ctx context.Context) *sentry.Span {
+		return integration.StartSpan(ctx, "db.redis", "GET")
+	}, config.WithCodeLocations())
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"github.com/getsentry/sentry-go"
+)
+
+// BeforeSendTransaction is a sentry.ClientOptions.BeforeSendTransaction
+// flagging repeated queries, see WithNPlusOneThreshold, then dropping the "db"
+// spans faster than the threshold of WithSlowQueryThreshold. It chains with
+// other hooks, such as scrub.BeforeSendTransaction:
+//
+//	BeforeSendTransaction: func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+//		return scrub.BeforeSendTransaction(config.BeforeSendTransaction(event, hint), hint)
+//	},
+func BeforeSendTransaction(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	if event == nil {
+		return event
+	}
+
+	c := Get()
+	if c.NPlusOneThreshold > 0 && !c.OmitStatements {
+		detectNPlusOne(event, c.NPlusOneThreshold)
+	}
+
+	threshold := c.SlowQueryThreshold
+	if threshold <= 0 {
+		return event
+	}
+
+	spans := event.Spans[:0]
+	for _, span := range event.Spans {
+		if isDatabase(span.Op) && span.EndTime.Sub(span.StartTime) < threshold {
+			continue
+		}
+		spans = append(spans, span)
+	}
+	event.Spans = spans
+
+	return event
+}
@@ -0,0 +1,374 @@
+// Package consultracer provides a tracer implementation for hashicorp/consul/api.
+//
+//	consulClient, err := api.NewClient(api.DefaultConfig())
+//	if err != nil {
+//		return err
+//	}
+//
+//	client := consultracer.NewSentryClient(consulClient)
+//
+//	pair, meta, err := client.KV().Get(ctx, "config/feature-flags", nil)
+//	entries, meta, err := client.Health().Service(ctx, "payments", "", true, nil)
+//
+// Blocking queries record the index they waited on, the requested wait time
+// and how long the query actually blocked. Service registrations and
+// deregistrations done through the Agent are recorded as breadcrumbs.
+package consultracer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/hashicorp/consul/api"
+)
+
+var integration = config.Integration{Origin: "auto.http.consul"}
+
+// SetEnabled turns the spans of Consul requests on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryConsulTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryConsulTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryConsulTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the operation and the description, e.g. "kv.get config/feature-flags".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryConsulTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func NewSentryClient(client *api.Client, opts ...SentryConsulTracerOption) *Client {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return &Client{
+		Client: client,
+		tracer: t,
+	}
+}
+
+// Client wraps an api.Client, with the KV, Health, Catalog and Agent endpoints
+// traced.
+type Client struct {
+	*api.Client
+	tracer *tracer
+}
+
+func (c *Client) KV() *KV {
+	return &KV{KV: c.Client.KV(), tracer: c.tracer}
+}
+
+func (c *Client) Health() *Health {
+	return &Health{Health: c.Client.Health(), tracer: c.tracer}
+}
+
+func (c *Client) Catalog() *Catalog {
+	return &Catalog{Catalog: c.Client.Catalog(), tracer: c.tracer}
+}
+
+func (c *Client) Agent() *Agent {
+	return &Agent{Agent: c.Client.Agent(), tracer: c.tracer}
+}
+
+func (t *tracer) startSpan(ctx context.Context, op, operation, target string) *sentry.Span {
+	description := operation
+	if target != "" {
+		description += " " + target
+	}
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, op, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", "consul")
+	span.SetData(semconv.DBOperation.Key(), operation)
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// queryOptions returns a copy of q bound to ctx, recording the datacenter and
+// blocking query parameters of q on span.
+func queryOptions(ctx context.Context, span *sentry.Span, q *api.QueryOptions) *api.QueryOptions {
+	if q == nil {
+		q = &api.QueryOptions{}
+	}
+
+	if q.Datacenter != "" {
+		span.SetData("consul.datacenter", q.Datacenter)
+	}
+	if q.WaitIndex > 0 {
+		span.SetData("consul.blocking", "true")
+		span.SetData("consul.wait_index", strconv.FormatUint(q.WaitIndex, 10))
+		if q.WaitTime > 0 {
+			span.SetData("consul.wait_time", strconv.FormatInt(q.WaitTime.Milliseconds(), 10))
+		}
+	}
+
+	return q.WithContext(ctx)
+}
+
+func writeOptions(ctx context.Context, span *sentry.Span, w *api.WriteOptions) *api.WriteOptions {
+	if w == nil {
+		w = &api.WriteOptions{}
+	}
+
+	if w.Datacenter != "" {
+		span.SetData("consul.datacenter", w.Datacenter)
+	}
+
+	return w.WithContext(ctx)
+}
+
+func finishQuery(span *sentry.Span, meta *api.QueryMeta, err error) {
+	if meta != nil {
+		span.SetData("consul.last_index", strconv.FormatUint(meta.LastIndex, 10))
+		span.SetData("consul.request_time", strconv.FormatInt(meta.RequestTime.Milliseconds(), 10))
+		span.SetData("consul.known_leader", strconv.FormatBool(meta.KnownLeader))
+		if meta.CacheHit {
+			span.SetData("consul.cache_hit", "true")
+		}
+	}
+
+	finish(span, err)
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+type KV struct {
+	*api.KV
+	tracer *tracer
+}
+
+func (k *KV) Get(ctx context.Context, key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	span := k.tracer.startSpan(ctx, "db", "kv.get", key)
+	if span == nil {
+		return k.KV.Get(key, q.WithContext(ctx))
+	}
+
+	span.SetData("consul.key", key)
+
+	pair, meta, err := k.KV.Get(key, queryOptions(span.Context(), span, q))
+	span.SetData("consul.found", strconv.FormatBool(pair != nil))
+	finishQuery(span, meta, err)
+
+	return pair, meta, err
+}
+
+func (k *KV) List(ctx context.Context, prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	span := k.tracer.startSpan(ctx, "db", "kv.list", prefix)
+	if span == nil {
+		return k.KV.List(prefix, q.WithContext(ctx))
+	}
+
+	span.SetData("consul.key_prefix", prefix)
+
+	pairs, meta, err := k.KV.List(prefix, queryOptions(span.Context(), span, q))
+	span.SetData("consul.count", strconv.Itoa(len(pairs)))
+	finishQuery(span, meta, err)
+
+	return pairs, meta, err
+}
+
+func (k *KV) Keys(ctx context.Context, prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
+	span := k.tracer.startSpan(ctx, "db", "kv.keys", prefix)
+	if span == nil {
+		return k.KV.Keys(prefix, separator, q.WithContext(ctx))
+	}
+
+	span.SetData("consul.key_prefix", prefix)
+
+	keys, meta, err := k.KV.Keys(prefix, separator, queryOptions(span.Context(), span, q))
+	span.SetData("consul.count", strconv.Itoa(len(keys)))
+	finishQuery(span, meta, err)
+
+	return keys, meta, err
+}
+
+func (k *KV) Put(ctx context.Context, p *api.KVPair, w *api.WriteOptions) (*api.WriteMeta, error) {
+	span := k.tracer.startSpan(ctx, "db", "kv.put", p.Key)
+	if span == nil {
+		return k.KV.Put(p, w.WithContext(ctx))
+	}
+
+	span.SetData("consul.key", p.Key)
+	span.SetData("consul.value_size", strconv.Itoa(len(p.Value)))
+
+	meta, err := k.KV.Put(p, writeOptions(span.Context(), span, w))
+	finish(span, err)
+
+	return meta, err
+}
+
+func (k *KV) Delete(ctx context.Context, key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	span := k.tracer.startSpan(ctx, "db", "kv.delete", key)
+	if span == nil {
+		return k.KV.Delete(key, w.WithContext(ctx))
+	}
+
+	span.SetData("consul.key", key)
+
+	meta, err := k.KV.Delete(key, writeOptions(span.Context(), span, w))
+	finish(span, err)
+
+	return meta, err
+}
+
+type Health struct {
+	*api.Health
+	tracer *tracer
+}
+
+func (h *Health) Service(ctx context.Context, service, tag string, passingOnly bool, q *api.QueryOptions) ([]*api.ServiceEntry, *api.QueryMeta, error) {
+	span := h.tracer.startSpan(ctx, "http.client", "health.service", service)
+	if span == nil {
+		return h.Health.Service(service, tag, passingOnly, q.WithContext(ctx))
+	}
+
+	span.SetData("consul.service", service)
+	span.SetData("consul.passing_only", strconv.FormatBool(passingOnly))
+
+	entries, meta, err := h.Health.Service(service, tag, passingOnly, queryOptions(span.Context(), span, q))
+	span.SetData("consul.count", strconv.Itoa(len(entries)))
+	finishQuery(span, meta, err)
+
+	return entries, meta, err
+}
+
+func (h *Health) Checks(ctx context.Context, service string, q *api.QueryOptions) (api.HealthChecks, *api.QueryMeta, error) {
+	span := h.tracer.startSpan(ctx, "http.client", "health.checks", service)
+	if span == nil {
+		return h.Health.Checks(service, q.WithContext(ctx))
+	}
+
+	span.SetData("consul.service", service)
+
+	checks, meta, err := h.Health.Checks(service, queryOptions(span.Context(), span, q))
+	span.SetData("consul.count", strconv.Itoa(len(checks)))
+	finishQuery(span, meta, err)
+
+	return checks, meta, err
+}
+
+type Catalog struct {
+	*api.Catalog
+	tracer *tracer
+}
+
+func (c *Catalog) Services(ctx context.Context, q *api.QueryOptions) (map[string][]string, *api.QueryMeta, error) {
+	span := c.tracer.startSpan(ctx, "http.client", "catalog.services", "")
+	if span == nil {
+		return c.Catalog.Services(q.WithContext(ctx))
+	}
+
+	services, meta, err := c.Catalog.Services(queryOptions(span.Context(), span, q))
+	span.SetData("consul.count", strconv.Itoa(len(services)))
+	finishQuery(span, meta, err)
+
+	return services, meta, err
+}
+
+func (c *Catalog) Service(ctx context.Context, service, tag string, q *api.QueryOptions) ([]*api.CatalogService, *api.QueryMeta, error) {
+	span := c.tracer.startSpan(ctx, "http.client", "catalog.service", service)
+	if span == nil {
+		return c.Catalog.Service(service, tag, q.WithContext(ctx))
+	}
+
+	span.SetData("consul.service", service)
+
+	services, meta, err := c.Catalog.Service(service, tag, queryOptions(span.Context(), span, q))
+	span.SetData("consul.count", strconv.Itoa(len(services)))
+	finishQuery(span, meta, err)
+
+	return services, meta, err
+}
+
+type Agent struct {
+	*api.Agent
+	tracer *tracer
+}
+
+// ServiceRegister implements api.Agent.ServiceRegister, recording the
+// registration as a breadcrumb.
+func (a *Agent) ServiceRegister(service *api.AgentServiceRegistration) error {
+	err := a.Agent.ServiceRegister(service)
+
+	data := map[string]interface{}{
+		"id":   service.ID,
+		"name": service.Name,
+	}
+	if service.Port != 0 {
+		data["port"] = service.Port
+	}
+	addServiceBreadcrumb("Registered service "+service.Name, data, err)
+
+	return err
+}
+
+// ServiceDeregister implements api.Agent.ServiceDeregister, recording the
+// deregistration as a breadcrumb.
+func (a *Agent) ServiceDeregister(serviceID string) error {
+	err := a.Agent.ServiceDeregister(serviceID)
+	addServiceBreadcrumb("Deregistered service "+serviceID, map[string]interface{}{"id": serviceID}, err)
+
+	return err
+}
+
+func addServiceBreadcrumb(message string, data map[string]interface{}, err error) {
+	level := sentry.LevelInfo
+	if err != nil {
+		level = sentry.LevelError
+		data["error"] = err.Error()
+	}
+
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "consul.agent",
+		Message:  message,
+		Data:     data,
+		Level:    level,
+	})
+}
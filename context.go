@@ -0,0 +1,34 @@
+package sentryintegration
+
+import (
+	"context"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+)
+
+// EnsureHub returns ctx with a hub bound to it, along with that hub. When ctx
+// carries none, a clone of sentry.CurrentHub is bound, so that scope changes
+// made down the line do not leak into the current hub.
+func EnsureHub(ctx context.Context) (context.Context, *sentry.Hub) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		return ctx, hub
+	}
+
+	hub := sentry.CurrentHub().Clone()
+
+	return sentry.SetHubOnContext(ctx, hub), hub
+}
+
+// SpanOrTransaction starts a span of op described by name, as a child of the
+// span of ctx. When ctx carries no span, it deliberately starts a transaction
+// named name instead, on a hub bound by EnsureHub. It is started like the spans
+// of the integrations, hence returns nil when the global configuration of
+// package config drops it.
+func SpanOrTransaction(ctx context.Context, op, name string, opts ...sentry.SpanOption) *sentry.Span {
+	if sentry.SpanFromContext(ctx) == nil {
+		ctx, _ = EnsureHub(ctx)
+	}
+
+	return config.StartTransaction(ctx, nil, op, name, opts...)
+}
@@ -0,0 +1,261 @@
+// Package crontracer provides a tracer implementation for robfig/cron, as a
+// cron.JobWrapper emitting Sentry Cron check-ins.
+//
+//	c := cron.New(cron.WithChain(crontracer.NewSentryJobWrapper(
+//		crontracer.WithMonitorConfig("daily report", &sentry.MonitorConfig{
+//			Schedule: sentry.CrontabSchedule("0 3 * * *"),
+//		}),
+//	)))
+//
+//	c.AddJob("0 3 * * *", crontracer.Func("daily report", func(ctx context.Context) error {
+//		return generateDailyReport(ctx)
+//	}))
+//
+// Every run is a "cron.job" transaction, and is checked in to the monitor whose
+// slug is derived from the job name, e.g. "daily-report". Jobs created with Job
+// or Func carry their name, other jobs are named after their type.
+package crontracer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/getsentry/sentry-go"
+	"github.com/robfig/cron/v3"
+)
+
+var integration = config.Integration{Origin: "auto.function.cron"}
+
+// SetEnabled turns the spans of cron jobs on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryCronTracerOption func(*wrapper)
+
+func WithTags(tags map[string]string) SentryCronTracerOption {
+	return func(w *wrapper) {
+		for k, v := range tags {
+			w.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryCronTracerOption {
+	return func(w *wrapper) {
+		w.tags[key] = value
+	}
+}
+
+// WithSpanSampler runs jobs for which sampler returns false, given the
+// "cron.job" operation and the job name, without a transaction nor check-ins.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryCronTracerOption {
+	return func(w *wrapper) {
+		w.spanSampler = sampler
+	}
+}
+
+// WithMonitorConfig sets the monitor config sent along check-ins of the job
+// with the given name, so the monitor is created or updated on the first
+// check-in.
+func WithMonitorConfig(name string, config *sentry.MonitorConfig) SentryCronTracerOption {
+	return func(w *wrapper) {
+		w.configs[name] = config
+	}
+}
+
+// WithoutCheckIns disables check-ins, only keeping the transaction and panic
+// recovery.
+func WithoutCheckIns() SentryCronTracerOption {
+	return func(w *wrapper) {
+		w.checkIns = false
+	}
+}
+
+type wrapper struct {
+	checkIns    bool
+	configs     map[string]*sentry.MonitorConfig
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// NewSentryJobWrapper returns a cron.JobWrapper that runs every job within a
+// "cron.job" transaction, recovers panics and captures errors of jobs created
+// with Func.
+func NewSentryJobWrapper(opts ...SentryCronTracerOption) cron.JobWrapper {
+	w := &wrapper{
+		checkIns: true,
+		configs:  make(map[string]*sentry.MonitorConfig),
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w.wrap
+}
+
+func (w *wrapper) wrap(job cron.Job) cron.Job {
+	name := jobName(job)
+	slug := monitorSlug(name)
+
+	return cron.FuncJob(func() {
+		hub := sentry.CurrentHub().Clone()
+		ctx := sentry.SetHubOnContext(context.Background(), hub)
+
+		startedAt := time.Now()
+
+		span := integration.StartTransaction(ctx, w.spanSampler, "cron.job", name)
+		if span == nil {
+			job.Run()
+			return
+		}
+
+		span.SetData("cron.job.name", name)
+		span.SetData("cron.monitor.slug", slug)
+
+		for k, v := range w.tags {
+			span.SetTag(k, v)
+		}
+
+		var checkInID *sentry.EventID
+		if w.checkIns {
+			checkInID = hub.CaptureCheckIn(&sentry.CheckIn{
+				MonitorSlug: slug,
+				Status:      sentry.CheckInStatusInProgress,
+			}, w.configs[name])
+		}
+
+		var err error
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				hub.RecoverWithContext(ctx, recovered)
+				err = fmt.Errorf("panic: %v", recovered)
+			} else if err != nil {
+				hub.CaptureException(err)
+			}
+
+			if err != nil {
+				span.Status = sentry.SpanStatusInternalError
+				span.SetData("error", err.Error())
+			} else {
+				span.Status = sentry.SpanStatusOK
+			}
+			span.Finish()
+
+			if w.checkIns {
+				status := sentry.CheckInStatusOK
+				if err != nil {
+					status = sentry.CheckInStatusError
+				}
+
+				checkIn := &sentry.CheckIn{
+					MonitorSlug: slug,
+					Status:      status,
+					Duration:    time.Since(startedAt),
+				}
+				if checkInID != nil {
+					checkIn.ID = *checkInID
+				}
+				hub.CaptureCheckIn(checkIn, w.configs[name])
+			}
+		}()
+
+		ctx, unlabel := profiling.Label(span.Context(), span)
+		defer unlabel()
+
+		if contextJob, ok := job.(interface {
+			RunContext(ctx context.Context) error
+		}); ok {
+			err = contextJob.RunContext(ctx)
+			return
+		}
+
+		job.Run()
+	})
+}
+
+// Job names job, for its transactions and monitor slug.
+func Job(name string, job cron.Job) cron.Job {
+	return &namedJob{Job: job, name: name}
+}
+
+type namedJob struct {
+	cron.Job
+	name string
+}
+
+func (j *namedJob) Name() string {
+	return j.name
+}
+
+// Func returns a named job running fn with the context of its transaction. A
+// non-nil error returned by fn is captured and marks the check-in as failed.
+func Func(name string, fn func(ctx context.Context) error) cron.Job {
+	return &funcJob{fn: fn, name: name}
+}
+
+type funcJob struct {
+	fn   func(ctx context.Context) error
+	name string
+}
+
+func (j *funcJob) Name() string {
+	return j.name
+}
+
+func (j *funcJob) Run() {
+	_ = j.fn(context.Background())
+}
+
+func (j *funcJob) RunContext(ctx context.Context) error {
+	return j.fn(ctx)
+}
+
+// jobName returns the name of a job created with Job or Func, or the name of
+// its type, or function for a cron.FuncJob.
+func jobName(job cron.Job) string {
+	if named, ok := job.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	if fn, ok := job.(cron.FuncJob); ok {
+		if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+			name := f.Name()
+			if i := strings.LastIndex(name, "/"); i >= 0 {
+				name = name[i+1:]
+			}
+			return name
+		}
+	}
+
+	return strings.TrimPrefix(reflect.TypeOf(job).String(), "*")
+}
+
+// monitorSlug derives a monitor slug out of a job name, lowercasing it and
+// replacing any run of other characters than letters and digits with a dash,
+// e.g. "Daily report" becomes "daily-report".
+func monitorSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
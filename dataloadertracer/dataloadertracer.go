@@ -0,0 +1,237 @@
+// Package dataloadertracer provides a tracer implementation for
+// graph-gophers/dataloader, and for the fetch functions of generated loaders
+// in the style of gqlgen's dataloaden.
+//
+// Every batch load is a "graphql.dataloader" span recording the number of keys
+// in the batch, the keys themselves unless personal data is omitted, and how
+// many loads were served by the loader cache since the previous batch.
+//
+//	tracer := dataloadertracer.NewSentryTracer[string, *User]("users")
+//	loader := dataloader.NewBatchedLoader(batchUsers,
+//		dataloader.WithTracer[string, *User](tracer),
+//		dataloader.WithCache[string, *User](tracer.Cache(dataloader.NewCache[string, *User]())))
+//
+// Generated loaders are traced by wrapping their fetch function, as long as it
+// takes a context.
+//
+//	loader := dataloadgen.NewLoader(dataloadertracer.TraceFetch("users", fetchUsers))
+package dataloadertracer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+	"github.com/graph-gophers/dataloader/v7"
+)
+
+var integration = config.Integration{Origin: "auto.graphql.dataloader"}
+
+// SetEnabled turns the spans of batch loads on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+// maxKeys is the number of keys of a batch recorded on its span.
+const maxKeys = 100
+
+type SentryDataloaderTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryDataloaderTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryDataloaderTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of batches for which sampler returns false,
+// given the "graphql.dataloader" operation and the name of the loader.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryDataloaderTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	name        string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(name string, opts []SentryDataloaderTracerOption) tracer {
+	t := tracer{
+		name: name,
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+// startBatch starts the span of a batch of keys, recording hits cache hits.
+func startBatch[K comparable](ctx context.Context, t tracer, keys []K, hits int64) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "graphql.dataloader", t.name)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("dataloader.name", t.name)
+	span.SetData("dataloader.batch.size", strconv.Itoa(len(keys)))
+	span.SetData("dataloader.cache.hit_count", strconv.FormatInt(hits, 10))
+	if !config.Get().OmitPII {
+		span.SetData("dataloader.keys", formatKeys(keys))
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// finishBatch records the number of keys of a batch that failed to load.
+func finishBatch(span *sentry.Span, failed int, err error) {
+	if span == nil {
+		return
+	}
+
+	switch {
+	case err != nil:
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	case failed > 0:
+		span.Status = sentry.SpanStatusInternalError
+	default:
+		span.Status = sentry.SpanStatusOK
+	}
+	span.SetData("dataloader.error_count", strconv.Itoa(failed))
+
+	span.Finish()
+}
+
+// Tracer implements dataloader.Tracer, creating a span for every batch load.
+type Tracer[K comparable, V any] struct {
+	tracer
+	hits atomic.Int64
+}
+
+// NewSentryTracer returns a Tracer for the loader name, e.g. "users".
+func NewSentryTracer[K comparable, V any](name string, opts ...SentryDataloaderTracerOption) *Tracer[K, V] {
+	return &Tracer[K, V]{tracer: newTracer(name, opts)}
+}
+
+// TraceLoad implements dataloader.Tracer. Single loads are not traced, they
+// are part of the span of their batch.
+func (t *Tracer[K, V]) TraceLoad(ctx context.Context, _ K) (context.Context, dataloader.TraceLoadFinishFunc[V]) {
+	return ctx, func(dataloader.Thunk[V]) {}
+}
+
+// TraceLoadMany implements dataloader.Tracer. Loads are not traced, they are
+// part of the span of their batch.
+func (t *Tracer[K, V]) TraceLoadMany(ctx context.Context, _ []K) (context.Context, dataloader.TraceLoadManyFinishFunc[V]) {
+	return ctx, func(dataloader.ThunkMany[V]) {}
+}
+
+// TraceBatch implements dataloader.Tracer.
+func (t *Tracer[K, V]) TraceBatch(ctx context.Context, keys []K) (context.Context, dataloader.TraceBatchFinishFunc[V]) {
+	span := startBatch(ctx, t.tracer, keys, t.hits.Swap(0))
+	if span == nil {
+		return ctx, func([]*dataloader.Result[V]) {}
+	}
+
+	return span.Context(), func(results []*dataloader.Result[V]) {
+		failed := 0
+		for _, result := range results {
+			if result != nil && result.Error != nil {
+				failed++
+			}
+		}
+
+		finishBatch(span, failed, nil)
+	}
+}
+
+// Cache wraps the cache of the loader so that the loads it serves are
+// counted, and recorded on the span of the next batch.
+func (t *Tracer[K, V]) Cache(cache dataloader.Cache[K, V]) dataloader.Cache[K, V] {
+	return &countingCache[K, V]{Cache: cache, hits: &t.hits}
+}
+
+type countingCache[K comparable, V any] struct {
+	dataloader.Cache[K, V]
+	hits *atomic.Int64
+}
+
+func (c *countingCache[K, V]) Get(ctx context.Context, key K) (dataloader.Thunk[V], bool) {
+	thunk, ok := c.Cache.Get(ctx, key)
+	if ok {
+		c.hits.Add(1)
+	}
+
+	return thunk, ok
+}
+
+// TraceFetch wraps the fetch function of the loader name so that every batch
+// it loads is a span. fetch loads the values of keys in the same order, along
+// with an error per key or a single error for the whole batch. Generated
+// loaders cache loads without telling, so their spans always record zero
+// cache hits.
+func TraceFetch[K comparable, V any](name string, fetch func(ctx context.Context, keys []K) ([]V, []error), opts ...SentryDataloaderTracerOption) func(ctx context.Context, keys []K) ([]V, []error) {
+	t := newTracer(name, opts)
+
+	return func(ctx context.Context, keys []K) ([]V, []error) {
+		span := startBatch(ctx, t, keys, 0)
+		if span == nil {
+			return fetch(ctx, keys)
+		}
+
+		values, errs := fetch(span.Context(), keys)
+
+		failed := 0
+		for _, err := range errs {
+			if err != nil {
+				failed++
+			}
+		}
+		// A single error fails the whole batch.
+		if len(errs) == 1 && len(keys) > 1 && errs[0] != nil {
+			finishBatch(span, len(keys), errs[0])
+		} else {
+			finishBatch(span, failed, nil)
+		}
+
+		return values, errs
+	}
+}
+
+// formatKeys returns the first maxKeys keys, separated by commas.
+func formatKeys[K comparable](keys []K) string {
+	var b strings.Builder
+	for i, key := range keys {
+		if i == maxKeys {
+			fmt.Fprintf(&b, ", and %d more", len(keys)-maxKeys)
+			break
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprint(&b, key)
+	}
+
+	return b.String()
+}
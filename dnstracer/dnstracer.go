@@ -0,0 +1,265 @@
+// Package dnstracer provides a tracer implementation for DNS lookups done
+// through a net.Resolver.
+//
+//	resolver := dnstracer.NewSentryResolver(net.DefaultResolver, dnstracer.WithHashedHost())
+//
+//	addrs, err := resolver.LookupHost(ctx, "api.example.com")
+//
+// Lookups are recorded as "dns.lookup" spans with the queried name, the record
+// type and the number of answers. Timeouts and unknown names are reported
+// through the span status. The Go resolver does not expose whether an answer
+// came from a cache, so cached answers only show up as very short spans.
+package dnstracer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.dns"}
+
+// SetEnabled turns the spans of DNS lookups on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryDNSTracerOption func(*Resolver)
+
+func WithTags(tags map[string]string) SentryDNSTracerOption {
+	return func(r *Resolver) {
+		for k, v := range tags {
+			r.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryDNSTracerOption {
+	return func(r *Resolver) {
+		r.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of lookups for which sampler returns false,
+// given the operation and the "TYPE name" description, e.g. "A localhost".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryDNSTracerOption {
+	return func(r *Resolver) {
+		r.spanSampler = sampler
+	}
+}
+
+// WithHashedHost records the SHA-256 of queried names instead of the names
+// themselves, for names that are considered sensitive.
+func WithHashedHost() SentryDNSTracerOption {
+	return func(r *Resolver) {
+		r.hashHost = true
+	}
+}
+
+func NewSentryResolver(resolver *net.Resolver, opts ...SentryDNSTracerOption) *Resolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	r := &Resolver{
+		Resolver: resolver,
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Resolver wraps a net.Resolver, with its lookups traced.
+type Resolver struct {
+	*net.Resolver
+
+	hashHost    bool
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (r *Resolver) startSpan(ctx context.Context, name, recordType string) *sentry.Span {
+	if r.hashHost {
+		sum := sha256.Sum256([]byte(name))
+		name = hex.EncodeToString(sum[:])
+	}
+
+	description := recordType + " " + name
+
+	span := integration.StartSampledSpan(ctx, r.spanSampler, "dns.lookup", description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("dns.question.name", name)
+	span.SetData("dns.question.type", recordType)
+	if r.Resolver.PreferGo {
+		span.SetData("dns.resolver", "go")
+	}
+
+	for k, v := range r.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, answers int, err error) {
+	span.SetData("dns.answer.count", strconv.Itoa(answers))
+
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			switch {
+			case dnsErr.IsTimeout:
+				span.Status = sentry.SpanStatusDeadlineExceeded
+				span.SetData("dns.outcome", "timeout")
+			case dnsErr.IsNotFound:
+				span.Status = sentry.SpanStatusNotFound
+				span.SetData("dns.outcome", "not_found")
+			case dnsErr.IsTemporary:
+				span.Status = sentry.SpanStatusUnavailable
+				span.SetData("dns.outcome", "temporary_failure")
+			}
+			if dnsErr.Server != "" {
+				span.SetData(semconv.ServerAddress.Key(), dnsErr.Server)
+			}
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			span.Status = sentry.SpanStatusDeadlineExceeded
+			span.SetData("dns.outcome", "timeout")
+		}
+	} else {
+		span.Status = sentry.SpanStatusOK
+		span.SetData("dns.outcome", "success")
+	}
+
+	span.Finish()
+}
+
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	span := r.startSpan(ctx, host, "A+AAAA")
+	if span == nil {
+		return r.Resolver.LookupHost(ctx, host)
+	}
+
+	addrs, err := r.Resolver.LookupHost(span.Context(), host)
+	finish(span, len(addrs), err)
+
+	return addrs, err
+}
+
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	span := r.startSpan(ctx, host, "A+AAAA")
+	if span == nil {
+		return r.Resolver.LookupIPAddr(ctx, host)
+	}
+
+	addrs, err := r.Resolver.LookupIPAddr(span.Context(), host)
+	finish(span, len(addrs), err)
+
+	return addrs, err
+}
+
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	recordType := "A+AAAA"
+	switch network {
+	case "ip4":
+		recordType = "A"
+	case "ip6":
+		recordType = "AAAA"
+	}
+
+	span := r.startSpan(ctx, host, recordType)
+	if span == nil {
+		return r.Resolver.LookupIP(ctx, network, host)
+	}
+
+	ips, err := r.Resolver.LookupIP(span.Context(), network, host)
+	finish(span, len(ips), err)
+
+	return ips, err
+}
+
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	span := r.startSpan(ctx, host, "CNAME")
+	if span == nil {
+		return r.Resolver.LookupCNAME(ctx, host)
+	}
+
+	cname, err := r.Resolver.LookupCNAME(span.Context(), host)
+	answers := 0
+	if cname != "" {
+		answers = 1
+	}
+	finish(span, answers, err)
+
+	return cname, err
+}
+
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	span := r.startSpan(ctx, name, "MX")
+	if span == nil {
+		return r.Resolver.LookupMX(ctx, name)
+	}
+
+	records, err := r.Resolver.LookupMX(span.Context(), name)
+	finish(span, len(records), err)
+
+	return records, err
+}
+
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	span := r.startSpan(ctx, name, "TXT")
+	if span == nil {
+		return r.Resolver.LookupTXT(ctx, name)
+	}
+
+	records, err := r.Resolver.LookupTXT(span.Context(), name)
+	finish(span, len(records), err)
+
+	return records, err
+}
+
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	query := name
+	if service != "" || proto != "" {
+		query = "_" + service + "._" + proto + "." + name
+	}
+
+	span := r.startSpan(ctx, query, "SRV")
+	if span == nil {
+		return r.Resolver.LookupSRV(ctx, service, proto, name)
+	}
+
+	cname, records, err := r.Resolver.LookupSRV(span.Context(), service, proto, name)
+	finish(span, len(records), err)
+
+	return cname, records, err
+}
+
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	span := r.startSpan(ctx, addr, "PTR")
+	if span == nil {
+		return r.Resolver.LookupAddr(ctx, addr)
+	}
+
+	names, err := r.Resolver.LookupAddr(span.Context(), addr)
+	finish(span, len(names), err)
+
+	return names, err
+}
@@ -0,0 +1,383 @@
+// Package dockertracer provides a tracer implementation for the Docker Engine
+// API client.
+//
+//	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+//	if err != nil {
+//		return err
+//	}
+//
+//	docker := dockertracer.NewSentryClient(cli)
+//
+//	reader, err := docker.ImagePull(ctx, "docker.io/library/alpine:3.19", types.ImagePullOptions{})
+//	if err != nil {
+//		return err
+//	}
+//	defer reader.Close()
+//	io.Copy(io.Discard, reader)
+//
+// Image pulls are traced until the progress stream is closed, and the layers
+// being pulled are recorded as breadcrumbs.
+package dockertracer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/getsentry/sentry-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var integration = config.Integration{Origin: "auto.http.docker"}
+
+// SetEnabled turns the spans of Docker Engine requests on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryDockerTracerOption func(*Client)
+
+func WithTags(tags map[string]string) SentryDockerTracerOption {
+	return func(c *Client) {
+		for k, v := range tags {
+			c.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryDockerTracerOption {
+	return func(c *Client) {
+		c.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the operation and the description, e.g. "ContainerWait 4f2a".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryDockerTracerOption {
+	return func(c *Client) {
+		c.spanSampler = sampler
+	}
+}
+
+func NewSentryClient(cli *client.Client, opts ...SentryDockerTracerOption) *Client {
+	c := &Client{
+		Client: cli,
+		tags:   make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Client wraps a client.Client. Container create, start, wait and exec
+// operations as well as image pulls are traced, other methods are forwarded to
+// the underlying client as-is.
+type Client struct {
+	*client.Client
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (c *Client) startSpan(ctx context.Context, op, description string) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, c.spanSampler, op, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData(semconv.ServerAddress.Key(), c.DaemonHost())
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// shortID truncates container and exec IDs the way the Docker CLI displays them.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+func (c *Client) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	span := c.startSpan(ctx, "container.create", "ContainerCreate "+config.Image)
+	if span == nil {
+		return c.Client.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+	}
+
+	span.SetData("container.image.name", config.Image)
+	if containerName != "" {
+		span.SetData("container.name", containerName)
+	}
+
+	response, err := c.Client.ContainerCreate(span.Context(), config, hostConfig, networkingConfig, platform, containerName)
+	if err == nil {
+		span.SetData("container.id", response.ID)
+		if len(response.Warnings) > 0 {
+			span.SetData("container.warnings", strings.Join(response.Warnings, "; "))
+		}
+	}
+	finish(span, err)
+
+	return response, err
+}
+
+func (c *Client) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	span := c.startSpan(ctx, "container.start", "ContainerStart "+shortID(containerID))
+	if span == nil {
+		return c.Client.ContainerStart(ctx, containerID, options)
+	}
+
+	span.SetData("container.id", containerID)
+
+	err := c.Client.ContainerStart(span.Context(), containerID, options)
+	finish(span, err)
+
+	return err
+}
+
+// ContainerWait implements client.Client.ContainerWait. The span is finished
+// once the container exits, recording its exit code.
+func (c *Client) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	span := c.startSpan(ctx, "container.wait", "ContainerWait "+shortID(containerID))
+	if span == nil {
+		return c.Client.ContainerWait(ctx, containerID, condition)
+	}
+
+	span.SetData("container.id", containerID)
+
+	responses, errs := c.Client.ContainerWait(span.Context(), containerID, condition)
+
+	responseC := make(chan container.WaitResponse, 1)
+	errC := make(chan error, 1)
+
+	go func() {
+		select {
+		case response := <-responses:
+			span.SetData("container.exit_code", strconv.FormatInt(response.StatusCode, 10))
+			if response.Error != nil {
+				span.SetData("error", response.Error.Message)
+			}
+			if response.StatusCode != 0 || response.Error != nil {
+				span.Status = sentry.SpanStatusInternalError
+			} else {
+				span.Status = sentry.SpanStatusOK
+			}
+			span.Finish()
+			responseC <- response
+		case err := <-errs:
+			finish(span, err)
+			errC <- err
+		}
+	}()
+
+	return responseC, errC
+}
+
+func (c *Client) ContainerExecCreate(ctx context.Context, containerID string, config types.ExecConfig) (types.IDResponse, error) {
+	command := strings.Join(config.Cmd, " ")
+
+	span := c.startSpan(ctx, "container.exec", "ContainerExecCreate "+shortID(containerID))
+	if span == nil {
+		return c.Client.ContainerExecCreate(ctx, containerID, config)
+	}
+
+	span.SetData("container.id", containerID)
+	if len(config.Cmd) > 0 {
+		span.SetData("process.executable.name", config.Cmd[0])
+		span.SetData("process.command_line", command)
+	}
+
+	response, err := c.Client.ContainerExecCreate(span.Context(), containerID, config)
+	if err == nil {
+		span.SetData("container.exec.id", response.ID)
+	}
+	finish(span, err)
+
+	return response, err
+}
+
+func (c *Client) ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error {
+	span := c.startSpan(ctx, "container.exec", "ContainerExecStart "+shortID(execID))
+	if span == nil {
+		return c.Client.ContainerExecStart(ctx, execID, config)
+	}
+
+	span.SetData("container.exec.id", execID)
+
+	err := c.Client.ContainerExecStart(span.Context(), execID, config)
+	finish(span, err)
+
+	return err
+}
+
+func (c *Client) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	span := c.startSpan(ctx, "container.exec", "ContainerExecInspect "+shortID(execID))
+	if span == nil {
+		return c.Client.ContainerExecInspect(ctx, execID)
+	}
+
+	span.SetData("container.exec.id", execID)
+
+	inspect, err := c.Client.ContainerExecInspect(span.Context(), execID)
+	if err == nil {
+		span.SetData("container.id", inspect.ContainerID)
+		span.SetData("container.exec.running", strconv.FormatBool(inspect.Running))
+		if !inspect.Running {
+			span.SetData("container.exit_code", strconv.Itoa(inspect.ExitCode))
+		}
+	}
+	finish(span, err)
+
+	return inspect, err
+}
+
+// ImagePull implements client.Client.ImagePull. The span is finished once the
+// returned progress stream is closed.
+func (c *Client) ImagePull(ctx context.Context, refStr string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	span := c.startSpan(ctx, "image.pull", "ImagePull "+refStr)
+	if span == nil {
+		return c.Client.ImagePull(ctx, refStr, options)
+	}
+
+	span.SetData("container.image.name", refStr)
+	if options.Platform != "" {
+		span.SetData("container.image.platform", options.Platform)
+	}
+
+	reader, err := c.Client.ImagePull(span.Context(), refStr, options)
+	if err != nil {
+		finish(span, err)
+		return reader, err
+	}
+
+	return &pullProgress{ReadCloser: reader, span: span, image: refStr, layers: make(map[string]string)}, nil
+}
+
+// pullProgress reads the JSON messages of an image pull progress stream as it
+// is consumed, recording layer status changes as breadcrumbs.
+type pullProgress struct {
+	io.ReadCloser
+	span  *sentry.Span
+	image string
+
+	pending []byte
+	layers  map[string]string
+	err     string
+}
+
+func (p *pullProgress) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	if n > 0 && p.span != nil {
+		p.pending = append(p.pending, b[:n]...)
+		p.consumeLines()
+	}
+
+	return n, err
+}
+
+func (p *pullProgress) consumeLines() {
+	for {
+		i := bytes.IndexByte(p.pending, '\n')
+		if i < 0 {
+			// The last line may be incomplete, keep it for the next read.
+			return
+		}
+
+		line := p.pending[:i]
+		p.pending = p.pending[i+1:]
+
+		var message jsonmessage.JSONMessage
+		if json.Unmarshal(line, &message) == nil {
+			p.record(message)
+		}
+	}
+}
+
+func (p *pullProgress) record(message jsonmessage.JSONMessage) {
+	if message.Error != nil {
+		p.err = message.Error.Message
+		return
+	}
+	if message.ErrorMessage != "" {
+		p.err = message.ErrorMessage
+		return
+	}
+
+	// Progress updates of the same status, e.g. "Downloading", are skipped.
+	if message.ID != "" {
+		if p.layers[message.ID] == message.Status {
+			return
+		}
+		p.layers[message.ID] = message.Status
+	}
+
+	data := map[string]interface{}{
+		"image": p.image,
+	}
+	if message.ID != "" {
+		data["layer"] = message.ID
+	}
+
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "docker.pull",
+		Message:  message.Status,
+		Data:     data,
+		Level:    sentry.LevelInfo,
+	})
+}
+
+func (p *pullProgress) Close() error {
+	err := p.ReadCloser.Close()
+	if p.span == nil {
+		return err
+	}
+
+	if len(p.pending) > 0 {
+		var message jsonmessage.JSONMessage
+		if json.Unmarshal(p.pending, &message) == nil {
+			p.record(message)
+		}
+	}
+
+	p.span.SetData("container.image.layers", strconv.Itoa(len(p.layers)))
+	if p.err != "" {
+		p.span.Status = sentry.SpanStatusInternalError
+		p.span.SetData("error", p.err)
+		p.span.Finish()
+	} else {
+		finish(p.span, err)
+	}
+	p.span = nil
+
+	return err
+}
@@ -0,0 +1,213 @@
+// Package dynamodbtracer provides a tracer implementation for the AWS SDK v2
+// DynamoDB client, as a smithy-go middleware.
+//
+//	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+//		o.APIOptions = append(o.APIOptions, dynamodbtracer.NewSentryMiddleware())
+//	})
+package dynamodbtracer
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.db.dynamodb"}
+
+// SetEnabled turns the spans of DynamoDB operations on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryDynamoDBTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryDynamoDBTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryDynamoDBTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the "db" operation and the description, e.g. "GetItem users".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryDynamoDBTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithConsumedCapacity asks DynamoDB to return the total consumed capacity for
+// operations which did not ask for it explicitly, so it can be recorded on spans.
+func WithConsumedCapacity() SentryDynamoDBTracerOption {
+	return func(t *tracer) {
+		t.consumedCapacity = true
+	}
+}
+
+type tracer struct {
+	tags             map[string]string
+	spanSampler      func(operation, description string) bool
+	consumedCapacity bool
+}
+
+// NewSentryMiddleware returns a function to be appended to dynamodb.Options.APIOptions.
+func NewSentryMiddleware(opts ...SentryDynamoDBTracerOption) func(*middleware.Stack) error {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("SentryDynamoDBTracer", t.handleInitialize), middleware.Before)
+	}
+}
+
+func (t *tracer) handleInitialize(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	operation := awsmiddleware.GetOperationName(ctx)
+	tableNames := tableNames(in.Parameters)
+
+	description := operation
+	if len(tableNames) > 0 {
+		description += " " + strings.Join(tableNames, ",")
+	}
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "db", description)
+	if span == nil {
+		return next.HandleInitialize(ctx, in)
+	}
+	defer span.Finish()
+
+	span.SetData("db.system", "dynamodb")
+	span.SetData(semconv.DBOperation.Key(), operation)
+	span.SetData("cloud.region", awsmiddleware.GetRegion(ctx))
+	if len(tableNames) > 0 {
+		span.SetData("aws.dynamodb.table_names", strings.Join(tableNames, ","))
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	if t.consumedCapacity {
+		setReturnConsumedCapacity(in.Parameters)
+	}
+
+	out, metadata, err := next.HandleInitialize(span.Context(), in)
+
+	if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+		span.SetData("aws.request_id", requestID)
+	}
+
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return out, metadata, err
+	}
+
+	span.Status = sentry.SpanStatusOK
+	recordOutput(span, out.Result)
+
+	return out, metadata, nil
+}
+
+// tableNames returns the tables targeted by an operation input. Most inputs have
+// a TableName field, while batch operations key their items by table name.
+func tableNames(input interface{}) []string {
+	value := reflect.Indirect(reflect.ValueOf(input))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if field := value.FieldByName("TableName"); field.IsValid() && field.Kind() == reflect.Pointer && !field.IsNil() {
+		if name, ok := field.Elem().Interface().(string); ok {
+			return []string{name}
+		}
+	}
+
+	if field := value.FieldByName("RequestItems"); field.IsValid() && field.Kind() == reflect.Map {
+		names := make([]string, 0, field.Len())
+		for _, key := range field.MapKeys() {
+			names = append(names, key.String())
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	return nil
+}
+
+func setReturnConsumedCapacity(input interface{}) {
+	value := reflect.Indirect(reflect.ValueOf(input))
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	field := value.FieldByName("ReturnConsumedCapacity")
+	if !field.IsValid() || !field.CanSet() || field.Type() != reflect.TypeOf(types.ReturnConsumedCapacity("")) {
+		return
+	}
+
+	if field.String() == "" {
+		field.Set(reflect.ValueOf(types.ReturnConsumedCapacityTotal))
+	}
+}
+
+func recordOutput(span *sentry.Span, output interface{}) {
+	value := reflect.Indirect(reflect.ValueOf(output))
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	if field := value.FieldByName("Count"); field.IsValid() && field.Kind() == reflect.Int32 {
+		span.SetData("aws.dynamodb.count", strconv.FormatInt(field.Int(), 10))
+	}
+	if field := value.FieldByName("ScannedCount"); field.IsValid() && field.Kind() == reflect.Int32 {
+		span.SetData("aws.dynamodb.scanned_count", strconv.FormatInt(field.Int(), 10))
+	}
+	if field := value.FieldByName("Items"); field.IsValid() && field.Kind() == reflect.Slice {
+		span.SetData("aws.dynamodb.item_count", strconv.Itoa(field.Len()))
+	}
+	if field := value.FieldByName("Item"); field.IsValid() && field.Kind() == reflect.Map {
+		span.SetData("aws.dynamodb.item_found", strconv.FormatBool(field.Len() > 0))
+	}
+
+	var capacityUnits float64
+	var found bool
+	switch consumed := value.FieldByName("ConsumedCapacity"); {
+	case !consumed.IsValid():
+	case consumed.Type() == reflect.TypeOf(&types.ConsumedCapacity{}):
+		if capacity, ok := consumed.Interface().(*types.ConsumedCapacity); ok && capacity != nil && capacity.CapacityUnits != nil {
+			capacityUnits, found = *capacity.CapacityUnits, true
+		}
+	case consumed.Type() == reflect.TypeOf([]types.ConsumedCapacity{}):
+		for _, capacity := range consumed.Interface().([]types.ConsumedCapacity) {
+			if capacity.CapacityUnits != nil {
+				capacityUnits += *capacity.CapacityUnits
+				found = true
+			}
+		}
+	}
+	if found {
+		span.SetData("aws.dynamodb.consumed_capacity", strconv.FormatFloat(capacityUnits, 'f', -1, 64))
+	}
+}
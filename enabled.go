@@ -0,0 +1,11 @@
+package sentryintegration
+
+import "github.com/aldy505/sentry-integration/config"
+
+// SetEnabled turns the spans of every integration, and of the helpers of this
+// package, on or off at runtime. While off, operations run untraced, while
+// errors and panics are still captured. Each integration package also has its
+// own SetEnabled to turn it off alone.
+func SetEnabled(enabled bool) {
+	config.SetEnabled(enabled)
+}
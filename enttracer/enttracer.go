@@ -0,0 +1,167 @@
+// Package enttracer provides a tracer implementation for ent, as a dialect.Driver
+// wrapper.
+//
+//	drv, err := sql.Open(dialect.Postgres, dsn)
+//	if err != nil {
+//		return err
+//	}
+//
+//	client := ent.NewClient(ent.Driver(enttracer.NewSentryDriver(drv)))
+package enttracer
+
+import (
+	"context"
+	"strings"
+
+	"entgo.io/ent"
+	"entgo.io/ent/dialect"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.db.ent"}
+
+// SetEnabled turns the spans of ent queries on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryEntTracerOption func(*Driver)
+
+func WithTags(tags map[string]string) SentryEntTracerOption {
+	return func(t *Driver) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryEntTracerOption {
+	return func(t *Driver) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of queries for which sampler returns false,
+// given the operation and the query.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryEntTracerOption {
+	return func(t *Driver) {
+		t.spanSampler = sampler
+	}
+}
+
+func NewSentryDriver(driver dialect.Driver, opts ...SentryEntTracerOption) dialect.Driver {
+	d := &Driver{
+		Driver: driver,
+		tags:   make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+type Driver struct {
+	dialect.Driver
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// Exec implements dialect.ExecQuerier.
+func (d *Driver) Exec(ctx context.Context, query string, args, v any) error {
+	return d.trace(ctx, query, func(ctx context.Context) error {
+		return d.Driver.Exec(ctx, query, args, v)
+	})
+}
+
+// Query implements dialect.ExecQuerier.
+func (d *Driver) Query(ctx context.Context, query string, args, v any) error {
+	return d.trace(ctx, query, func(ctx context.Context) error {
+		return d.Driver.Query(ctx, query, args, v)
+	})
+}
+
+// Tx implements dialect.Driver.
+func (d *Driver) Tx(ctx context.Context) (dialect.Tx, error) {
+	tx, err := d.Driver.Tx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, driver: d}, nil
+}
+
+type Tx struct {
+	dialect.Tx
+	driver *Driver
+}
+
+// Exec implements dialect.ExecQuerier.
+func (t *Tx) Exec(ctx context.Context, query string, args, v any) error {
+	return t.driver.trace(ctx, query, func(ctx context.Context) error {
+		return t.Tx.Exec(ctx, query, args, v)
+	})
+}
+
+// Query implements dialect.ExecQuerier.
+func (t *Tx) Query(ctx context.Context, query string, args, v any) error {
+	return t.driver.trace(ctx, query, func(ctx context.Context) error {
+		return t.Tx.Query(ctx, query, args, v)
+	})
+}
+
+func (d *Driver) trace(ctx context.Context, query string, fn func(ctx context.Context) error) error {
+	span := integration.StartSampledSpan(ctx, d.spanSampler, "db.sql.query", query)
+	if span == nil {
+		return fn(ctx)
+	}
+	defer span.Finish()
+
+	span.SetData("db.system", dbSystem(d.Driver.Dialect()))
+	if operation := operationName(query); operation != "" {
+		span.SetData(semconv.DBOperation.Key(), operation)
+	}
+	if queryContext := ent.QueryFromContext(ctx); queryContext != nil && queryContext.Type != "" {
+		span.SetData("ent.node_type", queryContext.Type)
+	}
+
+	for k, v := range d.tags {
+		span.SetTag(k, v)
+	}
+
+	err := fn(span.Context())
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return err
+}
+
+// dbSystem maps ent dialect names to the db.system values Sentry expects.
+func dbSystem(name string) string {
+	switch name {
+	case dialect.Postgres:
+		return "postgresql"
+	case dialect.SQLite:
+		return "sqlite"
+	default:
+		return name
+	}
+}
+
+func operationName(query string) string {
+	query = strings.TrimSpace(query)
+	if i := strings.IndexAny(query, " \t\n"); i > 0 {
+		query = query[:i]
+	}
+
+	return strings.ToUpper(query)
+}
@@ -0,0 +1,227 @@
+// Package errgrouptracer provides an errgroup.Group replacement whose tasks run
+// within child spans of the group's context, each with its own clone of the
+// hub.
+//
+//	group, ctx := errgrouptracer.WithContext(ctx)
+//
+//	group.GoContext("fetch user", func(ctx context.Context) error {
+//		user, err = users.Get(ctx, userID)
+//		return err
+//	})
+//	group.GoContext("fetch orders", func(ctx context.Context) error {
+//		orders, err = orders.List(ctx, userID)
+//		return err
+//	})
+//
+//	if err := group.Wait(); err != nil {
+//		return err
+//	}
+//
+// Panicking tasks are recovered, captured as exceptions and reported as the
+// error of the group, instead of crashing the process.
+package errgrouptracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/getsentry/sentry-go"
+	"golang.org/x/sync/errgroup"
+)
+
+var integration = config.Integration{Origin: "auto.function.errgroup"}
+
+// SetEnabled turns the spans of errgroup tasks on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryErrgroupTracerOption func(*Group)
+
+func WithTags(tags map[string]string) SentryErrgroupTracerOption {
+	return func(g *Group) {
+		for k, v := range tags {
+			g.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryErrgroupTracerOption {
+	return func(g *Group) {
+		g.tags[key] = value
+	}
+}
+
+// WithSpanSampler runs tasks for which sampler returns false, given the
+// "function" operation and the task name, without a span. Their panics and
+// errors are still recovered and collected.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryErrgroupTracerOption {
+	return func(g *Group) {
+		g.spanSampler = sampler
+	}
+}
+
+// WithCaptureErrors captures the errors returned by tasks as a single
+// exception once Wait returns.
+func WithCaptureErrors() SentryErrgroupTracerOption {
+	return func(g *Group) {
+		g.captureErrors = true
+	}
+}
+
+// Group is a drop-in replacement for errgroup.Group. The zero value is not
+// usable, create one with New or WithContext.
+type Group struct {
+	group *errgroup.Group
+	ctx   context.Context
+
+	captureErrors bool
+	tags          map[string]string
+	spanSampler   func(operation, description string) bool
+
+	mu    sync.Mutex
+	tasks int
+	errs  []error
+}
+
+// New returns a Group whose tasks are traced as children of the span of ctx.
+// Unlike WithContext, ctx is not cancelled when a task fails.
+func New(ctx context.Context, opts ...SentryErrgroupTracerOption) *Group {
+	g := &Group{
+		group: &errgroup.Group{},
+		ctx:   ctx,
+		tags:  make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+// WithContext implements errgroup.WithContext.
+func WithContext(ctx context.Context, opts ...SentryErrgroupTracerOption) (*Group, context.Context) {
+	group, ctx := errgroup.WithContext(ctx)
+
+	g := New(ctx, opts...)
+	g.group = group
+
+	return g, ctx
+}
+
+// Go implements errgroup.Group.Go. As f does not receive a context, its span
+// can not be a parent of the spans it starts, GoContext should be preferred.
+func (g *Group) Go(f func() error) {
+	g.GoContext("", func(context.Context) error {
+		return f()
+	})
+}
+
+// GoContext calls f in a new goroutine, within a child span named name. The
+// context given to f carries that span and a clone of the hub.
+func (g *Group) GoContext(name string, f func(ctx context.Context) error) {
+	g.group.Go(g.task(name, f))
+}
+
+// TryGo implements errgroup.Group.TryGo.
+func (g *Group) TryGo(f func() error) bool {
+	return g.TryGoContext("", func(context.Context) error {
+		return f()
+	})
+}
+
+// TryGoContext calls f in a new goroutine like GoContext, only when the number
+// of active goroutines is below the limit of the group.
+func (g *Group) TryGoContext(name string, f func(ctx context.Context) error) bool {
+	return g.group.TryGo(g.task(name, f))
+}
+
+// SetLimit implements errgroup.Group.SetLimit.
+func (g *Group) SetLimit(n int) {
+	g.group.SetLimit(n)
+}
+
+// Wait implements errgroup.Group.Wait.
+func (g *Group) Wait() error {
+	err := g.group.Wait()
+
+	g.mu.Lock()
+	errs := g.errs
+	g.errs = nil
+	g.mu.Unlock()
+
+	if g.captureErrors && len(errs) > 0 {
+		hub := sentry.GetHubFromContext(g.ctx)
+		if hub == nil {
+			hub = sentry.CurrentHub()
+		}
+		hub.CaptureException(errors.Join(errs...))
+	}
+
+	return err
+}
+
+func (g *Group) task(name string, f func(ctx context.Context) error) func() error {
+	g.mu.Lock()
+	g.tasks++
+	index := g.tasks
+	g.mu.Unlock()
+
+	if name == "" {
+		name = "errgroup task " + strconv.Itoa(index)
+	}
+
+	return func() (err error) {
+		hub := sentry.GetHubFromContext(g.ctx)
+		if hub == nil {
+			hub = sentry.CurrentHub()
+		}
+		hub = hub.Clone()
+		ctx := sentry.SetHubOnContext(g.ctx, hub)
+
+		span := integration.StartSampledSpan(ctx, g.spanSampler, "function", name)
+		if span != nil {
+			span.SetData("errgroup.task.index", strconv.Itoa(index))
+			for k, v := range g.tags {
+				span.SetTag(k, v)
+			}
+			ctx = span.Context()
+
+			var unlabel func()
+			ctx, unlabel = profiling.Label(ctx, span)
+			defer unlabel()
+		}
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				hub.RecoverWithContext(ctx, recovered)
+				err = fmt.Errorf("panic in %s: %v", name, recovered)
+			} else if err != nil {
+				g.mu.Lock()
+				g.errs = append(g.errs, err)
+				g.mu.Unlock()
+			}
+
+			if span != nil {
+				if err != nil {
+					span.Status = sentry.SpanStatusInternalError
+					span.SetData("error", err.Error())
+				} else if ctx.Err() != nil {
+					span.Status = sentry.SpanStatusCanceled
+				} else {
+					span.Status = sentry.SpanStatusOK
+				}
+				span.Finish()
+			}
+		}()
+
+		return f(ctx)
+	}
+}
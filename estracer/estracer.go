@@ -0,0 +1,276 @@
+// Package estracer provides a tracer implementation for go-elasticsearch, as an
+// http.RoundTripper. Spans are named after the API endpoint being called, and
+// record the index name, the "took" time and the shard statistics of responses.
+//
+//	client, err := elasticsearch.NewClient(elasticsearch.Config{
+//		Addresses: []string{"http://localhost:9200"},
+//		Transport: estracer.NewSentryRoundTripper(nil),
+//	})
+package estracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+// responsePrefixSize is the amount of response body bytes inspected for the
+// "took" and "_shards" fields, which Elasticsearch writes at the very beginning
+// of the response.
+const responsePrefixSize = 1024
+
+var (
+	tookPattern   = regexp.MustCompile(`"took"\s*:\s*(\d+)`)
+	shardsPattern = regexp.MustCompile(`"_shards"\s*:\s*(\{[^{}]*\})`)
+)
+
+var integration = config.Integration{Origin: "auto.db.elasticsearch"}
+
+// SetEnabled turns the spans of Elasticsearch requests on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryElasticsearchTracerOption func(*SentryRoundTripper)
+
+func WithTags(tags map[string]string) SentryElasticsearchTracerOption {
+	return func(t *SentryRoundTripper) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryElasticsearchTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of requests for which sampler returns false,
+// given the "db" operation and the endpoint, e.g. to leave out "_cluster/health".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryElasticsearchTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithDBSystem overrides the "db.system" span data, for Elasticsearch-compatible
+// engines. Defaults to "elasticsearch".
+func WithDBSystem(system string) SentryElasticsearchTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.system = system
+	}
+}
+
+// WithIntegration starts the spans through integration rather than the one of
+// estracer, for Elasticsearch-compatible engines which have their own origin
+// and SetEnabled switch.
+func WithIntegration(integration *config.Integration) SentryElasticsearchTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.integration = integration
+	}
+}
+
+func NewSentryRoundTripper(originalRoundTripper http.RoundTripper, opts ...SentryElasticsearchTracerOption) http.RoundTripper {
+	if originalRoundTripper == nil {
+		originalRoundTripper = http.DefaultTransport
+	}
+
+	t := &SentryRoundTripper{
+		originalRoundTripper: originalRoundTripper,
+		system:               "elasticsearch",
+		integration:          &integration,
+		tags:                 make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+type SentryRoundTripper struct {
+	originalRoundTripper http.RoundTripper
+	system               string
+	integration          *config.Integration
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (s *SentryRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	endpoint, index := Endpoint(request.Method, request.URL.Path)
+
+	span := s.integration.StartSampledSpan(request.Context(), s.spanSampler, "db", endpoint)
+	if span == nil {
+		return s.originalRoundTripper.RoundTrip(request)
+	}
+
+	for k, v := range s.tags {
+		span.SetTag(k, v)
+	}
+
+	span.SetData("db.system", s.system)
+	span.SetData(semconv.DBOperation.Key(), endpoint)
+	span.SetData(semconv.HTTPRequestMethod.Key(), request.Method)
+	span.SetData(semconv.ServerAddress.Key(), request.URL.Hostname())
+	if port := request.URL.Port(); port != "" {
+		span.SetData(semconv.ServerPort.Key(), port)
+	}
+	if index != "" {
+		span.SetData("db.elasticsearch.path_parts.index", index)
+	}
+	if region, service, ok := sigV4Scope(request.Header.Get("Authorization")); ok {
+		span.SetData("aws.region", region)
+		span.SetData("aws.service", service)
+	}
+
+	response, err := s.originalRoundTripper.RoundTrip(request.WithContext(span.Context()))
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		span.Finish()
+		return response, err
+	}
+
+	span.Status = sentry.HTTPtoSpanStatus(response.StatusCode)
+	span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(response.StatusCode))
+
+	if response.Body == nil || response.Body == http.NoBody {
+		span.Finish()
+		return response, nil
+	}
+
+	// The span is finished once the response body is closed, after the took
+	// time and shard statistics were read out of it.
+	response.Body = &responseBody{ReadCloser: response.Body, span: span}
+
+	return response, nil
+}
+
+type responseBody struct {
+	io.ReadCloser
+	span   *sentry.Span
+	prefix bytes.Buffer
+}
+
+func (r *responseBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if remaining := responsePrefixSize - r.prefix.Len(); remaining > 0 && n > 0 {
+		r.prefix.Write(p[:min(n, remaining)])
+	}
+
+	return n, err
+}
+
+func (r *responseBody) Close() error {
+	err := r.ReadCloser.Close()
+
+	prefix := r.prefix.Bytes()
+	if match := tookPattern.FindSubmatch(prefix); match != nil {
+		r.span.SetData("db.elasticsearch.took", string(match[1]))
+	}
+	if match := shardsPattern.FindSubmatch(prefix); match != nil {
+		var shards struct {
+			Total      int `json:"total"`
+			Successful int `json:"successful"`
+			Skipped    int `json:"skipped"`
+			Failed     int `json:"failed"`
+		}
+		if json.Unmarshal(match[1], &shards) == nil {
+			r.span.SetData("db.elasticsearch.shards.total", strconv.Itoa(shards.Total))
+			r.span.SetData("db.elasticsearch.shards.successful", strconv.Itoa(shards.Successful))
+			r.span.SetData("db.elasticsearch.shards.skipped", strconv.Itoa(shards.Skipped))
+			r.span.SetData("db.elasticsearch.shards.failed", strconv.Itoa(shards.Failed))
+		}
+	}
+
+	r.span.Finish()
+
+	return err
+}
+
+// Endpoint derives the API endpoint name (e.g. "search", "bulk", "index") and
+// the target index out of a request method and path.
+func Endpoint(method, path string) (endpoint string, index string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) == 1 && segments[0] == "" {
+		return "info", ""
+	}
+
+	if !strings.HasPrefix(segments[0], "_") {
+		index = segments[0]
+	}
+
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "_") {
+			continue
+		}
+
+		api := strings.TrimPrefix(segment, "_")
+		switch api {
+		case "doc", "create":
+			switch method {
+			case http.MethodGet:
+				return "get", index
+			case http.MethodHead:
+				return "exists", index
+			case http.MethodDelete:
+				return "delete", index
+			default:
+				return "index", index
+			}
+		case "cat", "cluster", "nodes", "snapshot", "tasks", "ingest", "security", "ilm":
+			if i+1 < len(segments) {
+				return api + "." + strings.TrimPrefix(segments[i+1], "_"), index
+			}
+			return api, index
+		default:
+			return api, index
+		}
+	}
+
+	switch method {
+	case http.MethodPut:
+		return "indices.create", index
+	case http.MethodDelete:
+		return "indices.delete", index
+	case http.MethodHead:
+		return "indices.exists", index
+	default:
+		return "indices.get", index
+	}
+}
+
+// sigV4Scope extracts the region and service out of an AWS Signature Version 4
+// Authorization header, as produced for Amazon OpenSearch Service.
+func sigV4Scope(authorization string) (region string, service string, ok bool) {
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+		return "", "", false
+	}
+
+	_, credential, found := strings.Cut(authorization, "Credential=")
+	if !found {
+		return "", "", false
+	}
+	credential, _, _ = strings.Cut(credential, ",")
+
+	// Credential=<access key>/<date>/<region>/<service>/aws4_request
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 {
+		return "", "", false
+	}
+
+	return parts[2], parts[3], true
+}
@@ -0,0 +1,165 @@
+package sentryintegration
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/getsentry/sentry-go"
+)
+
+var everyIntegration = config.Integration{Origin: "auto.function.every"}
+
+type EveryOption func(*runner)
+
+// WithMonitor emits Sentry Cron check-ins with the given monitor slug on every
+// tick. When config is nil, the monitor is configured with the interval of the
+// runner, rounded down to minutes.
+func WithMonitor(slug string, config *sentry.MonitorConfig) EveryOption {
+	return func(r *runner) {
+		r.monitorSlug = slug
+		r.monitorConfig = config
+	}
+}
+
+func WithEveryTags(tags map[string]string) EveryOption {
+	return func(r *runner) {
+		for k, v := range tags {
+			r.tags[k] = v
+		}
+	}
+}
+
+type runner struct {
+	interval time.Duration
+	name     string
+
+	monitorSlug   string
+	monitorConfig *sentry.MonitorConfig
+	tags          map[string]string
+}
+
+// Every calls fn every interval until ctx is done, each call within a new
+// "function" transaction named name. Ticks dropped because a previous call was
+// still running are counted as skipped on the next transaction, along with how
+// late the call started compared to its tick.
+//
+//	go sentryintegration.Every(ctx, time.Minute, "refresh exchange rates", func(ctx context.Context) error {
+//		return rates.Refresh(ctx)
+//	}, sentryintegration.WithMonitor("refresh-exchange-rates", nil))
+//
+// Panics are recovered and errors returned by fn are captured as exceptions,
+// neither stops the runner. Every returns the error of ctx once it is done.
+func Every(ctx context.Context, interval time.Duration, name string, fn func(ctx context.Context) error, opts ...EveryOption) error {
+	r := &runner{
+		interval: interval,
+		name:     name,
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.monitorSlug != "" && r.monitorConfig == nil && interval >= time.Minute {
+		r.monitorConfig = &sentry.MonitorConfig{
+			Schedule: sentry.IntervalSchedule(int64(interval/time.Minute), sentry.MonitorScheduleUnitMinute),
+		}
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case tick := <-ticker.C:
+			skipped := 0
+			if !last.IsZero() {
+				skipped = int(tick.Sub(last)/interval) - 1
+			}
+			last = tick
+
+			r.run(ctx, hub.Clone(), tick, skipped, fn)
+		}
+	}
+}
+
+func (r *runner) run(ctx context.Context, hub *sentry.Hub, tick time.Time, skipped int, fn func(ctx context.Context) error) {
+	ctx = sentry.SetHubOnContext(detachedContext{Context: ctx}, hub)
+	startedAt := time.Now()
+
+	span := everyIntegration.StartTransaction(ctx, nil, "function", r.name)
+	if span != nil {
+		span.SetData("runner.interval", strconv.FormatInt(r.interval.Milliseconds(), 10))
+		span.SetData("runner.jitter", strconv.FormatInt(startedAt.Sub(tick).Milliseconds(), 10))
+		if skipped > 0 {
+			span.SetData("runner.skipped_ticks", strconv.Itoa(skipped))
+		}
+		for k, v := range r.tags {
+			span.SetTag(k, v)
+		}
+		ctx = span.Context()
+
+		var unlabel func()
+		ctx, unlabel = profiling.Label(ctx, span)
+		defer unlabel()
+	}
+
+	var checkInID *sentry.EventID
+	if r.monitorSlug != "" {
+		checkInID = hub.CaptureCheckIn(&sentry.CheckIn{
+			MonitorSlug: r.monitorSlug,
+			Status:      sentry.CheckInStatusInProgress,
+		}, r.monitorConfig)
+	}
+
+	var err error
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			hub.RecoverWithContext(ctx, recovered)
+			err = fmt.Errorf("panic: %v", recovered)
+		} else if err != nil {
+			hub.CaptureException(err)
+		}
+
+		if span != nil {
+			if err != nil {
+				span.Status = sentry.SpanStatusInternalError
+				span.SetData("error", err.Error())
+			} else {
+				span.Status = sentry.SpanStatusOK
+			}
+			span.Finish()
+		}
+
+		if r.monitorSlug != "" {
+			status := sentry.CheckInStatusOK
+			if err != nil {
+				status = sentry.CheckInStatusError
+			}
+
+			checkIn := &sentry.CheckIn{
+				MonitorSlug: r.monitorSlug,
+				Status:      status,
+				Duration:    time.Since(startedAt),
+			}
+			if checkInID != nil {
+				checkIn.ID = *checkInID
+			}
+			hub.CaptureCheckIn(checkIn, r.monitorConfig)
+		}
+	}()
+
+	err = fn(ctx)
+}
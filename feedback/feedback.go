@@ -0,0 +1,262 @@
+// Package feedback lets the users of an HTTP service describe what they were
+// doing when a request of theirs failed, attaching their feedback to the
+// errors captured while handling it.
+//
+//	mux.Handle("/api/", feedback.Middleware(api))
+//	mux.Handle("/api/feedback", feedback.NewHandler())
+//
+// Middleware records the IDs of the error events captured on the hub of every
+// request, and answers server errors with the ID of the last one in the
+// X-Sentry-Event-ID header, which frontends read to prompt their users right
+// after a 500. The prompt is then posted to the handler as JSON:
+//
+//	{"event_id": "...", "name": "Jane", "email": "jane@example.com", "comments": "Clicked on pay twice."}
+//
+// Middleware runs within the middleware binding the hub of the request, if
+// any, e.g. gozerotracer.RestMiddleware:
+//
+//	server.Use(gozerotracer.RestMiddleware())
+//	server.Use(func(next http.HandlerFunc) http.HandlerFunc {
+//		return feedback.Middleware(next).ServeHTTP
+//	})
+package feedback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aldy505/sentry-integration/internal/envelope"
+	"github.com/aldy505/sentry-integration/internal/httpwriter"
+	"github.com/getsentry/sentry-go"
+)
+
+// EventIDHeader is the response header carrying the ID of the last error
+// event captured while handling a request answered with a server error, the
+// same as httprecovery.EventIDHeader.
+const EventIDHeader = httpwriter.EventIDHeader
+
+// maxBodySize caps the size of the feedback posted to the handler.
+const maxBodySize = 64 << 10
+
+type contextKey struct{}
+
+// recorder records the IDs of the error events captured for a request.
+type recorder struct {
+	mu  sync.Mutex
+	ids []sentry.EventID
+}
+
+func (r *recorder) record(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	if event.Type == "" && (len(event.Exception) > 0 || event.Level == sentry.LevelError || event.Level == sentry.LevelFatal) {
+		r.mu.Lock()
+		r.ids = append(r.ids, event.EventID)
+		r.mu.Unlock()
+	}
+
+	return event
+}
+
+func (r *recorder) last() sentry.EventID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.ids) == 0 {
+		return ""
+	}
+
+	return r.ids[len(r.ids)-1]
+}
+
+// Middleware records the IDs of the error events captured while handling a
+// request, binding to its context a clone of the hub of the context, or of the
+// current hub, which records them. Responses with a status code of 500 or
+// above carry the ID of the last one in the EventIDHeader header. Events
+// dropped afterwards, e.g. by BeforeSend or sampling, are recorded
+// nonetheless, while events captured on the hub of an outer middleware, such
+// as the panics sentryhttp recovers, are not.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub := sentry.GetHubFromContext(r.Context())
+		if hub == nil {
+			hub = sentry.CurrentHub()
+		}
+		// The recorder is added to a clone, so that it does not pile up on
+		// the scope of a hub shared across requests.
+		hub = hub.Clone()
+
+		rec := &recorder{}
+		hub.Scope().AddEventProcessor(rec.record)
+		ctx := sentry.SetHubOnContext(r.Context(), hub)
+		ctx = context.WithValue(ctx, contextKey{}, rec)
+
+		writer := &httpwriter.ResponseWriter{
+			ResponseWriter: w,
+			BeforeWriteHeader: func(status int) {
+				if status < http.StatusInternalServerError {
+					return
+				}
+				if id := rec.last(); id != "" {
+					w.Header().Set(EventIDHeader, string(id))
+				}
+			},
+		}
+
+		next.ServeHTTP(writer, r.WithContext(ctx))
+	})
+}
+
+// EventIDs returns the IDs of the error events captured so far while handling
+// the request of ctx, in order, or nil outside of Middleware.
+func EventIDs(ctx context.Context) []sentry.EventID {
+	rec, ok := ctx.Value(contextKey{}).(*recorder)
+	if !ok {
+		return nil
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return append([]sentry.EventID(nil), rec.ids...)
+}
+
+// LastEventID returns the ID of the last error event captured while handling
+// the request of ctx, e.g. to render it within an error page, or an empty ID.
+func LastEventID(ctx context.Context) sentry.EventID {
+	rec, ok := ctx.Value(contextKey{}).(*recorder)
+	if !ok {
+		return ""
+	}
+
+	return rec.last()
+}
+
+// Feedback is the feedback of a user about the error event EventID.
+type Feedback struct {
+	EventID  sentry.EventID `json:"event_id"`
+	Name     string         `json:"name"`
+	Email    string         `json:"email"`
+	Comments string         `json:"comments"`
+}
+
+// ErrInvalidFeedback is returned by Send for feedback without a valid event
+// ID or without comments.
+var ErrInvalidFeedback = errors.New("feedback: invalid feedback")
+
+// Send sends feedback as a user report to the DSN of the client of hub, or of
+// sentry.CurrentHub when hub is nil. Event IDs are accepted with or without
+// dashes.
+func Send(hub *sentry.Hub, feedback Feedback) error {
+	feedback.EventID = sentry.EventID(strings.ToLower(strings.ReplaceAll(string(feedback.EventID), "-", "")))
+	if !validEventID(feedback.EventID) || strings.TrimSpace(feedback.Comments) == "" {
+		return ErrInvalidFeedback
+	}
+
+	payload, err := json.Marshal(feedback)
+	if err != nil {
+		return err
+	}
+
+	return envelope.Send(hub, "user_report", payload)
+}
+
+func validEventID(id sentry.EventID) bool {
+	if len(id) != 32 {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Option func(*Handler)
+
+// WithHub sends feedback through the client of hub instead of the client of
+// the hub of the request context, or of sentry.CurrentHub.
+func WithHub(hub *sentry.Hub) Option {
+	return func(h *Handler) {
+		h.hub = hub
+	}
+}
+
+// Handler accepts feedback posted as JSON, or as a form with the same field
+// names, answering 204 once it is sent, 400 when it is invalid and 502 when
+// it could not be sent.
+type Handler struct {
+	hub *sentry.Hub
+}
+
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	feedback, err := decode(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hub := h.hub
+	if hub == nil {
+		hub = sentry.GetHubFromContext(r.Context())
+	}
+
+	err = Send(hub, feedback)
+	switch {
+	case errors.Is(err, ErrInvalidFeedback):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decode decodes the feedback of r, either JSON or a form.
+func decode(w http.ResponseWriter, r *http.Request) (Feedback, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(maxBodySize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return Feedback{}, err
+		}
+
+		return Feedback{
+			EventID:  sentry.EventID(r.PostFormValue("event_id")),
+			Name:     r.PostFormValue("name"),
+			Email:    r.PostFormValue("email"),
+			Comments: r.PostFormValue("comments"),
+		}, nil
+	}
+
+	var feedback Feedback
+	if err := json.NewDecoder(r.Body).Decode(&feedback); err != nil && !errors.Is(err, io.EOF) {
+		return Feedback{}, err
+	}
+
+	return feedback, nil
+}
@@ -0,0 +1,366 @@
+// Package firebasetracer provides a tracer implementation for the Firebase
+// Admin SDK, covering Cloud Messaging and Authentication.
+//
+//	httpOption, err := firebasetracer.NewHTTPClientOption(ctx)
+//	if err != nil {
+//		return err
+//	}
+//
+//	app, err := firebase.NewApp(ctx, nil, httpOption)
+//	if err != nil {
+//		return err
+//	}
+//
+//	messagingClient, err := app.Messaging(ctx)
+//	if err != nil {
+//		return err
+//	}
+//
+//	client := firebasetracer.NewSentryMessagingClient(messagingClient)
+//	response, err := client.SendEachForMulticast(ctx, &messaging.MulticastMessage{Tokens: tokens})
+//
+// Batch sends record the batch size and how many messages succeeded or failed.
+// Registration tokens and user IDs are never recorded.
+package firebasetracer
+
+import (
+	"context"
+	"strconv"
+
+	"firebase.google.com/go/v4/auth"
+	"firebase.google.com/go/v4/messaging"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/httpclient"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// firebaseScopes are the OAuth2 scopes the Admin SDK requests when it creates
+// its own HTTP client.
+var firebaseScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	"https://www.googleapis.com/auth/datastore",
+	"https://www.googleapis.com/auth/devstorage.full_control",
+	"https://www.googleapis.com/auth/firebase",
+	"https://www.googleapis.com/auth/identitytoolkit",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+var integration = config.Integration{Origin: "auto.http.firebase"}
+
+// SetEnabled turns the spans of Firebase calls on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryFirebaseTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryFirebaseTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryFirebaseTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the operation and the description, e.g. "auth.VerifyIDToken".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryFirebaseTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryFirebaseTracerOption) *tracer {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *tracer) startSpan(ctx context.Context, op, description string) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, t.spanSampler, op, description)
+	if span == nil {
+		return nil
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, err error, status sentry.SpanStatus) {
+	if err != nil {
+		span.Status = status
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// NewHTTPClientOption returns a client option for firebase.NewApp, with an
+// authenticated HTTP client whose transport is traced. Requests made by the
+// Admin SDK then carry the sentry-trace and baggage headers.
+//
+// The given options are used to authenticate the HTTP client, e.g.
+// option.WithCredentialsFile.
+func NewHTTPClientOption(ctx context.Context, opts ...option.ClientOption) (option.ClientOption, error) {
+	opts = append([]option.ClientOption{option.WithScopes(firebaseScopes...)}, opts...)
+
+	client, _, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Transport = httpclient.NewSentryRoundTripper(client.Transport, nil)
+
+	return option.WithHTTPClient(client), nil
+}
+
+func NewSentryMessagingClient(client *messaging.Client, opts ...SentryFirebaseTracerOption) *MessagingClient {
+	return &MessagingClient{
+		Client: client,
+		tracer: newTracer(opts...),
+	}
+}
+
+// MessagingClient wraps a messaging.Client, with the Send methods traced.
+type MessagingClient struct {
+	*messaging.Client
+	tracer *tracer
+}
+
+func (c *MessagingClient) Send(ctx context.Context, message *messaging.Message) (string, error) {
+	span := c.tracer.startSpan(ctx, "firebase.messaging", "messaging.Send")
+	if span == nil {
+		return c.Client.Send(ctx, message)
+	}
+
+	span.SetData("messaging.system", "fcm")
+	span.SetData("messaging.batch.message_count", "1")
+	if message != nil {
+		recordTarget(span, message)
+	}
+
+	id, err := c.Client.Send(span.Context(), message)
+	if err != nil {
+		finish(span, err, messagingSpanStatus(err))
+		return id, err
+	}
+
+	span.SetData(semconv.MessagingMessageID.Key(), id)
+	finish(span, nil, sentry.SpanStatusOK)
+
+	return id, nil
+}
+
+func (c *MessagingClient) SendEach(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	span := c.startBatchSpan(ctx, "messaging.SendEach", len(messages))
+	if span == nil {
+		return c.Client.SendEach(ctx, messages)
+	}
+
+	response, err := c.Client.SendEach(span.Context(), messages)
+	finishBatch(span, response, err)
+
+	return response, err
+}
+
+func (c *MessagingClient) SendEachForMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	span := c.startBatchSpan(ctx, "messaging.SendEachForMulticast", multicastSize(message))
+	if span == nil {
+		return c.Client.SendEachForMulticast(ctx, message)
+	}
+
+	response, err := c.Client.SendEachForMulticast(span.Context(), message)
+	finishBatch(span, response, err)
+
+	return response, err
+}
+
+func (c *MessagingClient) SendAll(ctx context.Context, messages []*messaging.Message) (*messaging.BatchResponse, error) {
+	span := c.startBatchSpan(ctx, "messaging.SendAll", len(messages))
+	if span == nil {
+		return c.Client.SendAll(ctx, messages)
+	}
+
+	response, err := c.Client.SendAll(span.Context(), messages)
+	finishBatch(span, response, err)
+
+	return response, err
+}
+
+func (c *MessagingClient) SendMulticast(ctx context.Context, message *messaging.MulticastMessage) (*messaging.BatchResponse, error) {
+	span := c.startBatchSpan(ctx, "messaging.SendMulticast", multicastSize(message))
+	if span == nil {
+		return c.Client.SendMulticast(ctx, message)
+	}
+
+	response, err := c.Client.SendMulticast(span.Context(), message)
+	finishBatch(span, response, err)
+
+	return response, err
+}
+
+func (c *MessagingClient) startBatchSpan(ctx context.Context, description string, size int) *sentry.Span {
+	span := c.tracer.startSpan(ctx, "firebase.messaging", description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("messaging.system", "fcm")
+	span.SetData("messaging.batch.message_count", strconv.Itoa(size))
+
+	return span
+}
+
+func multicastSize(message *messaging.MulticastMessage) int {
+	if message == nil {
+		return 0
+	}
+
+	return len(message.Tokens)
+}
+
+// recordTarget records whether a message is sent to a topic, a condition or a
+// single device. Device registration tokens are left out.
+func recordTarget(span *sentry.Span, message *messaging.Message) {
+	switch {
+	case message.Topic != "":
+		span.SetData("messaging.destination.kind", "topic")
+		span.SetData(semconv.MessagingDestinationName.Key(), message.Topic)
+	case message.Condition != "":
+		span.SetData("messaging.destination.kind", "condition")
+	case message.Token != "":
+		span.SetData("messaging.destination.kind", "token")
+	}
+}
+
+// finishBatch records the success and failure counts of a batch send. The span
+// is only marked as failed when the batch as a whole failed, or when every
+// message in it did.
+func finishBatch(span *sentry.Span, response *messaging.BatchResponse, err error) {
+	if err != nil {
+		finish(span, err, messagingSpanStatus(err))
+		return
+	}
+
+	span.SetData("messaging.batch.success_count", strconv.Itoa(response.SuccessCount))
+	span.SetData("messaging.batch.failure_count", strconv.Itoa(response.FailureCount))
+
+	if response.SuccessCount == 0 && response.FailureCount > 0 {
+		for _, r := range response.Responses {
+			if r.Error != nil {
+				finish(span, r.Error, messagingSpanStatus(r.Error))
+				return
+			}
+		}
+	}
+
+	finish(span, nil, sentry.SpanStatusOK)
+}
+
+func messagingSpanStatus(err error) sentry.SpanStatus {
+	switch {
+	case messaging.IsInvalidArgument(err):
+		return sentry.SpanStatusInvalidArgument
+	case messaging.IsUnregistered(err):
+		return sentry.SpanStatusNotFound
+	case messaging.IsQuotaExceeded(err):
+		return sentry.SpanStatusResourceExhausted
+	case messaging.IsSenderIDMismatch(err), messaging.IsThirdPartyAuthError(err):
+		return sentry.SpanStatusPermissionDenied
+	case messaging.IsUnavailable(err):
+		return sentry.SpanStatusUnavailable
+	default:
+		return sentry.SpanStatusInternalError
+	}
+}
+
+func NewSentryAuthClient(client *auth.Client, opts ...SentryFirebaseTracerOption) *AuthClient {
+	return &AuthClient{
+		Client: client,
+		tracer: newTracer(opts...),
+	}
+}
+
+// AuthClient wraps an auth.Client, with ID token verification traced.
+type AuthClient struct {
+	*auth.Client
+	tracer *tracer
+}
+
+func (c *AuthClient) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	span := c.tracer.startSpan(ctx, "firebase.auth", "auth.VerifyIDToken")
+	if span == nil {
+		return c.Client.VerifyIDToken(ctx, idToken)
+	}
+
+	token, err := c.Client.VerifyIDToken(span.Context(), idToken)
+	finishVerify(span, token, err)
+
+	return token, err
+}
+
+func (c *AuthClient) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*auth.Token, error) {
+	span := c.tracer.startSpan(ctx, "firebase.auth", "auth.VerifyIDTokenAndCheckRevoked")
+	if span == nil {
+		return c.Client.VerifyIDTokenAndCheckRevoked(ctx, idToken)
+	}
+
+	span.SetData("firebase.auth.check_revoked", "true")
+
+	token, err := c.Client.VerifyIDTokenAndCheckRevoked(span.Context(), idToken)
+	finishVerify(span, token, err)
+
+	return token, err
+}
+
+func finishVerify(span *sentry.Span, token *auth.Token, err error) {
+	if token != nil {
+		if token.Firebase.SignInProvider != "" {
+			span.SetData("firebase.auth.sign_in_provider", token.Firebase.SignInProvider)
+		}
+		if token.Firebase.Tenant != "" {
+			span.SetData("firebase.auth.tenant", token.Firebase.Tenant)
+		}
+	}
+
+	finish(span, err, authSpanStatus(err))
+}
+
+func authSpanStatus(err error) sentry.SpanStatus {
+	switch {
+	case auth.IsIDTokenExpired(err), auth.IsIDTokenInvalid(err), auth.IsIDTokenRevoked(err):
+		return sentry.SpanStatusUnauthenticated
+	case auth.IsUserDisabled(err), auth.IsTenantIDMismatch(err):
+		return sentry.SpanStatusPermissionDenied
+	case auth.IsCertificateFetchFailed(err):
+		return sentry.SpanStatusUnavailable
+	default:
+		return sentry.SpanStatusInternalError
+	}
+}
@@ -0,0 +1,45 @@
+// Package flags records evaluated feature flags, so errors and spans can be
+// sliced by the flags that were active when they happened.
+//
+//	enabled := client.IsEnabled("new-checkout", user)
+//	flags.Record(ctx, "new-checkout", enabled)
+//
+// A flag is recorded as a "flag.<key>" tag on the scope of the hub of ctx,
+// attached to every later event, and as "flag.evaluation.<key>" data on the
+// span of ctx. Contexts without a hub only get the span data, as the scope of
+// sentry.CurrentHub is shared by the whole process.
+package flags
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Record records that the flag key evaluated to value.
+func Record(ctx context.Context, key string, value interface{}) {
+	formatted := format(value)
+
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetTag("flag."+key, formatted)
+	}
+
+	if span := sentry.SpanFromContext(ctx); span != nil {
+		span.SetData("flag.evaluation."+key, formatted)
+	}
+}
+
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,138 @@
+package fstracer
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/spf13/afero"
+)
+
+func NewSentryAferoFs(fs afero.Fs, opts ...SentryFSTracerOption) *AferoFs {
+	return &AferoFs{
+		Fs:     fs,
+		ctx:    context.Background(),
+		tracer: newTracer(opts...),
+	}
+}
+
+// AferoFs wraps an afero.Fs, tracing files opened or created through it. Other
+// operations are forwarded to the underlying filesystem as-is.
+type AferoFs struct {
+	afero.Fs
+	ctx    context.Context
+	tracer *tracer
+}
+
+// WithContext returns a copy of a whose files are traced as children of the
+// span of ctx.
+func (a *AferoFs) WithContext(ctx context.Context) *AferoFs {
+	copied := *a
+	copied.ctx = ctx
+	return &copied
+}
+
+// Name implements afero.Fs.
+func (a *AferoFs) Name() string {
+	return "SentryAferoFs(" + a.Fs.Name() + ")"
+}
+
+// Create implements afero.Fs.
+func (a *AferoFs) Create(name string) (afero.File, error) {
+	return a.open(name, "file.write", func() (afero.File, error) {
+		return a.Fs.Create(name)
+	})
+}
+
+// Open implements afero.Fs.
+func (a *AferoFs) Open(name string) (afero.File, error) {
+	return a.open(name, "file.read", func() (afero.File, error) {
+		return a.Fs.Open(name)
+	})
+}
+
+// OpenFile implements afero.Fs. Files opened with os.O_WRONLY or os.O_RDWR are
+// traced as written to.
+func (a *AferoFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	op := "file.read"
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		op = "file.write"
+	}
+
+	return a.open(name, op, func() (afero.File, error) {
+		return a.Fs.OpenFile(name, flag, perm)
+	})
+}
+
+func (a *AferoFs) open(name, op string, open func() (afero.File, error)) (afero.File, error) {
+	span := a.tracer.startSpan(a.ctx, op, name)
+	if span == nil {
+		return open()
+	}
+
+	file, err := open()
+	if err != nil {
+		finish(span, 0, err)
+		return nil, err
+	}
+
+	return &aferoFile{File: file, span: span, write: op == "file.write"}, nil
+}
+
+// aferoFile records the bytes read out of or written to a file, finishing its
+// span on Close.
+type aferoFile struct {
+	afero.File
+	span  *sentry.Span
+	write bool
+
+	read    atomic.Int64
+	written atomic.Int64
+}
+
+func (f *aferoFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.read.Add(int64(n))
+	return n, err
+}
+
+func (f *aferoFile) ReadAt(b []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(b, off)
+	f.read.Add(int64(n))
+	return n, err
+}
+
+func (f *aferoFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	f.written.Add(int64(n))
+	return n, err
+}
+
+func (f *aferoFile) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	f.written.Add(int64(n))
+	return n, err
+}
+
+func (f *aferoFile) WriteString(s string) (int, error) {
+	n, err := f.File.WriteString(s)
+	f.written.Add(int64(n))
+	return n, err
+}
+
+func (f *aferoFile) Close() error {
+	err := f.File.Close()
+	if f.span == nil {
+		return err
+	}
+
+	size := f.read.Load()
+	if f.write {
+		size = f.written.Load()
+	}
+	finish(f.span, size, err)
+	f.span = nil
+
+	return err
+}
@@ -0,0 +1,214 @@
+// Package fstracer provides a tracer implementation for filesystems, as an
+// io/fs.FS and an afero.Fs.
+//
+// Neither interface takes a context, so the traced filesystem has to be bound
+// to the context of the caller first.
+//
+//	fsys := fstracer.NewSentryFS(os.DirFS("/mnt/nfs/assets"))
+//
+//	data, err := fs.ReadFile(fsys.WithContext(ctx), "logo.png")
+//
+//	appFs := fstracer.NewSentryAferoFs(afero.NewOsFs(), fstracer.WithPathScrubber(scrubUserID))
+//
+//	err := afero.WriteFile(appFs.WithContext(ctx), "/var/uploads/42/avatar.png", data, 0o644)
+//
+// Files opened for reading are traced as a "file.read" span, and files opened
+// for writing as a "file.write" span, lasting until the file is closed and
+// recording the number of bytes read or written.
+package fstracer
+
+import (
+	"context"
+	"io/fs"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.file"}
+
+// SetEnabled turns the spans of file reads and writes on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryFSTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryFSTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryFSTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of files for which sampler returns false,
+// given the "file.read" or "file.write" operation and the scrubbed path.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryFSTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithPathScrubber sets a function applied to file paths before they are
+// recorded, e.g. to replace user IDs.
+func WithPathScrubber(scrubber func(path string) string) SentryFSTracerOption {
+	return func(t *tracer) {
+		t.pathScrubber = scrubber
+	}
+}
+
+type tracer struct {
+	pathScrubber func(path string) string
+	tags         map[string]string
+	spanSampler  func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryFSTracerOption) *tracer {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *tracer) startSpan(ctx context.Context, op, path string) *sentry.Span {
+	if t.pathScrubber != nil {
+		path = t.pathScrubber(path)
+	}
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, op, path)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("file.path", path)
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, size int64, err error) {
+	span.SetData("file.size", strconv.FormatInt(size, 10))
+
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+func NewSentryFS(fsys fs.FS, opts ...SentryFSTracerOption) *FS {
+	return &FS{
+		fsys:   fsys,
+		ctx:    context.Background(),
+		tracer: newTracer(opts...),
+	}
+}
+
+// FS wraps an fs.FS, tracing files opened through it.
+type FS struct {
+	fsys   fs.FS
+	ctx    context.Context
+	tracer *tracer
+}
+
+// WithContext returns a copy of f whose files are traced as children of the
+// span of ctx.
+func (f *FS) WithContext(ctx context.Context) *FS {
+	copied := *f
+	copied.ctx = ctx
+	return &copied
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	span := f.tracer.startSpan(f.ctx, "file.read", name)
+	if span == nil {
+		return f.fsys.Open(name)
+	}
+
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		finish(span, 0, err)
+		return nil, err
+	}
+
+	return &readFile{File: file, span: span}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	span := f.tracer.startSpan(f.ctx, "file.read", name)
+	if span == nil {
+		return fs.ReadFile(f.fsys, name)
+	}
+
+	data, err := fs.ReadFile(f.fsys, name)
+	finish(span, int64(len(data)), err)
+
+	return data, err
+}
+
+// Stat implements fs.StatFS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, name)
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, name)
+}
+
+// readFile records the bytes read out of a file, finishing its span on Close.
+type readFile struct {
+	fs.File
+	span *sentry.Span
+	read atomic.Int64
+}
+
+func (r *readFile) Read(b []byte) (int, error) {
+	n, err := r.File.Read(b)
+	r.read.Add(int64(n))
+
+	return n, err
+}
+
+// ReadDir implements fs.ReadDirFile, for directories to be walked.
+func (r *readFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := r.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Err: fs.ErrInvalid}
+	}
+
+	return dir.ReadDir(n)
+}
+
+func (r *readFile) Close() error {
+	err := r.File.Close()
+	if r.span != nil {
+		finish(r.span, r.read.Load(), err)
+		r.span = nil
+	}
+
+	return err
+}
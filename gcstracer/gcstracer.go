@@ -0,0 +1,256 @@
+// Package gcstracer provides a tracer implementation for the Google Cloud
+// Storage client, cloud.google.com/go/storage.
+//
+// Spans cover an object read or write from the moment the reader or writer is
+// opened until it is closed, and record the bucket, object size and generation.
+// Resumable uploads record each uploaded chunk as a breadcrumb.
+//
+//	tracer := gcstracer.NewSentryTracer()
+//
+//	writer := tracer.NewWriter(ctx, client.Bucket("my-bucket").Object("reports/2024.csv"))
+//	if _, err := io.Copy(writer, file); err != nil {
+//		writer.Close()
+//		return err
+//	}
+//	if err := writer.Close(); err != nil {
+//		return err
+//	}
+//
+//	reader, err := tracer.NewReader(ctx, client.Bucket("my-bucket").Object("reports/2024.csv"))
+//	if err != nil {
+//		return err
+//	}
+//	defer reader.Close()
+package gcstracer
+
+import (
+	"context"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.http.gcs"}
+
+// SetEnabled turns the spans of Cloud Storage operations on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryGCSTracerOption func(*Tracer)
+
+func WithTags(tags map[string]string) SentryGCSTracerOption {
+	return func(t *Tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryGCSTracerOption {
+	return func(t *Tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of operations for which sampler returns
+// false, given the operation and the "Operation bucket/object" description.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryGCSTracerOption {
+	return func(t *Tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every object name before it is
+// recorded on a span, e.g. to strip user identifiers out of the name.
+func WithKeyScrubber(scrubber func(name string) string) SentryGCSTracerOption {
+	return func(t *Tracer) {
+		t.scrubKey = scrubber
+	}
+}
+
+func NewSentryTracer(opts ...SentryGCSTracerOption) *Tracer {
+	t := &Tracer{
+		scrubKey: func(name string) string { return name },
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+type Tracer struct {
+	scrubKey    func(name string) string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (t *Tracer) startSpan(ctx context.Context, op, operation string, object *storage.ObjectHandle) *sentry.Span {
+	name := t.scrubKey(object.ObjectName())
+	description := operation + " " + object.BucketName() + "/" + name
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, op, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("gcp.gcs.bucket", object.BucketName())
+	span.SetData("gcp.gcs.object", name)
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// NewReader opens a reader on object. The span is finished once the reader is
+// closed.
+func (t *Tracer) NewReader(ctx context.Context, object *storage.ObjectHandle) (*Reader, error) {
+	span := t.startSpan(ctx, "object.get", "NewReader", object)
+	if span == nil {
+		reader, err := object.NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{Reader: reader}, nil
+	}
+
+	reader, err := object.NewReader(span.Context())
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+
+	span.SetData("gcp.gcs.object.size", strconv.FormatInt(reader.Attrs.Size, 10))
+	span.SetData("gcp.gcs.object.generation", strconv.FormatInt(reader.Attrs.Generation, 10))
+
+	return &Reader{Reader: reader, span: span}, nil
+}
+
+// Reader wraps a storage.Reader, recording the amount of bytes read.
+type Reader struct {
+	*storage.Reader
+	span *sentry.Span
+
+	bytesRead int64
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.bytesRead += int64(n)
+
+	return n, err
+}
+
+func (r *Reader) Close() error {
+	err := r.Reader.Close()
+	if r.span == nil {
+		return err
+	}
+
+	r.span.SetData("gcp.gcs.bytes_read", strconv.FormatInt(r.bytesRead, 10))
+	finish(r.span, err)
+	r.span = nil
+
+	return err
+}
+
+// NewWriter opens a writer on object. The span is finished once the writer is
+// closed, which is when the upload completes.
+func (t *Tracer) NewWriter(ctx context.Context, object *storage.ObjectHandle) *Writer {
+	span := t.startSpan(ctx, "object.put", "NewWriter", object)
+	if span == nil {
+		return &Writer{Writer: object.NewWriter(ctx)}
+	}
+
+	return &Writer{Writer: object.NewWriter(span.Context()), span: span, name: t.scrubKey(object.ObjectName())}
+}
+
+// Writer wraps a storage.Writer. Fields of the storage.Writer, such as
+// ChunkSize or ProgressFunc, must be set before the first call to Write.
+type Writer struct {
+	*storage.Writer
+	span *sentry.Span
+	name string
+
+	started bool
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if !w.started && w.span != nil {
+		w.started = true
+		w.watchProgress()
+	}
+
+	return w.Writer.Write(p)
+}
+
+// watchProgress records every chunk of a resumable upload as a breadcrumb,
+// calling the ProgressFunc set by the caller afterwards.
+func (w *Writer) watchProgress() {
+	if w.Writer.ChunkSize <= 0 {
+		return
+	}
+
+	w.span.SetData("gcp.gcs.chunk_size", strconv.Itoa(w.Writer.ChunkSize))
+
+	progressFunc := w.Writer.ProgressFunc
+	bucket, name := w.Writer.Bucket, w.name
+	chunk := 0
+
+	w.Writer.ProgressFunc = func(written int64) {
+		chunk++
+		sentry.AddBreadcrumb(&sentry.Breadcrumb{
+			Type:     "default",
+			Category: "gcs.upload",
+			Message:  "Uploaded chunk " + strconv.Itoa(chunk),
+			Data: map[string]interface{}{
+				"bucket":        bucket,
+				"object":        name,
+				"chunk":         chunk,
+				"bytes_written": written,
+			},
+			Level: sentry.LevelInfo,
+		})
+
+		if progressFunc != nil {
+			progressFunc(written)
+		}
+	}
+}
+
+func (w *Writer) Close() error {
+	err := w.Writer.Close()
+	if w.span == nil {
+		return err
+	}
+
+	if err == nil {
+		if attrs := w.Writer.Attrs(); attrs != nil {
+			w.span.SetData("gcp.gcs.object.size", strconv.FormatInt(attrs.Size, 10))
+			w.span.SetData("gcp.gcs.object.generation", strconv.FormatInt(attrs.Generation, 10))
+		}
+	}
+	finish(w.span, err)
+	w.span = nil
+
+	return err
+}
@@ -0,0 +1,146 @@
+package sentryintegration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/getsentry/sentry-go"
+)
+
+var goIntegration = config.Integration{Origin: "auto.function.go"}
+
+type GoOption func(*goroutine)
+
+// WithTransaction runs the goroutine within a new "function" transaction,
+// continuing the trace of the parent span, instead of a child span. It suits
+// background work that outlives the request that started it.
+func WithTransaction() GoOption {
+	return func(g *goroutine) {
+		g.transaction = true
+	}
+}
+
+// WithFlushTimeout sets how long to wait for events to be sent once the
+// goroutine panicked or returned an error. It defaults to 2 seconds, a zero
+// timeout disables flushing.
+func WithFlushTimeout(timeout time.Duration) GoOption {
+	return func(g *goroutine) {
+		g.flushTimeout = timeout
+	}
+}
+
+func WithGoTags(tags map[string]string) GoOption {
+	return func(g *goroutine) {
+		for k, v := range tags {
+			g.tags[k] = v
+		}
+	}
+}
+
+type goroutine struct {
+	transaction  bool
+	flushTimeout time.Duration
+	tags         map[string]string
+}
+
+// Go runs fn in a new goroutine with a clone of the hub of ctx, so scope
+// changes made by fn do not leak into the caller. fn runs within a span named
+// name, a child of the span of ctx. Panics are recovered and errors returned by
+// fn are captured as exceptions.
+//
+//	sentryintegration.Go(ctx, "send welcome email", func(ctx context.Context) error {
+//		return mailer.SendWelcome(ctx, user)
+//	})
+func Go(ctx context.Context, name string, fn func(ctx context.Context) error, opts ...GoOption) {
+	g := &goroutine{
+		flushTimeout: 2 * time.Second,
+		tags:         make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+	hub = hub.Clone()
+
+	parent := sentry.SpanFromContext(ctx)
+
+	// The goroutine must not be cancelled along with the request that started
+	// it, only its values are kept.
+	ctx = sentry.SetHubOnContext(context.WithoutCancel(ctx), hub)
+
+	go g.run(ctx, hub, parent, name, fn)
+}
+
+func (g *goroutine) run(ctx context.Context, hub *sentry.Hub, parent *sentry.Span, name string, fn func(ctx context.Context) error) {
+	// Without a parent, as SpanOrTransaction, the goroutine starts a
+	// transaction of its own.
+	var options []sentry.SpanOption
+	if g.transaction && parent != nil {
+		options = append(options, sentry.ContinueFromHeaders(parent.ToSentryTrace(), parent.ToBaggage()))
+		ctx = detachedContext{Context: ctx}
+	}
+
+	span := goIntegration.StartTransaction(ctx, nil, "function", name, options...)
+
+	// Spans may be turned off or dropped, the goroutine still has its panics
+	// and errors captured.
+	if span != nil {
+		for k, v := range g.tags {
+			span.SetTag(k, v)
+		}
+		ctx = span.Context()
+
+		var unlabel func()
+		ctx, unlabel = profiling.Label(ctx, span)
+		defer unlabel()
+	}
+
+	var err error
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			hub.RecoverWithContext(ctx, recovered)
+			err = fmt.Errorf("panic: %v", recovered)
+		} else if err != nil {
+			hub.CaptureException(err)
+		}
+
+		if span != nil {
+			if err != nil {
+				span.Status = sentry.SpanStatusInternalError
+				span.SetData("error", err.Error())
+			} else {
+				span.Status = sentry.SpanStatusOK
+			}
+			span.Finish()
+		}
+
+		if err != nil && g.flushTimeout > 0 {
+			hub.Flush(g.flushTimeout)
+		}
+	}()
+
+	err = fn(ctx)
+}
+
+// detachedContext hides the span of its parent context, so spans started out
+// of it are new transactions rather than child spans.
+type detachedContext struct {
+	context.Context
+}
+
+func (c detachedContext) Value(key any) any {
+	value := c.Context.Value(key)
+	if _, ok := value.(*sentry.Span); ok {
+		return nil
+	}
+
+	return value
+}
@@ -3,9 +3,69 @@ module github.com/aldy505/sentry-integration
 go 1.21.6
 
 require (
+	cloud.google.com/go/storage v1.36.0
+	entgo.io/ent v0.12.5
+	firebase.google.com/go/v4 v4.13.0
+	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.9.1
+	github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus v1.5.0
+	github.com/IBM/sarama v1.42.1
+	github.com/ThreeDotsLabs/watermill v1.3.5
+	github.com/allegro/bigcache/v3 v3.1.0
+	github.com/aws/aws-sdk-go-v2 v1.24.1
+	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.26.9
+	github.com/aws/aws-sdk-go-v2/service/sns v1.26.7
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.29.7
+	github.com/aws/smithy-go v1.19.0
+	github.com/bradfitz/gomemcache v0.0.0-20230905024940-24af94b03874
+	github.com/bytedance/gopkg v0.0.0-20230728082804-614d0af6619b
+	github.com/cloudwego/hertz v0.7.3
+	github.com/cloudwego/kitex v0.8.0
+	github.com/confluentinc/confluent-kafka-go/v2 v2.3.0
+	github.com/dgraph-io/ristretto v0.1.1
+	github.com/docker/docker v25.0.1+incompatible
+	github.com/eclipse/paho.golang v0.20.0
 	github.com/getsentry/sentry-go v0.27.0
+	github.com/go-kratos/kratos/v2 v2.7.2
+	github.com/go-redis/cache/v9 v9.0.0
+	github.com/go-redsync/redsync/v4 v4.11.0
+	github.com/graph-gophers/dataloader/v7 v7.1.0
+	github.com/hashicorp/consul/api v1.27.0
+	github.com/hibiken/asynq v0.24.1
+	github.com/influxdata/influxdb-client-go/v2 v2.13.0
 	github.com/jackc/pgx/v5 v5.5.3
+	github.com/kr/fs v0.1.0
+	github.com/minio/minio-go/v7 v7.0.66
+	github.com/nats-io/nats.go v1.32.0
+	github.com/neo4j/neo4j-go-driver/v5 v5.16.0
+	github.com/nsqio/go-nsq v1.1.0
+	github.com/open-feature/go-sdk v1.10.0
+	github.com/opencontainers/image-spec v1.1.0-rc5
+	github.com/opensearch-project/opensearch-go/v2 v2.3.0
+	github.com/panjf2000/ants/v2 v2.9.0
+	github.com/pkg/sftp v1.13.6
+	github.com/rabbitmq/amqp091-go v1.9.0
 	github.com/redis/go-redis/v9 v9.4.0
+	github.com/redis/rueidis v1.0.31
+	github.com/riverqueue/river v0.0.20
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/sony/gobreaker v0.5.0
+	github.com/spf13/afero v1.11.0
+	github.com/stripe/stripe-go/v76 v76.13.0
+	github.com/twilio/twilio-go v1.16.1
+	github.com/uptrace/bun v1.1.17
+	go-micro.dev/v4 v4.10.2
+	go.mongodb.org/mongo-driver v1.13.1
+	go.temporal.io/api v1.26.0
+	go.temporal.io/sdk v1.25.1
+	gocloud.dev v0.36.0
+	golang.org/x/crypto v0.17.0
+	golang.org/x/oauth2 v0.16.0
+	golang.org/x/sync v0.6.0
+	golang.org/x/time v0.5.0
+	google.golang.org/api v0.150.0
+	google.golang.org/grpc v1.59.0
+	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
+	k8s.io/client-go v0.29.1
 )
 
 require (
@@ -13,7 +73,6 @@ require (
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
-	golang.org/x/crypto v0.17.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
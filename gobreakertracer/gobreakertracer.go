@@ -0,0 +1,213 @@
+// Package gobreakertracer provides a tracer implementation for sony/gobreaker
+// circuit breakers.
+//
+//	cb := gobreakertracer.NewSentryCircuitBreaker(gobreaker.Settings{
+//		Name:    "payment-gateway",
+//		Timeout: 30 * time.Second,
+//	})
+//
+//	result, err := cb.ExecuteContext(ctx, func(ctx context.Context) (interface{}, error) {
+//		return gateway.Charge(ctx, order)
+//	})
+//
+// Every state transition is recorded as a breadcrumb, and the breaker tripping
+// open is captured as a warning message. Requests executed through
+// ExecuteContext run within a "circuitbreaker.execute" span tagged with the
+// state of the breaker.
+package gobreakertracer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+	"github.com/sony/gobreaker"
+)
+
+var integration = config.Integration{Origin: "auto.function.gobreaker"}
+
+// SetEnabled turns the spans of circuit breaker executions on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryGobreakerTracerOption func(*CircuitBreaker)
+
+func WithTags(tags map[string]string) SentryGobreakerTracerOption {
+	return func(cb *CircuitBreaker) {
+		for k, v := range tags {
+			cb.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryGobreakerTracerOption {
+	return func(cb *CircuitBreaker) {
+		cb.tags[key] = value
+	}
+}
+
+// WithSpanSampler runs requests for which sampler returns false, given the
+// "circuitbreaker.execute" operation and the name of the breaker, without a
+// span. State transitions are recorded regardless.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryGobreakerTracerOption {
+	return func(cb *CircuitBreaker) {
+		cb.spanSampler = sampler
+	}
+}
+
+// WithoutTripMessages disables capturing a message when the breaker trips
+// open, only keeping the breadcrumb.
+func WithoutTripMessages() SentryGobreakerTracerOption {
+	return func(cb *CircuitBreaker) {
+		cb.tripMessages = false
+	}
+}
+
+// NewSentryCircuitBreaker creates a gobreaker.CircuitBreaker out of settings,
+// observing its state transitions. An OnStateChange callback of settings is
+// still called.
+func NewSentryCircuitBreaker(settings gobreaker.Settings, opts ...SentryGobreakerTracerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		tripMessages: true,
+		tags:         make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(cb)
+	}
+
+	// The counts are reset by the time the state changes, keep the ones that
+	// tripped the breaker.
+	readyToTrip := settings.ReadyToTrip
+	if readyToTrip == nil {
+		readyToTrip = func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures > 5
+		}
+	}
+	settings.ReadyToTrip = func(counts gobreaker.Counts) bool {
+		if !readyToTrip(counts) {
+			return false
+		}
+
+		cb.tripCounts = counts
+		return true
+	}
+
+	onStateChange := settings.OnStateChange
+	settings.OnStateChange = func(name string, from, to gobreaker.State) {
+		cb.stateChanged(name, from, to)
+
+		if onStateChange != nil {
+			onStateChange(name, from, to)
+		}
+	}
+
+	cb.CircuitBreaker = gobreaker.NewCircuitBreaker(settings)
+
+	return cb
+}
+
+// CircuitBreaker wraps a gobreaker.CircuitBreaker. Requests executed through
+// ExecuteContext are traced, Execute is forwarded to the underlying breaker
+// as-is.
+type CircuitBreaker struct {
+	*gobreaker.CircuitBreaker
+	tripMessages bool
+	tags         map[string]string
+	spanSampler  func(operation, description string) bool
+
+	// tripCounts is only accessed under the lock of the underlying breaker.
+	tripCounts gobreaker.Counts
+}
+
+func (cb *CircuitBreaker) stateChanged(name string, from, to gobreaker.State) {
+	level := sentry.LevelInfo
+	if to == gobreaker.StateOpen {
+		level = sentry.LevelWarning
+	}
+
+	data := map[string]interface{}{
+		"name": name,
+		"from": from.String(),
+		"to":   to.String(),
+	}
+	// A half-open breaker trips on its first failure, without ReadyToTrip.
+	tripped := to == gobreaker.StateOpen && from == gobreaker.StateClosed
+	if tripped {
+		data["requests"] = cb.tripCounts.Requests
+		data["total_failures"] = cb.tripCounts.TotalFailures
+		data["consecutive_failures"] = cb.tripCounts.ConsecutiveFailures
+	}
+
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "circuitbreaker",
+		Message:  "Circuit breaker " + name + " changed from " + from.String() + " to " + to.String(),
+		Data:     data,
+		Level:    level,
+	})
+
+	if to != gobreaker.StateOpen || !cb.tripMessages {
+		return
+	}
+
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelWarning)
+		scope.SetTag("circuitbreaker.name", name)
+		scope.SetTag("circuitbreaker.from", from.String())
+		scope.SetTags(cb.tags)
+		if tripped {
+			scope.SetContext("circuitbreaker", map[string]interface{}{
+				"requests":             cb.tripCounts.Requests,
+				"total_failures":       cb.tripCounts.TotalFailures,
+				"consecutive_failures": cb.tripCounts.ConsecutiveFailures,
+			})
+		}
+
+		sentry.CaptureMessage("Circuit breaker " + name + " tripped open")
+	})
+}
+
+// ExecuteContext runs req through the breaker within a "circuitbreaker.execute"
+// span. Requests rejected by an open breaker, or for exceeding the requests
+// allowed while half-open, are recorded as such without calling req.
+func (cb *CircuitBreaker) ExecuteContext(ctx context.Context, req func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	span := integration.StartSampledSpan(ctx, cb.spanSampler, "circuitbreaker.execute", cb.Name())
+	if span == nil {
+		return cb.CircuitBreaker.Execute(func() (interface{}, error) {
+			return req(ctx)
+		})
+	}
+
+	span.SetData("circuitbreaker.name", cb.Name())
+	span.SetTag("circuitbreaker.state", cb.State().String())
+
+	for k, v := range cb.tags {
+		span.SetTag(k, v)
+	}
+
+	result, err := cb.CircuitBreaker.Execute(func() (interface{}, error) {
+		return req(span.Context())
+	})
+
+	switch {
+	case err == nil:
+		span.Status = sentry.SpanStatusOK
+	case errors.Is(err, gobreaker.ErrOpenState):
+		span.Status = sentry.SpanStatusUnavailable
+		span.SetData("error", err.Error())
+	case errors.Is(err, gobreaker.ErrTooManyRequests):
+		span.Status = sentry.SpanStatusResourceExhausted
+		span.SetData("error", err.Error())
+	default:
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	}
+
+	span.Finish()
+
+	return result, err
+}
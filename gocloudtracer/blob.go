@@ -0,0 +1,247 @@
+package gocloudtracer
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"gocloud.dev/blob"
+)
+
+// Bucket wraps a blob.Bucket. NewReader, NewRangeReader, NewWriter, ReadAll,
+// WriteAll, Attributes, Exists, Copy and Delete are traced, other methods are
+// forwarded to the underlying bucket as-is.
+type Bucket struct {
+	*blob.Bucket
+	tracer
+	name string
+}
+
+// NewSentryBucket wraps bucket, recording name as its bucket name.
+func NewSentryBucket(bucket *blob.Bucket, name string, opts ...SentryGoCloudTracerOption) *Bucket {
+	return &Bucket{
+		Bucket: bucket,
+		tracer: newTracer(opts),
+		name:   name,
+	}
+}
+
+func (b *Bucket) startSpan(ctx context.Context, op, operation, key string) *sentry.Span {
+	key = b.scrubKey(key)
+
+	span := integration.StartSampledSpan(ctx, b.spanSampler, op, operation+" "+b.name+"/"+key)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("gocloud.blob.bucket", b.name)
+	span.SetData("gocloud.blob.key", key)
+	b.setTags(span)
+
+	return span
+}
+
+// NewReader opens a reader on key. The span is finished once the reader is
+// closed.
+func (b *Bucket) NewReader(ctx context.Context, key string, opts *blob.ReaderOptions) (*Reader, error) {
+	return b.NewRangeReader(ctx, key, 0, -1, opts)
+}
+
+// NewRangeReader opens a reader on length bytes of key from offset. The span
+// is finished once the reader is closed.
+func (b *Bucket) NewRangeReader(ctx context.Context, key string, offset, length int64, opts *blob.ReaderOptions) (*Reader, error) {
+	span := b.startSpan(ctx, "object.get", "NewReader", key)
+	if span == nil {
+		reader, err := b.Bucket.NewRangeReader(ctx, key, offset, length, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{Reader: reader}, nil
+	}
+
+	reader, err := b.Bucket.NewRangeReader(span.Context(), key, offset, length, opts)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+
+	span.SetData("gocloud.blob.object_size", strconv.FormatInt(reader.Size(), 10))
+
+	return &Reader{Reader: reader, span: span}, nil
+}
+
+// Reader wraps a blob.Reader, recording the amount of bytes read.
+type Reader struct {
+	*blob.Reader
+	span *sentry.Span
+
+	bytesRead int64
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.bytesRead += int64(n)
+
+	return n, err
+}
+
+// WriteTo implements io.WriterTo, as blob.Reader does.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	n, err := r.Reader.WriteTo(w)
+	r.bytesRead += n
+
+	return n, err
+}
+
+func (r *Reader) Close() error {
+	err := r.Reader.Close()
+	if r.span == nil {
+		return err
+	}
+
+	r.span.SetData("gocloud.blob.bytes_read", strconv.FormatInt(r.bytesRead, 10))
+	finish(r.span, err)
+	r.span = nil
+
+	return err
+}
+
+// NewWriter opens a writer on key. The span is finished once the writer is
+// closed, which is when the upload completes.
+func (b *Bucket) NewWriter(ctx context.Context, key string, opts *blob.WriterOptions) (*Writer, error) {
+	span := b.startSpan(ctx, "object.put", "NewWriter", key)
+	if span == nil {
+		writer, err := b.Bucket.NewWriter(ctx, key, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &Writer{Writer: writer}, nil
+	}
+
+	writer, err := b.Bucket.NewWriter(span.Context(), key, opts)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+
+	return &Writer{Writer: writer, span: span}, nil
+}
+
+// Writer wraps a blob.Writer, recording the amount of bytes written.
+type Writer struct {
+	*blob.Writer
+	span *sentry.Span
+
+	bytesWritten int64
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.bytesWritten += int64(n)
+
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom, as blob.Writer does.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	n, err := w.Writer.ReadFrom(r)
+	w.bytesWritten += n
+
+	return n, err
+}
+
+func (w *Writer) Close() error {
+	err := w.Writer.Close()
+	if w.span == nil {
+		return err
+	}
+
+	w.span.SetData("gocloud.blob.bytes_written", strconv.FormatInt(w.bytesWritten, 10))
+	finish(w.span, err)
+	w.span = nil
+
+	return err
+}
+
+func (b *Bucket) ReadAll(ctx context.Context, key string) ([]byte, error) {
+	span := b.startSpan(ctx, "object.get", "ReadAll", key)
+	if span == nil {
+		return b.Bucket.ReadAll(ctx, key)
+	}
+
+	data, err := b.Bucket.ReadAll(span.Context(), key)
+	span.SetData("gocloud.blob.bytes_read", strconv.Itoa(len(data)))
+	finish(span, err)
+
+	return data, err
+}
+
+func (b *Bucket) WriteAll(ctx context.Context, key string, p []byte, opts *blob.WriterOptions) error {
+	span := b.startSpan(ctx, "object.put", "WriteAll", key)
+	if span == nil {
+		return b.Bucket.WriteAll(ctx, key, p, opts)
+	}
+
+	err := b.Bucket.WriteAll(span.Context(), key, p, opts)
+	span.SetData("gocloud.blob.bytes_written", strconv.Itoa(len(p)))
+	finish(span, err)
+
+	return err
+}
+
+func (b *Bucket) Attributes(ctx context.Context, key string) (*blob.Attributes, error) {
+	span := b.startSpan(ctx, "object.get", "Attributes", key)
+	if span == nil {
+		return b.Bucket.Attributes(ctx, key)
+	}
+
+	attributes, err := b.Bucket.Attributes(span.Context(), key)
+	if err == nil {
+		span.SetData("gocloud.blob.object_size", strconv.FormatInt(attributes.Size, 10))
+	}
+	finish(span, err)
+
+	return attributes, err
+}
+
+// Exists reports whether key exists. A missing key is not an error, and is
+// recorded with an ok status.
+func (b *Bucket) Exists(ctx context.Context, key string) (bool, error) {
+	span := b.startSpan(ctx, "object.get", "Exists", key)
+	if span == nil {
+		return b.Bucket.Exists(ctx, key)
+	}
+
+	exists, err := b.Bucket.Exists(span.Context(), key)
+	span.SetData("gocloud.blob.exists", strconv.FormatBool(exists))
+	finish(span, err)
+
+	return exists, err
+}
+
+func (b *Bucket) Copy(ctx context.Context, dstKey, srcKey string, opts *blob.CopyOptions) error {
+	span := b.startSpan(ctx, "object.put", "Copy", dstKey)
+	if span == nil {
+		return b.Bucket.Copy(ctx, dstKey, srcKey, opts)
+	}
+
+	span.SetData("gocloud.blob.source_key", b.scrubKey(srcKey))
+
+	err := b.Bucket.Copy(span.Context(), dstKey, srcKey, opts)
+	finish(span, err)
+
+	return err
+}
+
+func (b *Bucket) Delete(ctx context.Context, key string) error {
+	span := b.startSpan(ctx, "object.delete", "Delete", key)
+	if span == nil {
+		return b.Bucket.Delete(ctx, key)
+	}
+
+	err := b.Bucket.Delete(span.Context(), key)
+	finish(span, err)
+
+	return err
+}
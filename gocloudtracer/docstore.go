@@ -0,0 +1,236 @@
+package gocloudtracer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"gocloud.dev/docstore"
+)
+
+// Collection wraps a docstore.Collection. Single document actions, action
+// lists and queries are traced, other methods are forwarded to the underlying
+// collection as-is.
+type Collection struct {
+	*docstore.Collection
+	tracer
+	name string
+}
+
+// NewSentryCollection wraps collection, recording name as its collection name.
+func NewSentryCollection(collection *docstore.Collection, name string, opts ...SentryGoCloudTracerOption) *Collection {
+	return &Collection{
+		Collection: collection,
+		tracer:     newTracer(opts),
+		name:       name,
+	}
+}
+
+func (c *Collection) startSpan(ctx context.Context, operation string) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, c.spanSampler, "db", operation+" "+c.name)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", "docstore")
+	span.SetData(semconv.DBOperation.Key(), operation)
+	span.SetData("db.collection.name", c.name)
+	c.setTags(span)
+
+	return span
+}
+
+// do runs action within a span of operation.
+func (c *Collection) do(ctx context.Context, operation string, action func(ctx context.Context) error) error {
+	span := c.startSpan(ctx, operation)
+	if span == nil {
+		return action(ctx)
+	}
+
+	err := action(span.Context())
+	finish(span, err)
+
+	return err
+}
+
+func (c *Collection) Get(ctx context.Context, doc docstore.Document, fps ...docstore.FieldPath) error {
+	return c.do(ctx, "Get", func(ctx context.Context) error {
+		return c.Collection.Get(ctx, doc, fps...)
+	})
+}
+
+func (c *Collection) Create(ctx context.Context, doc docstore.Document) error {
+	return c.do(ctx, "Create", func(ctx context.Context) error {
+		return c.Collection.Create(ctx, doc)
+	})
+}
+
+func (c *Collection) Put(ctx context.Context, doc docstore.Document) error {
+	return c.do(ctx, "Put", func(ctx context.Context) error {
+		return c.Collection.Put(ctx, doc)
+	})
+}
+
+func (c *Collection) Replace(ctx context.Context, doc docstore.Document) error {
+	return c.do(ctx, "Replace", func(ctx context.Context) error {
+		return c.Collection.Replace(ctx, doc)
+	})
+}
+
+func (c *Collection) Update(ctx context.Context, doc docstore.Document, mods docstore.Mods) error {
+	return c.do(ctx, "Update", func(ctx context.Context) error {
+		return c.Collection.Update(ctx, doc, mods)
+	})
+}
+
+func (c *Collection) Delete(ctx context.Context, doc docstore.Document) error {
+	return c.do(ctx, "Delete", func(ctx context.Context) error {
+		return c.Collection.Delete(ctx, doc)
+	})
+}
+
+// Actions returns an action list which Do is traced as a single "Actions"
+// span, recording the number of actions.
+func (c *Collection) Actions() *ActionList {
+	return &ActionList{list: c.Collection.Actions(), collection: c}
+}
+
+// ActionList wraps a docstore.ActionList.
+type ActionList struct {
+	list       *docstore.ActionList
+	collection *Collection
+	actions    int
+}
+
+// add counts an action appended to the list.
+func (l *ActionList) add() *ActionList {
+	l.actions++
+	return l
+}
+
+func (l *ActionList) Get(doc docstore.Document, fps ...docstore.FieldPath) *ActionList {
+	l.list.Get(doc, fps...)
+	return l.add()
+}
+
+func (l *ActionList) Create(doc docstore.Document) *ActionList {
+	l.list.Create(doc)
+	return l.add()
+}
+
+func (l *ActionList) Put(doc docstore.Document) *ActionList {
+	l.list.Put(doc)
+	return l.add()
+}
+
+func (l *ActionList) Replace(doc docstore.Document) *ActionList {
+	l.list.Replace(doc)
+	return l.add()
+}
+
+func (l *ActionList) Update(doc docstore.Document, mods docstore.Mods) *ActionList {
+	l.list.Update(doc, mods)
+	return l.add()
+}
+
+func (l *ActionList) Delete(doc docstore.Document) *ActionList {
+	l.list.Delete(doc)
+	return l.add()
+}
+
+// Do runs the actions of the list, see docstore.ActionList.Do.
+func (l *ActionList) Do(ctx context.Context) error {
+	span := l.collection.startSpan(ctx, "Actions")
+	if span == nil {
+		return l.list.Do(ctx)
+	}
+
+	span.SetData("db.docstore.action_count", strconv.Itoa(l.actions))
+
+	err := l.list.Do(span.Context())
+	finish(span, err)
+
+	return err
+}
+
+// Query returns a query which Get is traced as a "Query" span, lasting until
+// its iterator is exhausted or stopped.
+func (c *Collection) Query() *Query {
+	return &Query{query: c.Collection.Query(), collection: c}
+}
+
+// Query wraps a docstore.Query.
+type Query struct {
+	query      *docstore.Query
+	collection *Collection
+}
+
+func (q *Query) Where(fp docstore.FieldPath, op string, value interface{}) *Query {
+	q.query.Where(fp, op, value)
+	return q
+}
+
+func (q *Query) Limit(n int) *Query {
+	q.query.Limit(n)
+	return q
+}
+
+func (q *Query) OrderBy(field, direction string) *Query {
+	q.query.OrderBy(field, direction)
+	return q
+}
+
+func (q *Query) Plan(fps ...docstore.FieldPath) (string, error) {
+	return q.query.Plan(fps...)
+}
+
+// Get runs the query, see docstore.Query.Get.
+func (q *Query) Get(ctx context.Context, fps ...docstore.FieldPath) *DocumentIterator {
+	span := q.collection.startSpan(ctx, "Query")
+	if span == nil {
+		return &DocumentIterator{DocumentIterator: q.query.Get(ctx, fps...)}
+	}
+
+	return &DocumentIterator{DocumentIterator: q.query.Get(span.Context(), fps...), span: span}
+}
+
+// DocumentIterator wraps a docstore.DocumentIterator, recording the number of
+// documents returned.
+type DocumentIterator struct {
+	*docstore.DocumentIterator
+	span *sentry.Span
+
+	documents int
+}
+
+func (it *DocumentIterator) Next(ctx context.Context, dst docstore.Document) error {
+	err := it.DocumentIterator.Next(ctx, dst)
+	switch {
+	case err == nil:
+		it.documents++
+	case errors.Is(err, io.EOF):
+		it.finish(nil)
+	default:
+		it.finish(err)
+	}
+
+	return err
+}
+
+func (it *DocumentIterator) Stop() {
+	it.DocumentIterator.Stop()
+	it.finish(nil)
+}
+
+func (it *DocumentIterator) finish(err error) {
+	if it.span == nil {
+		return
+	}
+
+	it.span.SetData("db.docstore.document_count", strconv.Itoa(it.documents))
+	finish(it.span, err)
+	it.span = nil
+}
@@ -0,0 +1,167 @@
+// Package gocloudtracer provides a tracer implementation for the portable
+// APIs of gocloud.dev: blob, pubsub and docstore, whichever the provider
+// behind them.
+//
+//	b, err := blob.OpenBucket(ctx, "s3://assets?region=eu-west-1")
+//	if err != nil {
+//		return err
+//	}
+//	bucket := gocloudtracer.NewSentryBucket(b, "assets")
+//
+//	data, err := bucket.ReadAll(ctx, "logo.png")
+//
+//	t, err := pubsub.OpenTopic(ctx, "gcppubsub://projects/acme/topics/orders")
+//	if err != nil {
+//		return err
+//	}
+//	topic := gocloudtracer.NewSentryTopic(t, "orders")
+//
+//	err = topic.Send(ctx, &pubsub.Message{Body: body})
+//
+//	s, err := pubsub.OpenSubscription(ctx, "gcppubsub://projects/acme/subscriptions/orders")
+//	if err != nil {
+//		return err
+//	}
+//	subscription := gocloudtracer.NewSentrySubscription(s, "orders")
+//
+//	message, err := subscription.Receive(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	err = processOrder(message.Context(), message.Body)
+//	message.Ack()
+//
+//	c, err := docstore.OpenCollection(ctx, "mongo://shop/customers?id_field=id")
+//	if err != nil {
+//		return err
+//	}
+//	customers := gocloudtracer.NewSentryCollection(c, "customers")
+//
+//	err = customers.Get(ctx, &customer)
+//
+// Providers only hand out the portable types, so those are wrapped rather
+// than the drivers underneath. Buckets, topics, subscriptions and collections
+// do not expose their name, which is given when wrapping them instead.
+//
+// Blob operations are "object.get", "object.put" and "object.delete" spans,
+// readers and writers lasting until they are closed. Sent messages are
+// "queue.publish" spans, which trace context is carried in the message
+// metadata, and received messages "queue.process" transactions continuing it,
+// finished once the message is acknowledged. Docstore actions are "db" spans.
+// Error codes of gocloud.dev, see gcerrors, are recorded as span statuses.
+package gocloudtracer
+
+import (
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+	"gocloud.dev/gcerrors"
+)
+
+var integration = config.Integration{Origin: "auto.gocloud"}
+
+// SetEnabled turns the spans of gocloud.dev operations on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryGoCloudTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryGoCloudTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryGoCloudTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans for which sampler returns false, given the
+// operation and the description, e.g. "ReadAll assets/logo.png", "orders" or
+// "Get customers".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryGoCloudTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every blob key before it is
+// recorded on a span, e.g. to strip user identifiers out of the key.
+func WithKeyScrubber(scrubber func(key string) string) SentryGoCloudTracerOption {
+	return func(t *tracer) {
+		t.scrubKey = scrubber
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+	scrubKey    func(key string) string
+}
+
+func newTracer(opts []SentryGoCloudTracerOption) tracer {
+	t := tracer{
+		tags:     make(map[string]string),
+		scrubKey: func(key string) string { return key },
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// finish sets the status of span after err, then finishes it.
+func finish(span *sentry.Span, err error) {
+	span.Status = status(err)
+	if err != nil {
+		span.SetData("error", err.Error())
+		span.SetData("gocloud.error_code", gcerrors.Code(err).String())
+	}
+
+	span.Finish()
+}
+
+// status returns the span status of the gcerrors code of err.
+func status(err error) sentry.SpanStatus {
+	if err == nil {
+		return sentry.SpanStatusOK
+	}
+
+	switch gcerrors.Code(err) {
+	case gcerrors.NotFound:
+		return sentry.SpanStatusNotFound
+	case gcerrors.AlreadyExists:
+		return sentry.SpanStatusAlreadyExists
+	case gcerrors.InvalidArgument:
+		return sentry.SpanStatusInvalidArgument
+	case gcerrors.Internal:
+		return sentry.SpanStatusInternalError
+	case gcerrors.Unimplemented:
+		return sentry.SpanStatusUnimplemented
+	case gcerrors.FailedPrecondition:
+		return sentry.SpanStatusFailedPrecondition
+	case gcerrors.PermissionDenied:
+		return sentry.SpanStatusPermissionDenied
+	case gcerrors.ResourceExhausted:
+		return sentry.SpanStatusResourceExhausted
+	case gcerrors.Canceled:
+		return sentry.SpanStatusCanceled
+	case gcerrors.DeadlineExceeded:
+		return sentry.SpanStatusDeadlineExceeded
+	default:
+		return sentry.SpanStatusUnknown
+	}
+}
@@ -0,0 +1,136 @@
+package gocloudtracer
+
+import (
+	"context"
+
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"gocloud.dev/pubsub"
+)
+
+// Topic wraps a pubsub.Topic, sending messages within a "queue.publish" span.
+type Topic struct {
+	*pubsub.Topic
+	tracer
+	name string
+}
+
+// NewSentryTopic wraps topic, recording name as its destination name.
+func NewSentryTopic(topic *pubsub.Topic, name string, opts ...SentryGoCloudTracerOption) *Topic {
+	return &Topic{
+		Topic:  topic,
+		tracer: newTracer(opts),
+		name:   name,
+	}
+}
+
+// Send sends message, with the trace context of its span set on its metadata.
+func (t *Topic) Send(ctx context.Context, message *pubsub.Message) error {
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "queue.publish", t.name)
+	if span == nil {
+		return t.Topic.Send(ctx, message)
+	}
+
+	span.SetData("messaging.system", "gocloud")
+	span.SetData(semconv.MessagingDestinationName.Key(), t.name)
+	messaging.SetBodySize(span, len(message.Body))
+	t.setTags(span)
+
+	if message.Metadata == nil {
+		message.Metadata = make(map[string]string)
+	}
+	propagation.Inject(span, propagation.MapCarrier(message.Metadata))
+
+	err := t.Topic.Send(span.Context(), message)
+	if err == nil && message.LoggableID != "" {
+		span.SetData(semconv.MessagingMessageID.Key(), message.LoggableID)
+	}
+	finish(span, err)
+
+	return err
+}
+
+// Subscription wraps a pubsub.Subscription, receiving every message within a
+// "queue.process" transaction.
+type Subscription struct {
+	*pubsub.Subscription
+	tracer
+	name string
+}
+
+// NewSentrySubscription wraps subscription, recording name as its destination
+// name.
+func NewSentrySubscription(subscription *pubsub.Subscription, name string, opts ...SentryGoCloudTracerOption) *Subscription {
+	return &Subscription{
+		Subscription: subscription,
+		tracer:       newTracer(opts),
+		name:         name,
+	}
+}
+
+// Receive receives a message, starting its "queue.process" transaction,
+// continued from the trace context of its metadata. The transaction is
+// finished once the message is acknowledged or not.
+func (s *Subscription) Receive(ctx context.Context) (*Message, error) {
+	message, err := s.Subscription.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier(message.Metadata))
+
+	span := integration.StartTransaction(ctx, s.spanSampler, "queue.process", s.name, continueTrace)
+	if span == nil {
+		return &Message{Message: message, ctx: ctx}, nil
+	}
+
+	span.SetData("messaging.system", "gocloud")
+	span.SetData(semconv.MessagingDestinationName.Key(), s.name)
+	messaging.SetBodySize(span, len(message.Body))
+	if message.LoggableID != "" {
+		span.SetData(semconv.MessagingMessageID.Key(), message.LoggableID)
+	}
+	s.setTags(span)
+
+	return &Message{Message: message, ctx: span.Context(), span: span}, nil
+}
+
+// Message wraps a received pubsub.Message, which transaction is finished by
+// Ack or Nack.
+type Message struct {
+	*pubsub.Message
+	ctx  context.Context
+	span *sentry.Span
+}
+
+// Context returns the context carrying the transaction of the message, with a
+// clone of the hub bound to it.
+func (m *Message) Context() context.Context {
+	return m.ctx
+}
+
+// Ack acknowledges the message, finishing its transaction with an ok status.
+func (m *Message) Ack() {
+	m.Message.Ack()
+	m.finish("ack", sentry.SpanStatusOK)
+}
+
+// Nack negatively acknowledges the message, finishing its transaction with an
+// aborted status.
+func (m *Message) Nack() {
+	m.Message.Nack()
+	m.finish("nack", sentry.SpanStatusAborted)
+}
+
+func (m *Message) finish(outcome string, status sentry.SpanStatus) {
+	if m.span == nil {
+		return
+	}
+
+	m.span.SetData("messaging.gocloud.outcome", outcome)
+	m.span.Status = status
+	m.span.Finish()
+	m.span = nil
+}
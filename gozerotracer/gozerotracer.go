@@ -0,0 +1,254 @@
+// Package gozerotracer provides rest middleware and zrpc interceptors for
+// go-zero, whose own telemetry assumes OpenTelemetry.
+//
+//	server := rest.MustNewServer(c.RestConf)
+//	server.Use(gozerotracer.RestMiddleware())
+//
+//	rpcServer := zrpc.MustNewServer(c.RpcServerConf, register)
+//	rpcServer.AddUnaryInterceptors(gozerotracer.UnaryServerInterceptor())
+//	rpcServer.AddStreamInterceptors(gozerotracer.StreamServerInterceptor())
+//
+// Every request is a "http.server" or "grpc.server" transaction, continued
+// from the trace context of the request headers or metadata, with a clone of
+// the hub bound to its context. Panics are captured, then raised again for
+// the recovery of go-zero to answer the request.
+package gozerotracer
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/internal/grpcstatus"
+	"github.com/aldy505/sentry-integration/internal/httpwriter"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var integration = config.Integration{Origin: "auto.http.go_zero"}
+
+// SetEnabled turns the transactions of go-zero requests on or off at runtime,
+// running them untraced while off. Hubs are bound and panics captured
+// regardless.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryGoZeroTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryGoZeroTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryGoZeroTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the transactions of requests for which sampler
+// returns false, given the operation and the description, e.g. "GET /health"
+// or "/health.v1.Health/Check".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryGoZeroTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithRouteSampler samples the transactions of requests and calls not
+// continuing a sampled trace at the rate sampler returns, e.g. 0 for health
+// checks and 1 for checkouts, instead of the sample rate of the client. It is
+// given the path or full method, the HTTP method of requests, and the headers
+// or metadata.
+func WithRouteSampler(sampler config.RouteSampler) SentryGoZeroTracerOption {
+	return func(t *tracer) {
+		t.routeSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags         map[string]string
+	spanSampler  func(operation, description string) bool
+	routeSampler config.RouteSampler
+}
+
+func newTracer(opts []SentryGoZeroTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// recoverPanic captures a panic of a request on hub, then raises it again.
+func (t tracer) recoverPanic(ctx context.Context, hub *sentry.Hub, span *sentry.Span) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	if span != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.Finish()
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(t.tags)
+		hub.RecoverWithContext(ctx, recovered)
+	})
+
+	panic(recovered)
+}
+
+// RestMiddleware returns a go-zero rest middleware, passed to Server.Use,
+// handling every request within a "http.server" transaction.
+func RestMiddleware(opts ...SentryGoZeroTracerOption) func(next http.HandlerFunc) http.HandlerFunc {
+	t := newTracer(opts)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, continueTrace := propagation.Continue(r.Context(), propagation.HeaderCarrier(r.Header))
+			hub := sentry.GetHubFromContext(ctx)
+			hub.Scope().SetRequest(r)
+
+			description := r.Method + " " + r.URL.Path
+			span := integration.StartTransaction(ctx, t.spanSampler, "http.server", description,
+				continueTrace, config.SampleRoute(t.routeSampler, r.URL.Path, r.Method, r.Header),
+				sentry.WithTransactionSource(sentry.SourceURL))
+			if span == nil {
+				defer t.recoverPanic(ctx, hub, nil)
+				next(w, r.WithContext(ctx))
+				return
+			}
+			defer t.recoverPanic(span.Context(), hub, span)
+
+			span.SetData(semconv.HTTPRequestMethod.Key(), r.Method)
+			t.setTags(span)
+
+			statusCode := http.StatusOK
+			writer := &httpwriter.ResponseWriter{
+				ResponseWriter:    w,
+				BeforeWriteHeader: func(code int) { statusCode = code },
+			}
+			next(writer, r.WithContext(span.Context()))
+
+			span.Status = sentry.HTTPtoSpanStatus(statusCode)
+			span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(statusCode))
+			span.Finish()
+		}
+	}
+}
+
+// metadataCarrier is a propagation.Carrier over incoming gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// startRPC starts the "grpc.server" transaction of a call to method.
+func (t tracer) startRPC(ctx context.Context, method string) (context.Context, *sentry.Hub, *sentry.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, continueTrace := propagation.Continue(ctx, metadataCarrier(md))
+	hub := sentry.GetHubFromContext(ctx)
+
+	span := integration.StartTransaction(ctx, t.spanSampler, "grpc.server", method,
+		continueTrace, config.SampleRoute(t.routeSampler, method, "", metadataCarrier(md)),
+		sentry.WithTransactionSource(sentry.SourceRoute))
+	if span == nil {
+		return ctx, hub, nil
+	}
+
+	span.SetData("rpc.system", "grpc")
+	t.setTags(span)
+
+	return span.Context(), hub, span
+}
+
+// finishRPC sets the status of span after err, as the span statuses mirror
+// the gRPC codes.
+func finishRPC(span *sentry.Span, err error) {
+	code := status.Code(err)
+	span.SetData("rpc.grpc.status_code", code.String())
+	span.Status = grpcstatus.SpanStatus(code)
+
+	if err != nil {
+		span.SetData("error", err.Error())
+	}
+
+	span.Finish()
+}
+
+// UnaryServerInterceptor returns a zrpc interceptor handling every unary call
+// within a "grpc.server" transaction.
+func UnaryServerInterceptor(opts ...SentryGoZeroTracerOption) grpc.UnaryServerInterceptor {
+	t := newTracer(opts)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, hub, span := t.startRPC(ctx, info.FullMethod)
+		defer t.recoverPanic(ctx, hub, span)
+
+		resp, err := handler(ctx, req)
+		if span != nil {
+			finishRPC(span, err)
+		}
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a zrpc interceptor handling every stream
+// within a "grpc.server" transaction.
+func StreamServerInterceptor(opts ...SentryGoZeroTracerOption) grpc.StreamServerInterceptor {
+	t := newTracer(opts)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, hub, span := t.startRPC(ss.Context(), info.FullMethod)
+		defer t.recoverPanic(ctx, hub, span)
+
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		if span != nil {
+			finishRPC(span, err)
+		}
+
+		return err
+	}
+}
+
+// serverStream is ss with the context carrying the transaction.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,224 @@
+// Package grpcgatewaytracer connects the traces of REST requests served by
+// grpc-gateway to the gRPC calls the gateway makes, so a request crossing the
+// gateway is a single trace.
+//
+// The span started by the HTTP server middleware, such as sentryhttp, is
+// handed to the gRPC calls as metadata by Annotator, and each call is a
+// "grpc.client" span by UnaryClientInterceptor:
+//
+//	mux := runtime.NewServeMux(runtime.WithMetadata(grpcgatewaytracer.Annotator))
+//
+//	conn, err := grpc.Dial(endpoint,
+//		grpc.WithTransportCredentials(insecure.NewCredentials()),
+//		grpc.WithChainUnaryInterceptor(grpcgatewaytracer.UnaryClientInterceptor()),
+//		grpc.WithChainStreamInterceptor(grpcgatewaytracer.StreamClientInterceptor()))
+//	if err != nil {
+//		return err
+//	}
+//
+//	handler := sentryhttp.New(sentryhttp.Options{}).Handle(mux)
+//
+// gRPC servers continue the trace out of the incoming metadata through
+// propagation.Continue:
+//
+//	md, _ := metadata.FromIncomingContext(ctx)
+//	ctx, continueTrace := propagation.Continue(ctx, grpcgatewaytracer.MetadataCarrier(md))
+package grpcgatewaytracer
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/internal/grpcstatus"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/getsentry/sentry-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var integration = config.Integration{Origin: "auto.grpc.grpc_gateway"}
+
+// SetEnabled turns the spans of gRPC calls on or off at runtime, running them
+// untraced while off. Annotator propagates the trace regardless.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+// MetadataCarrier is a propagation.Carrier over gRPC metadata, which keys are
+// lowercased.
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (c MetadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Annotator is a grpc-gateway metadata annotator, passed to
+// runtime.WithMetadata, handing the trace context of the span of ctx to the
+// gRPC calls made for request. Without a span, the trace context of the
+// request headers is handed over as-is, so the trace is still connected when
+// the gateway itself is not traced.
+func Annotator(ctx context.Context, request *http.Request) metadata.MD {
+	md := metadata.MD{}
+
+	if span := sentry.SpanFromContext(ctx); span != nil {
+		propagation.Inject(span, MetadataCarrier(md))
+		return md
+	}
+
+	for _, key := range []string{sentry.SentryTraceHeader, sentry.SentryBaggageHeader} {
+		if value := request.Header.Get(key); value != "" {
+			md.Set(key, value)
+		}
+	}
+
+	return md
+}
+
+type SentryGrpcGatewayTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryGrpcGatewayTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryGrpcGatewayTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the "grpc.client" operation and the full method, e.g.
+// "/grpc.health.v1.Health/Check".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryGrpcGatewayTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts []SentryGrpcGatewayTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+// startSpan starts the "grpc.client" span of a call to method, returning the
+// context of the call carrying the trace context of the span, replacing the
+// one set by Annotator.
+func (t tracer) startSpan(ctx context.Context, method string) (context.Context, *sentry.Span) {
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "grpc.client", method)
+	if span == nil {
+		return ctx, nil
+	}
+
+	span.SetData("rpc.system", "grpc")
+	if service, name, ok := splitMethod(method); ok {
+		span.SetData("rpc.service", service)
+		span.SetData("rpc.method", name)
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	propagation.Inject(span, MetadataCarrier(md))
+
+	return metadata.NewOutgoingContext(span.Context(), md), span
+}
+
+// UnaryClientInterceptor creates a "grpc.client" span for every unary call,
+// propagating its trace context through the metadata of the call.
+func UnaryClientInterceptor(opts ...SentryGrpcGatewayTracerOption) grpc.UnaryClientInterceptor {
+	t := newTracer(opts)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		ctx, span := t.startSpan(ctx, method)
+		if span == nil {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		defer span.Finish()
+
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		finish(span, err)
+
+		return err
+	}
+}
+
+// StreamClientInterceptor creates a "grpc.client" span for every streaming
+// call, lasting until the stream is set up. Messages sent and received
+// afterwards are not part of the span.
+func StreamClientInterceptor(opts ...SentryGrpcGatewayTracerOption) grpc.StreamClientInterceptor {
+	t := newTracer(opts)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := t.startSpan(ctx, method)
+		if span == nil {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+		defer span.Finish()
+
+		stream, err := streamer(ctx, desc, cc, method, callOpts...)
+		finish(span, err)
+
+		return stream, err
+	}
+}
+
+// finish sets the status of span after the status code of err, as the span
+// statuses mirror the gRPC codes.
+func finish(span *sentry.Span, err error) {
+	code := status.Code(err)
+	span.SetData("rpc.grpc.status_code", code.String())
+
+	span.Status = grpcstatus.SpanStatus(code)
+
+	if err != nil {
+		span.SetData("error", err.Error())
+	}
+}
+
+// splitMethod splits a full method, "/package.Service/Method", into its
+// service and method.
+func splitMethod(fullMethod string) (string, string, bool) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+
+	i := strings.LastIndex(fullMethod, "/")
+	if i < 0 {
+		return "", "", false
+	}
+
+	return fullMethod[:i], fullMethod[i+1:], true
+}
@@ -0,0 +1,234 @@
+// Package grpcrecovery provides gRPC server interceptors recovering panics and
+// capturing errors of selected status codes as Sentry exceptions. They create
+// no span, so they compose with any tracing interceptor.
+//
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(
+//			otelgrpc.UnaryServerInterceptor(),
+//			grpcrecovery.UnaryServerInterceptor(),
+//		),
+//		grpc.ChainStreamInterceptor(
+//			grpcrecovery.StreamServerInterceptor(),
+//		),
+//	)
+//
+// Captured exceptions carry the full method, the peer and the request
+// metadata, without the values of sensitive keys.
+package grpcrecovery
+
+import (
+	"context"
+	"strings"
+
+	sentryintegration "github.com/aldy505/sentry-integration"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/getsentry/sentry-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// defaultCodes are the status codes of the errors captured by default, which
+// denote a fault of the server rather than of the request.
+var defaultCodes = []codes.Code{codes.Unknown, codes.Internal, codes.DataLoss}
+
+// sensitiveMetadata are the metadata keys which values are never sent.
+var sensitiveMetadata = []string{"authorization", "cookie", "x-api-key"}
+
+type SentryGrpcRecoveryOption func(*recoverer)
+
+func WithTags(tags map[string]string) SentryGrpcRecoveryOption {
+	return func(r *recoverer) {
+		for k, v := range tags {
+			r.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryGrpcRecoveryOption {
+	return func(r *recoverer) {
+		r.tags[key] = value
+	}
+}
+
+// WithCapturedCodes replaces the status codes of the returned errors that are
+// captured, codes.Unknown, codes.Internal and codes.DataLoss by default.
+// Errors without a status are of codes.Unknown.
+func WithCapturedCodes(captured ...codes.Code) SentryGrpcRecoveryOption {
+	return func(r *recoverer) {
+		r.codes = make(map[codes.Code]struct{}, len(captured))
+		for _, code := range captured {
+			r.codes[code] = struct{}{}
+		}
+	}
+}
+
+// WithRepanic panics again once a panic is captured, e.g. for an outer
+// recovery interceptor to handle it, instead of returning a codes.Internal
+// error.
+func WithRepanic() SentryGrpcRecoveryOption {
+	return func(r *recoverer) {
+		r.repanic = true
+	}
+}
+
+type recoverer struct {
+	tags    map[string]string
+	codes   map[codes.Code]struct{}
+	repanic bool
+}
+
+func newRecoverer(opts ...SentryGrpcRecoveryOption) *recoverer {
+	r := &recoverer{
+		tags:  make(map[string]string),
+		codes: make(map[codes.Code]struct{}, len(defaultCodes)),
+	}
+	for _, code := range defaultCodes {
+		r.codes[code] = struct{}{}
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// UnaryServerInterceptor returns an interceptor recovering panics of unary
+// handlers and capturing the errors they return with a captured status code.
+func UnaryServerInterceptor(opts ...SentryGrpcRecoveryOption) grpc.UnaryServerInterceptor {
+	r := newRecoverer(opts...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx, hub := sentryintegration.EnsureHub(ctx)
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = r.recover(ctx, hub, info.FullMethod, recovered)
+			}
+		}()
+
+		resp, err = handler(ctx, req)
+		r.capture(ctx, hub, info.FullMethod, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor recovering panics of stream
+// handlers and capturing the errors they return with a captured status code.
+func StreamServerInterceptor(opts ...SentryGrpcRecoveryOption) grpc.StreamServerInterceptor {
+	r := newRecoverer(opts...)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx, hub := sentryintegration.EnsureHub(ss.Context())
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = r.recover(ctx, hub, info.FullMethod, recovered)
+			}
+		}()
+
+		err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		r.capture(ctx, hub, info.FullMethod, err)
+
+		return err
+	}
+}
+
+// serverStream is ss with the context carrying the hub.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// recover captures recovered, and returns the error answered to the client
+// unless repanicking.
+func (r *recoverer) recover(ctx context.Context, hub *sentry.Hub, method string, recovered interface{}) error {
+	hub.WithScope(func(scope *sentry.Scope) {
+		r.configureScope(ctx, scope, method, codes.Internal)
+		hub.RecoverWithContext(ctx, recovered)
+	})
+
+	if r.repanic {
+		panic(recovered)
+	}
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// capture captures err when its status code is a captured one.
+func (r *recoverer) capture(ctx context.Context, hub *sentry.Hub, method string, err error) {
+	if err == nil {
+		return
+	}
+
+	code := status.Code(err)
+	if _, ok := r.codes[code]; !ok {
+		return
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		r.configureScope(ctx, scope, method, code)
+		hub.CaptureException(err)
+	})
+}
+
+func (r *recoverer) configureScope(ctx context.Context, scope *sentry.Scope, method string, code codes.Code) {
+	scope.SetTag("grpc.method", method)
+	scope.SetTag("grpc.status_code", code.String())
+	for k, v := range r.tags {
+		scope.SetTag(k, v)
+	}
+
+	request := sentry.Context{
+		"method": method,
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if p.Addr != nil {
+			request["peer.address"] = p.Addr.String()
+		}
+		if p.AuthInfo != nil {
+			request["peer.auth_type"] = p.AuthInfo.AuthType()
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok && !config.Get().OmitPII {
+		request["metadata"] = scrubMetadata(md)
+	}
+
+	scope.SetContext("grpc", request)
+}
+
+// scrubMetadata flattens md, replacing the values of sensitive keys.
+func scrubMetadata(md metadata.MD) map[string]string {
+	scrubbed := make(map[string]string, len(md))
+	for key, values := range md {
+		if isSensitive(key) {
+			scrubbed[key] = scrub.Filtered
+			continue
+		}
+
+		scrubbed[key] = scrub.String(strings.Join(values, ", "))
+	}
+
+	return scrubbed
+}
+
+func isSensitive(key string) bool {
+	for _, sensitive := range sensitiveMetadata {
+		if key == sensitive {
+			return true
+		}
+	}
+
+	return scrub.IsSensitiveKey(key)
+}
@@ -0,0 +1,127 @@
+// Package hertztracer provides a server middleware for CloudWeGo Hertz.
+//
+//	h := server.Default()
+//	h.Use(hertztracer.NewSentryMiddleware())
+//
+// Every request is a "http.server" transaction named after its route, e.g.
+// "GET /users/:id", continued from the trace context of the request headers,
+// with a clone of the hub bound to the context handed to the handlers.
+package hertztracer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.http.hertz"}
+
+// SetEnabled turns the transactions of Hertz requests on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryHertzTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryHertzTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryHertzTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the transactions of requests for which sampler
+// returns false, given the "http.server" operation and the transaction name,
+// e.g. "GET /health".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryHertzTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithRouteSampler samples the transactions of requests not continuing a
+// sampled trace at the rate sampler returns, given the route, e.g.
+// "/users/:id", the method and the headers of requests, instead of the sample
+// rate of the client.
+func WithRouteSampler(sampler config.RouteSampler) SentryHertzTracerOption {
+	return func(t *tracer) {
+		t.routeSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags         map[string]string
+	spanSampler  func(operation, description string) bool
+	routeSampler config.RouteSampler
+}
+
+// headerCarrier is a propagation.Carrier over the headers of a Hertz request.
+type headerCarrier struct {
+	rc *app.RequestContext
+}
+
+func (c headerCarrier) Get(key string) string {
+	return string(c.rc.Request.Header.Peek(key))
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c.rc.Request.Header.Set(key, value)
+}
+
+// NewSentryMiddleware returns a middleware handling every request within a
+// "http.server" transaction.
+func NewSentryMiddleware(opts ...SentryHertzTracerOption) app.HandlerFunc {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return func(c context.Context, rc *app.RequestContext) {
+		c, continueTrace := propagation.Continue(c, headerCarrier{rc: rc})
+
+		method := string(rc.Method())
+		route, source := rc.FullPath(), sentry.SourceRoute
+		if route == "" {
+			route, source = string(rc.Path()), sentry.SourceURL
+		}
+
+		span := integration.StartTransaction(c, t.spanSampler, "http.server", method+" "+route,
+			continueTrace, config.SampleRoute(t.routeSampler, route, method, headerCarrier{rc: rc}),
+			sentry.WithTransactionSource(source))
+		if span == nil {
+			rc.Next(c)
+			return
+		}
+		defer span.Finish()
+
+		span.SetData(semconv.HTTPRequestMethod.Key(), method)
+		for k, v := range t.tags {
+			span.SetTag(k, v)
+		}
+
+		rc.Next(span.Context())
+
+		statusCode := rc.Response.StatusCode()
+		span.Status = sentry.HTTPtoSpanStatus(statusCode)
+		span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(statusCode))
+		if err := rc.Errors.Last(); err != nil {
+			span.SetData("error", err.Error())
+		}
+	}
+}
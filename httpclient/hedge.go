@@ -0,0 +1,187 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+// WithHedging sends a second attempt of requests that take longer than delay,
+// answering with whichever attempt responds first and cancelling the other.
+// Only GET, HEAD and OPTIONS requests are hedged, as long as their body, if
+// any, can be sent again through http.Request.GetBody. Both attempts are
+// recorded as child spans of the request span, the winning attempt with the
+// "http.request.hedge.winner" data set to true. Requests sent without a span,
+// e.g. dropped by the sampler, are not hedged.
+func WithHedging(delay time.Duration) SentryRoundTripTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.hedgeDelay = delay
+	}
+}
+
+func (s *SentryRoundTripper) hedgeable(request *http.Request) bool {
+	if s.hedgeDelay <= 0 {
+		return false
+	}
+
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+
+	switch request.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+type attempt struct {
+	number   int
+	span     *sentry.Span
+	cancel   context.CancelFunc
+	response *http.Response
+	err      error
+	done     bool
+}
+
+// hedge sends request as a first attempt, and as a second one once the delay
+// elapses without a response. The first successful attempt wins, or the last
+// failing one when both fail. Attempts carry the trace context when propagate
+// is set.
+func (s *SentryRoundTripper) hedge(parent *sentry.Span, request *http.Request, propagate bool) (*http.Response, error) {
+	results := make(chan *attempt, 2)
+	var attempts []*attempt
+
+	launch := func() {
+		a := &attempt{number: len(attempts) + 1}
+		attempts = append(attempts, a)
+
+		a.span = parent.StartChild(parent.Op, sentry.WithDescription(parent.Description))
+		integration.SetOrigin(a.span)
+		a.span.SetData("http.request.hedge.attempt", strconv.Itoa(a.number))
+
+		var ctx context.Context
+		ctx, a.cancel = context.WithCancel(a.span.Context())
+
+		attemptRequest := request.Clone(ctx)
+		if a.number > 1 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				a.err = err
+				results <- a
+				return
+			}
+			attemptRequest.Body = body
+		}
+
+		if propagate {
+			attemptRequest.Header.Add("Baggage", a.span.ToBaggage())
+			attemptRequest.Header.Add("Sentry-Trace", a.span.ToSentryTrace())
+		}
+
+		go func() {
+			a.response, a.err = s.roundTrip(attemptRequest)
+			results <- a
+		}()
+	}
+
+	launch()
+
+	timer := time.NewTimer(s.hedgeDelay)
+	defer timer.Stop()
+
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			if len(attempts) == 1 {
+				parent.SetData("http.request.hedged", "true")
+				launch()
+				pending++
+			}
+		case a := <-results:
+			a.done = true
+			pending--
+			if a.err != nil && pending > 0 {
+				finishAttempt(a, false)
+				continue
+			}
+
+			finishAttempt(a, true)
+
+			if pending > 0 {
+				// Pending attempts are recorded as cancelled right away, as
+				// the request span may finish before they return.
+				for _, loser := range attempts {
+					if !loser.done {
+						loser.cancel()
+						loser.span.SetData("http.request.hedge.winner", "false")
+						loser.span.Status = sentry.SpanStatusCanceled
+						loser.span.Finish()
+					}
+				}
+				go discard(results, pending)
+			}
+
+			if a.response != nil {
+				// The winning attempt lives until its body is read.
+				a.response.Body = &cancelBody{ReadCloser: a.response.Body, cancel: a.cancel}
+			} else {
+				a.cancel()
+			}
+
+			return a.response, a.err
+		}
+	}
+}
+
+// discard waits for the pending cancelled attempts, closing their responses.
+func discard(results <-chan *attempt, pending int) {
+	for ; pending > 0; pending-- {
+		if a := <-results; a.response != nil {
+			a.response.Body.Close()
+		}
+	}
+}
+
+func finishAttempt(a *attempt, winner bool) {
+	a.span.SetData("http.request.hedge.winner", strconv.FormatBool(winner))
+
+	switch {
+	case a.response != nil:
+		a.span.Status = sentry.HTTPtoSpanStatus(a.response.StatusCode)
+		a.span.SetData(semconv.HTTPResponseStatusCode.Key(), a.response.Status)
+	case errors.Is(a.err, context.Canceled):
+		a.span.Status = sentry.SpanStatusCanceled
+	case a.err != nil:
+		a.span.Status = sentry.SpanStatusInternalError
+		a.span.SetData("error", a.err.Error())
+	}
+
+	a.span.Finish()
+
+	if !winner {
+		a.cancel()
+	}
+}
+
+// cancelBody cancels the context of the request of its response once
+// closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
@@ -6,30 +6,86 @@
 //	}
 //
 //	request, err := client.Do(request)
+//
+// Spans record the server address and port, the HTTP version of the response
+// as "network.protocol.version", and the TLS version of secured connections.
+// Any transport may be wrapped, including h2c ones such as an http2.Transport
+// allowing plain HTTP, whose responses are recorded as HTTP/2 without TLS.
+// SOAP backends, which requests would all be named alike, are told apart by
+// their operation with WithSOAP.
 package httpclient
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aldy505/sentry-integration/bodycapture"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/metrics"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/aldy505/sentry-integration/semconv"
 	"github.com/getsentry/sentry-go"
 )
 
+var integration = config.Integration{Origin: "auto.http.client"}
+
+// SetEnabled turns the spans of outgoing HTTP requests on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
 type SentryRoundTripTracerOption func(*SentryRoundTripper)
 
 func WithTags(tags map[string]string) SentryRoundTripTracerOption {
 	return func(t *SentryRoundTripper) {
-		for k, v := range tags {
-			t.tags[k] = v
-		}
+		t.options.SetTags(tags)
 	}
 }
 
 func WithTag(key, value string) SentryRoundTripTracerOption {
 	return func(t *SentryRoundTripper) {
-		t.tags[key] = value
+		t.options.Tags[key] = value
+	}
+}
+
+// WithAttributes adds attributes to the data of every span, e.g. the name of
+// the service called.
+func WithAttributes(attributes map[string]interface{}) SentryRoundTripTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.options.SetAttributes(attributes)
+	}
+}
+
+// WithSpanOperation replaces the "http.client" operation of the spans.
+func WithSpanOperation(operation string) SentryRoundTripTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.options.SetOperation(operation)
+	}
+}
+
+// WithSpanSampler sends requests for which sampler returns false, given the
+// operation and the "METHOD /path" description, without a span nor trace
+// propagation headers.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryRoundTripTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.options.Sampler = sampler
+	}
+}
+
+// WithBodyCapture attaches the request and response bodies of failed
+// exchanges, either erroring or answered with a status code of 400 or above,
+// to the next event captured on the hub of the request context, until the
+// response body is closed. Requests without a hub of their own are left alone.
+func WithBodyCapture(opts ...bodycapture.Option) SentryRoundTripTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.bodyCapture = bodycapture.New(opts...)
 	}
 }
 
@@ -41,13 +97,15 @@ func NewSentryRoundTripper(originalRoundTripper http.RoundTripper, tracePropagat
 	t := &SentryRoundTripper{
 		originalRoundTripper:    originalRoundTripper,
 		tracePropagationTargets: tracePropagationTargets,
-		tags:                    make(map[string]string),
+		options:                 config.NewOptions("http.client"),
 	}
 
 	for _, opt := range opts {
 		opt(t)
 	}
 
+	t.data = t.options.SpanData(nil)
+
 	return t
 }
 
@@ -55,47 +113,203 @@ type SentryRoundTripper struct {
 	originalRoundTripper    http.RoundTripper
 	tracePropagationTargets []string
 
-	tags map[string]string
+	options     config.Options
+	data        *config.SpanData
+	bodyCapture *bodycapture.Capture
+	hedgeDelay  time.Duration
+	soap        bool
 }
 
 func (s *SentryRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
-	// Respect trace propagation targets
-	if len(s.tracePropagationTargets) > 0 {
-		requestUrlString := request.URL.String()
-		for _, t := range s.tracePropagationTargets {
-			if strings.Contains(requestUrlString, t) {
-				continue
-			}
-
-			return s.originalRoundTripper.RoundTrip(request)
-		}
-	}
-
 	// Start Sentry trace
 	ctx := request.Context()
 	cleanRequestURL := request.URL.Path
 
-	span := sentry.StartSpan(ctx, "http.client", sentry.WithTransactionName(fmt.Sprintf("%s %s", request.Method, cleanRequestURL)))
+	description := fmt.Sprintf("%s %s", request.Method, cleanRequestURL)
+	span := integration.StartSampledSpan(ctx, s.options.Sampler, s.options.Operation, description)
+	if span == nil {
+		return s.roundTrip(request)
+	}
 
-	for k, v := range s.tags {
-		span.SetTag(k, v)
+	s.data.Apply(span)
+
+	// The envelope is only read for the requests that are traced.
+	var soapAction, soapOperation string
+	if s.soap {
+		request, soapAction, soapOperation = soapRequest(request)
+		if soapOperation != "" {
+			span.Description += " " + soapOperation
+		}
 	}
 
 	defer span.Finish()
 
-	span.SetData("http.query", request.URL.Query().Encode())
+	if !config.Get().OmitPII {
+		span.SetData("http.query", scrub.Query(request.URL.Query()).Encode())
+	}
 	span.SetData("http.fragment", request.URL.Fragment)
-	span.SetData("http.request.method", request.Method)
+	span.SetData(semconv.HTTPRequestMethod.Key(), request.Method)
+	span.SetData(semconv.ServerAddress.Key(), request.URL.Hostname())
+	if port := serverPort(request.URL); port != "" {
+		span.SetData(semconv.ServerPort.Key(), port)
+	}
+	if soapAction != "" {
+		span.SetData("soap.action", soapAction)
+	}
+	if soapOperation != "" {
+		span.SetData("soap.operation", soapOperation)
+	}
 
-	request.Header.Add("Baggage", span.ToBaggage())
-	request.Header.Add("Sentry-Trace", span.ToSentryTrace())
+	// Requests are traced whatever their URL, the trace propagation targets
+	// only restrict where the trace context is sent.
+	propagate := config.ShouldPropagate(s.tracePropagationTargets, request.URL.String())
 
-	response, err := s.originalRoundTripper.RoundTrip(request)
+	var response *http.Response
+	var err error
+	if s.hedgeable(request) {
+		response, err = s.hedge(span, request, propagate)
+	} else {
+		if propagate {
+			// The request of the caller is not to be modified.
+			request = request.Clone(request.Context())
+			request.Header.Add("Baggage", span.ToBaggage())
+			request.Header.Add("Sentry-Trace", span.ToSentryTrace())
+		}
+
+		response, err = s.roundTrip(request)
+	}
 
 	if response != nil {
 		span.Status = sentry.HTTPtoSpanStatus(response.StatusCode)
-		span.SetData("http.response.status_code", response.Status)
+		span.SetData(semconv.HTTPResponseStatusCode.Key(), response.Status)
 		span.SetData("http.response_content_length", strconv.FormatInt(response.ContentLength, 10))
+		span.SetData(semconv.NetworkProtocolVersion.Key(), protocolVersion(response))
+		if response.TLS != nil {
+			span.SetData("tls.protocol.version", strings.TrimPrefix(tls.VersionName(response.TLS.Version), "TLS "))
+			span.SetData("tls.cipher", tls.CipherSuiteName(response.TLS.CipherSuite))
+		}
+		if s.soap {
+			s.recordFault(ctx, span, response)
+		}
+	}
+
+	return response, err
+}
+
+// serverPort returns the port of u, or the default port of its scheme.
+func serverPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+
+	switch u.Scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	default:
+		return ""
+	}
+}
+
+// protocolVersion returns the HTTP version of response as the OpenTelemetry
+// conventions spell it, e.g. "1.1" or "2", which includes h2c responses.
+func protocolVersion(response *http.Response) string {
+	if response.ProtoMajor >= 2 && response.ProtoMinor == 0 {
+		return strconv.Itoa(response.ProtoMajor)
+	}
+
+	return strconv.Itoa(response.ProtoMajor) + "." + strconv.Itoa(response.ProtoMinor)
+}
+
+// roundTrip sends request, capturing its bodies when WithBodyCapture is set.
+func (s *SentryRoundTripper) roundTrip(request *http.Request) (*http.Response, error) {
+	if s.bodyCapture != nil {
+		if hub := sentry.GetHubFromContext(request.Context()); hub != nil {
+			return s.roundTripCapture(hub, request)
+		}
+	}
+
+	return s.send(request)
+}
+
+// roundTripCapture is roundTrip, attaching the bodies of a failed exchange to
+// the next event captured on hub.
+func (s *SentryRoundTripper) roundTripCapture(hub *sentry.Hub, request *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	requestContentType := request.Header.Get("Content-Type")
+	if s.bodyCapture.Allowed(requestContentType) {
+		var body io.ReadCloser
+		requestBody, body = s.bodyCapture.Peek(request.Body)
+		request = withBody(request, body)
+	}
+
+	response, err := s.send(request)
+	if err == nil && response != nil && response.StatusCode < http.StatusBadRequest {
+		return response, err
+	}
+
+	var attachments []*sentry.Attachment
+	if len(requestBody) > 0 {
+		attachments = append(attachments, s.bodyCapture.Attachment("request-body", requestContentType, requestBody))
+	}
+
+	if response != nil {
+		responseContentType := response.Header.Get("Content-Type")
+		if s.bodyCapture.Allowed(responseContentType) {
+			var responseBody []byte
+			responseBody, response.Body = s.bodyCapture.Peek(response.Body)
+			if len(responseBody) > 0 {
+				attachments = append(attachments, s.bodyCapture.Attachment("response-body", responseContentType, responseBody))
+			}
+		}
+	}
+
+	release := bodycapture.Attach(hub, attachments...)
+	if response != nil && response.Body != nil {
+		response.Body = &releasingBody{ReadCloser: response.Body, release: release}
+	}
+
+	return response, err
+}
+
+// releasingBody releases the bodies attached for a failed exchange once the
+// response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
+
+// withBody returns a copy of request sending body. The transport consumes the
+// body, so it is sent from a copy of the request rather than replaced on the
+// request of the caller.
+func withBody(request *http.Request, body io.ReadCloser) *http.Request {
+	sent := request.Clone(request.Context())
+	sent.Body = body
+
+	return sent
+}
+
+// send sends request through the original round tripper, counting its
+// response status in the "http.client.requests" counter.
+func (s *SentryRoundTripper) send(request *http.Request) (*http.Response, error) {
+	response, err := s.originalRoundTripper.RoundTrip(request)
+
+	if metrics.Enabled() {
+		status := "error"
+		if response != nil {
+			status = strconv.Itoa(response.StatusCode)
+		}
+
+		metrics.Increment("http.client.requests", 1, metrics.UnitNone, map[string]string{
+			"http.request.method":       request.Method,
+			"http.response.status_code": status,
+		})
 	}
 
 	return response, err
@@ -0,0 +1,141 @@
+package httpclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/httpclient"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/aldy505/sentry-integration/sentryintegrationtest"
+	"github.com/getsentry/sentry-go"
+)
+
+// get sends a GET request to path of server through client, returning the
+// sentry-trace header the server got.
+func get(t *testing.T, ctx context.Context, client *http.Client, server *httptest.Server, path string) string {
+	t.Helper()
+
+	var trace string
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = r.Header.Get(sentry.SentryTraceHeader)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	return trace
+}
+
+func TestRoundTripper(t *testing.T) {
+	server := httptest.NewServer(nil)
+	defer server.Close()
+
+	recorder := sentryintegrationtest.NewRecorder(t)
+	client := &http.Client{Transport: httpclient.NewSentryRoundTripper(nil, nil, httpclient.WithTag("team", "payments"))}
+
+	ctx, finish := recorder.StartTransaction(context.Background(), "test")
+	trace := get(t, ctx, client, server, "/users")
+	finish()
+
+	span := recorder.RequireSpan("http.client", "GET /users", semconv.HTTPResponseStatusCode.Key(), semconv.ServerAddress.Key())
+	if span.Status != sentry.SpanStatusOK {
+		t.Errorf("span status = %v, want %v", span.Status, sentry.SpanStatusOK)
+	}
+	if span.Tags["team"] != "payments" {
+		t.Errorf("span tags = %v, want the team tag", span.Tags)
+	}
+	if want := span.ToSentryTrace(); trace != want {
+		t.Errorf("sentry-trace header = %q, want %q", trace, want)
+	}
+}
+
+func TestRoundTripperSampler(t *testing.T) {
+	server := httptest.NewServer(nil)
+	defer server.Close()
+
+	recorder := sentryintegrationtest.NewRecorder(t)
+	client := &http.Client{Transport: httpclient.NewSentryRoundTripper(nil, nil, httpclient.WithSpanSampler(func(operation, description string) bool {
+		return description != "GET /health"
+	}))}
+
+	ctx, finish := recorder.StartTransaction(context.Background(), "test")
+	trace := get(t, ctx, client, server, "/health")
+	finish()
+
+	recorder.RequireNoSpan("http.client")
+	if trace != "" {
+		t.Errorf("sentry-trace header = %q, want none for a dropped span", trace)
+	}
+}
+
+func TestRoundTripperWithoutRootSpans(t *testing.T) {
+	config.Set(config.WithoutRootSpans())
+	defer config.Reset()
+
+	server := httptest.NewServer(nil)
+	defer server.Close()
+
+	recorder := sentryintegrationtest.NewRecorder(t)
+	client := &http.Client{Transport: httpclient.NewSentryRoundTripper(nil, nil)}
+
+	get(t, recorder.Context(context.Background()), client, server, "/users")
+
+	if transactions := recorder.Transactions(); len(transactions) != 0 {
+		t.Errorf("transactions = %v, want none without a parent span", transactions)
+	}
+}
+
+func TestRoundTripperPropagationTargets(t *testing.T) {
+	server := httptest.NewServer(nil)
+	defer server.Close()
+
+	recorder := sentryintegrationtest.NewRecorder(t)
+	client := &http.Client{Transport: httpclient.NewSentryRoundTripper(nil, []string{"api.example.com"})}
+
+	ctx, finish := recorder.StartTransaction(context.Background(), "test")
+	trace := get(t, ctx, client, server, "/users")
+	finish()
+
+	recorder.RequireSpan("http.client", "GET /users")
+	if trace != "" {
+		t.Errorf("sentry-trace header = %q, want none outside the propagation targets", trace)
+	}
+}
+
+func TestRoundTripperLeavesRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	recorder := sentryintegrationtest.NewRecorder(t)
+	client := &http.Client{Transport: httpclient.NewSentryRoundTripper(nil, nil)}
+
+	ctx, finish := recorder.StartTransaction(context.Background(), "test")
+	defer finish()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if trace := request.Header.Get(sentry.SentryTraceHeader); trace != "" {
+		t.Errorf("sentry-trace header of the request = %q, want the request left as is", trace)
+	}
+}
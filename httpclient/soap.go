@@ -0,0 +1,237 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// soapPeekSize caps the bytes of SOAP envelopes read to find their operation
+// or fault.
+const soapPeekSize = 64 << 10
+
+// WithSOAP names the spans of SOAP requests after their operation, e.g.
+// "POST /service GetUser" rather than "POST /service", taken from the first
+// element of the envelope body, or else from the SOAPAction header or the
+// action parameter of a SOAP 1.2 content type. SOAP faults answered are
+// recorded on the span, as "soap.fault.code" and "soap.fault.string", and
+// captured as a *Fault on the hub of the request context. Faults of the
+// client, or sender, are recorded with an invalid argument status, others
+// with an internal error status.
+func WithSOAP() SentryRoundTripTracerOption {
+	return func(t *SentryRoundTripper) {
+		t.soap = true
+	}
+}
+
+// Fault is a SOAP fault answered to a request.
+type Fault struct {
+	// Code is the fault code without its namespace prefix, e.g. "Server" or,
+	// for SOAP 1.2, "Receiver".
+	Code string
+	// String is the human readable explanation of the fault.
+	String string
+	// Actor is the node the fault originated from, if any.
+	Actor string
+}
+
+func (f *Fault) Error() string {
+	return "soap fault " + f.Code + ": " + f.String
+}
+
+// soapRequest returns the SOAP action and operation of request, along with
+// the request to send, reading its body again when it can not be obtained
+// through http.Request.GetBody.
+func soapRequest(request *http.Request) (*http.Request, string, string) {
+	mediaType, params, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if !isSOAPMediaType(mediaType) {
+		return request, "", ""
+	}
+
+	action := strings.Trim(request.Header.Get("SOAPAction"), `"`)
+	if action == "" {
+		action = params["action"]
+	}
+
+	var body []byte
+	switch {
+	case request.Body == nil || request.Body == http.NoBody:
+	case request.GetBody != nil:
+		if reader, err := request.GetBody(); err == nil {
+			body, _ = io.ReadAll(io.LimitReader(reader, soapPeekSize))
+			_ = reader.Close()
+		}
+	default:
+		var peeked io.ReadCloser
+		body, peeked = peekSOAP(request.Body)
+		request = withBody(request, peeked)
+	}
+
+	operation := soapOperation(body)
+	if operation == "" && action != "" {
+		operation = action[strings.LastIndexAny(action, "/#:")+1:]
+	}
+
+	return request, action, operation
+}
+
+func isSOAPMediaType(mediaType string) bool {
+	return mediaType == "text/xml" || mediaType == "application/soap+xml"
+}
+
+// peekSOAP reads the first bytes of body, up to soapPeekSize. It returns them
+// along with a body yielding the whole content again.
+func peekSOAP(body io.ReadCloser) ([]byte, io.ReadCloser) {
+	peeked, _ := io.ReadAll(io.LimitReader(body, soapPeekSize))
+
+	return peeked, &soapBody{
+		Reader: io.MultiReader(bytes.NewReader(peeked), body),
+		Closer: body,
+	}
+}
+
+type soapBody struct {
+	io.Reader
+	io.Closer
+}
+
+// soapOperation returns the local name of the first element of the body of
+// envelope, or an empty string if there is none.
+func soapOperation(envelope []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(envelope))
+
+	inBody := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if inBody {
+			return start.Name.Local
+		}
+		inBody = start.Name.Local == "Body"
+	}
+}
+
+// soapFault is a fault element of either SOAP 1.1 or SOAP 1.2.
+type soapFault struct {
+	FaultCode   string `xml:"faultcode"`
+	FaultString string `xml:"faultstring"`
+	FaultActor  string `xml:"faultactor"`
+
+	Code struct {
+		Value string `xml:"Value"`
+	} `xml:"Code"`
+	Reason struct {
+		Text []string `xml:"Text"`
+	} `xml:"Reason"`
+	Role string `xml:"Role"`
+}
+
+// parseFault returns the fault of the body of envelope, or nil if there is
+// none.
+func parseFault(envelope []byte) *Fault {
+	decoder := xml.NewDecoder(bytes.NewReader(envelope))
+
+	inBody := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if !inBody {
+			inBody = start.Name.Local == "Body"
+			continue
+		}
+
+		if start.Name.Local != "Fault" {
+			return nil
+		}
+
+		var raw soapFault
+		if err := decoder.DecodeElement(&raw, &start); err != nil {
+			return nil
+		}
+
+		fault := &Fault{
+			Code:   raw.FaultCode,
+			String: raw.FaultString,
+			Actor:  raw.FaultActor,
+		}
+		if fault.Code == "" {
+			fault.Code = raw.Code.Value
+		}
+		if fault.String == "" && len(raw.Reason.Text) > 0 {
+			fault.String = raw.Reason.Text[0]
+		}
+		if fault.Actor == "" {
+			fault.Actor = raw.Role
+		}
+		fault.Code = strings.TrimSpace(fault.Code[strings.LastIndex(fault.Code, ":")+1:])
+
+		return fault
+	}
+}
+
+// recordFault records the SOAP fault of response, if any, on span and captures
+// it on the hub of ctx.
+func (s *SentryRoundTripper) recordFault(ctx context.Context, span *sentry.Span, response *http.Response) {
+	if response.StatusCode < http.StatusBadRequest {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if !isSOAPMediaType(mediaType) {
+		return
+	}
+
+	var body []byte
+	body, response.Body = peekSOAP(response.Body)
+
+	fault := parseFault(body)
+	if fault == nil {
+		return
+	}
+
+	switch fault.Code {
+	case "Client", "Sender":
+		span.Status = sentry.SpanStatusInvalidArgument
+	default:
+		span.Status = sentry.SpanStatusInternalError
+	}
+	span.SetData("soap.fault.code", fault.Code)
+	span.SetData("soap.fault.string", fault.String)
+	if fault.Actor != "" {
+		span.SetData("soap.fault.actor", fault.Actor)
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("soap.fault.code", fault.Code)
+		scope.SetTags(s.options.Tags)
+
+		hub.CaptureException(fault)
+	})
+}
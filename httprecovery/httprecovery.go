@@ -0,0 +1,185 @@
+// Package httprecovery provides a net/http middleware recovering panics of
+// handlers and capturing them as Sentry exceptions. It creates no span, so it
+// composes with any router and any tracing middleware.
+//
+//	handler := httprecovery.Middleware(router)
+//
+//	r := chi.NewRouter()
+//	r.Use(httprecovery.Middleware)
+//
+// Captured exceptions carry the request, without the cookies and the values
+// of sensitive headers, and panics are answered with a 500 response carrying
+// the ID of the event in the X-Sentry-Event-ID header, for support teams to
+// look up the event a user reports.
+package httprecovery
+
+import (
+	"context"
+	"net/http"
+
+	sentryintegration "github.com/aldy505/sentry-integration"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/internal/httpwriter"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/getsentry/sentry-go"
+)
+
+// EventIDHeader is the response header carrying the ID of the event of a
+// recovered panic, the same as feedback.EventIDHeader.
+const EventIDHeader = httpwriter.EventIDHeader
+
+// sensitiveHeaders are the headers which values are never sent.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+type SentryHTTPRecoveryOption func(*recoverer)
+
+func WithTags(tags map[string]string) SentryHTTPRecoveryOption {
+	return func(r *recoverer) {
+		for k, v := range tags {
+			r.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryHTTPRecoveryOption {
+	return func(r *recoverer) {
+		r.tags[key] = value
+	}
+}
+
+// WithResponse replaces the plain text 500 response written once a panic is
+// captured, e.g. to render an error page showing eventID, which is empty when
+// the event was not sent. The EventIDHeader header is already set when
+// respond is called. Nothing is written when the handler had already written
+// its response headers.
+func WithResponse(respond func(w http.ResponseWriter, r *http.Request, eventID sentry.EventID)) SentryHTTPRecoveryOption {
+	return func(r *recoverer) {
+		r.respond = respond
+	}
+}
+
+// WithRepanic panics again once a panic is captured, e.g. for an outer
+// recovery middleware to handle it, instead of writing a response.
+func WithRepanic() SentryHTTPRecoveryOption {
+	return func(r *recoverer) {
+		r.repanic = true
+	}
+}
+
+type recoverer struct {
+	tags    map[string]string
+	respond func(w http.ResponseWriter, r *http.Request, eventID sentry.EventID)
+	repanic bool
+}
+
+func defaultResponse(w http.ResponseWriter, _ *http.Request, _ sentry.EventID) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// Middleware recovers the panics of next with the default options.
+func Middleware(next http.Handler) http.Handler {
+	return NewMiddleware()(next)
+}
+
+// NewMiddleware returns a middleware recovering the panics of handlers,
+// binding a clone of the current hub to the request context when it has
+// none. Panics with http.ErrAbortHandler, which net/http uses to abort a
+// response, are raised again without being captured.
+func NewMiddleware(opts ...SentryHTTPRecoveryOption) func(next http.Handler) http.Handler {
+	r := &recoverer{
+		tags:    make(map[string]string),
+		respond: defaultResponse,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, hub := sentryintegration.EnsureHub(req.Context())
+			req = req.WithContext(ctx)
+			writer := &httpwriter.ResponseWriter{ResponseWriter: w}
+
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					r.recover(ctx, hub, writer, req, recovered)
+				}
+			}()
+
+			next.ServeHTTP(writer, req)
+		})
+	}
+}
+
+// recover captures recovered, and answers the request unless repanicking.
+func (r *recoverer) recover(ctx context.Context, hub *sentry.Hub, w *httpwriter.ResponseWriter, req *http.Request, recovered interface{}) {
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+
+	var eventID *sentry.EventID
+	hub.WithScope(func(scope *sentry.Scope) {
+		r.configureScope(scope, req)
+		eventID = hub.RecoverWithContext(ctx, recovered)
+	})
+
+	if r.repanic {
+		panic(recovered)
+	}
+
+	if w.WroteHeader() {
+		return
+	}
+
+	var id sentry.EventID
+	if eventID != nil {
+		id = *eventID
+		w.Header().Set(EventIDHeader, string(id))
+	}
+
+	r.respond(w, req, id)
+}
+
+func (r *recoverer) configureScope(scope *sentry.Scope, req *http.Request) {
+	scope.SetTag("http.request.method", req.Method)
+	for k, v := range r.tags {
+		scope.SetTag(k, v)
+	}
+
+	scoped := req.Clone(req.Context())
+	scoped.Header = scrubHeaders(req.Header)
+	if config.Get().OmitPII {
+		scoped.URL.RawQuery = ""
+	}
+	scope.SetRequest(scoped)
+}
+
+// scrubHeaders copies header, replacing the values of sensitive headers.
+func scrubHeaders(header http.Header) http.Header {
+	scrubbed := make(http.Header, len(header))
+	for key, values := range header {
+		if isSensitive(key) {
+			scrubbed[key] = []string{scrub.Filtered}
+			continue
+		}
+
+		copied := make([]string, len(values))
+		for i, value := range values {
+			copied[i] = scrub.String(value)
+		}
+		scrubbed[key] = copied
+	}
+
+	return scrubbed
+}
+
+func isSensitive(key string) bool {
+	for _, sensitive := range sensitiveHeaders {
+		if http.CanonicalHeaderKey(key) == sensitive {
+			return true
+		}
+	}
+
+	return scrub.IsSensitiveKey(key)
+}
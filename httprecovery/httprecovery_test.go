@@ -0,0 +1,61 @@
+package httprecovery_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aldy505/sentry-integration/httprecovery"
+	"github.com/aldy505/sentry-integration/sentryintegrationtest"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := sentryintegrationtest.NewRecorder(t)
+	handler := httprecovery.NewMiddleware(httprecovery.WithTag("team", "payments"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("checkout failed")
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/checkout", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	request = request.WithContext(recorder.Context(context.Background()))
+	response := httptest.NewRecorder()
+
+	handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", response.Code, http.StatusInternalServerError)
+	}
+
+	event := recorder.RequireEvent("checkout failed")
+	if got := response.Header().Get(httprecovery.EventIDHeader); got != string(event.EventID) {
+		t.Errorf("%s header = %q, want %q", httprecovery.EventIDHeader, got, event.EventID)
+	}
+	if event.Tags["team"] != "payments" {
+		t.Errorf("event tags = %v, want the team tag", event.Tags)
+	}
+	if event.Request == nil || event.Request.Headers["Authorization"] == "Bearer secret" {
+		t.Errorf("event request = %+v, want the Authorization header filtered", event.Request)
+	}
+}
+
+func TestMiddlewareWroteHeader(t *testing.T) {
+	recorder := sentryintegrationtest.NewRecorder(t)
+	handler := httprecovery.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("too late")
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(recorder.Context(context.Background()))
+	response := httptest.NewRecorder()
+
+	handler.ServeHTTP(response, request)
+
+	recorder.RequireEvent("too late")
+	if response.Code != http.StatusAccepted {
+		t.Errorf("status = %d, want the %d the handler wrote", response.Code, http.StatusAccepted)
+	}
+	if got := response.Header().Get(httprecovery.EventIDHeader); got != "" {
+		t.Errorf("%s header = %q, want none once the headers were written", httprecovery.EventIDHeader, got)
+	}
+}
@@ -0,0 +1,347 @@
+// Package influxdbtracer provides a tracer implementation for influxdb-client-go.
+//
+//	client := influxdb2.NewClient("http://localhost:8086", token)
+//
+//	writeAPI := influxdbtracer.NewSentryWriteAPIBlocking(client, "my-org", "my-bucket")
+//	err := writeAPI.WritePoint(ctx, influxdb2.NewPointWithMeasurement("cpu").AddField("usage", 0.5))
+//
+//	queryAPI := influxdbtracer.NewSentryQueryAPI(client, "my-org")
+//	result, err := queryAPI.Query(ctx, `from(bucket: "my-bucket") |> range(start: -1h)`)
+//
+// The non-blocking WriteAPI sends batches in the background, so no span can be
+// attached to a request. Failed batches are recorded as breadcrumbs instead,
+// and captured as exceptions once they are dropped.
+//
+//	writeAPI := influxdbtracer.NewSentryWriteAPI(client, "my-org", "my-bucket")
+//	writeAPI.WritePoint(point)
+package influxdbtracer
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+var integration = config.Integration{Origin: "auto.db.influxdb"}
+
+// SetEnabled turns the spans of InfluxDB writes and queries on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryInfluxDBTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryInfluxDBTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryInfluxDBTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of writes and queries for which sampler
+// returns false, given the "db" operation and the description.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryInfluxDBTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	org     string
+	bucket  string
+	address string
+	port    string
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(client influxdb2.Client, org, bucket string, opts ...SentryInfluxDBTracerOption) *tracer {
+	t := &tracer{
+		org:    org,
+		bucket: bucket,
+		tags:   make(map[string]string),
+	}
+
+	if serverURL, err := url.Parse(client.ServerURL()); err == nil {
+		t.address = serverURL.Hostname()
+		t.port = serverURL.Port()
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *tracer) startSpan(ctx context.Context, operation, description string) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "db", description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", "influxdb")
+	span.SetData(semconv.DBOperation.Key(), operation)
+	span.SetData("db.influxdb.org", t.org)
+	if t.bucket != "" {
+		span.SetData("db.influxdb.bucket", t.bucket)
+	}
+	if t.address != "" {
+		span.SetData(semconv.ServerAddress.Key(), t.address)
+	}
+	if t.port != "" {
+		span.SetData(semconv.ServerPort.Key(), t.port)
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+func NewSentryWriteAPIBlocking(client influxdb2.Client, org, bucket string, opts ...SentryInfluxDBTracerOption) api.WriteAPIBlocking {
+	return &writeAPIBlocking{
+		WriteAPIBlocking: client.WriteAPIBlocking(org, bucket),
+		tracer:           newTracer(client, org, bucket, opts...),
+	}
+}
+
+type writeAPIBlocking struct {
+	api.WriteAPIBlocking
+	tracer *tracer
+}
+
+// WriteRecord implements api.WriteAPIBlocking.
+func (w *writeAPIBlocking) WriteRecord(ctx context.Context, line ...string) error {
+	span := w.tracer.startSpan(ctx, "write", "write "+w.tracer.bucket)
+	if span == nil {
+		return w.WriteAPIBlocking.WriteRecord(ctx, line...)
+	}
+
+	measurements := make(map[string]struct{})
+	for _, l := range line {
+		measurements[measurementName(l)] = struct{}{}
+	}
+	span.SetData("db.influxdb.points", strconv.Itoa(len(line)))
+	span.SetData("db.influxdb.measurements", strconv.Itoa(len(measurements)))
+
+	err := w.WriteAPIBlocking.WriteRecord(span.Context(), line...)
+	finish(span, err)
+
+	return err
+}
+
+// WritePoint implements api.WriteAPIBlocking.
+func (w *writeAPIBlocking) WritePoint(ctx context.Context, point ...*write.Point) error {
+	span := w.tracer.startSpan(ctx, "write", "write "+w.tracer.bucket)
+	if span == nil {
+		return w.WriteAPIBlocking.WritePoint(ctx, point...)
+	}
+
+	measurements := make(map[string]struct{})
+	for _, p := range point {
+		measurements[p.Name()] = struct{}{}
+	}
+	span.SetData("db.influxdb.points", strconv.Itoa(len(point)))
+	span.SetData("db.influxdb.measurements", strconv.Itoa(len(measurements)))
+
+	err := w.WriteAPIBlocking.WritePoint(span.Context(), point...)
+	finish(span, err)
+
+	return err
+}
+
+// Flush implements api.WriteAPIBlocking.
+func (w *writeAPIBlocking) Flush(ctx context.Context) error {
+	span := w.tracer.startSpan(ctx, "flush", "flush "+w.tracer.bucket)
+	if span == nil {
+		return w.WriteAPIBlocking.Flush(ctx)
+	}
+
+	err := w.WriteAPIBlocking.Flush(span.Context())
+	finish(span, err)
+
+	return err
+}
+
+func NewSentryWriteAPI(client influxdb2.Client, org, bucket string, opts ...SentryInfluxDBTracerOption) api.WriteAPI {
+	w := &writeAPI{
+		WriteAPI: client.WriteAPI(org, bucket),
+		tracer:   newTracer(client, org, bucket, opts...),
+	}
+	w.WriteAPI.SetWriteFailedCallback(w.writeFailed)
+
+	return w
+}
+
+type writeAPI struct {
+	api.WriteAPI
+	tracer *tracer
+
+	writeFailedCallback api.WriteFailedCallback
+}
+
+// SetWriteFailedCallback implements api.WriteAPI. The callback is called after
+// the failure has been recorded.
+func (w *writeAPI) SetWriteFailedCallback(cb api.WriteFailedCallback) {
+	w.writeFailedCallback = cb
+}
+
+func (w *writeAPI) writeFailed(batch string, writeErr http.Error, retryAttempts uint) bool {
+	retry := true
+	if w.writeFailedCallback != nil {
+		retry = w.writeFailedCallback(batch, writeErr, retryAttempts)
+	}
+
+	data := map[string]interface{}{
+		"org":            w.tracer.org,
+		"bucket":         w.tracer.bucket,
+		"batch_size":     strings.Count(strings.TrimSuffix(batch, "\n"), "\n") + 1,
+		"retry_attempts": retryAttempts,
+		"status_code":    writeErr.StatusCode,
+		"retry":          retry,
+	}
+
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "error",
+		Category: "influxdb.write",
+		Message:  writeErr.Error(),
+		Data:     data,
+		Level:    sentry.LevelWarning,
+	})
+
+	if !retry {
+		sentry.WithScope(func(scope *sentry.Scope) {
+			for k, v := range w.tracer.tags {
+				scope.SetTag(k, v)
+			}
+			scope.SetContext("influxdb.write", data)
+			sentry.CaptureException(&writeErr)
+		})
+	}
+
+	return retry
+}
+
+func NewSentryQueryAPI(client influxdb2.Client, org string, opts ...SentryInfluxDBTracerOption) api.QueryAPI {
+	return &queryAPI{
+		QueryAPI: client.QueryAPI(org),
+		tracer:   newTracer(client, org, "", opts...),
+	}
+}
+
+type queryAPI struct {
+	api.QueryAPI
+	tracer *tracer
+}
+
+func (q *queryAPI) startSpan(ctx context.Context, query string) *sentry.Span {
+	span := q.tracer.startSpan(ctx, "query", query)
+	if span == nil {
+		return nil
+	}
+
+	if !config.Get().OmitStatements {
+		span.SetData(semconv.DBStatement.Key(), query)
+	}
+
+	return span
+}
+
+// QueryRaw implements api.QueryAPI.
+func (q *queryAPI) QueryRaw(ctx context.Context, query string, dialect *domain.Dialect) (string, error) {
+	span := q.startSpan(ctx, query)
+	if span == nil {
+		return q.QueryAPI.QueryRaw(ctx, query, dialect)
+	}
+
+	result, err := q.QueryAPI.QueryRaw(span.Context(), query, dialect)
+	finish(span, err)
+
+	return result, err
+}
+
+// QueryRawWithParams implements api.QueryAPI.
+func (q *queryAPI) QueryRawWithParams(ctx context.Context, query string, dialect *domain.Dialect, params interface{}) (string, error) {
+	span := q.startSpan(ctx, query)
+	if span == nil {
+		return q.QueryAPI.QueryRawWithParams(ctx, query, dialect, params)
+	}
+
+	result, err := q.QueryAPI.QueryRawWithParams(span.Context(), query, dialect, params)
+	finish(span, err)
+
+	return result, err
+}
+
+// Query implements api.QueryAPI.
+func (q *queryAPI) Query(ctx context.Context, query string) (*api.QueryTableResult, error) {
+	span := q.startSpan(ctx, query)
+	if span == nil {
+		return q.QueryAPI.Query(ctx, query)
+	}
+
+	result, err := q.QueryAPI.Query(span.Context(), query)
+	finish(span, err)
+
+	return result, err
+}
+
+// QueryWithParams implements api.QueryAPI.
+func (q *queryAPI) QueryWithParams(ctx context.Context, query string, params interface{}) (*api.QueryTableResult, error) {
+	span := q.startSpan(ctx, query)
+	if span == nil {
+		return q.QueryAPI.QueryWithParams(ctx, query, params)
+	}
+
+	result, err := q.QueryAPI.QueryWithParams(span.Context(), query, params)
+	finish(span, err)
+
+	return result, err
+}
+
+// measurementName returns the measurement of a line protocol record, which ends
+// at the first unescaped comma or space.
+func measurementName(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ',', ' ':
+			return line[:i]
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,227 @@
+// Package envelope sends envelope items sentry-go has no support for, such as
+// metrics or session aggregates, to the DSN of a client.
+package envelope
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// ErrRateLimited is returned by Send while Sentry asks for items of the type
+// to be held back, as told by the response to a previous item.
+var ErrRateLimited = errors.New("envelope: rate limited")
+
+// timeout is the timeout of the HTTP clients created by Send, as the one of
+// the transport of sentry-go.
+const timeout = 30 * time.Second
+
+// defaultRetryAfter is how long items are held back after a 429 response
+// telling no better.
+const defaultRetryAfter = time.Minute
+
+// Send sends payload as a single item of itemType to the DSN of the client of
+// hub, or of sentry.CurrentHub when hub is nil. Nothing is sent when the
+// client has no DSN.
+//
+// The request goes through the HTTPClient of the client options, or else
+// their HTTPTransport, or else a transport honoring their HTTPProxy,
+// HTTPSProxy and CaCerts, as sentry-go does for events. Items are held back
+// while rate limited, see ErrRateLimited.
+func Send(hub *sentry.Hub, itemType string, payload []byte) error {
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	client := hub.Client()
+	if client == nil || client.Options().Dsn == "" {
+		return nil
+	}
+	options := client.Options()
+
+	dsn, err := sentry.NewDsn(options.Dsn)
+	if err != nil {
+		return err
+	}
+
+	category := categoryOf(itemType)
+	if limits.limited(dsn.String(), category, time.Now()) {
+		return ErrRateLimited
+	}
+
+	var body bytes.Buffer
+	header, err := json.Marshal(map[string]string{
+		"sent_at": time.Now().UTC().Format(time.RFC3339Nano),
+		"dsn":     dsn.String(),
+	})
+	if err != nil {
+		return err
+	}
+	body.Write(header)
+	fmt.Fprintf(&body, "\n{\"type\":%q,\"length\":%d}\n", itemType, len(payload))
+	body.Write(payload)
+
+	request, err := http.NewRequest(http.MethodPost, dsn.GetAPIURL().String(), &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-sentry-envelope")
+	request.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=sentry.go/%s, sentry_key=%s", sentry.SDKVersion, dsn.GetPublicKey()))
+
+	response, err := httpClient(options).Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	limits.update(dsn.String(), response, time.Now())
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	if response.StatusCode >= 400 {
+		return errors.New("envelope: sending " + itemType + " item: " + response.Status)
+	}
+
+	return nil
+}
+
+// transportKey identifies the client options a transport is created from.
+type transportKey struct {
+	httpProxy  string
+	httpsProxy string
+	caCerts    *x509.CertPool
+}
+
+// clients are the HTTP clients created for client options without an
+// HTTPClient nor an HTTPTransport, shared so that connections are reused.
+var clients sync.Map
+
+func httpClient(options sentry.ClientOptions) *http.Client {
+	if options.HTTPClient != nil {
+		return options.HTTPClient
+	}
+
+	if options.HTTPTransport != nil {
+		return &http.Client{Transport: options.HTTPTransport, Timeout: timeout}
+	}
+
+	key := transportKey{
+		httpProxy:  options.HTTPProxy,
+		httpsProxy: options.HTTPSProxy,
+		caCerts:    options.CaCerts,
+	}
+	if client, ok := clients.Load(key); ok {
+		return client.(*http.Client)
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if proxy := firstNonEmpty(options.HTTPSProxy, options.HTTPProxy); proxy != "" {
+		transport.Proxy = func(*http.Request) (*url.URL, error) {
+			return url.Parse(proxy)
+		}
+	}
+	if options.CaCerts != nil {
+		// #nosec G402 -- The same configuration as the transport of sentry-go.
+		transport.TLSClientConfig = &tls.Config{RootCAs: options.CaCerts}
+	}
+
+	client, _ := clients.LoadOrStore(key, &http.Client{Transport: transport, Timeout: timeout})
+
+	return client.(*http.Client)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// categoryOf returns the rate limit category of items of itemType.
+func categoryOf(itemType string) string {
+	switch itemType {
+	case "statsd":
+		return "metric_bucket"
+	case "sessions":
+		return "session"
+	default:
+		return itemType
+	}
+}
+
+// rateLimits holds, for each DSN and category, the time until which items are
+// held back. The empty category holds back every item.
+type rateLimits struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+var limits = &rateLimits{until: make(map[string]time.Time)}
+
+func (l *rateLimits) limited(dsn, category string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return now.Before(l.until[dsn+"|"]) || now.Before(l.until[dsn+"|"+category])
+}
+
+// update records the rate limits of response, read from its
+// X-Sentry-Rate-Limits header, or else from its Retry-After header when it is
+// a 429 response.
+func (l *rateLimits) update(dsn string, response *http.Response, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if header := response.Header.Get("X-Sentry-Rate-Limits"); header != "" {
+		for _, limit := range strings.Split(header, ",") {
+			parts := strings.Split(strings.TrimSpace(limit), ":")
+			seconds, err := strconv.ParseFloat(parts[0], 64)
+			if err != nil {
+				continue
+			}
+			until := now.Add(time.Duration(seconds * float64(time.Second)))
+
+			categories := []string{""}
+			if len(parts) > 1 && parts[1] != "" {
+				categories = strings.Split(parts[1], ";")
+			}
+			for _, category := range categories {
+				l.extend(dsn+"|"+category, until)
+			}
+		}
+		return
+	}
+
+	if response.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	retryAfter := defaultRetryAfter
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	l.extend(dsn+"|", now.Add(retryAfter))
+}
+
+func (l *rateLimits) extend(key string, until time.Time) {
+	if until.After(l.until[key]) {
+		l.until[key] = until
+	}
+}
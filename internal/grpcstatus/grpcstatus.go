@@ -0,0 +1,18 @@
+// Package grpcstatus maps gRPC status codes to span statuses, for the
+// integrations tracing gRPC calls, such as gozerotracer and grpcgatewaytracer.
+package grpcstatus
+
+import (
+	"github.com/getsentry/sentry-go"
+	"google.golang.org/grpc/codes"
+)
+
+// SpanStatus returns the span status of code. Span statuses mirror the gRPC
+// codes, shifted by one, codes past codes.Unauthenticated are unknown.
+func SpanStatus(code codes.Code) sentry.SpanStatus {
+	if code > codes.Unauthenticated {
+		return sentry.SpanStatusUnknown
+	}
+
+	return sentry.SpanStatus(code) + sentry.SpanStatusOK
+}
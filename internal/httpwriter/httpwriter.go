@@ -0,0 +1,86 @@
+// Package httpwriter wraps the http.ResponseWriter of the middlewares acting
+// on the response of the handlers they run, such as httprecovery and
+// feedback.
+package httpwriter
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// EventIDHeader is the response header carrying the ID of the error event
+// captured while handling a request, for support teams to look up the event a
+// user reports.
+const EventIDHeader = "X-Sentry-Event-ID"
+
+// ResponseWriter records whether the response headers were written, and runs
+// BeforeWriteHeader right before they are. Flush and Hijack are forwarded to
+// the wrapped ResponseWriter when it supports them.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	// BeforeWriteHeader, when set, is run once with the status code of the
+	// response, e.g. to set headers depending on it.
+	BeforeWriteHeader func(status int)
+
+	wroteHeader bool
+}
+
+// WroteHeader reports whether the response headers were written, or the
+// connection hijacked.
+func (w *ResponseWriter) WroteHeader() bool {
+	return w.wroteHeader
+}
+
+func (w *ResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.BeforeWriteHeader != nil {
+			w.BeforeWriteHeader(status)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the ResponseWriter, for http.ResponseController.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *ResponseWriter) Flush() {
+	flusher, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	flusher.Flush()
+}
+
+// Hijack implements http.Hijacker, e.g. for WebSocket upgrades, returning
+// http.ErrNotSupported when the wrapped ResponseWriter is no http.Hijacker.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+
+	return conn, rw, err
+}
@@ -0,0 +1,317 @@
+// Package k8stracer provides a tracer implementation for Kubernetes client-go.
+//
+// Spans are named after the verb and resource of the API call, parsed out of
+// the request path, e.g. "list pods -n default" or "update deployments/scale".
+// Conflicts (409) and throttled requests (429), common in controllers, are
+// recorded as span data.
+//
+//	config, err := rest.InClusterConfig()
+//	if err != nil {
+//		return err
+//	}
+//
+//	clientset, err := kubernetes.NewForConfig(k8stracer.WrapConfig(config))
+//
+// When only the transport has to be traced, NewSentryRoundTripper can be used
+// as a rest.Config WrapTransport function.
+//
+//	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+//		return k8stracer.NewSentryRoundTripper(rt)
+//	})
+package k8stracer
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var integration = config.Integration{Origin: "auto.http.k8s"}
+
+// SetEnabled turns the spans of Kubernetes API requests on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryKubernetesTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryKubernetesTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryKubernetesTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans for which sampler returns false, given the
+// operation and the description, e.g. to leave out "http.client" spans of
+// "GET leases" made by leader election.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryKubernetesTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryKubernetesTracerOption) *tracer {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// WrapConfig returns a copy of config with its transport traced, and its rate
+// limiter recording the time requests wait on it.
+func WrapConfig(config *rest.Config, opts ...SentryKubernetesTracerOption) *rest.Config {
+	t := newTracer(opts...)
+	config = rest.CopyConfig(config)
+
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &SentryRoundTripper{originalRoundTripper: rt, tracer: t}
+	})
+
+	rateLimiter := config.RateLimiter
+	if rateLimiter == nil {
+		qps, burst := config.QPS, config.Burst
+		if qps == 0 {
+			qps = rest.DefaultQPS
+		}
+		if burst == 0 {
+			burst = rest.DefaultBurst
+		}
+		if qps > 0 {
+			rateLimiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+		}
+	}
+	if rateLimiter != nil {
+		config.RateLimiter = &rateLimiterTracer{RateLimiter: rateLimiter, tracer: t}
+	}
+
+	return config
+}
+
+func NewSentryRoundTripper(originalRoundTripper http.RoundTripper, opts ...SentryKubernetesTracerOption) http.RoundTripper {
+	if originalRoundTripper == nil {
+		originalRoundTripper = http.DefaultTransport
+	}
+
+	return &SentryRoundTripper{
+		originalRoundTripper: originalRoundTripper,
+		tracer:               newTracer(opts...),
+	}
+}
+
+type SentryRoundTripper struct {
+	originalRoundTripper http.RoundTripper
+	tracer               *tracer
+}
+
+func (s *SentryRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	info := parseRequest(request)
+	description := info.description()
+
+	span := integration.StartSampledSpan(request.Context(), s.tracer.spanSampler, "http.client", description)
+	if span == nil {
+		return s.originalRoundTripper.RoundTrip(request)
+	}
+	defer span.Finish()
+
+	span.SetData(semconv.HTTPRequestMethod.Key(), request.Method)
+	span.SetData(semconv.ServerAddress.Key(), request.URL.Hostname())
+	span.SetData("k8s.verb", info.verb)
+	if info.resource != "" {
+		span.SetData("k8s.resource", info.resource)
+	}
+	if info.subresource != "" {
+		span.SetData("k8s.subresource", info.subresource)
+	}
+	if info.group != "" {
+		span.SetData("k8s.api_group", info.group)
+	}
+	if info.version != "" {
+		span.SetData("k8s.api_version", info.version)
+	}
+	if info.namespace != "" {
+		span.SetData("k8s.namespace.name", info.namespace)
+	}
+
+	for k, v := range s.tracer.tags {
+		span.SetTag(k, v)
+	}
+
+	response, err := s.originalRoundTripper.RoundTrip(request.WithContext(span.Context()))
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return response, err
+	}
+
+	span.Status = sentry.HTTPtoSpanStatus(response.StatusCode)
+	span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(response.StatusCode))
+
+	switch response.StatusCode {
+	case http.StatusConflict:
+		span.SetData("k8s.conflict", "true")
+	case http.StatusTooManyRequests:
+		span.SetData("k8s.throttled", "true")
+		if retryAfter := response.Header.Get("Retry-After"); retryAfter != "" {
+			span.SetData("http.response.header.retry-after", retryAfter)
+		}
+	}
+
+	return response, nil
+}
+
+type requestInfo struct {
+	verb        string
+	group       string
+	version     string
+	namespace   string
+	resource    string
+	subresource string
+}
+
+func (r requestInfo) description() string {
+	if r.resource == "" {
+		return r.verb
+	}
+
+	description := r.verb + " " + r.resource
+	if r.subresource != "" {
+		description += "/" + r.subresource
+	}
+	if r.namespace != "" {
+		description += " -n " + r.namespace
+	}
+
+	return description
+}
+
+// parseRequest derives the Kubernetes verb and resource of a request out of its
+// method and path, e.g. "/api/v1/namespaces/default/pods/foo/log" or
+// "/apis/apps/v1/deployments". Object names are left out.
+func parseRequest(request *http.Request) requestInfo {
+	segments := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+
+	var info requestInfo
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		info.version = segments[1]
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		info.group = segments[1]
+		info.version = segments[2]
+		segments = segments[3:]
+	default:
+		// Non-resource URLs such as /healthz or /version.
+		info.verb = strings.ToLower(request.Method) + " " + request.URL.Path
+		return info
+	}
+
+	if len(segments) > 2 && segments[0] == "namespaces" {
+		info.namespace = segments[1]
+		segments = segments[2:]
+	}
+
+	var name string
+	if len(segments) > 0 {
+		info.resource = segments[0]
+	}
+	if len(segments) > 1 {
+		name = segments[1]
+	}
+	if len(segments) > 2 {
+		info.subresource = segments[2]
+	}
+
+	switch request.Method {
+	case http.MethodGet, http.MethodHead:
+		switch {
+		case request.URL.Query().Get("watch") == "true" || request.URL.Query().Get("watch") == "1":
+			info.verb = "watch"
+		case name == "":
+			info.verb = "list"
+		default:
+			info.verb = "get"
+		}
+	case http.MethodPost:
+		info.verb = "create"
+	case http.MethodPut:
+		info.verb = "update"
+	case http.MethodPatch:
+		info.verb = "patch"
+	case http.MethodDelete:
+		if name == "" {
+			info.verb = "deletecollection"
+		} else {
+			info.verb = "delete"
+		}
+	default:
+		info.verb = strings.ToLower(request.Method)
+	}
+
+	return info
+}
+
+// rateLimiterTracer records the time a request waited on the client-side rate
+// limiter as a span, when it had to wait at all.
+type rateLimiterTracer struct {
+	flowcontrol.RateLimiter
+	tracer *tracer
+}
+
+func (r *rateLimiterTracer) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := r.RateLimiter.Wait(ctx)
+
+	wait := time.Since(start)
+	if wait < time.Millisecond || sentry.SpanFromContext(ctx) == nil {
+		return err
+	}
+
+	span := integration.StartSampledSpan(ctx, r.tracer.spanSampler, "k8s.client.rate_limit", "client-side throttling")
+	if span == nil {
+		return err
+	}
+
+	span.StartTime = start
+	span.SetData("k8s.rate_limit.wait", strconv.FormatInt(wait.Milliseconds(), 10))
+	span.SetData("k8s.rate_limit.qps", strconv.FormatFloat(float64(r.RateLimiter.QPS()), 'f', -1, 32))
+	for k, v := range r.tracer.tags {
+		span.SetTag(k, v)
+	}
+
+	if err != nil {
+		span.Status = sentry.SpanStatusDeadlineExceeded
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+	span.Finish()
+
+	return err
+}
@@ -0,0 +1,435 @@
+// Package kafkatracer provides a tracer implementation for confluent-kafka-go.
+//
+//	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": "localhost"})
+//	if err != nil {
+//		return err
+//	}
+//
+//	producer := kafkatracer.NewSentryProducer(p)
+//	err = producer.Produce(ctx, &kafka.Message{
+//		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+//		Value:          []byte("hello"),
+//	}, nil)
+//
+//	c, err := kafka.NewConsumer(&kafka.ConfigMap{"bootstrap.servers": "localhost", "group.id": "orders"})
+//	if err != nil {
+//		return err
+//	}
+//
+//	consumer := kafkatracer.NewSentryConsumer(c)
+//	stop := consumer.ReportLag(10 * time.Second)
+//	defer stop()
+//	for {
+//		event, err := consumer.Poll(ctx, 100, func(ctx context.Context, message *kafka.Message) error {
+//			return processOrder(ctx, message.Value)
+//		})
+//	}
+package kafkatracer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.queue.kafka"}
+
+// SetEnabled turns the spans of Kafka produces and consumes on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryKafkaTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryKafkaTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryKafkaTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the topic.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryKafkaTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithoutDeliveryReports finishes the "queue.publish" spans of a producer as
+// soon as the message is enqueued, for producers configured with
+// "go.delivery.reports" set to false, which never get the report the spans
+// otherwise wait for.
+func WithoutDeliveryReports() SentryKafkaTracerOption {
+	return func(t *tracer) {
+		t.withoutDeliveryReports = true
+	}
+}
+
+type tracer struct {
+	tags                   map[string]string
+	spanSampler            func(operation, description string) bool
+	withoutDeliveryReports bool
+}
+
+func newTracer(opts ...SentryKafkaTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+func NewSentryProducer(producer *kafka.Producer, opts ...SentryKafkaTracerOption) *Producer {
+	p := &Producer{
+		Producer: producer,
+		tracer:   newTracer(opts...),
+		reports:  make(chan kafka.Event),
+		events:   make(chan kafka.Event, cap(producer.Events())),
+		done:     make(chan struct{}),
+	}
+
+	go p.forward()
+
+	return p
+}
+
+type Producer struct {
+	*kafka.Producer
+	tracer
+
+	// reports receives the delivery reports of the traced messages, which
+	// forward passes on to the channel the message was produced with, or to
+	// events.
+	reports chan kafka.Event
+	events  chan kafka.Event
+	pending sync.Map
+	done    chan struct{}
+}
+
+// delivery is set as the Opaque of a traced message until its delivery report
+// arrives.
+type delivery struct {
+	span         *sentry.Span
+	opaque       interface{}
+	deliveryChan chan kafka.Event
+}
+
+// Events returns the events channel of the producer, carrying the delivery
+// reports of the messages produced without a delivery channel, as
+// kafka.Producer.Events does.
+func (p *Producer) Events() chan kafka.Event {
+	return p.events
+}
+
+// Close closes the producer, finishing the spans of the messages still
+// waiting for their delivery report with the aborted status. Flush the
+// producer first to get the reports of the messages in flight.
+func (p *Producer) Close() {
+	p.Producer.Close()
+	<-p.done
+}
+
+// Produce wraps kafka.Producer.Produce with a "queue.publish" span that is
+// finished once the delivery report for the message arrives. The report is then
+// forwarded to deliveryChan, or to the producer's Events channel when
+// deliveryChan is nil, just like the original Produce would. Without delivery
+// reports, see WithoutDeliveryReports, the span is finished once the message
+// is enqueued.
+func (p *Producer) Produce(ctx context.Context, message *kafka.Message, deliveryChan chan kafka.Event) error {
+	topic := topicName(message.TopicPartition)
+
+	span := integration.StartSampledSpan(ctx, p.spanSampler, "queue.publish", topic)
+	if span == nil {
+		return p.Producer.Produce(message, deliveryChan)
+	}
+
+	span.SetData("messaging.system", "kafka")
+	span.SetData(semconv.MessagingDestinationName.Key(), topic)
+	messaging.SetBodySize(span, len(message.Value))
+	p.setTags(span)
+
+	message.Headers = setHeader(message.Headers, sentry.SentryTraceHeader, span.ToSentryTrace())
+	message.Headers = setHeader(message.Headers, sentry.SentryBaggageHeader, span.ToBaggage())
+
+	if p.withoutDeliveryReports {
+		err := p.Producer.Produce(message, deliveryChan)
+		if err != nil {
+			span.Status = sentry.SpanStatusInternalError
+			span.SetData("error", err.Error())
+		} else {
+			span.Status = sentry.SpanStatusOK
+		}
+		span.Finish()
+		return err
+	}
+
+	d := &delivery{span: span, opaque: message.Opaque, deliveryChan: deliveryChan}
+	message.Opaque = d
+	p.pending.Store(d, struct{}{})
+
+	if err := p.Producer.Produce(message, p.reports); err != nil {
+		p.pending.Delete(d)
+		message.Opaque = d.opaque
+
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		span.Finish()
+		return err
+	}
+
+	return nil
+}
+
+// forward passes every event of the producer on, finishing the spans of the
+// delivery reports on the way, until the producer is closed.
+func (p *Producer) forward() {
+	defer close(p.done)
+	defer close(p.events)
+
+	events := p.Producer.Events()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				p.abort()
+				return
+			}
+			p.deliver(event)
+		case event := <-p.reports:
+			p.deliver(event)
+		}
+	}
+}
+
+func (p *Producer) deliver(event kafka.Event) {
+	m, ok := event.(*kafka.Message)
+	if !ok {
+		p.events <- event
+		return
+	}
+
+	d, ok := m.Opaque.(*delivery)
+	if !ok {
+		p.events <- event
+		return
+	}
+
+	p.pending.Delete(d)
+	m.Opaque = d.opaque
+
+	d.span.SetData("messaging.kafka.destination.partition", strconv.FormatInt(int64(m.TopicPartition.Partition), 10))
+	d.span.SetData("messaging.kafka.message.offset", m.TopicPartition.Offset.String())
+	if m.TopicPartition.Error != nil {
+		d.span.Status = sentry.SpanStatusInternalError
+		d.span.SetData("error", m.TopicPartition.Error.Error())
+	} else {
+		d.span.Status = sentry.SpanStatusOK
+	}
+	d.span.Finish()
+
+	if d.deliveryChan != nil {
+		d.deliveryChan <- event
+	} else {
+		p.events <- event
+	}
+}
+
+// abort passes on the reports that arrived while the producer was closing,
+// and finishes the spans of the messages that got none.
+func (p *Producer) abort() {
+	for {
+		select {
+		case event := <-p.reports:
+			p.deliver(event)
+		default:
+			p.pending.Range(func(key, _ interface{}) bool {
+				d := key.(*delivery)
+				d.span.Status = sentry.SpanStatusAborted
+				d.span.Finish()
+				p.pending.Delete(d)
+				return true
+			})
+			return
+		}
+	}
+}
+
+// MessageHandler processes a single message. The provided context carries the
+// "queue.process" transaction of the message.
+type MessageHandler func(ctx context.Context, message *kafka.Message) error
+
+func NewSentryConsumer(consumer *kafka.Consumer, opts ...SentryKafkaTracerOption) *Consumer {
+	return &Consumer{
+		Consumer: consumer,
+		tracer:   newTracer(opts...),
+	}
+}
+
+type Consumer struct {
+	*kafka.Consumer
+	tracer
+}
+
+// Poll wraps kafka.Consumer.Poll. Whenever the polled event is a message, it is
+// handed to handler within a "queue.process" transaction continued from the
+// message headers. The polled event is always returned, along with the error
+// returned by handler.
+func (c *Consumer) Poll(ctx context.Context, timeoutMs int, handler MessageHandler) (kafka.Event, error) {
+	event := c.Consumer.Poll(timeoutMs)
+
+	message, ok := event.(*kafka.Message)
+	if !ok {
+		return event, nil
+	}
+
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier{
+		sentry.SentryTraceHeader:   getHeader(message.Headers, sentry.SentryTraceHeader),
+		sentry.SentryBaggageHeader: getHeader(message.Headers, sentry.SentryBaggageHeader),
+	})
+
+	topic := topicName(message.TopicPartition)
+
+	span := integration.StartTransaction(
+		ctx,
+		c.spanSampler,
+		"queue.process",
+		topic,
+		continueTrace,
+	)
+	if span == nil {
+		return event, handler(ctx, message)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "kafka")
+	span.SetData(semconv.MessagingDestinationName.Key(), topic)
+	span.SetData("messaging.kafka.destination.partition", strconv.FormatInt(int64(message.TopicPartition.Partition), 10))
+	span.SetData("messaging.kafka.message.offset", message.TopicPartition.Offset.String())
+	messaging.SetBodySize(span, len(message.Value))
+	messaging.SetReceiveLatency(span, message.Timestamp, time.Now())
+	if _, high, err := c.Consumer.GetWatermarkOffsets(topic, message.TopicPartition.Partition); err == nil && high > 0 {
+		messaging.SetConsumerLag(span, high-int64(message.TopicPartition.Offset)-1)
+	}
+	c.setTags(span)
+
+	err := handler(span.Context(), message)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return event, err
+}
+
+// ReportLag records the lag of the partitions assigned to the consumer, the
+// messages between its position and the high water mark, as the
+// "messaging.consumer.lag" gauge every interval, until stop is called. The
+// high water marks are the ones cached by the last fetches, so no request is
+// made to the brokers.
+func (c *Consumer) ReportLag(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.recordLag()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func (c *Consumer) recordLag() {
+	assignment, err := c.Consumer.Assignment()
+	if err != nil || len(assignment) == 0 {
+		return
+	}
+
+	positions, err := c.Consumer.Position(assignment)
+	if err != nil {
+		return
+	}
+
+	for _, position := range positions {
+		// Logical offsets, such as kafka.OffsetInvalid, mean nothing has
+		// been consumed from the partition yet.
+		if position.Topic == nil || position.Offset < 0 {
+			continue
+		}
+
+		_, high, err := c.Consumer.GetWatermarkOffsets(*position.Topic, position.Partition)
+		if err != nil || high <= 0 {
+			continue
+		}
+
+		messaging.RecordConsumerLag("kafka", *position.Topic, position.Partition, high-int64(position.Offset))
+	}
+}
+
+func topicName(topicPartition kafka.TopicPartition) string {
+	if topicPartition.Topic == nil {
+		return ""
+	}
+
+	return *topicPartition.Topic
+}
+
+func getHeader(headers []kafka.Header, key string) string {
+	for _, header := range headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+func setHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	for i := range headers {
+		if headers[i].Key == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+
+	return append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
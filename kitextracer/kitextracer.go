@@ -0,0 +1,192 @@
+// Package kitextracer provides client and server middlewares for CloudWeGo
+// Kitex.
+//
+//	svr := echo.NewServer(handler, server.WithMiddleware(kitextracer.ServerMiddleware()))
+//
+//	cli, err := echo.NewClient("echo",
+//		client.WithHostPorts("127.0.0.1:8888"),
+//		client.WithMiddleware(kitextracer.ClientMiddleware()))
+//
+// Every call made by a client is a "rpc.client" span, and every call handled
+// by a server a "rpc.server" transaction, both named after the service and
+// method, e.g. "echo/Echo". The trace context travels as metainfo transient
+// values, which require a transport carrying them, such as TTHeader or gRPC.
+package kitextracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/bytedance/gopkg/cloud/metainfo"
+	"github.com/cloudwego/kitex/pkg/endpoint"
+	"github.com/cloudwego/kitex/pkg/kerrors"
+	"github.com/cloudwego/kitex/pkg/rpcinfo"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.rpc.kitex"}
+
+// SetEnabled turns the spans of Kitex calls on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryKitexTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryKitexTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryKitexTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the operation and the service and method, e.g. "echo/Echo".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryKitexTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts []SentryKitexTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setData(span *sentry.Span, service, method string) {
+	span.SetData("rpc.system", "kitex")
+	span.SetData("rpc.service", service)
+	span.SetData("rpc.method", method)
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// metainfoCarrier is a propagation.Carrier over the metainfo transient values
+// of a context, which Set replaces with a context holding the new value.
+type metainfoCarrier struct {
+	ctx context.Context
+}
+
+func (c *metainfoCarrier) Get(key string) string {
+	value, _ := metainfo.GetValue(c.ctx, key)
+	return value
+}
+
+func (c *metainfoCarrier) Set(key, value string) {
+	c.ctx = metainfo.WithValue(c.ctx, key, value)
+}
+
+// callee returns the service and method called, of the RPC info of ctx.
+func callee(ctx context.Context) (string, string) {
+	ri := rpcinfo.GetRPCInfo(ctx)
+	if ri == nil || ri.To() == nil {
+		return "", ""
+	}
+
+	return ri.To().ServiceName(), ri.To().Method()
+}
+
+// ServerMiddleware returns a middleware handling every call within a
+// "rpc.server" transaction, with a clone of the hub bound to its context.
+func ServerMiddleware(opts ...SentryKitexTracerOption) endpoint.Middleware {
+	t := newTracer(opts)
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			ctx, continueTrace := propagation.Continue(ctx, &metainfoCarrier{ctx: ctx})
+
+			service, method := callee(ctx)
+			span := integration.StartTransaction(ctx, t.spanSampler, "rpc.server", service+"/"+method,
+				continueTrace, sentry.WithTransactionSource(sentry.SourceRoute))
+			if span == nil {
+				return next(ctx, req, resp)
+			}
+			defer span.Finish()
+
+			t.setData(span, service, method)
+
+			err := next(span.Context(), req, resp)
+			finish(span, err)
+
+			return err
+		}
+	}
+}
+
+// ClientMiddleware returns a middleware making every call within a
+// "rpc.client" span.
+func ClientMiddleware(opts ...SentryKitexTracerOption) endpoint.Middleware {
+	t := newTracer(opts)
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, req, resp interface{}) error {
+			service, method := callee(ctx)
+			span := integration.StartSampledSpan(ctx, t.spanSampler, "rpc.client", service+"/"+method)
+			if span == nil {
+				return next(ctx, req, resp)
+			}
+			defer span.Finish()
+
+			t.setData(span, service, method)
+
+			carrier := &metainfoCarrier{ctx: span.Context()}
+			propagation.Inject(span, carrier)
+
+			err := next(carrier.ctx, req, resp)
+			finish(span, err)
+
+			return err
+		}
+	}
+}
+
+// finish sets the status of span after err. Business errors are answers of
+// the server, recorded with their status code.
+func finish(span *sentry.Span, err error) {
+	if err == nil {
+		span.Status = sentry.SpanStatusOK
+		return
+	}
+
+	span.SetData("error", err.Error())
+
+	if bizErr, ok := kerrors.FromBizStatusError(err); ok {
+		span.Status = sentry.SpanStatusUnknown
+		span.SetData("rpc.kitex.biz_status_code", strconv.FormatInt(int64(bizErr.BizStatusCode()), 10))
+		return
+	}
+
+	switch {
+	case errors.Is(err, kerrors.ErrRPCTimeout):
+		span.Status = sentry.SpanStatusDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		span.Status = sentry.SpanStatusCanceled
+	default:
+		span.Status = sentry.SpanStatusInternalError
+	}
+}
@@ -0,0 +1,234 @@
+// Package kratostracer provides server and client middleware for Kratos.
+//
+//	httpSrv := http.NewServer(http.Address(":8000"), http.Middleware(kratostracer.Server()))
+//	grpcSrv := grpc.NewServer(grpc.Address(":9000"), grpc.Middleware(kratostracer.Server()))
+//
+//	conn, err := grpc.DialInsecure(ctx,
+//		grpc.WithEndpoint("127.0.0.1:9000"),
+//		grpc.WithMiddleware(kratostracer.Client()))
+//
+// Every handled request is a "http.server" or "grpc.server" transaction,
+// depending on the transport, named after the operation, e.g.
+// "/helloworld.v1.Greeter/SayHello", and continued from the trace context of
+// the request headers. Every call made by a client is a "http.client" or
+// "grpc.client" span, which trace context is sent as request headers. Errors
+// of handlers with a server error code are captured.
+package kratostracer
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+var integration = config.Integration{Origin: "auto.http.kratos"}
+
+// SetEnabled turns the spans of Kratos requests on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryKratosTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryKratosTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryKratosTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of requests for which sampler returns false,
+// given the operation and the Kratos operation, e.g. to leave out health
+// checks.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryKratosTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithoutErrorCapture disables capturing the errors of handlers, only
+// recording them on their transactions.
+func WithoutErrorCapture() SentryKratosTracerOption {
+	return func(t *tracer) {
+		t.captureErrors = false
+	}
+}
+
+// WithRouteSampler samples the transactions of requests not continuing a
+// sampled trace at the rate sampler returns, given the Kratos operation, the
+// method of HTTP requests and the request headers, instead of the sample rate
+// of the client. It only applies to Server.
+func WithRouteSampler(sampler config.RouteSampler) SentryKratosTracerOption {
+	return func(t *tracer) {
+		t.routeSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags          map[string]string
+	spanSampler   func(operation, description string) bool
+	captureErrors bool
+	routeSampler  config.RouteSampler
+}
+
+func newTracer(opts []SentryKratosTracerOption) tracer {
+	t := tracer{
+		tags:          make(map[string]string),
+		captureErrors: true,
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setData(span *sentry.Span, tr transport.Transporter) {
+	span.SetData("rpc.system", string(tr.Kind()))
+	span.SetData("kratos.operation", tr.Operation())
+	if endpoint := tr.Endpoint(); endpoint != "" {
+		span.SetData("kratos.endpoint", endpoint)
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// Server returns a middleware handling every request within a transaction.
+func Server(opts ...SentryKratosTracerOption) middleware.Middleware {
+	t := newTracer(opts)
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+
+			ctx, continueTrace := propagation.Continue(ctx, tr.RequestHeader())
+
+			var method string
+			if ht, ok := tr.(interface{ Request() *http.Request }); ok {
+				method = ht.Request().Method
+			}
+
+			span := integration.StartTransaction(ctx, t.spanSampler, operation(tr.Kind(), "server"), tr.Operation(),
+				continueTrace, config.SampleRoute(t.routeSampler, tr.Operation(), method, tr.RequestHeader()))
+			if span == nil {
+				reply, err := handler(ctx, req)
+				t.capture(ctx, tr, err)
+				return reply, err
+			}
+			defer span.Finish()
+
+			t.setData(span, tr)
+
+			reply, err := handler(span.Context(), req)
+			finish(span, err)
+			t.capture(span.Context(), tr, err)
+
+			return reply, err
+		}
+	}
+}
+
+// Client returns a middleware making every call within a span.
+func Client(opts ...SentryKratosTracerOption) middleware.Middleware {
+	t := newTracer(opts)
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, ok := transport.FromClientContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+
+			span := integration.StartSampledSpan(ctx, t.spanSampler, operation(tr.Kind(), "client"), tr.Operation())
+			if span == nil {
+				return handler(ctx, req)
+			}
+			defer span.Finish()
+
+			t.setData(span, tr)
+			if config.ShouldPropagate(nil, tr.Endpoint()) {
+				propagation.Inject(span, tr.RequestHeader())
+			}
+
+			reply, err := handler(span.Context(), req)
+			finish(span, err)
+
+			return reply, err
+		}
+	}
+}
+
+// capture captures err on the hub of ctx when it has a server error code.
+func (t tracer) capture(ctx context.Context, tr transport.Transporter, err error) {
+	if err == nil || !t.captureErrors || errors.FromError(err).Code < http.StatusInternalServerError {
+		return
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("kratos.operation", tr.Operation())
+		scope.SetTag("kratos.transport", string(tr.Kind()))
+		scope.SetTags(t.tags)
+
+		hub.CaptureException(err)
+	})
+}
+
+// operation returns the span operation of side, "server" or "client", of a
+// request over the transport kind, e.g. "grpc.server".
+func operation(kind transport.Kind, side string) string {
+	switch kind {
+	case transport.KindGRPC:
+		return "grpc." + side
+	case transport.KindHTTP:
+		return "http." + side
+	default:
+		return "rpc." + side
+	}
+}
+
+// finish sets the status of span after err, whose Kratos errors carry an HTTP
+// status code.
+func finish(span *sentry.Span, err error) {
+	if err == nil {
+		span.Status = sentry.SpanStatusOK
+		return
+	}
+
+	se := errors.FromError(err)
+	span.SetData("error", err.Error())
+	if se.Reason != "" {
+		span.SetData("kratos.error.reason", se.Reason)
+	}
+
+	if se.Code < http.StatusBadRequest {
+		span.Status = sentry.SpanStatusInternalError
+		return
+	}
+
+	span.Status = sentry.HTTPtoSpanStatus(int(se.Code))
+}
@@ -0,0 +1,234 @@
+// Package localcachetracer provides a tracer implementation for in-process
+// caches, with adapters for ristretto and bigcache.
+//
+// Spans follow Sentry's cache module conventions, and record "cache.tier" as
+// "local", so they can be told apart from remote caches within a trace. As
+// local cache lookups are cheap and frequent, spans are only created when the
+// context already carries a span, never starting a transaction on their own.
+//
+//	rc, err := ristretto.NewCache(&ristretto.Config{
+//		NumCounters: 1e7,
+//		MaxCost:     1 << 30,
+//		BufferItems: 64,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	localCache := localcachetracer.NewSentryRistretto(rc)
+//	value, found := localCache.Get(ctx, "user:42")
+//
+// Any other cache can be traced by implementing Store.
+//
+//	localCache := localcachetracer.NewSentryCache[string, *User]("lru", store)
+package localcachetracer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/allegro/bigcache/v3"
+	"github.com/dgraph-io/ristretto"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.cache.local"}
+
+// SetEnabled turns the spans of in-process cache operations on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryLocalCacheTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryLocalCacheTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryLocalCacheTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of operations for which sampler returns
+// false, given the operation and the scrubbed key.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryLocalCacheTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every cache key before it is
+// recorded on a span, e.g. to strip user identifiers out of the key.
+func WithKeyScrubber(scrubber func(key string) string) SentryLocalCacheTracerOption {
+	return func(t *tracer) {
+		t.scrubKey = scrubber
+	}
+}
+
+type tracer struct {
+	scrubKey    func(key string) string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// Store is an in-process cache.
+type Store[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V) bool
+	Delete(key K)
+}
+
+// NewSentryCache wraps store, system being the name of the cache
+// implementation recorded as "db.system".
+func NewSentryCache[K comparable, V any](system string, store Store[K, V], opts ...SentryLocalCacheTracerOption) *Cache[K, V] {
+	t := tracer{
+		scrubKey: func(key string) string { return key },
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return &Cache[K, V]{
+		store:  store,
+		system: system,
+		tracer: t,
+	}
+}
+
+type Cache[K comparable, V any] struct {
+	store  Store[K, V]
+	system string
+	size   func(value V) int
+
+	tracer tracer
+}
+
+func (c *Cache[K, V]) startSpan(ctx context.Context, operation string, key K) *sentry.Span {
+	if sentry.SpanFromContext(ctx) == nil {
+		return nil
+	}
+
+	description := scrub.String(c.tracer.scrubKey(fmt.Sprint(key)))
+
+	span := integration.StartSampledSpan(ctx, c.tracer.spanSampler, operation, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", c.system)
+	span.SetData("cache.key", description)
+	span.SetData("cache.tier", "local")
+
+	for k, v := range c.tracer.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, bool) {
+	span := c.startSpan(ctx, "cache.get", key)
+	if span == nil {
+		return c.store.Get(key)
+	}
+
+	value, found := c.store.Get(key)
+	span.SetData("cache.hit", strconv.FormatBool(found))
+	if found && c.size != nil {
+		span.SetData("cache.item_size", strconv.Itoa(c.size(value)))
+	}
+	span.Status = sentry.SpanStatusOK
+	span.Finish()
+
+	return value, found
+}
+
+// Set stores value under key, returning false when the cache rejected it.
+func (c *Cache[K, V]) Set(ctx context.Context, key K, value V) bool {
+	span := c.startSpan(ctx, "cache.put", key)
+	if span == nil {
+		return c.store.Set(key, value)
+	}
+
+	if c.size != nil {
+		span.SetData("cache.item_size", strconv.Itoa(c.size(value)))
+	}
+
+	stored := c.store.Set(key, value)
+	span.SetData("cache.stored", strconv.FormatBool(stored))
+	span.Status = sentry.SpanStatusOK
+	span.Finish()
+
+	return stored
+}
+
+func (c *Cache[K, V]) Delete(ctx context.Context, key K) {
+	span := c.startSpan(ctx, "cache.remove", key)
+	if span == nil {
+		c.store.Delete(key)
+		return
+	}
+
+	c.store.Delete(key)
+	span.Status = sentry.SpanStatusOK
+	span.Finish()
+}
+
+// NewSentryRistretto wraps a ristretto cache. Items are set with a cost of 0,
+// so the Cost function of the ristretto configuration is used.
+func NewSentryRistretto(cache *ristretto.Cache, opts ...SentryLocalCacheTracerOption) *Cache[interface{}, interface{}] {
+	return NewSentryCache[interface{}, interface{}]("ristretto", ristrettoStore{cache: cache}, opts...)
+}
+
+type ristrettoStore struct {
+	cache *ristretto.Cache
+}
+
+func (s ristrettoStore) Get(key interface{}) (interface{}, bool) {
+	return s.cache.Get(key)
+}
+
+func (s ristrettoStore) Set(key interface{}, value interface{}) bool {
+	return s.cache.Set(key, value, 0)
+}
+
+func (s ristrettoStore) Delete(key interface{}) {
+	s.cache.Del(key)
+}
+
+// NewSentryBigCache wraps a bigcache cache.
+func NewSentryBigCache(cache *bigcache.BigCache, opts ...SentryLocalCacheTracerOption) *Cache[string, []byte] {
+	c := NewSentryCache[string, []byte]("bigcache", bigcacheStore{cache: cache}, opts...)
+	c.size = func(value []byte) int { return len(value) }
+
+	return c
+}
+
+type bigcacheStore struct {
+	cache *bigcache.BigCache
+}
+
+func (s bigcacheStore) Get(key string) ([]byte, bool) {
+	value, err := s.cache.Get(key)
+	return value, err == nil
+}
+
+func (s bigcacheStore) Set(key string, value []byte) bool {
+	return s.cache.Set(key, value) == nil
+}
+
+func (s bigcacheStore) Delete(key string) {
+	_ = s.cache.Delete(key)
+}
@@ -0,0 +1,101 @@
+package mailtracer
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/semconv"
+	"gopkg.in/gomail.v2"
+)
+
+func NewSentryDialer(dialer *gomail.Dialer, opts ...SentryMailTracerOption) *Dialer {
+	return &Dialer{
+		Dialer: dialer,
+		tracer: newTracer(opts...),
+	}
+}
+
+// Dialer wraps a gomail.Dialer. Emails sent through the connections it opens
+// are traced.
+type Dialer struct {
+	*gomail.Dialer
+	tracer *tracer
+}
+
+// Dial implements gomail.Dialer.Dial. Emails sent through the returned
+// gomail.SendCloser are traced as children of the span of ctx.
+func (d *Dialer) Dial(ctx context.Context) (gomail.SendCloser, error) {
+	data := map[string]interface{}{
+		semconv.ServerAddress.Key(): d.Host,
+		semconv.ServerPort.Key():    d.Port,
+		"tls":                       d.SSL,
+	}
+	if d.Username != "" || d.Auth != nil {
+		data["auth"] = true
+	}
+
+	sender, err := d.Dialer.Dial()
+	addPhaseBreadcrumb("Connect "+d.Host, data, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sendCloser{
+		SendCloser: sender,
+		ctx:        ctx,
+		host:       d.Host,
+		port:       strconv.Itoa(d.Port),
+		tracer:     d.tracer,
+	}, nil
+}
+
+// DialAndSend implements gomail.Dialer.DialAndSend.
+func (d *Dialer) DialAndSend(ctx context.Context, m ...*gomail.Message) error {
+	sender, err := d.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	return gomail.Send(sender, m...)
+}
+
+type sendCloser struct {
+	gomail.SendCloser
+	ctx    context.Context
+	host   string
+	port   string
+	tracer *tracer
+}
+
+func (s *sendCloser) Send(from string, to []string, msg io.WriterTo) error {
+	span := s.tracer.startSpan(s.ctx, s.host, s.port, len(to))
+	if span == nil {
+		return s.SendCloser.Send(from, to, msg)
+	}
+
+	counted := &countedMessage{WriterTo: msg}
+	err := s.SendCloser.Send(from, to, counted)
+	if counted.size > 0 {
+		span.SetData("email.message_size", strconv.FormatInt(counted.size, 10))
+	}
+	finish(span, err)
+
+	return err
+}
+
+// countedMessage records the size of a message as gomail writes it to the
+// server.
+type countedMessage struct {
+	io.WriterTo
+	size int64
+}
+
+func (m *countedMessage) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	_, err := m.WriterTo.WriteTo(cw)
+	m.size = cw.n
+
+	return cw.n, err
+}
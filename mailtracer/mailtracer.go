@@ -0,0 +1,161 @@
+// Package mailtracer provides a tracer implementation for sending emails, both
+// through net/smtp and gopkg.in/gomail.v2.
+//
+//	err := mailtracer.SendMail(ctx, "smtp.example.com:587", auth, from, to, msg)
+//
+//	dialer := mailtracer.NewSentryDialer(gomail.NewDialer("smtp.example.com", 587, username, password))
+//	err := dialer.DialAndSend(ctx, message)
+//
+// Every sent email is recorded as an "email.send" span with the number of
+// recipients and the size of the message. Email addresses are never recorded.
+// The connection, TLS and authentication phases are recorded as breadcrumbs.
+package mailtracer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/textproto"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.email"}
+
+// SetEnabled turns the spans of sent emails on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryMailTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryMailTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryMailTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler sends emails for which sampler returns false, given the
+// "email.send" operation and the "SMTP host" description, without a span.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryMailTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryMailTracerOption) *tracer {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *tracer) startSpan(ctx context.Context, host string, port string, recipients int) *sentry.Span {
+	description := "SMTP " + host
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "email.send", description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData(semconv.ServerAddress.Key(), host)
+	if port != "" {
+		span.SetData(semconv.ServerPort.Key(), port)
+	}
+	span.SetData("email.recipient_count", strconv.Itoa(recipients))
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// finish records the SMTP response code of err, when the server rejected the
+// email. Successful sends are only accepted with a 250 reply, which net/smtp
+// does not expose.
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) {
+			span.SetData("smtp.response.code", strconv.Itoa(smtpErr.Code))
+			span.Status = smtpSpanStatus(smtpErr.Code)
+		}
+	} else {
+		span.Status = sentry.SpanStatusOK
+		span.SetData("smtp.response.code", "250")
+	}
+
+	span.Finish()
+}
+
+// smtpSpanStatus maps an SMTP reply code to a span status. Transient (4xx)
+// failures are reported as unavailable, permanent (5xx) ones by their kind.
+func smtpSpanStatus(code int) sentry.SpanStatus {
+	switch {
+	case code == 535 || code == 530:
+		return sentry.SpanStatusUnauthenticated
+	case code == 550 || code == 551 || code == 553:
+		return sentry.SpanStatusInvalidArgument
+	case code == 552 || code == 452:
+		return sentry.SpanStatusResourceExhausted
+	case code >= 400 && code < 500:
+		return sentry.SpanStatusUnavailable
+	default:
+		return sentry.SpanStatusInternalError
+	}
+}
+
+func addPhaseBreadcrumb(message string, data map[string]interface{}, err error) {
+	level := sentry.LevelInfo
+	if err != nil {
+		level = sentry.LevelError
+		data["error"] = err.Error()
+	}
+
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "smtp",
+		Message:  message,
+		Data:     data,
+		Level:    level,
+	})
+}
+
+// countingWriter counts the bytes of a message as it is written to the
+// server.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,101 @@
+package mailtracer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/semconv"
+)
+
+// SendMail implements smtp.SendMail, with the connection bound to ctx.
+func SendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte, opts ...SentryMailTracerOption) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	t := newTracer(opts...)
+
+	span := t.startSpan(ctx, host, port, len(to))
+	if span == nil {
+		return sendMail(ctx, addr, host, a, from, to, msg)
+	}
+
+	span.SetData("email.message_size", strconv.Itoa(len(msg)))
+
+	err = sendMail(span.Context(), addr, host, a, from, to, msg)
+	finish(span, err)
+
+	return err
+}
+
+// sendMail follows smtp.SendMail, recording each phase of the SMTP
+// conversation as a breadcrumb.
+func sendMail(ctx context.Context, addr, host string, a smtp.Auth, from string, to []string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		addPhaseBreadcrumb("Connect "+addr, map[string]interface{}{semconv.ServerAddress.Key(): addr}, err)
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	addPhaseBreadcrumb("Connect "+addr, map[string]interface{}{semconv.ServerAddress.Key(): addr}, err)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	// Stop the conversation once ctx is done, smtp.Client has no notion of it.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		addPhaseBreadcrumb("STARTTLS", map[string]interface{}{}, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+
+		err = c.Auth(a)
+		addPhaseBreadcrumb("AUTH", map[string]interface{}{}, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err = c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,201 @@
+// Package memcachetracer provides a tracer implementation for gomemcache.
+// Spans follow Sentry's cache module conventions, so hits and misses show up in
+// the Caches insights.
+//
+//	mc := memcachetracer.NewSentryClient(memcache.New("127.0.0.1:11211"))
+//
+//	item, err := mc.Get(ctx, "user:42")
+//	if errors.Is(err, memcache.ErrCacheMiss) {
+//		// ...
+//	}
+package memcachetracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.cache.memcache"}
+
+// SetEnabled turns the spans of memcached operations on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryMemcacheTracerOption func(*Client)
+
+func WithTags(tags map[string]string) SentryMemcacheTracerOption {
+	return func(c *Client) {
+		for k, v := range tags {
+			c.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryMemcacheTracerOption {
+	return func(c *Client) {
+		c.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of operations for which sampler returns
+// false, given the operation and the scrubbed keys joined by commas.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryMemcacheTracerOption {
+	return func(c *Client) {
+		c.spanSampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every cache key before it is
+// recorded on a span, e.g. to strip user identifiers out of the key.
+func WithKeyScrubber(scrubber func(key string) string) SentryMemcacheTracerOption {
+	return func(c *Client) {
+		c.scrubKey = scrubber
+	}
+}
+
+// WithServerAddress records the address of the memcached server on spans.
+func WithServerAddress(address string) SentryMemcacheTracerOption {
+	return func(c *Client) {
+		c.address = address
+	}
+}
+
+func NewSentryClient(client *memcache.Client, opts ...SentryMemcacheTracerOption) *Client {
+	c := &Client{
+		Client:   client,
+		scrubKey: func(key string) string { return key },
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Client wraps a memcache.Client. Get, GetMulti, Set and Delete are traced,
+// other methods are forwarded to the underlying client as-is.
+type Client struct {
+	*memcache.Client
+
+	address     string
+	scrubKey    func(key string) string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (c *Client) startSpan(ctx context.Context, operation string, keys ...string) *sentry.Span {
+	scrubbed := make([]string, len(keys))
+	for i, key := range keys {
+		scrubbed[i] = scrub.String(c.scrubKey(key))
+	}
+	description := strings.Join(scrubbed, ", ")
+
+	span := integration.StartSampledSpan(ctx, c.spanSampler, operation, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", "memcached")
+	span.SetData("cache.key", description)
+	if c.address != "" {
+		span.SetData("network.peer.address", c.address)
+	}
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// finish sets the status of span, treating a cache miss as a successful
+// operation.
+func finish(span *sentry.Span, err error) {
+	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+func (c *Client) Get(ctx context.Context, key string) (*memcache.Item, error) {
+	span := c.startSpan(ctx, "cache.get", key)
+	if span == nil {
+		return c.Client.Get(key)
+	}
+
+	item, err := c.Client.Get(key)
+	span.SetData("cache.hit", strconv.FormatBool(err == nil))
+	if err == nil {
+		span.SetData("cache.item_size", strconv.Itoa(len(item.Value)))
+	}
+	finish(span, err)
+
+	return item, err
+}
+
+func (c *Client) GetMulti(ctx context.Context, keys []string) (map[string]*memcache.Item, error) {
+	span := c.startSpan(ctx, "cache.get", keys...)
+	if span == nil {
+		return c.Client.GetMulti(keys)
+	}
+
+	items, err := c.Client.GetMulti(keys)
+	if err == nil {
+		var size int
+		for _, item := range items {
+			size += len(item.Value)
+		}
+
+		span.SetData("cache.hit", strconv.FormatBool(len(items) > 0))
+		span.SetData("cache.hit_count", strconv.Itoa(len(items)))
+		span.SetData("cache.item_size", strconv.Itoa(size))
+	}
+	finish(span, err)
+
+	return items, err
+}
+
+func (c *Client) Set(ctx context.Context, item *memcache.Item) error {
+	span := c.startSpan(ctx, "cache.put", item.Key)
+	if span == nil {
+		return c.Client.Set(item)
+	}
+
+	span.SetData("cache.item_size", strconv.Itoa(len(item.Value)))
+	if item.Expiration != 0 {
+		span.SetData("cache.ttl", strconv.FormatInt(int64(item.Expiration), 10))
+	}
+
+	err := c.Client.Set(item)
+	finish(span, err)
+
+	return err
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	span := c.startSpan(ctx, "cache.remove", key)
+	if span == nil {
+		return c.Client.Delete(key)
+	}
+
+	err := c.Client.Delete(key)
+	span.SetData("cache.hit", strconv.FormatBool(err == nil))
+	finish(span, err)
+
+	return err
+}
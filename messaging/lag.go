@@ -0,0 +1,36 @@
+package messaging
+
+import (
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/metrics"
+	"github.com/getsentry/sentry-go"
+)
+
+// ConsumerLagKey is the span data key, and the name of the gauge, of the
+// number of messages of a partition left to consume after a message.
+const ConsumerLagKey = "messaging.consumer.lag"
+
+// SetConsumerLag records lag on span. Negative lags, which mean the lag is
+// not known yet, are not recorded.
+func SetConsumerLag(span *sentry.Span, lag int64) {
+	if span == nil || lag < 0 {
+		return
+	}
+
+	setInt(span, ConsumerLagKey, lag)
+}
+
+// RecordConsumerLag records lag as the current value of the ConsumerLagKey
+// gauge of a partition of destination. Negative lags are not recorded.
+func RecordConsumerLag(system, destination string, partition int32, lag int64) {
+	if lag < 0 {
+		return
+	}
+
+	metrics.Gauge(ConsumerLagKey, float64(lag), metrics.UnitNone, map[string]string{
+		"messaging.system":                   system,
+		"messaging.destination.name":         destination,
+		"messaging.destination.partition.id": strconv.FormatInt(int64(partition), 10),
+	})
+}
@@ -0,0 +1,99 @@
+// Package messaging records the data of the Sentry Queues insights the same
+// way for every queue integration.
+//
+//	messaging.SetReceiveLatency(span, message.Timestamp, time.Now())
+//	messaging.SetBodySize(span, len(message.Value))
+//
+// Both are recorded as integers, which the Queues insights aggregate.
+package messaging
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+// ReceiveLatencyKey is the span data key of the time a message spent in its
+// queue, in milliseconds.
+const ReceiveLatencyKey = "messaging.message.receive.latency"
+
+// MaxClockSkew is how far in the future of the consumer clock an enqueue
+// timestamp may be, as the clocks of producers and brokers drift. Such
+// latencies are recorded as zero, later timestamps are not recorded at all.
+const MaxClockSkew = time.Minute
+
+// ReceiveLatency returns the time between enqueuedAt and receivedAt. It
+// reports false when enqueuedAt is zero, or further in the future of
+// receivedAt than MaxClockSkew.
+func ReceiveLatency(enqueuedAt, receivedAt time.Time) (time.Duration, bool) {
+	if enqueuedAt.IsZero() {
+		return 0, false
+	}
+
+	latency := receivedAt.Sub(enqueuedAt)
+	if latency < 0 {
+		if -latency > MaxClockSkew {
+			return 0, false
+		}
+		latency = 0
+	}
+
+	return latency, true
+}
+
+// SetReceiveLatency records the receive latency of a message enqueued at
+// enqueuedAt and received at receivedAt on span, see ReceiveLatency.
+func SetReceiveLatency(span *sentry.Span, enqueuedAt, receivedAt time.Time) {
+	if span == nil {
+		return
+	}
+
+	if latency, ok := ReceiveLatency(enqueuedAt, receivedAt); ok {
+		setInt(span, ReceiveLatencyKey, latency.Milliseconds())
+	}
+}
+
+// SetBodySize records size, in bytes, as the body size of the message of
+// span.
+func SetBodySize(span *sentry.Span, size int) {
+	if span == nil {
+		return
+	}
+
+	setInt(span, semconv.MessagingMessageBodySize.Key(), int64(size))
+}
+
+// setInt sets the data key of span to value. Span.SetData only takes strings,
+// so the data map is written directly, as config.SpanData.Apply does, by the
+// integration that started span and has not shared it yet.
+func setInt(span *sentry.Span, key string, value int64) {
+	if span.Data == nil {
+		span.Data = make(map[string]interface{})
+	}
+	span.Data[key] = value
+}
+
+// ParseUnixMilli parses an enqueue timestamp in milliseconds since the Unix
+// epoch, such as the SentTimestamp attribute of SQS messages. It returns the
+// zero time when value is not a positive integer.
+func ParseUnixMilli(value string) time.Time {
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || millis <= 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(millis)
+}
+
+// UnixNano returns the time of an enqueue timestamp in nanoseconds since the
+// Unix epoch, such as the timestamp of NSQ messages, or the zero time when
+// nanos is not positive.
+func UnixNano(nanos int64) time.Time {
+	if nanos <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,336 @@
+// Package metrics aggregates counters, distributions and gauges emitted by the
+// integrations, and sends them to Sentry periodically. Aggregates give an
+// overview of the health of a service, such as cache hit ratios or query
+// durations, without having to sample every span.
+//
+//	metrics.Start(metrics.WithFlushInterval(10 * time.Second))
+//	defer metrics.Stop()
+//
+//	metrics.Increment("checkout.completed", 1, "none", map[string]string{"plan": "pro"})
+//
+// Until Start is called, emitting a metric does nothing, so integrations emit
+// them unconditionally.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Units of the metrics emitted by the integrations.
+const (
+	UnitNone        = "none"
+	UnitMillisecond = "millisecond"
+	UnitByte        = "byte"
+)
+
+type Option func(*Aggregator)
+
+// WithFlushInterval sets how often aggregated metrics are sent, 10 seconds by
+// default. Metrics are aggregated in buckets of the same duration.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(a *Aggregator) {
+		if interval > 0 {
+			a.interval = interval
+		}
+	}
+}
+
+// WithHub sends metrics through the client of hub instead of the client of
+// sentry.CurrentHub.
+func WithHub(hub *sentry.Hub) Option {
+	return func(a *Aggregator) {
+		a.hub = hub
+	}
+}
+
+// WithTags adds tags to every metric, e.g. the name of the service.
+func WithTags(tags map[string]string) Option {
+	return func(a *Aggregator) {
+		for k, v := range tags {
+			a.tags[k] = v
+		}
+	}
+}
+
+// WithSender replaces how flushed metrics are sent. send receives the metrics
+// encoded in the statsd format Sentry expects, one per line.
+func WithSender(send func(payload []byte) error) Option {
+	return func(a *Aggregator) {
+		a.send = send
+	}
+}
+
+type metricType byte
+
+const (
+	counter      metricType = 'c'
+	distribution metricType = 'd'
+	gauge        metricType = 'g'
+)
+
+// value is the aggregate of one metric, with one set of tags, over one bucket.
+type value struct {
+	metricType metricType
+	name       string
+	unit       string
+	tags       string
+
+	// sum is the total of a counter, or the sum of gauge values.
+	sum    float64
+	values []float64
+
+	last, min, max float64
+	count          int
+}
+
+func (v *value) add(f float64) {
+	switch v.metricType {
+	case counter:
+		v.sum += f
+	case distribution:
+		v.values = append(v.values, f)
+	case gauge:
+		if v.count == 0 || f < v.min {
+			v.min = f
+		}
+		if v.count == 0 || f > v.max {
+			v.max = f
+		}
+		v.last = f
+		v.sum += f
+		v.count++
+	}
+}
+
+// Aggregator aggregates metrics in buckets of the flush interval. The zero
+// value is not usable, create one with New.
+type Aggregator struct {
+	interval time.Duration
+	hub      *sentry.Hub
+	tags     map[string]string
+	send     func(payload []byte) error
+
+	mu      sync.Mutex
+	buckets map[int64]map[string]*value
+	closed  bool
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// New returns an Aggregator flushing its metrics every flush interval, until
+// Close is called.
+func New(opts ...Option) *Aggregator {
+	a := &Aggregator{
+		interval: 10 * time.Second,
+		tags:     make(map[string]string),
+		buckets:  make(map[int64]map[string]*value),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	if a.send == nil {
+		a.send = a.sendEnvelope
+	}
+
+	go a.loop()
+
+	return a
+}
+
+func (a *Aggregator) loop() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.flush(false)
+		case <-a.stop:
+			a.flush(true)
+			return
+		}
+	}
+}
+
+// Increment adds value to the counter name.
+func (a *Aggregator) Increment(name string, value float64, unit string, tags map[string]string) {
+	a.add(counter, name, value, unit, tags)
+}
+
+// Distribution records value in the distribution name, e.g. a duration.
+func (a *Aggregator) Distribution(name string, value float64, unit string, tags map[string]string) {
+	a.add(distribution, name, value, unit, tags)
+}
+
+// Gauge records value as the current value of the gauge name, also keeping
+// its minimum, maximum, sum and count over the bucket.
+func (a *Aggregator) Gauge(name string, value float64, unit string, tags map[string]string) {
+	a.add(gauge, name, value, unit, tags)
+}
+
+func (a *Aggregator) add(metricType metricType, name string, f float64, unit string, tags map[string]string) {
+	if unit == "" {
+		unit = UnitNone
+	}
+
+	serializedTags := a.serializeTags(tags)
+	key := string(metricType) + name + "@" + unit + "|" + serializedTags
+	timestamp := time.Now().Truncate(a.interval).Unix()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return
+	}
+
+	bucket, ok := a.buckets[timestamp]
+	if !ok {
+		bucket = make(map[string]*value)
+		a.buckets[timestamp] = bucket
+	}
+
+	v, ok := bucket[key]
+	if !ok {
+		v = &value{metricType: metricType, name: name, unit: unit, tags: serializedTags}
+		bucket[key] = v
+	}
+
+	v.add(f)
+}
+
+// serializeTags merges tags with the tags of the aggregator, and encodes them
+// sorted by key, so the same tags always map to the same aggregate.
+func (a *Aggregator) serializeTags(tags map[string]string) string {
+	if len(tags) == 0 && len(a.tags) == 0 {
+		return ""
+	}
+
+	merged := make(map[string]string, len(a.tags)+len(tags))
+	for k, v := range a.tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sanitizeTagKey(k))
+		b.WriteByte(':')
+		b.WriteString(escapeTagValue(merged[k]))
+	}
+
+	return b.String()
+}
+
+// Flush sends every aggregated metric, including those of the current bucket.
+func (a *Aggregator) Flush() {
+	a.flush(true)
+}
+
+// flush sends the buckets that are complete, or every bucket when force is
+// set. Failures are dropped, as metrics are not worth retrying.
+func (a *Aggregator) flush(force bool) {
+	cutoff := time.Now().Truncate(a.interval).Unix()
+
+	a.mu.Lock()
+	flushed := make(map[int64]map[string]*value)
+	for timestamp, bucket := range a.buckets {
+		if force || timestamp < cutoff {
+			flushed[timestamp] = bucket
+			delete(a.buckets, timestamp)
+		}
+	}
+	a.mu.Unlock()
+
+	if len(flushed) == 0 {
+		return
+	}
+
+	_ = a.send(encode(flushed))
+}
+
+// Close stops the flush loop, after sending every aggregated metric. Metrics
+// emitted afterwards are dropped.
+func (a *Aggregator) Close() {
+	a.closeOnce.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		a.mu.Unlock()
+
+		close(a.stop)
+	})
+
+	<-a.done
+}
+
+var current atomic.Pointer[Aggregator]
+
+// Start creates the Aggregator the package level functions emit metrics to.
+// It is meant to be called once at startup, a previous Aggregator is closed.
+func Start(opts ...Option) {
+	if previous := current.Swap(New(opts...)); previous != nil {
+		previous.Close()
+	}
+}
+
+// Stop closes the Aggregator created by Start, sending every aggregated
+// metric. Metrics emitted afterwards are dropped.
+func Stop() {
+	if a := current.Swap(nil); a != nil {
+		a.Close()
+	}
+}
+
+// Enabled reports whether Start has been called, for integrations to skip
+// computing metrics nobody receives.
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Increment adds value to the counter name, when Start has been called.
+func Increment(name string, value float64, unit string, tags map[string]string) {
+	if a := current.Load(); a != nil {
+		a.Increment(name, value, unit, tags)
+	}
+}
+
+// Distribution records value in the distribution name, when Start has been
+// called.
+func Distribution(name string, value float64, unit string, tags map[string]string) {
+	if a := current.Load(); a != nil {
+		a.Distribution(name, value, unit, tags)
+	}
+}
+
+// Gauge records value as the current value of the gauge name, when Start has
+// been called.
+func Gauge(name string, value float64, unit string, tags map[string]string) {
+	if a := current.Load(); a != nil {
+		a.Gauge(name, value, unit, tags)
+	}
+}
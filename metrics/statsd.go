@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/internal/envelope"
+)
+
+// encode writes the buckets in the statsd format of Sentry, e.g.
+// "cache.hit@none:3|c|#cache.tier:local|T1700000000".
+func encode(buckets map[int64]map[string]*value) []byte {
+	timestamps := make([]int64, 0, len(buckets))
+	for timestamp := range buckets {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	var b bytes.Buffer
+	for _, timestamp := range timestamps {
+		for _, v := range buckets[timestamp] {
+			b.WriteString(sanitizeName(v.name))
+			b.WriteByte('@')
+			b.WriteString(sanitizeName(v.unit))
+
+			switch v.metricType {
+			case counter:
+				b.WriteByte(':')
+				b.WriteString(formatFloat(v.sum))
+			case distribution:
+				for _, f := range v.values {
+					b.WriteByte(':')
+					b.WriteString(formatFloat(f))
+				}
+			case gauge:
+				for _, f := range []float64{v.last, v.min, v.max, v.sum, float64(v.count)} {
+					b.WriteByte(':')
+					b.WriteString(formatFloat(f))
+				}
+			}
+
+			b.WriteByte('|')
+			b.WriteByte(byte(v.metricType))
+			if v.tags != "" {
+				b.WriteString("|#")
+				b.WriteString(v.tags)
+			}
+			b.WriteString("|T")
+			b.WriteString(strconv.FormatInt(timestamp, 10))
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.Bytes()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func sanitize(s string, allowed func(r rune) bool) string {
+	return strings.Map(func(r rune) rune {
+		if allowed(r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func sanitizeName(name string) string {
+	return sanitize(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || isAlphanumeric(r)
+	})
+}
+
+func sanitizeTagKey(key string) string {
+	return sanitize(key, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || r == '/' || isAlphanumeric(r)
+	})
+}
+
+func isAlphanumeric(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+var tagValueReplacer = strings.NewReplacer(
+	"\\", `\\`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+	"|", `\u{7c}`,
+	",", `\u{2c}`,
+)
+
+func escapeTagValue(value string) string {
+	return tagValueReplacer.Replace(value)
+}
+
+// sendEnvelope sends payload as a statsd envelope item to the DSN of the
+// client of the hub.
+func (a *Aggregator) sendEnvelope(payload []byte) error {
+	return envelope.Send(a.hub, "statsd", payload)
+}
@@ -0,0 +1,206 @@
+// Package microtracer provides handler and client wrappers for go-micro.
+//
+//	service := micro.NewService(
+//		micro.Name("greeter"),
+//		micro.WrapHandler(microtracer.NewHandlerWrapper()),
+//		micro.WrapClient(microtracer.NewClientWrapper()),
+//	)
+//
+// Every handled request is a "rpc.server" transaction, continued from the
+// trace context the caller sent as metadata. Every call made through the
+// client is a "rpc.client" span, and sends the trace context as metadata.
+package microtracer
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/getsentry/sentry-go"
+	"go-micro.dev/v4/client"
+	"go-micro.dev/v4/errors"
+	"go-micro.dev/v4/metadata"
+	"go-micro.dev/v4/server"
+)
+
+var integration = config.Integration{Origin: "auto.rpc.micro"}
+
+// SetEnabled turns the spans of go-micro requests on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryMicroTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryMicroTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryMicroTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of requests for which sampler returns false,
+// given the operation and the endpoint, e.g. "Greeter.Hello".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryMicroTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts []SentryMicroTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setData(span *sentry.Span, service, endpoint string) {
+	span.SetData("rpc.system", "go-micro")
+	span.SetData("rpc.service", service)
+	span.SetData("rpc.method", endpoint)
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// metadataCarrier is a propagation.Carrier over go-micro metadata, which
+// keys are case-insensitive.
+type metadataCarrier metadata.Metadata
+
+func (c metadataCarrier) Get(key string) string {
+	value, _ := metadata.Metadata(c).Get(key)
+	return value
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.Metadata(c).Set(key, value)
+}
+
+// NewHandlerWrapper returns a server.HandlerWrapper handling every request
+// within a "rpc.server" transaction.
+func NewHandlerWrapper(opts ...SentryMicroTracerOption) server.HandlerWrapper {
+	t := newTracer(opts)
+
+	return func(next server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			md, _ := metadata.FromContext(ctx)
+			ctx, continueTrace := propagation.Continue(ctx, metadataCarrier(md))
+
+			span := integration.StartTransaction(ctx, t.spanSampler, "rpc.server", req.Endpoint(), continueTrace)
+			if span == nil {
+				return next(ctx, req, rsp)
+			}
+			defer span.Finish()
+
+			t.setData(span, req.Service(), req.Endpoint())
+
+			err := next(span.Context(), req, rsp)
+			finish(span, err)
+
+			return err
+		}
+	}
+}
+
+// NewClientWrapper returns a client.Wrapper making every call within a
+// "rpc.client" span.
+func NewClientWrapper(opts ...SentryMicroTracerOption) client.Wrapper {
+	t := newTracer(opts)
+
+	return func(c client.Client) client.Client {
+		return &sentryClient{Client: c, tracer: t}
+	}
+}
+
+type sentryClient struct {
+	client.Client
+	tracer tracer
+}
+
+// startSpan starts the "rpc.client" span of a call to endpoint of service,
+// returning the context of the call carrying its trace context as metadata.
+func (c *sentryClient) startSpan(ctx context.Context, service, endpoint string) (context.Context, *sentry.Span) {
+	span := integration.StartSampledSpan(ctx, c.tracer.spanSampler, "rpc.client", endpoint)
+	if span == nil {
+		return ctx, nil
+	}
+
+	c.tracer.setData(span, service, endpoint)
+
+	md, ok := metadata.FromContext(ctx)
+	if ok {
+		md = metadata.Copy(md)
+	} else {
+		md = metadata.Metadata{}
+	}
+	propagation.Inject(span, metadataCarrier(md))
+
+	return metadata.NewContext(span.Context(), md), span
+}
+
+func (c *sentryClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	ctx, span := c.startSpan(ctx, req.Service(), req.Endpoint())
+	if span == nil {
+		return c.Client.Call(ctx, req, rsp, opts...)
+	}
+	defer span.Finish()
+
+	err := c.Client.Call(ctx, req, rsp, opts...)
+	finish(span, err)
+
+	return err
+}
+
+// Stream opens a stream within a "rpc.client" span, lasting until the stream
+// is open.
+func (c *sentryClient) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	ctx, span := c.startSpan(ctx, req.Service(), req.Endpoint())
+	if span == nil {
+		return c.Client.Stream(ctx, req, opts...)
+	}
+	defer span.Finish()
+
+	stream, err := c.Client.Stream(ctx, req, opts...)
+	finish(span, err)
+
+	return stream, err
+}
+
+// finish sets the status of span after err, whose go-micro errors carry an
+// HTTP status code.
+func finish(span *sentry.Span, err error) {
+	if err == nil {
+		span.Status = sentry.SpanStatusOK
+		return
+	}
+
+	span.SetData("error", err.Error())
+
+	code := int(errors.FromError(err).Code)
+	if code < http.StatusBadRequest {
+		span.Status = sentry.SpanStatusInternalError
+		return
+	}
+
+	span.Status = sentry.HTTPtoSpanStatus(code)
+}
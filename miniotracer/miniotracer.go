@@ -0,0 +1,271 @@
+// Package miniotracer provides a tracer implementation for minio-go, and any
+// S3-compatible object storage it talks to.
+//
+// Object operations create spans recording the bucket, key and object size. The
+// underlying transport is traced as well, so every HTTP request the operation is
+// made of (e.g. the parts of a multipart upload) shows up as a child span.
+//
+//	client, err := miniotracer.NewSentryClient("play.min.io", &minio.Options{
+//		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
+//		Secure: true,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	info, err := client.PutObject(ctx, "my-bucket", "reports/2024.csv", file, size, minio.PutObjectOptions{})
+package miniotracer
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/httpclient"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/minio/minio-go/v7"
+)
+
+var integration = config.Integration{Origin: "auto.http.minio"}
+
+// SetEnabled turns the spans of object storage operations on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryMinioTracerOption func(*Client)
+
+func WithTags(tags map[string]string) SentryMinioTracerOption {
+	return func(c *Client) {
+		for k, v := range tags {
+			c.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryMinioTracerOption {
+	return func(c *Client) {
+		c.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of operations for which sampler returns
+// false, given the operation and the "Operation bucket/key" description.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryMinioTracerOption {
+	return func(c *Client) {
+		c.spanSampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every object key before it is
+// recorded on a span, e.g. to strip user identifiers out of the key.
+func WithKeyScrubber(scrubber func(key string) string) SentryMinioTracerOption {
+	return func(c *Client) {
+		c.scrubKey = scrubber
+	}
+}
+
+// NewSentryClient creates a minio.Client with its transport traced, wrapped in
+// a Client tracing object operations.
+func NewSentryClient(endpoint string, options *minio.Options, opts ...SentryMinioTracerOption) (*Client, error) {
+	if options == nil {
+		options = &minio.Options{}
+	}
+
+	if options.Transport == nil {
+		transport, err := minio.DefaultTransport(options.Secure)
+		if err != nil {
+			return nil, err
+		}
+		options.Transport = transport
+	}
+	options.Transport = httpclient.NewSentryRoundTripper(options.Transport, nil)
+
+	client, err := minio.New(endpoint, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return WrapClient(client, opts...), nil
+}
+
+// WrapClient wraps an existing minio.Client. Only object operations are traced,
+// use NewSentryClient to trace the underlying transport as well.
+func WrapClient(client *minio.Client, opts ...SentryMinioTracerOption) *Client {
+	c := &Client{
+		Client:   client,
+		scrubKey: func(key string) string { return key },
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Client wraps a minio.Client. PutObject, FPutObject, GetObject, FGetObject,
+// StatObject and RemoveObject are traced, other methods are forwarded to the
+// underlying client as-is.
+type Client struct {
+	*minio.Client
+
+	scrubKey    func(key string) string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (c *Client) startSpan(ctx context.Context, op, operation, bucketName, objectName string) *sentry.Span {
+	key := c.scrubKey(objectName)
+	description := operation + " " + bucketName + "/" + key
+
+	span := integration.StartSampledSpan(ctx, c.spanSampler, op, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("aws.s3.bucket", bucketName)
+	span.SetData("aws.s3.key", key)
+	span.SetData(semconv.ServerAddress.Key(), c.EndpointURL().Hostname())
+	if port := c.EndpointURL().Port(); port != "" {
+		span.SetData(semconv.ServerPort.Key(), port)
+	}
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// recordUpload records the result of an upload. Multipart uploads have an ETag
+// suffixed with the number of parts, e.g. "<hash>-12".
+func recordUpload(span *sentry.Span, info minio.UploadInfo) {
+	span.SetData("aws.s3.object_size", strconv.FormatInt(info.Size, 10))
+	if info.VersionID != "" {
+		span.SetData("aws.s3.version_id", info.VersionID)
+	}
+
+	if i := strings.LastIndex(info.ETag, "-"); i >= 0 {
+		if parts, err := strconv.Atoi(info.ETag[i+1:]); err == nil {
+			span.SetData("aws.s3.multipart", "true")
+			span.SetData("aws.s3.parts", strconv.Itoa(parts))
+			return
+		}
+	}
+	span.SetData("aws.s3.multipart", "false")
+}
+
+func (c *Client) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	span := c.startSpan(ctx, "object.put", "PutObject", bucketName, objectName)
+	if span == nil {
+		return c.Client.PutObject(ctx, bucketName, objectName, reader, objectSize, opts)
+	}
+
+	if opts.PartSize > 0 {
+		span.SetData("aws.s3.part_size", strconv.FormatUint(opts.PartSize, 10))
+	}
+
+	info, err := c.Client.PutObject(span.Context(), bucketName, objectName, reader, objectSize, opts)
+	if err == nil {
+		recordUpload(span, info)
+	}
+	finish(span, err)
+
+	return info, err
+}
+
+func (c *Client) FPutObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	span := c.startSpan(ctx, "object.put", "FPutObject", bucketName, objectName)
+	if span == nil {
+		return c.Client.FPutObject(ctx, bucketName, objectName, filePath, opts)
+	}
+
+	info, err := c.Client.FPutObject(span.Context(), bucketName, objectName, filePath, opts)
+	if err == nil {
+		recordUpload(span, info)
+	}
+	finish(span, err)
+
+	return info, err
+}
+
+// GetObject implements minio.Client.GetObject. minio-go reads objects lazily,
+// so the object is stat'ed within the span to record its size. A failure to do
+// so is recorded on the span, and returned by the object on its first read as
+// it would be without tracing.
+func (c *Client) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error) {
+	span := c.startSpan(ctx, "object.get", "GetObject", bucketName, objectName)
+	if span == nil {
+		return c.Client.GetObject(ctx, bucketName, objectName, opts)
+	}
+
+	object, err := c.Client.GetObject(span.Context(), bucketName, objectName, opts)
+	if err != nil {
+		finish(span, err)
+		return object, err
+	}
+
+	info, err := object.Stat()
+	if err == nil {
+		span.SetData("aws.s3.object_size", strconv.FormatInt(info.Size, 10))
+	}
+	finish(span, err)
+
+	return object, nil
+}
+
+func (c *Client) FGetObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.GetObjectOptions) error {
+	span := c.startSpan(ctx, "object.get", "FGetObject", bucketName, objectName)
+	if span == nil {
+		return c.Client.FGetObject(ctx, bucketName, objectName, filePath, opts)
+	}
+
+	err := c.Client.FGetObject(span.Context(), bucketName, objectName, filePath, opts)
+	finish(span, err)
+
+	return err
+}
+
+func (c *Client) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	span := c.startSpan(ctx, "object.stat", "StatObject", bucketName, objectName)
+	if span == nil {
+		return c.Client.StatObject(ctx, bucketName, objectName, opts)
+	}
+
+	info, err := c.Client.StatObject(span.Context(), bucketName, objectName, opts)
+	if err == nil {
+		span.SetData("aws.s3.object_size", strconv.FormatInt(info.Size, 10))
+	}
+	finish(span, err)
+
+	return info, err
+}
+
+func (c *Client) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	span := c.startSpan(ctx, "object.remove", "RemoveObject", bucketName, objectName)
+	if span == nil {
+		return c.Client.RemoveObject(ctx, bucketName, objectName, opts)
+	}
+
+	err := c.Client.RemoveObject(span.Context(), bucketName, objectName, opts)
+	finish(span, err)
+
+	return err
+}
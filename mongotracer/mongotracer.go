@@ -0,0 +1,352 @@
+// Package mongotracer provides a tracer implementation for mongo-go-driver.
+//
+//	commandMonitor, poolMonitor := mongotracer.NewSentryMonitors()
+//	client, err := mongo.Connect(ctx, options.Client().
+//		ApplyURI("mongodb://localhost:27017").
+//		SetMonitor(commandMonitor).
+//		SetPoolMonitor(poolMonitor))
+//	if err != nil {
+//		return err
+//	}
+//
+// Monitors created together attribute the time spent waiting for a pooled
+// connection to the first command sent on it, as a "db.pool.wait" span, and
+// record the pool events of connections in use as breadcrumbs on the hub of
+// their command.
+package mongotracer
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var integration = config.Integration{Origin: "auto.db.mongo"}
+
+// SetEnabled turns the spans of MongoDB commands on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryMongoTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryMongoTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryMongoTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of commands for which sampler returns false,
+// given the "db" operation and the description, e.g. to leave out "ping".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryMongoTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type spanKey struct {
+	connectionID string
+	requestID    int64
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+
+	mu    sync.Mutex
+	spans map[spanKey]*sentry.Span
+
+	// waits holds the checkout wait of connections, by connection ID, until
+	// their first command starts. It is nil unless the pool is monitored.
+	waits map[string]time.Duration
+
+	// hubs holds the hub of the command of checked out connections, by
+	// connection ID, for the breadcrumbs of their pool events. It is nil
+	// unless the pool is monitored.
+	hubs map[string]*sentry.Hub
+}
+
+func newTracer(opts []SentryMongoTracerOption) *tracer {
+	t := &tracer{
+		tags:  make(map[string]string),
+		spans: make(map[spanKey]*sentry.Span),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func NewSentryCommandMonitor(opts ...SentryMongoTracerOption) *event.CommandMonitor {
+	return newTracer(opts).commandMonitor()
+}
+
+// NewSentryMonitors returns a command monitor and a pool monitor sharing
+// their state, so that commands record how long they waited for a pooled
+// connection.
+func NewSentryMonitors(opts ...SentryMongoTracerOption) (*event.CommandMonitor, *event.PoolMonitor) {
+	t := newTracer(opts)
+	t.waits = make(map[string]time.Duration)
+	t.hubs = make(map[string]*sentry.Hub)
+
+	return t.commandMonitor(), &event.PoolMonitor{Event: t.poolEvent}
+}
+
+func (t *tracer) commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   t.started,
+		Succeeded: t.succeeded,
+		Failed:    t.failed,
+	}
+}
+
+func (t *tracer) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	collection := collectionName(evt)
+
+	description := evt.CommandName
+	if collection != "" {
+		description += " " + collection
+	}
+
+	wait := t.checkoutWait(evt.ConnectionID)
+	if wait > 0 {
+		recordPoolWait(ctx, wait)
+	}
+	if t.hubs != nil {
+		if hub := sentry.GetHubFromContext(ctx); hub != nil {
+			t.mu.Lock()
+			t.hubs[evt.ConnectionID] = hub
+			t.mu.Unlock()
+		}
+	}
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "db", description)
+	if span == nil {
+		return
+	}
+
+	span.SetData("db.system", "mongodb")
+	span.SetData(semconv.DBName.Key(), evt.DatabaseName)
+	span.SetData(semconv.DBOperation.Key(), evt.CommandName)
+	if collection != "" {
+		span.SetData("db.mongodb.collection", collection)
+	}
+
+	host, port := serverAddress(evt.ConnectionID)
+	span.SetData(semconv.ServerAddress.Key(), host)
+	if port != "" {
+		span.SetData(semconv.ServerPort.Key(), port)
+	}
+
+	if wait > 0 {
+		span.SetData("db.mongodb.pool.wait", strconv.FormatInt(wait.Milliseconds(), 10))
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	t.mu.Lock()
+	t.spans[spanKey{connectionID: evt.ConnectionID, requestID: evt.RequestID}] = span
+	t.mu.Unlock()
+}
+
+func (t *tracer) finished(evt *event.CommandFinishedEvent) *sentry.Span {
+	key := spanKey{connectionID: evt.ConnectionID, requestID: evt.RequestID}
+
+	t.mu.Lock()
+	span, ok := t.spans[key]
+	if ok {
+		delete(t.spans, key)
+	}
+	t.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	span.SetData("db.mongodb.duration", strconv.FormatInt(evt.Duration.Milliseconds(), 10))
+
+	return span
+}
+
+func (t *tracer) succeeded(_ context.Context, evt *event.CommandSucceededEvent) {
+	span := t.finished(&evt.CommandFinishedEvent)
+	if span == nil {
+		return
+	}
+
+	span.Status = sentry.SpanStatusOK
+	span.Finish()
+}
+
+func (t *tracer) failed(_ context.Context, evt *event.CommandFailedEvent) {
+	span := t.finished(&evt.CommandFinishedEvent)
+	if span == nil {
+		return
+	}
+
+	span.Status = sentry.SpanStatusInternalError
+	span.SetData("error", evt.Failure)
+	span.Finish()
+}
+
+// collectionName returns the collection of a command, which by convention is
+// the value of the first element of the command document.
+func collectionName(evt *event.CommandStartedEvent) string {
+	element, err := evt.Command.IndexErr(0)
+	if err != nil {
+		return ""
+	}
+
+	if element.Key() != evt.CommandName {
+		return ""
+	}
+
+	collection, ok := element.Value().StringValueOK()
+	if !ok {
+		return ""
+	}
+
+	return collection
+}
+
+// serverAddress parses the host and port out of a connection ID, which has the
+// form "host:port[-N]".
+func serverAddress(connectionID string) (string, string) {
+	if i := strings.LastIndex(connectionID, "["); i >= 0 {
+		connectionID = connectionID[:i]
+	}
+
+	i := strings.LastIndex(connectionID, ":")
+	if i < 0 {
+		return connectionID, ""
+	}
+
+	return connectionID[:i], connectionID[i+1:]
+}
+
+// NewSentryPoolMonitor returns a pool monitor which records nothing.
+//
+// Deprecated: pool events carry no context to find the hub of their operation
+// from, so their breadcrumbs need the command monitor of NewSentryMonitors.
+func NewSentryPoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: func(*event.PoolEvent) {}}
+}
+
+func (t *tracer) poolEvent(evt *event.PoolEvent) {
+	id := connectionID(evt)
+
+	t.mu.Lock()
+	hub := t.hubs[id]
+	switch evt.Type {
+	case event.GetSucceeded:
+		t.waits[id] = evt.Duration
+	case event.ConnectionReturned, event.ConnectionClosed:
+		delete(t.waits, id)
+		delete(t.hubs, id)
+	}
+	t.mu.Unlock()
+
+	// Events of connections which are not checked out by a command, such as
+	// pool clears, have no operation to add their breadcrumb to.
+	if hub != nil {
+		addPoolBreadcrumb(hub, evt)
+	}
+}
+
+// checkoutWait returns the checkout wait of a connection, once.
+func (t *tracer) checkoutWait(connectionID string) time.Duration {
+	if t.waits == nil {
+		return 0
+	}
+
+	t.mu.Lock()
+	wait, ok := t.waits[connectionID]
+	if ok {
+		delete(t.waits, connectionID)
+	}
+	t.mu.Unlock()
+
+	return wait
+}
+
+// connectionID returns the ID of the connection of a pool event as command
+// events have it, "host:port[-N]".
+func connectionID(evt *event.PoolEvent) string {
+	return evt.Address + "[-" + strconv.FormatUint(evt.ConnectionID, 10) + "]"
+}
+
+// recordPoolWait starts a "db.pool.wait" span ending now, lasting wait.
+func recordPoolWait(ctx context.Context, wait time.Duration) {
+	// Waits outside of a trace are not worth a transaction of their own.
+	if sentry.SpanFromContext(ctx) == nil {
+		return
+	}
+
+	span := integration.StartSpan(ctx, "db.pool.wait", "wait")
+	if span == nil {
+		return
+	}
+
+	now := time.Now()
+	span.StartTime = now.Add(-wait)
+	span.EndTime = now
+	span.SetData("db.system", "mongodb")
+	span.Status = sentry.SpanStatusOK
+	span.Finish()
+}
+
+// addPoolBreadcrumb records connection pool lifecycle events as breadcrumbs of
+// hub.
+func addPoolBreadcrumb(hub *sentry.Hub, evt *event.PoolEvent) {
+	switch evt.Type {
+	case event.PoolCleared, event.PoolClosedEvent, event.ConnectionClosed, event.GetFailed:
+	default:
+		return
+	}
+
+	data := map[string]interface{}{
+		"address": evt.Address,
+	}
+	if evt.Reason != "" {
+		data["reason"] = evt.Reason
+	}
+	if evt.ConnectionID != 0 {
+		data["connection_id"] = evt.ConnectionID
+	}
+	if evt.Type == event.GetFailed && evt.Duration > 0 {
+		data["wait_ms"] = evt.Duration.Milliseconds()
+	}
+
+	level := sentry.LevelInfo
+	if evt.Type == event.GetFailed || evt.Type == event.PoolCleared {
+		level = sentry.LevelWarning
+	}
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "mongodb.pool",
+		Message:  evt.Type,
+		Data:     data,
+		Level:    level,
+	}, nil)
+}
@@ -0,0 +1,190 @@
+// Package mqtttracer provides a tracer implementation for the eclipse/paho.golang
+// MQTT v5 client. The trace context is carried within MQTT v5 user properties.
+//
+//	handler := mqtttracer.NewSentryPublishReceivedHandler(func(ctx context.Context, publish *paho.Publish) error {
+//		return processReading(ctx, publish.Payload)
+//	})
+//
+//	c := paho.NewClient(paho.ClientConfig{
+//		Conn:              conn,
+//		OnPublishReceived: []func(paho.PublishReceived) (bool, error){handler},
+//	})
+//
+//	client := mqtttracer.NewSentryClient(c)
+//	_, err := client.Publish(ctx, &paho.Publish{
+//		Topic:   "sensors/temperature",
+//		QoS:     1,
+//		Payload: []byte("21.5"),
+//	})
+package mqtttracer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.queue.mqtt"}
+
+// SetEnabled turns the spans of MQTT publishes and messages on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryMqttTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryMqttTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryMqttTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the topic.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryMqttTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryMqttTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+func NewSentryClient(client *paho.Client, opts ...SentryMqttTracerOption) *Client {
+	return &Client{
+		Client: client,
+		tracer: newTracer(opts...),
+	}
+}
+
+type Client struct {
+	*paho.Client
+	tracer
+}
+
+// Publish wraps paho.Client.Publish with a "queue.publish" span, and adds the
+// trace context to the user properties of the message.
+func (c *Client) Publish(ctx context.Context, publish *paho.Publish) (*paho.PublishResponse, error) {
+	span := integration.StartSampledSpan(ctx, c.spanSampler, "queue.publish", publish.Topic)
+	if span == nil {
+		return c.Client.Publish(ctx, publish)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "mqtt")
+	span.SetData(semconv.MessagingDestinationName.Key(), publish.Topic)
+	span.SetData("messaging.mqtt.qos", strconv.Itoa(int(publish.QoS)))
+	span.SetData("messaging.mqtt.retain", strconv.FormatBool(publish.Retain))
+	messaging.SetBodySize(span, len(publish.Payload))
+	c.setTags(span)
+
+	if publish.Properties == nil {
+		publish.Properties = &paho.PublishProperties{}
+	}
+	publish.Properties.User = setUserProperty(publish.Properties.User, sentry.SentryTraceHeader, span.ToSentryTrace())
+	publish.Properties.User = setUserProperty(publish.Properties.User, sentry.SentryBaggageHeader, span.ToBaggage())
+
+	response, err := c.Client.Publish(span.Context(), publish)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return response, err
+}
+
+// MessageHandler processes a single received message. The provided context
+// carries the "queue.process" transaction of the message.
+type MessageHandler func(ctx context.Context, publish *paho.Publish) error
+
+// NewSentryPublishReceivedHandler converts handler into a paho OnPublishReceived
+// callback that runs each message within a "queue.process" transaction.
+func NewSentryPublishReceivedHandler(handler MessageHandler, opts ...SentryMqttTracerOption) func(paho.PublishReceived) (bool, error) {
+	t := newTracer(opts...)
+
+	return func(received paho.PublishReceived) (bool, error) {
+		publish := received.Packet
+
+		var trace, baggage string
+		if publish.Properties != nil {
+			trace = publish.Properties.User.Get(sentry.SentryTraceHeader)
+			baggage = publish.Properties.User.Get(sentry.SentryBaggageHeader)
+		}
+
+		ctx, continueTrace := propagation.Continue(context.Background(), propagation.MapCarrier{
+			sentry.SentryTraceHeader:   trace,
+			sentry.SentryBaggageHeader: baggage,
+		})
+
+		span := integration.StartTransaction(ctx, t.spanSampler, "queue.process", publish.Topic, continueTrace)
+		if span == nil {
+			return true, handler(ctx, publish)
+		}
+		defer span.Finish()
+
+		span.SetData("messaging.system", "mqtt")
+		span.SetData(semconv.MessagingDestinationName.Key(), publish.Topic)
+		span.SetData("messaging.mqtt.qos", strconv.Itoa(int(publish.QoS)))
+		span.SetData("messaging.mqtt.retain", strconv.FormatBool(publish.Retain))
+		messaging.SetBodySize(span, len(publish.Payload))
+		t.setTags(span)
+
+		err := handler(span.Context(), publish)
+		if err != nil {
+			span.Status = sentry.SpanStatusInternalError
+			span.SetData("error", err.Error())
+		} else {
+			span.Status = sentry.SpanStatusOK
+		}
+
+		return true, err
+	}
+}
+
+func setUserProperty(properties paho.UserProperties, key, value string) paho.UserProperties {
+	for i := range properties {
+		if properties[i].Key == key {
+			properties[i].Value = value
+			return properties
+		}
+	}
+
+	return append(properties, paho.UserProperty{Key: key, Value: value})
+}
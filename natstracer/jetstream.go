@@ -0,0 +1,140 @@
+package natstracer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/getsentry/sentry-go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// JetStreamMsgHandler processes a single JetStream message. The provided context
+// carries the "queue.process" transaction of the message. Acknowledging the
+// message through msg records the outcome on the transaction.
+type JetStreamMsgHandler func(ctx context.Context, msg jetstream.Msg) error
+
+// NewSentryJetStreamConsumer wraps a JetStream consumer, so that every consumed
+// message is processed within a "queue.process" transaction.
+//
+//	js, err := jetstream.New(nc)
+//	if err != nil {
+//		return err
+//	}
+//
+//	c, err := js.Consumer(ctx, "ORDERS", "processor")
+//	if err != nil {
+//		return err
+//	}
+//
+//	consumer := natstracer.NewSentryJetStreamConsumer(c)
+//	consumeContext, err := consumer.Consume(func(ctx context.Context, msg jetstream.Msg) error {
+//		if err := processOrder(ctx, msg.Data()); err != nil {
+//			return msg.Nak()
+//		}
+//
+//		return msg.Ack()
+//	})
+func NewSentryJetStreamConsumer(consumer jetstream.Consumer, opts ...SentryNatsTracerOption) *JetStreamConsumer {
+	return &JetStreamConsumer{
+		Consumer: consumer,
+		tracer:   newTracer(opts...),
+	}
+}
+
+type JetStreamConsumer struct {
+	jetstream.Consumer
+	tracer
+}
+
+func (c *JetStreamConsumer) Consume(handler JetStreamMsgHandler, opts ...jetstream.PullConsumeOpt) (jetstream.ConsumeContext, error) {
+	return c.Consumer.Consume(func(msg jetstream.Msg) {
+		_ = c.process(context.Background(), msg, handler)
+	}, opts...)
+}
+
+// Fetch fetches a single batch of messages and hands every message of the batch
+// to handler. It returns the first error returned by handler, or the error of
+// the batch itself.
+func (c *JetStreamConsumer) Fetch(ctx context.Context, batch int, handler JetStreamMsgHandler, opts ...jetstream.FetchOpt) error {
+	messages, err := c.Consumer.Fetch(batch, opts...)
+	if err != nil {
+		return err
+	}
+
+	var handlerErr error
+	for msg := range messages.Messages() {
+		if err := c.process(ctx, msg, handler); err != nil && handlerErr == nil {
+			handlerErr = err
+		}
+	}
+
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	return messages.Error()
+}
+
+func (c *JetStreamConsumer) process(ctx context.Context, msg jetstream.Msg, handler JetStreamMsgHandler) error {
+	ctx, span := c.startProcessSpan(ctx, msg.Subject(), msg.Reply(), msg.Headers(), len(msg.Data()))
+	if span == nil {
+		return handler(ctx, msg)
+	}
+
+	if metadata, err := msg.Metadata(); err == nil && metadata != nil {
+		span.SetData("messaging.nats.stream", metadata.Stream)
+		span.SetData("messaging.nats.consumer", metadata.Consumer)
+		span.SetData("messaging.nats.stream.sequence", strconv.FormatUint(metadata.Sequence.Stream, 10))
+		span.SetData("messaging.nats.delivery_count", strconv.FormatUint(metadata.NumDelivered, 10))
+		if metadata.NumDelivered > 0 {
+			span.SetData("messaging.message.retry.count", strconv.FormatUint(metadata.NumDelivered-1, 10))
+		}
+		messaging.SetReceiveLatency(span, metadata.Timestamp, time.Now())
+	}
+
+	err := handler(ctx, &tracedMsg{Msg: msg, span: span})
+	finishWithError(span, err)
+
+	return err
+}
+
+// tracedMsg records the acknowledgement outcome of a message on its span.
+type tracedMsg struct {
+	jetstream.Msg
+	span *sentry.Span
+}
+
+func (m *tracedMsg) outcome(outcome string, err error) error {
+	m.span.SetData("messaging.nats.ack", outcome)
+	if err != nil {
+		m.span.SetData("messaging.nats.ack.error", err.Error())
+	}
+
+	return err
+}
+
+func (m *tracedMsg) Ack() error {
+	return m.outcome("ack", m.Msg.Ack())
+}
+
+func (m *tracedMsg) DoubleAck(ctx context.Context) error {
+	return m.outcome("ack", m.Msg.DoubleAck(ctx))
+}
+
+func (m *tracedMsg) Nak() error {
+	return m.outcome("nak", m.Msg.Nak())
+}
+
+func (m *tracedMsg) NakWithDelay(delay time.Duration) error {
+	return m.outcome("nak", m.Msg.NakWithDelay(delay))
+}
+
+func (m *tracedMsg) InProgress() error {
+	return m.outcome("in_progress", m.Msg.InProgress())
+}
+
+func (m *tracedMsg) Term() error {
+	return m.outcome("term", m.Msg.Term())
+}
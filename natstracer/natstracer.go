@@ -0,0 +1,202 @@
+// Package natstracer provides a tracer implementation for nats.go.
+//
+//	nc, err := nats.Connect(nats.DefaultURL)
+//	if err != nil {
+//		return err
+//	}
+//
+//	conn := natstracer.NewSentryConn(nc)
+//	err = conn.Publish(ctx, "orders.created", []byte("hello"))
+//
+//	subscription, err := conn.Subscribe("orders.*", func(ctx context.Context, msg *nats.Msg) error {
+//		return processOrder(ctx, msg.Data)
+//	})
+//
+// Request-reply is traced as a pair of "rpc.client" and "rpc.server" spans:
+//
+//	subscription, err := conn.SubscribeRequests("prices.get", func(ctx context.Context, msg *nats.Msg) error {
+//		return natstracer.RespondMsg(ctx, msg, &nats.Msg{Data: price(msg.Data)})
+//	})
+//
+//	response, err := conn.Request(ctx, "prices.get", []byte("sku-42"))
+package natstracer
+
+import (
+	"context"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/nats-io/nats.go"
+)
+
+var integration = config.Integration{Origin: "auto.queue.nats"}
+
+// SetEnabled turns the spans of NATS publishes and messages on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryNatsTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryNatsTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryNatsTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the subject, e.g. to leave out "_INBOX." replies.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryNatsTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryNatsTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// startPublishSpan starts a "queue.publish" span and injects the trace context
+// into the message headers.
+func (t tracer) startPublishSpan(ctx context.Context, msg *nats.Msg) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "queue.publish", msg.Subject)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("messaging.system", "nats")
+	span.SetData(semconv.MessagingDestinationName.Key(), msg.Subject)
+	if msg.Reply != "" {
+		span.SetData("messaging.nats.reply", msg.Reply)
+	}
+	messaging.SetBodySize(span, len(msg.Data))
+	t.setTags(span)
+
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	propagation.Inject(span, msg.Header)
+
+	return span
+}
+
+// startProcessSpan starts a "queue.process" transaction continued from the trace
+// context found in the message headers. The returned context has a cloned hub
+// bound to it.
+func (t tracer) startProcessSpan(ctx context.Context, subject, reply string, header nats.Header, size int) (context.Context, *sentry.Span) {
+	ctx, continueTrace := propagation.Continue(ctx, header)
+
+	span := integration.StartTransaction(ctx, t.spanSampler, "queue.process", subject, continueTrace)
+	if span == nil {
+		return ctx, nil
+	}
+
+	span.SetData("messaging.system", "nats")
+	span.SetData(semconv.MessagingDestinationName.Key(), subject)
+	if reply != "" {
+		span.SetData("messaging.nats.reply", reply)
+	}
+	messaging.SetBodySize(span, size)
+	t.setTags(span)
+
+	return span.Context(), span
+}
+
+func finishWithError(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+func NewSentryConn(conn *nats.Conn, opts ...SentryNatsTracerOption) *Conn {
+	return &Conn{
+		Conn:   conn,
+		tracer: newTracer(opts...),
+	}
+}
+
+type Conn struct {
+	*nats.Conn
+	tracer
+}
+
+// MsgHandler processes a single message. The provided context carries the
+// "queue.process" transaction of the message.
+type MsgHandler func(ctx context.Context, msg *nats.Msg) error
+
+func (c *Conn) PublishMsg(ctx context.Context, msg *nats.Msg) error {
+	span := c.startPublishSpan(ctx, msg)
+	if span == nil {
+		return c.Conn.PublishMsg(msg)
+	}
+
+	err := c.Conn.PublishMsg(msg)
+	finishWithError(span, err)
+
+	return err
+}
+
+func (c *Conn) Publish(ctx context.Context, subject string, data []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+
+	return c.PublishMsg(ctx, msg)
+}
+
+func (c *Conn) Subscribe(subject string, handler MsgHandler) (*nats.Subscription, error) {
+	return c.Conn.Subscribe(subject, c.WrapHandler(handler))
+}
+
+func (c *Conn) QueueSubscribe(subject, queue string, handler MsgHandler) (*nats.Subscription, error) {
+	return c.Conn.QueueSubscribe(subject, queue, c.WrapHandler(handler))
+}
+
+// WrapHandler converts handler into a nats.MsgHandler that runs each message
+// within a "queue.process" transaction.
+func (c *Conn) WrapHandler(handler MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		ctx, span := c.startProcessSpan(context.Background(), msg.Subject, msg.Reply, msg.Header, len(msg.Data))
+		if span == nil {
+			_ = handler(ctx, msg)
+			return
+		}
+
+		finishWithError(span, handler(ctx, msg))
+	}
+}
@@ -0,0 +1,137 @@
+package natstracer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/nats-io/nats.go"
+)
+
+// serviceErrorCodeHeader is the header of the responses of NATS services
+// reporting an error, see nats.go/micro.
+const serviceErrorCodeHeader = "Nats-Service-Error-Code"
+
+// Request sends a request on subject and waits for its response until ctx is
+// done, see RequestMsg.
+func (c *Conn) Request(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+
+	return c.RequestMsg(ctx, msg)
+}
+
+// RequestMsg sends msg as a request and waits for its response until ctx is
+// done, within a "rpc.client" span named after the subject. Timeouts are
+// recorded with the deadline_exceeded status, and requests nobody listens to
+// with the unavailable one.
+func (c *Conn) RequestMsg(ctx context.Context, msg *nats.Msg) (*nats.Msg, error) {
+	span := integration.StartSampledSpan(ctx, c.spanSampler, "rpc.client", msg.Subject)
+	if span == nil {
+		return c.Conn.RequestMsgWithContext(ctx, msg)
+	}
+	defer span.Finish()
+
+	span.SetData("rpc.system", "nats")
+	span.SetData(semconv.MessagingDestinationName.Key(), msg.Subject)
+	messaging.SetBodySize(span, len(msg.Data))
+	c.setTags(span)
+
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	propagation.Inject(span, msg.Header)
+
+	response, err := c.Conn.RequestMsgWithContext(span.Context(), msg)
+	if err != nil {
+		span.Status = requestStatus(err)
+		span.SetData("error", err.Error())
+		return response, err
+	}
+
+	if code := response.Header.Get(serviceErrorCodeHeader); code != "" {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("rpc.nats.error_code", code)
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return response, nil
+}
+
+// requestStatus maps the error of a request to a span status.
+func requestStatus(err error) sentry.SpanStatus {
+	switch {
+	case errors.Is(err, nats.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return sentry.SpanStatusDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return sentry.SpanStatusCanceled
+	case errors.Is(err, nats.ErrNoResponders):
+		return sentry.SpanStatusUnavailable
+	default:
+		return sentry.SpanStatusInternalError
+	}
+}
+
+// SubscribeRequests subscribes to the requests sent on subject, handling each
+// within a "rpc.server" transaction, see WrapRequestHandler.
+func (c *Conn) SubscribeRequests(subject string, handler MsgHandler) (*nats.Subscription, error) {
+	return c.Conn.Subscribe(subject, c.WrapRequestHandler(handler))
+}
+
+// QueueSubscribeRequests is SubscribeRequests for a queue group.
+func (c *Conn) QueueSubscribeRequests(subject, queue string, handler MsgHandler) (*nats.Subscription, error) {
+	return c.Conn.QueueSubscribe(subject, queue, c.WrapRequestHandler(handler))
+}
+
+// WrapRequestHandler converts handler into a nats.MsgHandler that runs each
+// request within a "rpc.server" transaction named after the subject,
+// continued from the "rpc.client" span of the requester. Handlers respond
+// with RespondMsg to have the response part of the transaction.
+func (c *Conn) WrapRequestHandler(handler MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		ctx, continueTrace := propagation.Continue(context.Background(), msg.Header)
+
+		span := integration.StartTransaction(ctx, c.spanSampler, "rpc.server", msg.Subject, continueTrace)
+		if span == nil {
+			_ = handler(ctx, msg)
+			return
+		}
+
+		span.SetData("rpc.system", "nats")
+		span.SetData(semconv.MessagingDestinationName.Key(), msg.Subject)
+		messaging.SetBodySize(span, len(msg.Data))
+		c.setTags(span)
+
+		finishWithError(span, handler(span.Context(), msg))
+	}
+}
+
+// RespondMsg responds to request with response, recording the size of the
+// response and whether it reports a service error on the span of ctx.
+func RespondMsg(ctx context.Context, request, response *nats.Msg) error {
+	span := sentry.SpanFromContext(ctx)
+	if span == nil {
+		return request.RespondMsg(response)
+	}
+
+	// The request body size is already recorded on span, the one of the
+	// response gets a key of its own, recorded as an int like the other sizes.
+	if span.Data == nil {
+		span.Data = make(map[string]interface{})
+	}
+	span.Data["rpc.nats.response.body.size"] = len(response.Data)
+	if code := response.Header.Get(serviceErrorCodeHeader); code != "" {
+		span.SetData("rpc.nats.error_code", code)
+	}
+
+	err := request.RespondMsg(response)
+	if err != nil {
+		span.SetData("rpc.nats.respond.error", err.Error())
+	}
+
+	return err
+}
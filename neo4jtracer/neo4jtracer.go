@@ -0,0 +1,321 @@
+// Package neo4jtracer provides a tracer implementation for neo4j-go-driver.
+//
+// Every Cypher statement executed through a traced session, either directly or
+// within a transaction, creates a span. The span is finished once the result
+// has been fully read or consumed, so the result summary counters can be
+// recorded on it.
+//
+//	driver, err := neo4j.NewDriverWithContext("neo4j://localhost:7687", neo4j.BasicAuth("neo4j", "password", ""))
+//	if err != nil {
+//		return err
+//	}
+//
+//	session := neo4jtracer.NewSentrySession(ctx, driver, neo4j.SessionConfig{DatabaseName: "neo4j"})
+//	defer session.Close(ctx)
+//
+//	_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+//		result, err := tx.Run(ctx, "CREATE (p:Person {name: $name})", map[string]any{"name": "Alice"})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return result.Consume(ctx)
+//	})
+package neo4jtracer
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// literalPattern matches string and numeric literals within a Cypher statement.
+var literalPattern = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|\b\d+(?:\.\d+)?\b`)
+
+var integration = config.Integration{Origin: "auto.db.neo4j"}
+
+// SetEnabled turns the spans of Neo4j queries on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryNeo4jTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryNeo4jTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryNeo4jTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of statements for which sampler returns
+// false, given the "db" operation and the scrubbed statement.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryNeo4jTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	database string
+	address  string
+	port     string
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// NewSentrySession opens a session on driver, with every statement executed
+// through it traced.
+func NewSentrySession(ctx context.Context, driver neo4j.DriverWithContext, config neo4j.SessionConfig, opts ...SentryNeo4jTracerOption) *Session {
+	target := driver.Target()
+
+	t := &tracer{
+		database: config.DatabaseName,
+		address:  target.Hostname(),
+		port:     target.Port(),
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return &Session{
+		SessionWithContext: driver.NewSession(ctx, config),
+		tracer:             t,
+	}
+}
+
+// Session wraps a neo4j.SessionWithContext, and can be used in its place.
+type Session struct {
+	neo4j.SessionWithContext
+	tracer *tracer
+}
+
+func (s *Session) Run(ctx context.Context, cypher string, params map[string]any, configurers ...func(*neo4j.TransactionConfig)) (neo4j.ResultWithContext, error) {
+	span := s.tracer.startSpan(ctx, cypher)
+	if span == nil {
+		return s.SessionWithContext.Run(ctx, cypher, params, configurers...)
+	}
+
+	result, err := s.SessionWithContext.Run(span.Context(), cypher, params, configurers...)
+	if err != nil {
+		finish(span, err)
+		return result, err
+	}
+
+	return &tracedResult{ResultWithContext: result, span: span}, nil
+}
+
+func (s *Session) BeginTransaction(ctx context.Context, configurers ...func(*neo4j.TransactionConfig)) (neo4j.ExplicitTransaction, error) {
+	tx, err := s.SessionWithContext.BeginTransaction(ctx, configurers...)
+	if err != nil {
+		return tx, err
+	}
+
+	return &explicitTransaction{ExplicitTransaction: tx, tracer: s.tracer}, nil
+}
+
+func (s *Session) ExecuteRead(ctx context.Context, work neo4j.ManagedTransactionWork, configurers ...func(*neo4j.TransactionConfig)) (any, error) {
+	return s.SessionWithContext.ExecuteRead(ctx, s.wrapWork(work), configurers...)
+}
+
+func (s *Session) ExecuteWrite(ctx context.Context, work neo4j.ManagedTransactionWork, configurers ...func(*neo4j.TransactionConfig)) (any, error) {
+	return s.SessionWithContext.ExecuteWrite(ctx, s.wrapWork(work), configurers...)
+}
+
+func (s *Session) wrapWork(work neo4j.ManagedTransactionWork) neo4j.ManagedTransactionWork {
+	return func(tx neo4j.ManagedTransaction) (any, error) {
+		return work(&managedTransaction{ManagedTransaction: tx, tracer: s.tracer})
+	}
+}
+
+type managedTransaction struct {
+	neo4j.ManagedTransaction
+	tracer *tracer
+}
+
+func (tx *managedTransaction) Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error) {
+	span := tx.tracer.startSpan(ctx, cypher)
+	if span == nil {
+		return tx.ManagedTransaction.Run(ctx, cypher, params)
+	}
+
+	result, err := tx.ManagedTransaction.Run(span.Context(), cypher, params)
+	if err != nil {
+		finish(span, err)
+		return result, err
+	}
+
+	return &tracedResult{ResultWithContext: result, span: span}, nil
+}
+
+type explicitTransaction struct {
+	neo4j.ExplicitTransaction
+	tracer *tracer
+}
+
+func (tx *explicitTransaction) Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error) {
+	span := tx.tracer.startSpan(ctx, cypher)
+	if span == nil {
+		return tx.ExplicitTransaction.Run(ctx, cypher, params)
+	}
+
+	result, err := tx.ExplicitTransaction.Run(span.Context(), cypher, params)
+	if err != nil {
+		finish(span, err)
+		return result, err
+	}
+
+	return &tracedResult{ResultWithContext: result, span: span}, nil
+}
+
+func (t *tracer) startSpan(ctx context.Context, cypher string) *sentry.Span {
+	statement := scrubStatement(cypher)
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "db", statement)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", "neo4j")
+	if !config.Get().OmitStatements {
+		span.SetData(semconv.DBStatement.Key(), statement)
+	}
+	if operation, _, _ := strings.Cut(strings.TrimSpace(statement), " "); operation != "" {
+		span.SetData(semconv.DBOperation.Key(), strings.ToUpper(operation))
+	}
+	if t.database != "" {
+		span.SetData(semconv.DBName.Key(), t.database)
+	}
+	if t.address != "" {
+		span.SetData(semconv.ServerAddress.Key(), t.address)
+	}
+	if t.port != "" {
+		span.SetData(semconv.ServerPort.Key(), t.port)
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// tracedResult finishes its span once the records have been exhausted or the
+// result has been consumed.
+type tracedResult struct {
+	neo4j.ResultWithContext
+	span *sentry.Span
+}
+
+func (r *tracedResult) Next(ctx context.Context) bool {
+	if r.ResultWithContext.Next(ctx) {
+		return true
+	}
+
+	r.finish(ctx, r.ResultWithContext.Err())
+	return false
+}
+
+func (r *tracedResult) NextRecord(ctx context.Context, record **neo4j.Record) bool {
+	if r.ResultWithContext.NextRecord(ctx, record) {
+		return true
+	}
+
+	r.finish(ctx, r.ResultWithContext.Err())
+	return false
+}
+
+func (r *tracedResult) Collect(ctx context.Context) ([]*neo4j.Record, error) {
+	records, err := r.ResultWithContext.Collect(ctx)
+	r.finish(ctx, err)
+
+	return records, err
+}
+
+func (r *tracedResult) Single(ctx context.Context) (*neo4j.Record, error) {
+	record, err := r.ResultWithContext.Single(ctx)
+	r.finish(ctx, err)
+
+	return record, err
+}
+
+func (r *tracedResult) Consume(ctx context.Context) (neo4j.ResultSummary, error) {
+	summary, err := r.ResultWithContext.Consume(ctx)
+	if r.span != nil {
+		if summary != nil {
+			recordSummary(r.span, summary)
+		}
+		finish(r.span, err)
+		r.span = nil
+	}
+
+	return summary, err
+}
+
+func (r *tracedResult) finish(ctx context.Context, err error) {
+	if r.span == nil {
+		return
+	}
+
+	if err == nil {
+		// Every record has been read already, consuming only fetches the summary.
+		if summary, consumeErr := r.ResultWithContext.Consume(ctx); consumeErr == nil && summary != nil {
+			recordSummary(r.span, summary)
+		}
+	}
+
+	finish(r.span, err)
+	r.span = nil
+}
+
+func recordSummary(span *sentry.Span, summary neo4j.ResultSummary) {
+	if database := summary.Database(); database != nil && database.Name() != "" {
+		span.SetData(semconv.DBName.Key(), database.Name())
+	}
+
+	counters := summary.Counters()
+	if counters == nil || !counters.ContainsUpdates() {
+		return
+	}
+
+	span.SetData("db.neo4j.nodes_created", strconv.Itoa(counters.NodesCreated()))
+	span.SetData("db.neo4j.nodes_deleted", strconv.Itoa(counters.NodesDeleted()))
+	span.SetData("db.neo4j.relationships_created", strconv.Itoa(counters.RelationshipsCreated()))
+	span.SetData("db.neo4j.relationships_deleted", strconv.Itoa(counters.RelationshipsDeleted()))
+	span.SetData("db.neo4j.properties_set", strconv.Itoa(counters.PropertiesSet()))
+	span.SetData("db.neo4j.labels_added", strconv.Itoa(counters.LabelsAdded()))
+	span.SetData("db.neo4j.labels_removed", strconv.Itoa(counters.LabelsRemoved()))
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// scrubStatement replaces string and numeric literals of a Cypher statement,
+// leaving parameters such as $name untouched.
+func scrubStatement(cypher string) string {
+	return literalPattern.ReplaceAllString(cypher, "?")
+}
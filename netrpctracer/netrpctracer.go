@@ -0,0 +1,256 @@
+// Package netrpctracer provides a tracer implementation for net/rpc.
+//
+//	server := rpc.NewServer()
+//	server.Register(new(Arith))
+//
+//	for {
+//		conn, err := listener.Accept()
+//		if err != nil {
+//			return err
+//		}
+//		go server.ServeCodec(netrpctracer.NewSentryServerCodec(jsonrpc.NewServerCodec(conn)))
+//	}
+//
+//	client := netrpctracer.NewSentryClient(rpcClient)
+//	err := client.Call(ctx, "Arith.Multiply", args, &reply)
+//
+// Every call handled by the server is a "rpc.server" transaction named after
+// its service method, e.g. "Arith.Multiply", and every call made through the
+// client a "rpc.client" span. Errors answered by the server are captured.
+//
+// The net/rpc protocol has no headers, so the trace of the caller can not be
+// continued by the server, and the methods of the server get no context.
+// Clients are wrapped rather than their codecs, as codecs get no context
+// either.
+package netrpctracer
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"strings"
+	"sync"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.rpc.net_rpc"}
+
+// SetEnabled turns the spans of net/rpc calls on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryNetRPCTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryNetRPCTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryNetRPCTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the operation and the service method, e.g. "Arith.Multiply".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryNetRPCTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithoutErrorCapture disables capturing the errors answered by the server,
+// only recording them on their transactions.
+func WithoutErrorCapture() SentryNetRPCTracerOption {
+	return func(t *tracer) {
+		t.captureErrors = false
+	}
+}
+
+type tracer struct {
+	tags          map[string]string
+	spanSampler   func(operation, description string) bool
+	captureErrors bool
+}
+
+func newTracer(opts []SentryNetRPCTracerOption) tracer {
+	t := tracer{
+		tags:          make(map[string]string),
+		captureErrors: true,
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setData(span *sentry.Span, serviceMethod string) {
+	span.SetData("rpc.system", "net_rpc")
+	if service, method, ok := strings.Cut(serviceMethod, "."); ok {
+		span.SetData("rpc.service", service)
+		span.SetData("rpc.method", method)
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// NewSentryServerCodec wraps codec so that every call it reads is a
+// transaction, finished once its response is written.
+func NewSentryServerCodec(codec rpc.ServerCodec, opts ...SentryNetRPCTracerOption) rpc.ServerCodec {
+	return &serverCodec{
+		ServerCodec: codec,
+		tracer:      newTracer(opts),
+		calls:       make(map[uint64]*call),
+	}
+}
+
+type call struct {
+	hub           *sentry.Hub
+	span          *sentry.Span
+	serviceMethod string
+}
+
+type serverCodec struct {
+	rpc.ServerCodec
+	tracer tracer
+
+	mu    sync.Mutex
+	calls map[uint64]*call
+}
+
+func (c *serverCodec) ReadRequestHeader(request *rpc.Request) error {
+	if err := c.ServerCodec.ReadRequestHeader(request); err != nil {
+		return err
+	}
+
+	hub := sentry.CurrentHub().Clone()
+	ctx := sentry.SetHubOnContext(context.Background(), hub)
+
+	span := integration.StartTransaction(ctx, c.tracer.spanSampler, "rpc.server", request.ServiceMethod,
+		sentry.WithTransactionSource(sentry.SourceRoute))
+	if span == nil && !c.tracer.captureErrors {
+		return nil
+	}
+	if span != nil {
+		c.tracer.setData(span, request.ServiceMethod)
+	}
+
+	c.mu.Lock()
+	c.calls[request.Seq] = &call{hub: hub, span: span, serviceMethod: request.ServiceMethod}
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *serverCodec) WriteResponse(response *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	call, ok := c.calls[response.Seq]
+	delete(c.calls, response.Seq)
+	c.mu.Unlock()
+
+	err := c.ServerCodec.WriteResponse(response, body)
+	if !ok {
+		return err
+	}
+
+	if response.Error != "" {
+		c.capture(call, response.Error)
+	}
+
+	if call.span == nil {
+		return err
+	}
+
+	switch {
+	case response.Error != "":
+		call.span.Status = sentry.SpanStatusInternalError
+		call.span.SetData("error", response.Error)
+	case err != nil:
+		call.span.Status = sentry.SpanStatusInternalError
+		call.span.SetData("error", err.Error())
+	default:
+		call.span.Status = sentry.SpanStatusOK
+	}
+	call.span.Finish()
+
+	return err
+}
+
+// capture captures the error answered to call.
+func (c *serverCodec) capture(call *call, message string) {
+	if !c.tracer.captureErrors {
+		return
+	}
+
+	call.hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("rpc.method", call.serviceMethod)
+		scope.SetTags(c.tracer.tags)
+
+		call.hub.CaptureException(errors.New(message))
+	})
+}
+
+// Client wraps a rpc.Client, making calls within a "rpc.client" span.
+type Client struct {
+	*rpc.Client
+	tracer tracer
+}
+
+func NewSentryClient(client *rpc.Client, opts ...SentryNetRPCTracerOption) *Client {
+	return &Client{
+		Client: client,
+		tracer: newTracer(opts),
+	}
+}
+
+// Call calls serviceMethod and waits for it to complete, or for ctx to be
+// done, leaving the call running in the background.
+func (c *Client) Call(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	span := integration.StartSampledSpan(ctx, c.tracer.spanSampler, "rpc.client", serviceMethod)
+	if span != nil {
+		defer span.Finish()
+		c.tracer.setData(span, serviceMethod)
+	}
+
+	var err error
+	select {
+	case done := <-c.Client.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1)).Done:
+		err = done.Error
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if span == nil {
+		return err
+	}
+
+	var serverErr rpc.ServerError
+	switch {
+	case err == nil:
+		span.Status = sentry.SpanStatusOK
+	case errors.Is(err, context.DeadlineExceeded):
+		span.Status = sentry.SpanStatusDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		span.Status = sentry.SpanStatusCanceled
+	case errors.As(err, &serverErr), errors.Is(err, rpc.ErrShutdown):
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	default:
+		span.Status = sentry.SpanStatusUnknown
+		span.SetData("error", err.Error())
+	}
+
+	return err
+}
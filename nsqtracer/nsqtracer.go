@@ -0,0 +1,276 @@
+// Package nsqtracer provides a tracer implementation for go-nsq.
+//
+// NSQ messages do not carry headers, so the trace context is carried within a
+// small JSON envelope wrapping the original message body. Messages which were
+// not published through this package are handled as-is.
+//
+//	p, err := nsq.NewProducer("127.0.0.1:4150", nsq.NewConfig())
+//	if err != nil {
+//		return err
+//	}
+//
+//	producer := nsqtracer.NewSentryProducer(p)
+//	err = producer.Publish(ctx, "orders", []byte("hello"))
+//
+//	consumer, err := nsq.NewConsumer("orders", "processor", nsq.NewConfig())
+//	if err != nil {
+//		return err
+//	}
+//
+//	consumer.AddHandler(nsqtracer.NewSentryHandler("orders", "processor", func(ctx context.Context, message *nsq.Message) error {
+//		return processOrder(ctx, message.Body)
+//	}))
+package nsqtracer
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/nsqio/go-nsq"
+)
+
+// envelope wraps the original message body along with the trace context.
+type envelope struct {
+	SentryTrace string `json:"sentry_trace"`
+	Baggage     string `json:"baggage,omitempty"`
+	Body        []byte `json:"body"`
+}
+
+var integration = config.Integration{Origin: "auto.queue.nsq"}
+
+// SetEnabled turns the spans of NSQ publishes and messages on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryNsqTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryNsqTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryNsqTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the topic. Messages published without a span are
+// not wrapped in an envelope.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryNsqTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryNsqTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+func NewSentryProducer(producer *nsq.Producer, opts ...SentryNsqTracerOption) *Producer {
+	return &Producer{
+		Producer: producer,
+		tracer:   newTracer(opts...),
+	}
+}
+
+type Producer struct {
+	*nsq.Producer
+	tracer
+}
+
+func (p *Producer) Publish(ctx context.Context, topic string, body []byte) error {
+	return p.publish(ctx, topic, 0, body)
+}
+
+func (p *Producer) DeferredPublish(ctx context.Context, topic string, delay time.Duration, body []byte) error {
+	return p.publish(ctx, topic, delay, body)
+}
+
+func (p *Producer) publish(ctx context.Context, topic string, delay time.Duration, body []byte) error {
+	span := integration.StartSampledSpan(ctx, p.spanSampler, "queue.publish", topic)
+	if span == nil {
+		return p.producerPublish(topic, delay, body)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "nsq")
+	span.SetData(semconv.MessagingDestinationName.Key(), topic)
+	messaging.SetBodySize(span, len(body))
+	if delay > 0 {
+		span.SetData("messaging.nsq.delay", delay.String())
+	}
+	p.setTags(span)
+
+	wrapped, err := json.Marshal(envelope{
+		SentryTrace: span.ToSentryTrace(),
+		Baggage:     span.ToBaggage(),
+		Body:        body,
+	})
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return err
+	}
+
+	err = p.producerPublish(topic, delay, wrapped)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return err
+}
+
+func (p *Producer) producerPublish(topic string, delay time.Duration, body []byte) error {
+	if delay > 0 {
+		return p.Producer.DeferredPublish(topic, delay, body)
+	}
+
+	return p.Producer.Publish(topic, body)
+}
+
+// HandlerFunc processes a single message. The provided context carries the
+// "queue.process" transaction of the message, and message.Body is the original
+// body without the envelope.
+type HandlerFunc func(ctx context.Context, message *nsq.Message) error
+
+func NewSentryHandler(topic, channel string, handler HandlerFunc, opts ...SentryNsqTracerOption) nsq.Handler {
+	return &Handler{
+		tracer:  newTracer(opts...),
+		topic:   topic,
+		channel: channel,
+		handler: handler,
+	}
+}
+
+type Handler struct {
+	tracer
+	topic   string
+	channel string
+	handler HandlerFunc
+}
+
+// HandleMessage implements nsq.Handler.
+func (h *Handler) HandleMessage(message *nsq.Message) error {
+	var trace, baggage string
+	var wrapped envelope
+	if err := json.Unmarshal(message.Body, &wrapped); err == nil && wrapped.SentryTrace != "" {
+		trace, baggage = wrapped.SentryTrace, wrapped.Baggage
+		message.Body = wrapped.Body
+	}
+
+	ctx, continueTrace := propagation.Continue(context.Background(), propagation.MapCarrier{
+		sentry.SentryTraceHeader:   trace,
+		sentry.SentryBaggageHeader: baggage,
+	})
+
+	span := integration.StartTransaction(ctx, h.spanSampler, "queue.process", h.topic, continueTrace)
+	if span == nil {
+		return h.handler(ctx, message)
+	}
+
+	// The delegate finishes the span of messages answered after HandleMessage
+	// returns; every other span is finished here.
+	delegated := false
+	defer func() {
+		if !delegated {
+			span.Finish()
+		}
+	}()
+
+	span.SetData("messaging.system", "nsq")
+	span.SetData(semconv.MessagingDestinationName.Key(), h.topic)
+	span.SetData("messaging.nsq.channel", h.channel)
+	span.SetData(semconv.MessagingMessageID.Key(), string(message.ID[:]))
+	messaging.SetBodySize(span, len(message.Body))
+	span.SetData("messaging.nsq.attempts", strconv.FormatUint(uint64(message.Attempts), 10))
+	if message.Attempts > 0 {
+		span.SetData("messaging.message.retry.count", strconv.FormatUint(uint64(message.Attempts-1), 10))
+	}
+	messaging.SetReceiveLatency(span, messaging.UnixNano(message.Timestamp), time.Now())
+	h.setTags(span)
+
+	err := h.handler(span.Context(), message)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	if message.HasResponded() {
+		return err
+	}
+
+	// With auto response disabled, the handler answers the message later on,
+	// and the span lasts until it does. Otherwise go-nsq answers as soon as
+	// HandleMessage returns, from its error.
+	if message.IsAutoResponseDisabled() {
+		if message.Delegate != nil {
+			message.Delegate = &delegate{MessageDelegate: message.Delegate, span: span}
+			delegated = true
+		}
+	} else if err != nil {
+		span.SetData("messaging.nsq.outcome", "requeue")
+	} else {
+		span.SetData("messaging.nsq.outcome", "finish")
+	}
+
+	return err
+}
+
+// delegate records the finish or requeue decision made for a message with auto
+// response disabled, and finishes its span.
+type delegate struct {
+	nsq.MessageDelegate
+	span *sentry.Span
+}
+
+func (d *delegate) OnFinish(message *nsq.Message) {
+	d.span.SetData("messaging.nsq.outcome", "finish")
+	d.span.Finish()
+	d.MessageDelegate.OnFinish(message)
+}
+
+func (d *delegate) OnRequeue(message *nsq.Message, delay time.Duration, backoff bool) {
+	d.span.SetData("messaging.nsq.outcome", "requeue")
+	d.span.SetData("messaging.nsq.requeue.delay", delay.String())
+	d.span.SetData("messaging.nsq.requeue.backoff", strconv.FormatBool(backoff))
+	d.span.Finish()
+	d.MessageDelegate.OnRequeue(message, delay, backoff)
+}
@@ -0,0 +1,250 @@
+// Package oauth2tracer provides a tracer implementation for golang.org/x/oauth2
+// token sources.
+//
+// Token sources are usually called on every outgoing request, and only fetch a
+// token from the authorization server once the cached one expired. A span is
+// recorded only when a new token was actually fetched, so token fetches and
+// refreshes no longer hide inside unrelated HTTP client spans.
+//
+//	config := &clientcredentials.Config{
+//		ClientID:     clientID,
+//		ClientSecret: clientSecret,
+//		TokenURL:     "https://auth.example.com/oauth/token",
+//	}
+//
+//	source := oauth2tracer.NewSentryTokenSource(ctx, config.TokenSource(ctx),
+//		oauth2tracer.WithIssuer("auth.example.com"),
+//		oauth2tracer.WithGrantType("client_credentials"),
+//	)
+//
+//	client := &http.Client{
+//		Transport: oauth2tracer.NewSentryTransport(http.DefaultTransport, source),
+//	}
+//
+// NewSentryTransport fetches tokens with the context of each request, so a
+// refresh is parented to the request that triggered it and recorded as a
+// breadcrumb.
+package oauth2tracer
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"golang.org/x/oauth2"
+)
+
+var integration = config.Integration{Origin: "auto.http.oauth2"}
+
+// SetEnabled turns the spans of token fetches on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryOAuth2TracerOption func(*TokenSource)
+
+func WithTags(tags map[string]string) SentryOAuth2TracerOption {
+	return func(t *TokenSource) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryOAuth2TracerOption {
+	return func(t *TokenSource) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of token fetches for which sampler returns
+// false, given the "auth.token" operation and the description. Refreshes are
+// still recorded as breadcrumbs.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryOAuth2TracerOption {
+	return func(t *TokenSource) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithIssuer sets the authorization server recorded on spans.
+func WithIssuer(issuer string) SentryOAuth2TracerOption {
+	return func(t *TokenSource) {
+		t.issuer = issuer
+	}
+}
+
+// WithGrantType sets the OAuth2 grant type recorded on spans, e.g.
+// "client_credentials" or "refresh_token".
+func WithGrantType(grantType string) SentryOAuth2TracerOption {
+	return func(t *TokenSource) {
+		t.grantType = grantType
+	}
+}
+
+// NewSentryTokenSource wraps source. Token calls without a context of their
+// own are traced as children of the span of ctx.
+func NewSentryTokenSource(ctx context.Context, source oauth2.TokenSource, opts ...SentryOAuth2TracerOption) *TokenSource {
+	t := &TokenSource{
+		source: source,
+		ctx:    ctx,
+		tags:   make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+type TokenSource struct {
+	source oauth2.TokenSource
+	ctx    context.Context
+
+	issuer      string
+	grantType   string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+
+	mu          sync.Mutex
+	accessToken string
+	fetched     bool
+}
+
+// Token implements oauth2.TokenSource.
+func (t *TokenSource) Token() (*oauth2.Token, error) {
+	return t.TokenContext(t.ctx)
+}
+
+// TokenContext returns a token out of the underlying token source, recording a
+// span under ctx when it had to be fetched.
+func (t *TokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	start := time.Now()
+	token, err := t.source.Token()
+
+	t.mu.Lock()
+	refresh := t.fetched
+	changed := err == nil && token.AccessToken != t.accessToken
+	if changed {
+		t.accessToken = token.AccessToken
+		t.fetched = true
+	}
+	t.mu.Unlock()
+
+	if err == nil && !changed {
+		return token, nil
+	}
+
+	operation := "fetch"
+	if refresh {
+		operation = "refresh"
+	}
+
+	// A refresh happening while a request is being traced adds latency to it.
+	if refresh && sentry.SpanFromContext(ctx) != nil {
+		data := map[string]interface{}{}
+		if t.issuer != "" {
+			data["issuer"] = t.issuer
+		}
+		level := sentry.LevelInfo
+		if err != nil {
+			level = sentry.LevelError
+			data["error"] = err.Error()
+		}
+
+		sentry.AddBreadcrumb(&sentry.Breadcrumb{
+			Type:     "default",
+			Category: "oauth2",
+			Message:  "Refreshed access token",
+			Data:     data,
+			Level:    level,
+		})
+	}
+
+	description := "oauth2 token " + operation
+	if t.issuer != "" {
+		description += " " + t.issuer
+	}
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, "auth.token", description)
+	if span == nil {
+		return token, err
+	}
+
+	span.StartTime = start
+	span.SetData("oauth2.operation", operation)
+	if t.issuer != "" {
+		span.SetData("oauth2.issuer", t.issuer)
+	}
+	if t.grantType != "" {
+		span.SetData("oauth2.grant_type", t.grantType)
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	if err != nil {
+		span.Status = sentry.SpanStatusUnauthenticated
+		span.SetData("error", err.Error())
+
+		if retrieveErr, ok := err.(*oauth2.RetrieveError); ok {
+			if retrieveErr.Response != nil {
+				span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(retrieveErr.Response.StatusCode))
+			}
+			if retrieveErr.ErrorCode != "" {
+				span.SetData("oauth2.error_code", retrieveErr.ErrorCode)
+			}
+		}
+	} else {
+		span.Status = sentry.SpanStatusOK
+		span.SetData("oauth2.token_type", token.Type())
+		if !token.Expiry.IsZero() {
+			span.SetData("oauth2.expiry", token.Expiry.Format(time.RFC3339))
+			span.SetData("oauth2.expires_in", strconv.FormatInt(int64(time.Until(token.Expiry).Seconds()), 10))
+		}
+	}
+	span.Finish()
+
+	return token, err
+}
+
+// NewSentryTransport returns an http.RoundTripper authorizing requests with
+// tokens out of source, fetched with the context of each request.
+func NewSentryTransport(base http.RoundTripper, source *TokenSource) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		base:   base,
+		source: source,
+	}
+}
+
+type Transport struct {
+	base   http.RoundTripper
+	source *TokenSource
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token, err := t.source.TokenContext(request.Context())
+	if err != nil {
+		if request.Body != nil {
+			request.Body.Close()
+		}
+		return nil, err
+	}
+
+	authorized := request.Clone(request.Context())
+	token.SetAuthHeader(authorized)
+
+	return t.base.RoundTrip(authorized)
+}
@@ -0,0 +1,56 @@
+// Package openfeaturetracer provides an OpenFeature hook recording evaluated
+// flags with package flags.
+//
+//	openfeature.AddHooks(openfeaturetracer.NewSentryHook())
+//
+//	client := openfeature.NewClient("checkout")
+//	enabled, err := client.BooleanValue(ctx, "new-checkout", false, evaluationContext)
+//
+// Only successful evaluations are recorded, a flag falling back to its
+// default value because of an error is not.
+package openfeaturetracer
+
+import (
+	"context"
+
+	"github.com/aldy505/sentry-integration/flags"
+	"github.com/open-feature/go-sdk/openfeature"
+)
+
+type SentryOpenFeatureTracerOption func(*Hook)
+
+// WithFlagFilter only records the flags for which filter returns true, e.g.
+// to leave out flags evaluated on every request.
+func WithFlagFilter(filter func(key string) bool) SentryOpenFeatureTracerOption {
+	return func(h *Hook) {
+		h.filter = filter
+	}
+}
+
+func NewSentryHook(opts ...SentryOpenFeatureTracerOption) *Hook {
+	h := &Hook{}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// Hook implements openfeature.Hook.
+type Hook struct {
+	openfeature.UnimplementedHook
+
+	filter func(key string) bool
+}
+
+// After implements openfeature.Hook, recording the evaluated flag.
+func (h *Hook) After(ctx context.Context, hookContext openfeature.HookContext, details openfeature.InterfaceEvaluationDetails, hookHints openfeature.HookHints) error {
+	if h.filter != nil && !h.filter(details.FlagKey) {
+		return nil
+	}
+
+	flags.Record(ctx, details.FlagKey, details.Value)
+
+	return nil
+}
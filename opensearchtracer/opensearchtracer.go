@@ -0,0 +1,86 @@
+// Package opensearchtracer provides a tracer implementation for opensearch-go.
+// OpenSearch shares its API with Elasticsearch, so the spans are the same as the
+// ones produced by estracer, with db.system set to "opensearch".
+//
+//	client, err := opensearch.NewClient(opensearchtracer.WrapConfig(opensearch.Config{
+//		Addresses: []string{"https://localhost:9200"},
+//	}))
+//
+// For Amazon OpenSearch Service, requests are signed before reaching the traced
+// transport, so the signature is left untouched and the region and service of
+// the signature are recorded on the spans.
+//
+//	awsConfig, err := config.LoadDefaultConfig(ctx)
+//	if err != nil {
+//		return err
+//	}
+//
+//	openSearchConfig, err := opensearchtracer.NewAmazonConfig(awsConfig, "es", []string{endpoint})
+//	if err != nil {
+//		return err
+//	}
+//
+//	client, err := opensearch.NewClient(openSearchConfig)
+package opensearchtracer
+
+import (
+	"net/http"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/estracer"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/opensearch-project/opensearch-go/v2"
+	"github.com/opensearch-project/opensearch-go/v2/signer/awsv2"
+)
+
+var integration = config.Integration{Origin: "auto.db.opensearch"}
+
+// SetEnabled turns the spans of OpenSearch requests on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryOpenSearchTracerOption = estracer.SentryElasticsearchTracerOption
+
+func WithTags(tags map[string]string) SentryOpenSearchTracerOption {
+	return estracer.WithTags(tags)
+}
+
+func WithTag(key, value string) SentryOpenSearchTracerOption {
+	return estracer.WithTag(key, value)
+}
+
+// WithSpanSampler drops the spans of requests for which sampler returns false,
+// given the "db" operation and the endpoint, e.g. to leave out "_cluster/health".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryOpenSearchTracerOption {
+	return estracer.WithSpanSampler(sampler)
+}
+
+func NewSentryRoundTripper(originalRoundTripper http.RoundTripper, opts ...SentryOpenSearchTracerOption) http.RoundTripper {
+	return estracer.NewSentryRoundTripper(originalRoundTripper, append([]SentryOpenSearchTracerOption{
+		estracer.WithDBSystem("opensearch"),
+		estracer.WithIntegration(&integration),
+	}, opts...)...)
+}
+
+// WrapConfig returns a copy of config with its Transport traced.
+func WrapConfig(config opensearch.Config, opts ...SentryOpenSearchTracerOption) opensearch.Config {
+	config.Transport = NewSentryRoundTripper(config.Transport, opts...)
+	return config
+}
+
+// NewAmazonConfig returns an opensearch.Config for Amazon OpenSearch Service,
+// with requests signed for the given service ("es" for managed clusters, "aoss"
+// for OpenSearch Serverless) and a traced Transport.
+func NewAmazonConfig(awsConfig aws.Config, service string, addresses []string, opts ...SentryOpenSearchTracerOption) (opensearch.Config, error) {
+	signer, err := awsv2.NewSignerWithService(awsConfig, service)
+	if err != nil {
+		return opensearch.Config{}, err
+	}
+
+	return WrapConfig(opensearch.Config{
+		Addresses: addresses,
+		Signer:    signer,
+	}, opts...), nil
+}
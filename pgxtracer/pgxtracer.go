@@ -25,79 +25,118 @@ package pgxtracer
 import (
 	"context"
 	"strconv"
+	"time"
 
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/metrics"
+	"github.com/aldy505/sentry-integration/semconv"
 	"github.com/getsentry/sentry-go"
 	"github.com/jackc/pgx/v5"
 )
 
+type spanContextKey struct{}
+
+type startContextKey struct{}
+
+var integration = config.Integration{Origin: "auto.db.pgx"}
+
+// SetEnabled turns the spans of pgx queries on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
 type SentryPgxTracerOption func(*Tracer)
 
 func WithTags(tags map[string]string) SentryPgxTracerOption {
 	return func(t *Tracer) {
-		for k, v := range tags {
-			t.tags[k] = v
-		}
+		t.options.SetTags(tags)
 	}
 }
 
 func WithTag(key, value string) SentryPgxTracerOption {
 	return func(t *Tracer) {
-		t.tags[key] = value
+		t.options.Tags[key] = value
+	}
+}
+
+// WithAttributes adds attributes to the data of every span, overriding the
+// data set by the tracer, e.g. "db.system".
+func WithAttributes(attributes map[string]interface{}) SentryPgxTracerOption {
+	return func(t *Tracer) {
+		t.options.SetAttributes(attributes)
+	}
+}
+
+// WithSpanOperation replaces the "db.sql.query" operation of the spans.
+func WithSpanOperation(operation string) SentryPgxTracerOption {
+	return func(t *Tracer) {
+		t.options.SetOperation(operation)
+	}
+}
+
+// WithSpanSampler drops the spans of queries for which sampler returns false,
+// given the operation and the query, e.g. to leave out "SELECT 1" health
+// checks.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryPgxTracerOption {
+	return func(t *Tracer) {
+		t.options.Sampler = sampler
 	}
 }
 
 func NewSentryPgxTracer(opts ...SentryPgxTracerOption) pgx.QueryTracer {
 	t := &Tracer{
-		tags: make(map[string]string),
+		options: config.NewOptions("db.sql.query"),
 	}
 
 	for _, opt := range opts {
 		opt(t)
 	}
 
+	t.data = t.options.SpanData(map[string]interface{}{
+		"db.system": "postgresql",
+	})
+
 	return t
 }
 
 type Tracer struct {
-	tags map[string]string
+	options config.Options
+	data    *config.SpanData
+
+	// pool samples the connection waits of the *sql.DB opened by OpenDB.
+	pool *poolWaits
 }
 
 func (t Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
-	span := sentry.StartSpan(ctx, "db.sql.query", sentry.WithTransactionName(data.SQL), sentry.WithDescription(data.SQL))
+	t.pool.record(ctx)
+
+	span := integration.StartSampledSpan(ctx, t.options.Sampler, t.options.Operation, data.SQL)
 	if span == nil {
-		return ctx
+		return startUntraced(ctx)
 	}
-	span.SetData("db.system", "postgresql")
+	t.data.Apply(span)
 
-	return span.Context()
+	return context.WithValue(span.Context(), spanContextKey{}, span)
 }
 
 func (t Tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
-	span := sentry.SpanFromContext(ctx)
-	if span == nil {
+	// The span of ctx may belong to the caller when the query was not traced.
+	span, ok := ctx.Value(spanContextKey{}).(*sentry.Span)
+	if !ok || span == nil {
+		if start, ok := ctx.Value(startContextKey{}).(time.Time); ok {
+			recordQuery(operation(data), time.Since(start), data.Err)
+		}
 		return
 	}
 
-	for k, v := range t.tags {
-		span.SetTag(k, v)
-	}
-
-	if data.CommandTag.Insert() {
-		span.SetData("db.operation", "INSERT")
-	} else if data.CommandTag.Select() {
-		span.SetData("db.operation", "SELECT")
-	} else if data.CommandTag.Delete() {
-		span.SetData("db.operation", "DELETE")
-	} else if data.CommandTag.Update() {
-		span.SetData("db.operation", "UPDATE")
-	} else {
-		span.SetData("db.operation", data.CommandTag.String())
-	}
+	op := operation(data)
+	span.SetData(semconv.DBOperation.Key(), op)
 
-	if config := conn.Config(); config != nil {
-		span.SetData("db.name", config.Database)
-		span.SetData("server.address", config.Host)
-		span.SetData("server.port", strconv.FormatUint(uint64(config.Port), 10))
+	if connConfig := conn.Config(); connConfig != nil {
+		span.SetData(semconv.DBName.Key(), connConfig.Database)
+		span.SetData(semconv.ServerAddress.Key(), connConfig.Host)
+		span.SetData(semconv.ServerPort.Key(), strconv.FormatUint(uint64(connConfig.Port), 10))
 	}
 
 	if data.Err != nil {
@@ -106,4 +145,50 @@ func (t Tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.Trac
 	}
 
 	span.Finish()
+
+	recordQuery(op, span.EndTime.Sub(span.StartTime), data.Err)
+}
+
+// startUntraced keeps the start time of a query without a span, for its
+// duration to be recorded as a metric.
+func startUntraced(ctx context.Context) context.Context {
+	if !metrics.Enabled() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, startContextKey{}, time.Now())
+}
+
+func operation(data pgx.TraceQueryEndData) string {
+	switch {
+	case data.CommandTag.Insert():
+		return "INSERT"
+	case data.CommandTag.Select():
+		return "SELECT"
+	case data.CommandTag.Delete():
+		return "DELETE"
+	case data.CommandTag.Update():
+		return "UPDATE"
+	default:
+		return data.CommandTag.String()
+	}
+}
+
+// recordQuery records the duration of a query in the "db.query.duration"
+// distribution, whether it was traced or not.
+func recordQuery(operation string, duration time.Duration, err error) {
+	if !metrics.Enabled() {
+		return
+	}
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+
+	metrics.Distribution("db.query.duration", float64(duration)/float64(time.Millisecond), metrics.UnitMillisecond, map[string]string{
+		"db.system":    "postgresql",
+		"db.operation": operation,
+		"status":       status,
+	})
 }
@@ -0,0 +1,130 @@
+package pgxtracer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/jackc/pgx/v5"
+)
+
+// Beginner starts transactions. *pgx.Conn, *pgxpool.Pool and *pgxpool.Conn
+// are beginners.
+type Beginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// BeginTx starts a transaction within a "db.transaction" span, finished by
+// Commit or Rollback. Statements executed with the returned context are
+// children of the span.
+//
+//	ctx, tx, err := pgxtracer.BeginTx(ctx, pool, pgx.TxOptions{IsoLevel: pgx.Serializable})
+//	if err != nil {
+//		return err
+//	}
+//	defer tx.Rollback(ctx)
+//
+//	if _, err := tx.Exec(ctx, "UPDATE accounts SET balance = balance - $1 WHERE id = $2", amount, id); err != nil {
+//		return err
+//	}
+//
+//	return tx.Commit(ctx)
+func BeginTx(ctx context.Context, db Beginner, txOptions pgx.TxOptions) (context.Context, pgx.Tx, error) {
+	span := integration.StartSpan(ctx, "db.transaction", "BEGIN")
+	if span == nil {
+		tx, err := db.BeginTx(ctx, txOptions)
+		return ctx, tx, err
+	}
+
+	span.SetData("db.system", "postgresql")
+	span.SetData("db.transaction.isolation_level", isolationLevel(txOptions.IsoLevel))
+	if txOptions.AccessMode != "" {
+		span.SetData("db.transaction.access_mode", string(txOptions.AccessMode))
+	}
+
+	ctx = span.Context()
+
+	tx, err := db.BeginTx(ctx, txOptions)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		span.Finish()
+		return ctx, nil, err
+	}
+
+	return ctx, &tracedTx{Tx: tx, span: span}, nil
+}
+
+// BeginFunc runs fn within a transaction started by BeginTx, committed when
+// fn returns no error and rolled back otherwise, as pgx.BeginTxFunc does.
+func BeginFunc(ctx context.Context, db Beginner, txOptions pgx.TxOptions, fn func(ctx context.Context, tx pgx.Tx) error) (err error) {
+	ctx, tx, err := BeginTx(ctx, db, txOptions)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rollbackErr := tx.Rollback(ctx)
+		if rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			err = rollbackErr
+		}
+	}()
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// tracedTx finishes the span of its transaction once committed or rolled
+// back. Rolling back a committed transaction, as deferred calls do, leaves
+// the span as is.
+type tracedTx struct {
+	pgx.Tx
+	span *sentry.Span
+}
+
+func (t *tracedTx) Commit(ctx context.Context) error {
+	err := t.Tx.Commit(ctx)
+	t.finish("commit", err)
+
+	return err
+}
+
+func (t *tracedTx) Rollback(ctx context.Context) error {
+	err := t.Tx.Rollback(ctx)
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return err
+	}
+	t.finish("rollback", err)
+
+	return err
+}
+
+func (t *tracedTx) finish(outcome string, err error) {
+	if t.span == nil {
+		return
+	}
+
+	t.span.SetData("db.transaction.outcome", outcome)
+	switch {
+	case err != nil:
+		t.span.Status = sentry.SpanStatusInternalError
+		t.span.SetData("error", err.Error())
+	case outcome == "rollback":
+		t.span.Status = sentry.SpanStatusAborted
+	default:
+		t.span.Status = sentry.SpanStatusOK
+	}
+
+	t.span.Finish()
+	t.span = nil
+}
+
+func isolationLevel(level pgx.TxIsoLevel) string {
+	if level == "" {
+		return "default"
+	}
+
+	return string(level)
+}
@@ -0,0 +1,58 @@
+// Package profiling correlates CPU profiles with the traces of the
+// integrations, by labelling goroutines with the IDs of the span they run
+// within.
+//
+//	config.Set(config.WithProfilerLabels())
+//
+// Worker wrappers of this module, such as sentryintegration.Go or the
+// asynq, River and Temporal tracers, then label their goroutines with
+// "trace_id", "span_id" and "span_op" pprof labels, which pprof filters with
+// -tagfocus. Transactions are profiled by Sentry itself once
+// sentry.ClientOptions.ProfilesSampleRate is set, no helper is needed for it.
+package profiling
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+)
+
+// Labels returns the pprof labels identifying span.
+func Labels(span *sentry.Span) pprof.LabelSet {
+	return pprof.Labels(
+		"trace_id", span.TraceID.String(),
+		"span_id", span.SpanID.String(),
+		"span_op", span.Op,
+	)
+}
+
+// Label labels the calling goroutine with the IDs of span, when enabled with
+// config.WithProfilerLabels. It returns ctx carrying the labels, for labels
+// set further down to add to them, and a function restoring the labels of ctx
+// to be called once span finishes. A nil span leaves the goroutine as is.
+func Label(ctx context.Context, span *sentry.Span) (context.Context, func()) {
+	if span == nil || !config.Get().ProfilerLabels {
+		return ctx, func() {}
+	}
+
+	labelled := pprof.WithLabels(ctx, Labels(span))
+	pprof.SetGoroutineLabels(labelled)
+
+	return labelled, func() {
+		pprof.SetGoroutineLabels(ctx)
+	}
+}
+
+// Do calls fn with the goroutine labelled with the IDs of the span of ctx, as
+// pprof.Do does, regardless of config.WithProfilerLabels.
+func Do(ctx context.Context, fn func(ctx context.Context)) {
+	span := sentry.SpanFromContext(ctx)
+	if span == nil {
+		fn(ctx)
+		return
+	}
+
+	pprof.Do(ctx, Labels(span), fn)
+}
@@ -0,0 +1,174 @@
+package propagation
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// sentryPrefix prefixes the baggage entries of the Sentry dynamic sampling
+// context, e.g. "sentry-trace_id".
+const sentryPrefix = "sentry-"
+
+// Member is an entry of a baggage header. Value is decoded, and properties
+// following the value are kept as is.
+type Member struct {
+	Key        string
+	Value      string
+	Properties string
+}
+
+// Baggage is the list of entries of a W3C baggage header, in order.
+//
+//	b := propagation.ParseBaggage(carrier.Get("baggage"))
+//	b = b.Set("tenant", tenantID)
+//	carrier.Set("baggage", b.String())
+type Baggage []Member
+
+// ParseBaggage parses a baggage header, skipping malformed entries.
+func ParseBaggage(header string) Baggage {
+	var b Baggage
+	for _, entry := range strings.Split(header, ",") {
+		entry, properties, _ := strings.Cut(entry, ";")
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+
+		decoded, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+
+		b = append(b, Member{Key: key, Value: decoded, Properties: strings.TrimSpace(properties)})
+	}
+
+	return b
+}
+
+// Get returns the value of key.
+func (b Baggage) Get(key string) (string, bool) {
+	for _, m := range b {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Set replaces the value of key, or appends it. The receiver is not modified.
+func (b Baggage) Set(key, value string) Baggage {
+	set := make(Baggage, 0, len(b)+1)
+	found := false
+	for _, m := range b {
+		if m.Key == key {
+			if found {
+				continue
+			}
+			m = Member{Key: key, Value: value}
+			found = true
+		}
+		set = append(set, m)
+	}
+
+	if !found {
+		set = append(set, Member{Key: key, Value: value})
+	}
+
+	return set
+}
+
+// Delete removes key. The receiver is not modified.
+func (b Baggage) Delete(key string) Baggage {
+	return b.Filter(func(m Member) bool {
+		return m.Key != key
+	})
+}
+
+// Filter returns the entries for which keep returns true. The receiver is not
+// modified.
+func (b Baggage) Filter(keep func(m Member) bool) Baggage {
+	filtered := make(Baggage, 0, len(b))
+	for _, m := range b {
+		if keep(m) {
+			filtered = append(filtered, m)
+		}
+	}
+
+	return filtered
+}
+
+// Sentry returns the entries of the Sentry dynamic sampling context.
+func (b Baggage) Sentry() Baggage {
+	return b.Filter(IsSentryMember)
+}
+
+// Custom returns the entries of the application and of third parties, i.e.
+// anything but the Sentry dynamic sampling context.
+func (b Baggage) Custom() Baggage {
+	return b.Filter(func(m Member) bool {
+		return !IsSentryMember(m)
+	})
+}
+
+// String encodes b as a baggage header.
+func (b Baggage) String() string {
+	var sb strings.Builder
+	for i, m := range b {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(m.Key)
+		sb.WriteByte('=')
+		sb.WriteString(url.PathEscape(m.Value))
+		if m.Properties != "" {
+			sb.WriteByte(';')
+			sb.WriteString(m.Properties)
+		}
+	}
+
+	return sb.String()
+}
+
+// IsSentryMember reports whether m belongs to the Sentry dynamic sampling
+// context, which is managed by the SDK.
+func IsSentryMember(m Member) bool {
+	return strings.HasPrefix(m.Key, sentryPrefix)
+}
+
+// AppendBaggage sets key to value in the baggage of carrier, e.g. a tenant or
+// request class after Inject. Processing integrations record such entries as
+// "baggage.<key>" span data, see Continue.
+func AppendBaggage(carrier Carrier, key, value string) {
+	if carrier == nil {
+		return
+	}
+
+	b := ParseBaggage(carrier.Get(sentry.SentryBaggageHeader)).Set(key, value)
+	carrier.Set(sentry.SentryBaggageHeader, b.String())
+}
+
+// FilterBaggage removes the entries of the baggage of carrier for which keep
+// returns false, e.g. to drop entries before a message leaves the system.
+func FilterBaggage(carrier Carrier, keep func(m Member) bool) {
+	if carrier == nil {
+		return
+	}
+
+	header := carrier.Get(sentry.SentryBaggageHeader)
+	if header == "" {
+		return
+	}
+
+	carrier.Set(sentry.SentryBaggageHeader, ParseBaggage(header).Filter(keep).String())
+}
+
+// setBaggageData records the entries of b as "baggage.<key>" data of span.
+func setBaggageData(span *sentry.Span, b Baggage) {
+	for _, m := range b {
+		span.SetData("baggage."+m.Key, m.Value)
+	}
+}
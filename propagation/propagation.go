@@ -0,0 +1,137 @@
+// Package propagation carries the Sentry trace context over any transport
+// which messages have string metadata, such as message bus headers, job
+// payloads or file metadata, the way the integrations do.
+//
+//	// Producer
+//	propagation.Inject(span, propagation.MapCarrier(job.Metadata))
+//
+//	// Consumer
+//	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier(job.Metadata))
+//	span := sentry.StartSpan(ctx, "queue.process", sentry.WithTransactionName(job.Kind), continueTrace)
+//	defer span.Finish()
+//
+// The trace context is carried under the "sentry-trace" and "baggage" keys,
+// and continued from the "traceparent" and "tracestate" keys of the W3C trace
+// context as well.
+package propagation
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Carrier is the metadata of a message. nats.Header and watermill's
+// message.Metadata are carriers as is.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// MapCarrier is a Carrier over a map, which must not be nil when injecting.
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c MapCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// HeaderCarrier is a Carrier over HTTP headers, which keys are canonicalized.
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string {
+	return http.Header(c).Get(key)
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	http.Header(c).Set(key, value)
+}
+
+// Inject sets the trace context of span on carrier, keeping the custom
+// baggage entries the carrier already has. It does nothing when span is nil,
+// e.g. when it was not sampled by an integration.
+func Inject(span *sentry.Span, carrier Carrier) {
+	if span == nil || carrier == nil {
+		return
+	}
+
+	carrier.Set(sentry.SentryTraceHeader, span.ToSentryTrace())
+
+	baggage := span.ToBaggage()
+	if custom := ParseBaggage(carrier.Get(sentry.SentryBaggageHeader)).Custom(); len(custom) > 0 {
+		baggage = append(ParseBaggage(baggage), custom...).String()
+	}
+	carrier.Set(sentry.SentryBaggageHeader, baggage)
+}
+
+// Continue prepares the processing of a message carrying the trace context
+// of carrier. The returned context has a clone of the hub routed by
+// SetHubRouter bound to it, else of the hub of ctx or of the current hub, so
+// the scope of the message is its own, and the
+// returned option continues the trace when starting the transaction of the
+// message, recording the custom baggage entries as "baggage.<key>" data.
+// Without a sentry-trace entry, the W3C traceparent entry of OpenTelemetry
+// instrumented upstreams is continued instead, see
+// SentryTraceFromTraceparent. Without trace context, the transaction starts a
+// new trace.
+func Continue(ctx context.Context, carrier Carrier) (context.Context, sentry.SpanOption) {
+	hub := routeHub(carrier)
+	if hub == nil {
+		hub = sentry.GetHubFromContext(ctx)
+	}
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+	ctx = sentry.SetHubOnContext(ctx, hub.Clone())
+
+	var trace, baggage string
+	if carrier != nil {
+		trace = carrier.Get(sentry.SentryTraceHeader)
+		baggage = carrier.Get(sentry.SentryBaggageHeader)
+	}
+
+	continueTrace := sentry.ContinueFromHeaders(trace, baggage)
+	if trace == "" && carrier != nil {
+		if w3c := continueTraceparent(carrier, baggage); w3c != nil {
+			continueTrace = w3c
+		}
+	}
+
+	custom := ParseBaggage(baggage).Custom()
+	if len(custom) == 0 {
+		return ctx, continueTrace
+	}
+
+	return ctx, func(span *sentry.Span) {
+		continueTrace(span)
+		setBaggageData(span, custom)
+	}
+}
+
+var hubRouter atomic.Pointer[func(carrier Carrier) *sentry.Hub]
+
+// SetHubRouter makes Continue bind a clone of the hub router returns for the
+// carrier of a message, unless it returns nil, e.g. the hub of the tenant of
+// the message, see package tenant. A nil router restores the default.
+func SetHubRouter(router func(carrier Carrier) *sentry.Hub) {
+	if router == nil {
+		hubRouter.Store(nil)
+		return
+	}
+
+	hubRouter.Store(&router)
+}
+
+func routeHub(carrier Carrier) *sentry.Hub {
+	router := hubRouter.Load()
+	if router == nil || carrier == nil {
+		return nil
+	}
+
+	return (*router)(carrier)
+}
@@ -0,0 +1,87 @@
+package propagation
+
+import (
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// TraceparentHeader and TracestateHeader are the keys of the W3C trace
+// context, as sent by OpenTelemetry instrumented upstreams.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TracestateKey is the span data key of the W3C tracestate a transaction was
+// continued with.
+const TracestateKey = "w3c.tracestate"
+
+// SentryTraceFromTraceparent converts a W3C traceparent header into a
+// sentry-trace header, carrying the same trace ID, parent span ID and
+// sampling decision. It reports false when traceparent is malformed, or of
+// the invalid version "ff".
+func SentryTraceFromTraceparent(traceparent string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 {
+		return "", false
+	}
+
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", false
+	}
+	if !isLowerHex(traceID, 32) || strings.Trim(traceID, "0") == "" {
+		return "", false
+	}
+	if !isLowerHex(parentID, 16) || strings.Trim(parentID, "0") == "" {
+		return "", false
+	}
+	if !isLowerHex(flags, 2) {
+		return "", false
+	}
+
+	// The sampled flag is the lowest bit of the flags.
+	sampled := "0"
+	if strings.IndexByte("13579bdf", flags[1]) >= 0 {
+		sampled = "1"
+	}
+
+	return traceID + "-" + parentID + "-" + sampled, true
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// continueTraceparent returns the option continuing the W3C trace context of
+// carrier, or nil when it has none. The tracestate is recorded as the
+// TracestateKey data of the transaction.
+func continueTraceparent(carrier Carrier, baggage string) sentry.SpanOption {
+	trace, ok := SentryTraceFromTraceparent(carrier.Get(TraceparentHeader))
+	if !ok {
+		return nil
+	}
+
+	continueTrace := sentry.ContinueFromHeaders(trace, baggage)
+	tracestate := carrier.Get(TracestateHeader)
+	if tracestate == "" {
+		return continueTrace
+	}
+
+	return func(span *sentry.Span) {
+		continueTrace(span)
+		span.SetData(TracestateKey, tracestate)
+	}
+}
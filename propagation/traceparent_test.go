@@ -0,0 +1,81 @@
+package propagation_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/sentryintegrationtest"
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID = "00f067aa0ba902b7"
+)
+
+func TestSentryTraceFromTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		want        string
+		ok          bool
+	}{
+		{"sampled", "00-" + traceID + "-" + parentID + "-01", traceID + "-" + parentID + "-1", true},
+		{"not sampled", "00-" + traceID + "-" + parentID + "-00", traceID + "-" + parentID + "-0", true},
+		{"other flags", "00-" + traceID + "-" + parentID + "-03", traceID + "-" + parentID + "-1", true},
+		{"future version", "01-" + traceID + "-" + parentID + "-01-future", traceID + "-" + parentID + "-1", true},
+		{"invalid version", "ff-" + traceID + "-" + parentID + "-01", "", false},
+		{"zero trace ID", "00-" + strings.Repeat("0", 32) + "-" + parentID + "-01", "", false},
+		{"zero parent ID", "00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", "", false},
+		{"short trace ID", "00-" + traceID[1:] + "-" + parentID + "-01", "", false},
+		{"long parent ID", "00-" + traceID + "-" + parentID + "0-01", "", false},
+		{"extra fields of version 00", "00-" + traceID + "-" + parentID + "-01-future", "", false},
+		{"uppercase", "00-" + strings.ToUpper(traceID) + "-" + parentID + "-01", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := propagation.SentryTraceFromTraceparent(tt.traceparent)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("SentryTraceFromTraceparent(%q) = %q, %v, want %q, %v", tt.traceparent, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestContinueTraceparent(t *testing.T) {
+	tests := []struct {
+		flags   string
+		sampled sentry.Sampled
+	}{
+		{"01", sentry.SampledTrue},
+		{"00", sentry.SampledFalse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flags, func(t *testing.T) {
+			recorder := sentryintegrationtest.NewRecorder(t)
+
+			ctx, continueTrace := propagation.Continue(recorder.Context(context.Background()), propagation.MapCarrier{
+				propagation.TraceparentHeader: "00-" + traceID + "-" + parentID + "-" + tt.flags,
+			})
+			span := sentry.StartSpan(ctx, "queue.process", sentry.WithTransactionName("test"), continueTrace)
+			defer span.Finish()
+
+			if span.TraceID.String() != traceID || span.ParentSpanID.String() != parentID {
+				t.Errorf("span trace = %s-%s, want %s-%s", span.TraceID, span.ParentSpanID, traceID, parentID)
+			}
+			if span.Sampled != tt.sampled {
+				t.Errorf("span sampled = %v, want %v", span.Sampled, tt.sampled)
+			}
+
+			want := traceID + "-" + span.SpanID.String() + "-" + strings.TrimPrefix(tt.flags, "0")
+			if got := span.ToSentryTrace(); got != want {
+				t.Errorf("sentry-trace = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package ratetracer provides a tracer implementation for golang.org/x/time/rate
+// limiters.
+//
+//	limiter := ratetracer.NewSentryLimiter(rate.NewLimiter(rate.Limit(10), 1), "github-api")
+//
+//	if err := limiter.Wait(ctx); err != nil {
+//		return err
+//	}
+//
+// Waits longer than the threshold, 10 milliseconds by default, are recorded as
+// a "throttle.wait" span, so time spent throttled does not look like latency of
+// the surrounding span. Waits that fail, e.g. as they would exceed the deadline
+// of the context, are always recorded.
+package ratetracer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+	"golang.org/x/time/rate"
+)
+
+var integration = config.Integration{Origin: "auto.function.rate"}
+
+// SetEnabled turns the spans of rate limiter waits on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryRateTracerOption func(*Limiter)
+
+func WithTags(tags map[string]string) SentryRateTracerOption {
+	return func(l *Limiter) {
+		for k, v := range tags {
+			l.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryRateTracerOption {
+	return func(l *Limiter) {
+		l.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the "throttle.wait" spans for which sampler returns
+// false, given the operation and the name of the limiter.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryRateTracerOption {
+	return func(l *Limiter) {
+		l.spanSampler = sampler
+	}
+}
+
+// WithThreshold sets how long a wait has to last to be recorded. A zero
+// threshold records every wait.
+func WithThreshold(threshold time.Duration) SentryRateTracerOption {
+	return func(l *Limiter) {
+		l.threshold = threshold
+	}
+}
+
+func NewSentryLimiter(limiter *rate.Limiter, name string, opts ...SentryRateTracerOption) *Limiter {
+	l := &Limiter{
+		Limiter:   limiter,
+		name:      name,
+		threshold: 10 * time.Millisecond,
+		tags:      make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Limiter wraps a rate.Limiter, tracing Wait and WaitN. Other methods are
+// forwarded to the underlying limiter as-is.
+type Limiter struct {
+	*rate.Limiter
+	name        string
+	threshold   time.Duration
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// Wait is shorthand for WaitN(ctx, 1).
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until the limiter permits n events, as rate.Limiter.WaitN does,
+// recording the wait as a "throttle.wait" span.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	start := time.Now()
+	err := l.Limiter.WaitN(ctx, n)
+	delay := time.Since(start)
+
+	// The span is only known to be worth recording once the wait is over.
+	if (delay < l.threshold && err == nil) || sentry.SpanFromContext(ctx) == nil {
+		return err
+	}
+
+	span := integration.StartSampledSpan(ctx, l.spanSampler, "throttle.wait", l.name)
+	if span == nil {
+		return err
+	}
+	span.StartTime = start
+	span.SetData("throttle.name", l.name)
+	span.SetData("throttle.tokens", strconv.Itoa(n))
+	span.SetData("throttle.delay", strconv.FormatInt(delay.Milliseconds(), 10))
+	span.SetData("throttle.limit", strconv.FormatFloat(float64(l.Limit()), 'f', -1, 64))
+	span.SetData("throttle.burst", strconv.Itoa(l.Burst()))
+
+	for k, v := range l.tags {
+		span.SetTag(k, v)
+	}
+
+	switch {
+	case err == nil:
+		span.Status = sentry.SpanStatusOK
+	case ctx.Err() != nil:
+		span.Status = sentry.SpanStatusCanceled
+		span.SetData("error", err.Error())
+	default:
+		span.Status = sentry.SpanStatusResourceExhausted
+		span.SetData("error", err.Error())
+	}
+
+	span.Finish()
+
+	return err
+}
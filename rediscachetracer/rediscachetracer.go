@@ -0,0 +1,303 @@
+// Package rediscachetracer provides a tracer implementation for go-redis/cache.
+//
+// Spans follow Sentry's cache module conventions. As go-redis/cache looks keys
+// up in its local tier before Redis, spans record which tier served a hit in
+// "cache.tier", either "local" or "remote".
+//
+//	mycache := rediscachetracer.NewSentryCache(&cache.Options{
+//		Redis:      rdb,
+//		LocalCache: cache.NewTinyLFU(1000, time.Minute),
+//	})
+//
+//	var user User
+//	err := mycache.Get(ctx, "user:42", &user)
+//
+// The Redis client itself is not traced, use redistracer for that.
+package rediscachetracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/metrics"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-redis/cache/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+type lookupContextKey struct{}
+
+var integration = config.Integration{Origin: "auto.cache.redis"}
+
+// SetEnabled turns the spans of go-redis/cache operations on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryRedisCacheTracerOption func(*Cache)
+
+func WithTags(tags map[string]string) SentryRedisCacheTracerOption {
+	return func(c *Cache) {
+		for k, v := range tags {
+			c.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryRedisCacheTracerOption {
+	return func(c *Cache) {
+		c.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of operations for which sampler returns
+// false, given the operation and the scrubbed key.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryRedisCacheTracerOption {
+	return func(c *Cache) {
+		c.spanSampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every cache key before it is
+// recorded on a span, e.g. to strip user identifiers out of the key.
+func WithKeyScrubber(scrubber func(key string) string) SentryRedisCacheTracerOption {
+	return func(c *Cache) {
+		c.scrubKey = scrubber
+	}
+}
+
+// NewSentryCache creates a cache.Cache out of opt, and wraps it in a Cache
+// tracing its operations.
+func NewSentryCache(opt *cache.Options, opts ...SentryRedisCacheTracerOption) *Cache {
+	o := *opt
+	if o.Redis != nil {
+		o.Redis = &remote{rediser: o.Redis}
+	}
+
+	c := &Cache{
+		Cache:    cache.New(&o),
+		scrubKey: func(key string) string { return key },
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Cache wraps a cache.Cache. Get, Set, Once and Delete are traced, other
+// methods are forwarded to the underlying cache as-is.
+type Cache struct {
+	*cache.Cache
+
+	scrubKey    func(key string) string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// lookup records whether a cache operation reached the Redis tier, and what it
+// got back from it.
+type lookup struct {
+	remote bool
+	size   int
+}
+
+// rediser mirrors the unexported interface cache.Options.Redis has to satisfy.
+type rediser interface {
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.StatusCmd
+	SetXX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.BoolCmd
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) *redis.BoolCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+// remote wraps the Redis tier, so lookups can tell whether the local tier
+// served the key or not.
+type remote struct {
+	rediser
+}
+
+func (r *remote) Get(ctx context.Context, key string) *redis.StringCmd {
+	cmd := r.rediser.Get(ctx, key)
+
+	if l, ok := ctx.Value(lookupContextKey{}).(*lookup); ok {
+		l.remote = true
+		if value, err := cmd.Bytes(); err == nil {
+			l.size = len(value)
+		}
+	}
+
+	return cmd
+}
+
+func (c *Cache) startSpan(ctx context.Context, operation, key string) *sentry.Span {
+	key = scrub.String(c.scrubKey(key))
+
+	span := integration.StartSampledSpan(ctx, c.spanSampler, operation, key)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("cache.key", key)
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// recordLookup counts a lookup in the "cache.lookup" counter, tagged with
+// whether it hit, and by which tier. Failed lookups are not counted, so the
+// counter gives the hit ratio of the cache.
+func recordLookup(l *lookup, err error) {
+	if !metrics.Enabled() {
+		return
+	}
+
+	tags := map[string]string{"cache.system": "redis"}
+	switch {
+	case err == nil:
+		tags["cache.hit"] = "true"
+		if l.remote {
+			tags["cache.tier"] = "remote"
+		} else {
+			tags["cache.tier"] = "local"
+		}
+	case errors.Is(err, cache.ErrCacheMiss):
+		tags["cache.hit"] = "false"
+	default:
+		return
+	}
+
+	metrics.Increment("cache.lookup", 1, metrics.UnitNone, tags)
+}
+
+// finishLookup records the outcome of a lookup. A miss is not an error.
+func finishLookup(span *sentry.Span, l *lookup, err error) {
+	recordLookup(l, err)
+
+	switch {
+	case err == nil:
+		span.SetData("cache.hit", "true")
+		if l.remote {
+			span.SetData("cache.tier", "remote")
+			span.SetData("cache.item_size", strconv.Itoa(l.size))
+		} else {
+			span.SetData("cache.tier", "local")
+		}
+		span.Status = sentry.SpanStatusOK
+	case errors.Is(err, cache.ErrCacheMiss):
+		span.SetData("cache.hit", "false")
+		span.Status = sentry.SpanStatusOK
+	default:
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	}
+
+	span.Finish()
+}
+
+func (c *Cache) Get(ctx context.Context, key string, value interface{}) error {
+	span := c.startSpan(ctx, "cache.get", key)
+	if span == nil {
+		if !metrics.Enabled() {
+			return c.Cache.Get(ctx, key, value)
+		}
+
+		l := &lookup{}
+		err := c.Cache.Get(context.WithValue(ctx, lookupContextKey{}, l), key, value)
+		recordLookup(l, err)
+
+		return err
+	}
+
+	l := &lookup{}
+	err := c.Cache.Get(context.WithValue(span.Context(), lookupContextKey{}, l), key, value)
+	finishLookup(span, l, err)
+
+	return err
+}
+
+func (c *Cache) Set(item *cache.Item) error {
+	span := c.startSpan(item.Context(), "cache.put", item.Key)
+	if span == nil {
+		return c.Cache.Set(item)
+	}
+
+	if item.TTL > 0 {
+		span.SetData("cache.ttl", strconv.FormatInt(int64(item.TTL.Seconds()), 10))
+	}
+
+	ctx := item.Ctx
+	item.Ctx = span.Context()
+	err := c.Cache.Set(item)
+	item.Ctx = ctx
+
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+	span.Finish()
+
+	return err
+}
+
+// Once implements cache.Cache.Once. When item.Do has to be called, the lookup
+// is recorded as a miss.
+func (c *Cache) Once(item *cache.Item) error {
+	span := c.startSpan(item.Context(), "cache.get", item.Key)
+	if span == nil {
+		return c.Cache.Once(item)
+	}
+
+	l := &lookup{}
+	missed := false
+
+	ctx, do := item.Ctx, item.Do
+	item.Ctx = context.WithValue(span.Context(), lookupContextKey{}, l)
+	if do != nil {
+		item.Do = func(item *cache.Item) (interface{}, error) {
+			missed = true
+			return do(item)
+		}
+	}
+
+	err := c.Cache.Once(item)
+	item.Ctx, item.Do = ctx, do
+
+	if err == nil && missed {
+		finishLookup(span, l, cache.ErrCacheMiss)
+	} else {
+		finishLookup(span, l, err)
+	}
+
+	return err
+}
+
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	span := c.startSpan(ctx, "cache.remove", key)
+	if span == nil {
+		return c.Cache.Delete(ctx, key)
+	}
+
+	err := c.Cache.Delete(span.Context(), key)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+	span.Finish()
+
+	return err
+}
@@ -10,49 +10,92 @@ import (
 	"context"
 	"net"
 	"strings"
+	"sync/atomic"
 
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
 	"github.com/getsentry/sentry-go"
 	redis "github.com/redis/go-redis/v9"
 )
 
+var integration = config.Integration{Origin: "auto.db.redis"}
+
+// SetEnabled turns the spans of Redis commands and streams on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
 type SentryRedisTracerOption func(*SentryRedisTracer)
 
 func WithTags(tags map[string]string) SentryRedisTracerOption {
 	return func(t *SentryRedisTracer) {
-		for k, v := range tags {
-			t.tags[k] = v
-		}
+		t.options.SetTags(tags)
 	}
 }
 
 func WithTag(key, value string) SentryRedisTracerOption {
 	return func(t *SentryRedisTracer) {
-		t.tags[key] = value
+		t.options.Tags[key] = value
+	}
+}
+
+// WithAttributes adds attributes to the data of every span, overriding the
+// data set by the tracer, e.g. "db.system".
+func WithAttributes(attributes map[string]interface{}) SentryRedisTracerOption {
+	return func(t *SentryRedisTracer) {
+		t.options.SetAttributes(attributes)
+	}
+}
+
+// WithSpanOperation replaces the "db.redis" operation of the spans.
+func WithSpanOperation(operation string) SentryRedisTracerOption {
+	return func(t *SentryRedisTracer) {
+		t.options.SetOperation(operation)
+	}
+}
+
+// WithSpanSampler drops the spans of commands for which sampler returns false,
+// given the operation and the command name, e.g. "PING".
+func WithSpanSampler(sampler func(operation, description string) bool) SentryRedisTracerOption {
+	return func(t *SentryRedisTracer) {
+		t.options.Sampler = sampler
 	}
 }
 
 func NewSentryRedisTracer(opts ...SentryRedisTracerOption) redis.Hook {
-	t := &SentryRedisTracer{}
+	t := &SentryRedisTracer{
+		options: config.NewOptions("db.redis"),
+	}
 
 	for _, opt := range opts {
 		opt(t)
 	}
 
+	t.setAddr("")
+
 	return t
 }
 
 type SentryRedisTracer struct {
-	network string
-	addr    string
+	options config.Options
 
-	tags map[string]string
+	// data holds the data and tags of every span, merged again once the
+	// address of the server is known.
+	data atomic.Pointer[config.SpanData]
+}
+
+func (s *SentryRedisTracer) setAddr(addr string) {
+	s.data.Store(s.options.SpanData(map[string]interface{}{
+		"db.system":                 "redis",
+		semconv.ServerAddress.Key(): addr,
+	}))
 }
 
 // DialHook implements redis.Hook.
 func (s *SentryRedisTracer) DialHook(next redis.DialHook) redis.DialHook {
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
-		s.network = network
-		s.addr = addr
+		s.setAddr(addr)
 		return next(ctx, network, addr)
 	}
 }
@@ -60,18 +103,13 @@ func (s *SentryRedisTracer) DialHook(next redis.DialHook) redis.DialHook {
 // ProcessHook implements redis.Hook.
 func (s *SentryRedisTracer) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
 	return func(ctx context.Context, cmd redis.Cmder) error {
-		span := sentry.StartSpan(ctx, "db.redis", sentry.WithTransactionName(strings.ToUpper(cmd.Name())), sentry.WithDescription(strings.ToUpper(cmd.Name())))
+		name := strings.ToUpper(cmd.Name())
+		span := integration.StartSampledSpan(ctx, s.options.Sampler, s.options.Operation, name)
 		if span == nil {
 			return next(ctx, cmd)
 		}
-		span.SetData("db.system", "redis")
-		span.SetData("db.operation", cmd.FullName())
-		span.SetData("server.address", s.addr)
-
-		for k, v := range s.tags {
-			span.SetTag(k, v)
-		}
-
+		s.data.Load().Apply(span)
+		span.SetData(semconv.DBOperation.Key(), cmd.FullName())
 		defer span.Finish()
 
 		err := next(ctx, cmd)
@@ -86,13 +124,12 @@ func (s *SentryRedisTracer) ProcessHook(next redis.ProcessHook) redis.ProcessHoo
 // ProcessPipelineHook implements redis.Hook.
 func (s *SentryRedisTracer) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
 	return func(ctx context.Context, cmds []redis.Cmder) error {
-		span := sentry.StartSpan(ctx, "db.redis", sentry.WithTransactionName("PIPELINE"), sentry.WithDescription("PIPELINE"))
+		span := integration.StartSampledSpan(ctx, s.options.Sampler, s.options.Operation, "PIPELINE")
 		if span == nil {
 			return next(ctx, cmds)
 		}
-		span.SetData("db.system", "redis")
-		span.SetData("db.operation", "PIPELINE")
-		span.SetData("server.address", s.addr)
+		s.data.Load().Apply(span)
+		span.SetData(semconv.DBOperation.Key(), "PIPELINE")
 		defer span.Finish()
 
 		err := next(ctx, cmds)
@@ -0,0 +1,296 @@
+package redistracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// XAdd wraps XADD with a "queue.publish" span, and adds the trace context to the
+// values of the entry so that a StreamWorker is able to continue the trace.
+//
+// The values of args must be either a map[string]interface{} or a
+// []interface{} of alternating field names and values. Of opts, the span
+// sampler and the tags apply to the "queue.publish" span.
+func XAdd(ctx context.Context, client redis.Cmdable, args *redis.XAddArgs, opts ...SentryStreamWorkerOption) *redis.StringCmd {
+	var options StreamWorker
+	if len(opts) > 0 {
+		options.tags = make(map[string]string)
+		for _, opt := range opts {
+			opt(&options)
+		}
+	}
+
+	span := integration.StartSampledSpan(ctx, options.spanSampler, "queue.publish", args.Stream)
+	if span == nil {
+		return client.XAdd(ctx, args)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "redis")
+	span.SetData(semconv.MessagingDestinationName.Key(), args.Stream)
+	for k, v := range options.tags {
+		span.SetTag(k, v)
+	}
+
+	switch values := args.Values.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(values)+2)
+		for k, v := range values {
+			copied[k] = v
+		}
+		copied[sentry.SentryTraceHeader] = span.ToSentryTrace()
+		copied[sentry.SentryBaggageHeader] = span.ToBaggage()
+		args.Values = copied
+	case []interface{}:
+		args.Values = append(values[:len(values):len(values)], sentry.SentryTraceHeader, span.ToSentryTrace(), sentry.SentryBaggageHeader, span.ToBaggage())
+	}
+
+	cmd := client.XAdd(span.Context(), args)
+	if err := cmd.Err(); err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+		span.SetData(semconv.MessagingMessageID.Key(), cmd.Val())
+	}
+
+	return cmd
+}
+
+// StreamHandler processes a single stream entry. The provided context carries
+// the "queue.process" transaction of the entry.
+type StreamHandler func(ctx context.Context, message redis.XMessage) error
+
+type SentryStreamWorkerOption func(*StreamWorker)
+
+// WithStreamBatchSize sets the maximum amount of entries read by a single XREADGROUP call.
+func WithStreamBatchSize(count int64) SentryStreamWorkerOption {
+	return func(w *StreamWorker) {
+		w.count = count
+	}
+}
+
+// WithStreamBlock sets how long a single XREADGROUP call blocks waiting for entries.
+func WithStreamBlock(block time.Duration) SentryStreamWorkerOption {
+	return func(w *StreamWorker) {
+		w.block = block
+	}
+}
+
+// WithStreamClaimMinIdle enables claiming entries which have been pending on
+// other consumers for at least minIdle, so entries of crashed consumers are
+// eventually processed.
+func WithStreamClaimMinIdle(minIdle time.Duration) SentryStreamWorkerOption {
+	return func(w *StreamWorker) {
+		w.claimMinIdle = minIdle
+	}
+}
+
+func WithStreamTags(tags map[string]string) SentryStreamWorkerOption {
+	return func(w *StreamWorker) {
+		for k, v := range tags {
+			w.tags[k] = v
+		}
+	}
+}
+
+// WithStreamSpanSampler processes entries for which sampler returns false,
+// given the "queue.process" operation and the stream, without a transaction.
+// Passed to XAdd, it is given the "queue.publish" operation instead.
+func WithStreamSpanSampler(sampler func(operation, description string) bool) SentryStreamWorkerOption {
+	return func(w *StreamWorker) {
+		w.spanSampler = sampler
+	}
+}
+
+// NewSentryStreamWorker creates a consumer group worker for a Redis stream.
+//
+//	worker := redistracer.NewSentryStreamWorker(rdb, "orders", "processors", hostname, func(ctx context.Context, message redis.XMessage) error {
+//		return processOrder(ctx, message.Values)
+//	}, redistracer.WithStreamClaimMinIdle(time.Minute))
+//
+//	err := worker.Run(ctx)
+func NewSentryStreamWorker(client redis.Cmdable, stream, group, consumer string, handler StreamHandler, opts ...SentryStreamWorkerOption) *StreamWorker {
+	w := &StreamWorker{
+		client:   client,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+		handler:  handler,
+		count:    10,
+		block:    5 * time.Second,
+		tags:     make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+type StreamWorker struct {
+	client   redis.Cmdable
+	stream   string
+	group    string
+	consumer string
+	handler  StreamHandler
+
+	count        int64
+	block        time.Duration
+	claimMinIdle time.Duration
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// Run reads and processes entries until ctx is done. Entries are acknowledged
+// once the handler returns without an error, failed entries are left pending.
+func (w *StreamWorker) Run(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if w.claimMinIdle > 0 {
+			if err := w.claim(ctx); err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+
+		streams, err := w.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    w.group,
+			Consumer: w.consumer,
+			Streams:  []string{w.stream, ">"},
+			Count:    w.count,
+			Block:    w.block,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				w.process(ctx, message, 1, 0)
+			}
+		}
+	}
+}
+
+func (w *StreamWorker) claim(ctx context.Context) error {
+	pending, err := w.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: w.stream,
+		Group:  w.group,
+		Idle:   w.claimMinIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  w.count,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range pending {
+		messages, err := w.client.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   w.stream,
+			Group:    w.group,
+			Consumer: w.consumer,
+			MinIdle:  w.claimMinIdle,
+			Messages: []string{entry.ID},
+		}).Result()
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			// XCLAIM increments the delivery counter of the entry.
+			w.process(ctx, message, entry.RetryCount+1, entry.Idle)
+		}
+	}
+
+	return nil
+}
+
+// process handles message within a "queue.process" transaction. pendingTime is
+// how long a claimed entry was left idle on another consumer, or zero.
+func (w *StreamWorker) process(ctx context.Context, message redis.XMessage, deliveryCount int64, pendingTime time.Duration) {
+	trace, _ := message.Values[sentry.SentryTraceHeader].(string)
+	baggage, _ := message.Values[sentry.SentryBaggageHeader].(string)
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier{
+		sentry.SentryTraceHeader:   trace,
+		sentry.SentryBaggageHeader: baggage,
+	})
+
+	span := integration.StartTransaction(
+		ctx,
+		w.spanSampler,
+		"queue.process",
+		w.stream,
+		continueTrace,
+	)
+	if span == nil {
+		if err := w.handler(ctx, message); err == nil {
+			w.client.XAck(ctx, w.stream, w.group, message.ID)
+		}
+		return
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "redis")
+	span.SetData(semconv.MessagingDestinationName.Key(), w.stream)
+	span.SetData("messaging.consumer.group.name", w.group)
+	span.SetData(semconv.MessagingMessageID.Key(), message.ID)
+	span.SetData("messaging.redis.delivery_count", strconv.FormatInt(deliveryCount, 10))
+	span.SetData("messaging.message.retry.count", strconv.FormatInt(deliveryCount-1, 10))
+	if enqueuedAt, ok := streamIDTime(message.ID); ok {
+		messaging.SetReceiveLatency(span, enqueuedAt, time.Now())
+	}
+	if pendingTime > 0 {
+		span.SetData("messaging.redis.pending_time", strconv.FormatInt(pendingTime.Milliseconds(), 10))
+	}
+
+	for k, v := range w.tags {
+		span.SetTag(k, v)
+	}
+
+	if err := w.handler(span.Context(), message); err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return
+	}
+
+	if err := w.client.XAck(span.Context(), w.stream, w.group, message.ID).Err(); err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return
+	}
+
+	span.Status = sentry.SpanStatusOK
+}
+
+// streamIDTime extracts the millisecond timestamp part of a stream entry ID.
+func streamIDTime(id string) (time.Time, bool) {
+	milliseconds, _, _ := strings.Cut(id, "-")
+	value, err := strconv.ParseInt(milliseconds, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(value), true
+}
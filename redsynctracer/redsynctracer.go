@@ -0,0 +1,289 @@
+// Package redsynctracer provides a tracer implementation for go-redsync
+// distributed locks.
+//
+//	rs := redsynctracer.NewSentryRedsync([]redis.Pool{goredis.NewPool(client)})
+//
+//	mutex := rs.NewMutex("order:42", redsync.WithTries(16))
+//	if err := mutex.LockContext(ctx); err != nil {
+//		return err
+//	}
+//	defer mutex.UnlockContext(ctx)
+//
+// Acquiring a lock is a "cache.lock" span recording how long it took and how
+// many times it was retried, releasing it a "cache.unlock" span. Failing to
+// acquire or release a lock is captured as an error, as contention is a common
+// hidden cause of latency. Failures of TryLock and TryLockContext, which give
+// up on contention by design, are not captured.
+package redsynctracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-redsync/redsync/v4"
+	"github.com/go-redsync/redsync/v4/redis"
+)
+
+var integration = config.Integration{Origin: "auto.cache.redsync"}
+
+// SetEnabled turns the spans of locks on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryRedsyncTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryRedsyncTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryRedsyncTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of locks for which sampler returns false,
+// given the operation and the scrubbed name of the lock.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryRedsyncTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithoutErrorCapture disables capturing the failures to acquire or release a
+// lock, only recording them on their spans.
+func WithoutErrorCapture() SentryRedsyncTracerOption {
+	return func(t *tracer) {
+		t.captureErrors = false
+	}
+}
+
+type tracer struct {
+	tags          map[string]string
+	spanSampler   func(operation, description string) bool
+	captureErrors bool
+}
+
+// Redsync creates traced mutexes.
+type Redsync struct {
+	redsync *redsync.Redsync
+	pools   int
+	tracer  tracer
+}
+
+// NewSentryRedsync creates a redsync.Redsync out of pools, whose mutexes are
+// traced.
+func NewSentryRedsync(pools []redis.Pool, opts ...SentryRedsyncTracerOption) *Redsync {
+	t := tracer{
+		tags:          make(map[string]string),
+		captureErrors: true,
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	countingPools := make([]redis.Pool, len(pools))
+	for i, pool := range pools {
+		countingPools[i] = countingPool{Pool: pool}
+	}
+
+	return &Redsync{
+		redsync: redsync.New(countingPools...),
+		pools:   len(pools),
+		tracer:  t,
+	}
+}
+
+// NewMutex returns a new distributed mutex with the given name.
+func (r *Redsync) NewMutex(name string, options ...redsync.Option) *Mutex {
+	return &Mutex{
+		Mutex:  r.redsync.NewMutex(name, options...),
+		pools:  r.pools,
+		tracer: r.tracer,
+	}
+}
+
+// Mutex wraps a redsync.Mutex. Acquiring and releasing it is traced, other
+// methods are forwarded as-is.
+type Mutex struct {
+	*redsync.Mutex
+	pools  int
+	tracer tracer
+}
+
+func (m *Mutex) startSpan(ctx context.Context, operation string) *sentry.Span {
+	description := scrub.String(m.Name())
+
+	span := integration.StartSampledSpan(ctx, m.tracer.spanSampler, operation, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("db.system", "redis")
+	span.SetData("cache.key", description)
+
+	for k, v := range m.tracer.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// Lock locks m, retrying as configured by the options of the mutex.
+func (m *Mutex) Lock() error {
+	return m.LockContext(context.Background())
+}
+
+// LockContext locks m within a "cache.lock" span.
+func (m *Mutex) LockContext(ctx context.Context) error {
+	return m.lock(ctx, m.Mutex.LockContext, true)
+}
+
+// TryLock only attempts to lock m once.
+func (m *Mutex) TryLock() error {
+	return m.TryLockContext(context.Background())
+}
+
+// TryLockContext attempts to lock m once within a "cache.lock" span.
+func (m *Mutex) TryLockContext(ctx context.Context) error {
+	return m.lock(ctx, m.Mutex.TryLockContext, false)
+}
+
+func (m *Mutex) lock(ctx context.Context, lock func(ctx context.Context) error, capture bool) error {
+	span := m.startSpan(ctx, "cache.lock")
+	if span == nil {
+		err := lock(ctx)
+		if capture {
+			m.capture(ctx, "lock", err)
+		}
+		return err
+	}
+	defer span.Finish()
+
+	attempts := new(atomic.Int64)
+	start := time.Now()
+
+	err := lock(context.WithValue(span.Context(), attemptsKey{}, attempts))
+
+	span.SetData("lock.wait_time", strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+	if m.pools > 0 {
+		if retries := attempts.Load()/int64(m.pools) - 1; retries > 0 {
+			span.SetData("lock.retries", strconv.FormatInt(retries, 10))
+		}
+	}
+	span.SetData("lock.acquired", strconv.FormatBool(err == nil))
+
+	finish(span, err)
+	if capture {
+		m.capture(span.Context(), "lock", err)
+	}
+
+	return err
+}
+
+// Unlock unlocks m, returning whether the lock was still held.
+func (m *Mutex) Unlock() (bool, error) {
+	return m.UnlockContext(context.Background())
+}
+
+// UnlockContext unlocks m within a "cache.unlock" span, returning whether the
+// lock was still held.
+func (m *Mutex) UnlockContext(ctx context.Context) (bool, error) {
+	span := m.startSpan(ctx, "cache.unlock")
+	if span == nil {
+		ok, err := m.Mutex.UnlockContext(ctx)
+		m.capture(ctx, "unlock", err)
+		return ok, err
+	}
+	defer span.Finish()
+
+	ok, err := m.Mutex.UnlockContext(span.Context())
+	span.SetData("lock.released", strconv.FormatBool(ok))
+
+	finish(span, err)
+	m.capture(span.Context(), "unlock", err)
+
+	return ok, err
+}
+
+// capture captures err on the hub of ctx, tagged with the name of the lock.
+func (m *Mutex) capture(ctx context.Context, operation string, err error) {
+	if err == nil || !m.tracer.captureErrors {
+		return
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("lock.name", scrub.String(m.Name()))
+		scope.SetTag("lock.operation", operation)
+		scope.SetTags(m.tracer.tags)
+
+		hub.CaptureException(err)
+	})
+}
+
+// finish sets the status of span after err. Locks taken by someone else are
+// recorded as aborted rather than failed.
+func finish(span *sentry.Span, err error) {
+	var taken *redsync.ErrTaken
+
+	switch {
+	case err == nil:
+		span.Status = sentry.SpanStatusOK
+	case errors.Is(err, redsync.ErrFailed), errors.As(err, &taken):
+		span.Status = sentry.SpanStatusAborted
+		span.SetData("error", err.Error())
+	default:
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	}
+}
+
+type attemptsKey struct{}
+
+// countingPool counts the attempts to acquire a lock, one per pool, in the
+// counter of the context of the lock.
+type countingPool struct {
+	redis.Pool
+}
+
+func (p countingPool) Get(ctx context.Context) (redis.Conn, error) {
+	conn, err := p.Pool.Get(ctx)
+	if err != nil {
+		return conn, err
+	}
+
+	attempts, ok := ctx.Value(attemptsKey{}).(*atomic.Int64)
+	if !ok {
+		return conn, nil
+	}
+
+	return countingConn{Conn: conn, attempts: attempts}, nil
+}
+
+type countingConn struct {
+	redis.Conn
+	attempts *atomic.Int64
+}
+
+func (c countingConn) SetNX(name string, value string, expiry time.Duration) (bool, error) {
+	c.attempts.Add(1)
+	return c.Conn.SetNX(name, value, expiry)
+}
@@ -0,0 +1,214 @@
+// Package rivertracer provides a tracer implementation for riverqueue/river workers.
+//
+//	workers := river.NewWorkers()
+//	river.AddWorker(workers, rivertracer.NewSentryWorker[SendEmailArgs](&SendEmailWorker{}))
+//
+//	riverClient, err := river.NewClient(riverpgxv5.New(dbPool), &river.Config{
+//		Queues: map[string]river.QueueConfig{
+//			river.QueueDefault: {MaxWorkers: 100},
+//		},
+//		Workers: workers,
+//	})
+package rivertracer
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	sentryintegration "github.com/aldy505/sentry-integration"
+	sentryconfig "github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/riverqueue/river"
+)
+
+const filtered = "[Filtered]"
+
+// defaultSensitiveKeys are the job argument keys which values are never sent to
+// Sentry. Keys are matched case-insensitively, by substring.
+var defaultSensitiveKeys = []string{"password", "secret", "token", "authorization", "api_key", "apikey", "credential"}
+
+var integration = sentryconfig.Integration{Origin: "auto.queue.river"}
+
+// SetEnabled turns the spans of River jobs on or off at runtime, running them
+// untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryRiverTracerOption func(*config)
+
+func WithTags(tags map[string]string) SentryRiverTracerOption {
+	return func(t *config) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryRiverTracerOption {
+	return func(t *config) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler works jobs for which sampler returns false, given the
+// "queue.process" operation and the job kind, without a transaction.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryRiverTracerOption {
+	return func(t *config) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithSensitiveKeys adds job argument keys which values are replaced with
+// "[Filtered]" before the arguments are attached to captured exceptions.
+func WithSensitiveKeys(keys ...string) SentryRiverTracerOption {
+	return func(t *config) {
+		for _, key := range keys {
+			t.sensitiveKeys = append(t.sensitiveKeys, strings.ToLower(key))
+		}
+	}
+}
+
+type config struct {
+	tags          map[string]string
+	spanSampler   func(operation, description string) bool
+	sensitiveKeys []string
+}
+
+// NewSentryWorker wraps worker so that every job is worked within a
+// "queue.process" transaction, and failed jobs are captured as exceptions with
+// their (scrubbed) arguments attached.
+func NewSentryWorker[T river.JobArgs](worker river.Worker[T], opts ...SentryRiverTracerOption) river.Worker[T] {
+	w := &Worker[T]{
+		Worker: worker,
+		config: config{
+			tags:          make(map[string]string),
+			sensitiveKeys: append([]string(nil), defaultSensitiveKeys...),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&w.config)
+	}
+
+	return w
+}
+
+type Worker[T river.JobArgs] struct {
+	river.Worker[T]
+	config
+}
+
+// Work implements river.Worker.
+func (w *Worker[T]) Work(ctx context.Context, job *river.Job[T]) (err error) {
+	ctx, hub := sentryintegration.EnsureHub(ctx)
+
+	span := integration.StartTransaction(ctx, w.spanSampler, "queue.process", job.Kind)
+	if span == nil {
+		return w.Worker.Work(ctx, job)
+	}
+
+	span.SetData("messaging.system", "river")
+	span.SetData(semconv.MessagingDestinationName.Key(), job.Queue)
+	span.SetData(semconv.MessagingMessageID.Key(), strconv.FormatInt(job.ID, 10))
+	messaging.SetBodySize(span, len(job.EncodedArgs))
+	span.SetData("messaging.message.retry.count", strconv.Itoa(job.Attempt-1))
+	span.SetData("river.job.kind", job.Kind)
+	span.SetData("river.job.attempt", strconv.Itoa(job.Attempt))
+	span.SetData("river.job.max_attempts", strconv.Itoa(job.MaxAttempts))
+
+	startedAt := time.Now()
+	if job.AttemptedAt != nil {
+		startedAt = *job.AttemptedAt
+	}
+	messaging.SetReceiveLatency(span, job.ScheduledAt, startedAt)
+
+	for k, v := range w.tags {
+		span.SetTag(k, v)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			span.Status = sentry.SpanStatusInternalError
+			hub.WithScope(func(scope *sentry.Scope) {
+				scope.SetContext("river.job", w.jobContext(job.Kind, job.Queue, job.Attempt, job.EncodedArgs))
+				hub.RecoverWithContext(ctx, recovered)
+			})
+			span.Finish()
+
+			// River records panics on the job itself, so let it do so.
+			panic(recovered)
+		}
+
+		if err != nil {
+			span.Status = sentry.SpanStatusInternalError
+			span.SetData("error", err.Error())
+			hub.WithScope(func(scope *sentry.Scope) {
+				scope.SetContext("river.job", w.jobContext(job.Kind, job.Queue, job.Attempt, job.EncodedArgs))
+				hub.CaptureException(err)
+			})
+		} else {
+			span.Status = sentry.SpanStatusOK
+		}
+		span.Finish()
+	}()
+
+	ctx, unlabel := profiling.Label(span.Context(), span)
+	defer unlabel()
+
+	return w.Worker.Work(ctx, job)
+}
+
+func (w *Worker[T]) jobContext(kind, queue string, attempt int, encodedArgs []byte) sentry.Context {
+	jobContext := sentry.Context{
+		"kind":    kind,
+		"queue":   queue,
+		"attempt": attempt,
+	}
+
+	var args interface{}
+	if err := json.Unmarshal(encodedArgs, &args); err == nil {
+		jobContext["args"] = w.scrub(args)
+	}
+
+	return jobContext
+}
+
+func (w *Worker[T]) scrub(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if w.isSensitive(key) {
+				v[key] = filtered
+				continue
+			}
+
+			v[key] = w.scrub(inner)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = w.scrub(inner)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func (w *Worker[T]) isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range w.sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,259 @@
+// Package rueidistracer provides a tracer implementation for rueidis, which
+// has no hook compatibility with go-redis.
+//
+//	client, err := rueidis.NewClient(rueidis.ClientOption{InitAddress: []string{":6379"}})
+//	if err != nil {
+//		return err
+//	}
+//	client = rueidistracer.NewSentryClient(client)
+//
+// Commands sent with Do and DoMulti are "db.redis" spans, as with redistracer.
+// Commands sent with DoCache and DoMultiCache are "cache.get" spans following
+// Sentry's cache module conventions, recording whether the client side cache
+// served them in "cache.hit". Commands of dedicated clients are not traced.
+package rueidistracer
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/redis/rueidis"
+)
+
+var integration = config.Integration{Origin: "auto.db.rueidis"}
+
+// SetEnabled turns the spans of rueidis commands on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryRueidisTracerOption func(*Client)
+
+func WithTags(tags map[string]string) SentryRueidisTracerOption {
+	return func(c *Client) {
+		c.options.SetTags(tags)
+	}
+}
+
+func WithTag(key, value string) SentryRueidisTracerOption {
+	return func(c *Client) {
+		c.options.Tags[key] = value
+	}
+}
+
+// WithAttributes adds attributes to the data of every span, overriding the
+// data set by the tracer, e.g. "db.system".
+func WithAttributes(attributes map[string]interface{}) SentryRueidisTracerOption {
+	return func(c *Client) {
+		c.options.SetAttributes(attributes)
+	}
+}
+
+// WithSpanOperation replaces the "db.redis" operation of the spans of
+// commands sent with Do and DoMulti.
+func WithSpanOperation(operation string) SentryRueidisTracerOption {
+	return func(c *Client) {
+		c.options.SetOperation(operation)
+	}
+}
+
+// WithSpanSampler drops the spans of commands for which sampler returns false,
+// given the operation and the command name, e.g. "PING", or the key of cached
+// commands.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryRueidisTracerOption {
+	return func(c *Client) {
+		c.options.Sampler = sampler
+	}
+}
+
+// WithKeyScrubber sets a function applied to every cache key before it is
+// recorded on a span, e.g. to strip user identifiers out of the key.
+func WithKeyScrubber(scrubber func(key string) string) SentryRueidisTracerOption {
+	return func(c *Client) {
+		c.scrubKey = scrubber
+	}
+}
+
+// NewSentryClient wraps client so that its commands are traced.
+func NewSentryClient(client rueidis.Client, opts ...SentryRueidisTracerOption) rueidis.Client {
+	c := &Client{
+		Client:   client,
+		options:  config.NewOptions("db.redis"),
+		scrubKey: func(key string) string { return key },
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.data = c.options.SpanData(map[string]interface{}{
+		"db.system": "redis",
+	})
+
+	return c
+}
+
+// Client wraps a rueidis.Client. Do, DoMulti, DoCache and DoMultiCache are
+// traced, other methods are forwarded to the underlying client as-is.
+type Client struct {
+	rueidis.Client
+
+	options  config.Options
+	data     *config.SpanData
+	scrubKey func(key string) string
+}
+
+func (c *Client) startSpan(ctx context.Context, operation, description string) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, c.options.Sampler, operation, description)
+	if span == nil {
+		return nil
+	}
+	c.data.Apply(span)
+
+	return span
+}
+
+func (c *Client) Do(ctx context.Context, cmd rueidis.Completed) rueidis.RedisResult {
+	name := commandName(cmd.Commands())
+
+	span := c.startSpan(ctx, c.options.Operation, name)
+	if span == nil {
+		return c.Client.Do(ctx, cmd)
+	}
+	defer span.Finish()
+
+	span.SetData(semconv.DBOperation.Key(), name)
+
+	result := c.Client.Do(span.Context(), cmd)
+	finish(span, result.Error())
+
+	return result
+}
+
+func (c *Client) DoMulti(ctx context.Context, multi ...rueidis.Completed) []rueidis.RedisResult {
+	span := c.startSpan(ctx, c.options.Operation, "PIPELINE")
+	if span == nil {
+		return c.Client.DoMulti(ctx, multi...)
+	}
+	defer span.Finish()
+
+	span.SetData(semconv.DBOperation.Key(), "PIPELINE")
+	span.SetData("db.redis.pipeline_length", strconv.Itoa(len(multi)))
+
+	results := c.Client.DoMulti(span.Context(), multi...)
+	for _, result := range results {
+		if err := result.Error(); err != nil && !rueidis.IsRedisNil(err) {
+			finish(span, err)
+			return results
+		}
+	}
+	finish(span, nil)
+
+	return results
+}
+
+func (c *Client) DoCache(ctx context.Context, cmd rueidis.Cacheable, ttl time.Duration) rueidis.RedisResult {
+	commands := cmd.Commands()
+	key := c.key(commands)
+
+	span := c.startSpan(ctx, "cache.get", key)
+	if span == nil {
+		return c.Client.DoCache(ctx, cmd, ttl)
+	}
+	defer span.Finish()
+
+	span.SetData("cache.key", key)
+	span.SetData(semconv.DBOperation.Key(), commandName(commands))
+
+	result := c.Client.DoCache(span.Context(), cmd, ttl)
+	finishLookup(span, result)
+
+	return result
+}
+
+func (c *Client) DoMultiCache(ctx context.Context, multi ...rueidis.CacheableTTL) []rueidis.RedisResult {
+	keys := make([]string, 0, len(multi))
+	for _, m := range multi {
+		keys = append(keys, c.key(m.Cmd.Commands()))
+	}
+	description := strings.Join(keys, ", ")
+
+	span := c.startSpan(ctx, "cache.get", description)
+	if span == nil {
+		return c.Client.DoMultiCache(ctx, multi...)
+	}
+	defer span.Finish()
+
+	span.SetData("cache.key", description)
+
+	results := c.Client.DoMultiCache(span.Context(), multi...)
+
+	hits := 0
+	for _, result := range results {
+		err := result.Error()
+		if err != nil && !rueidis.IsRedisNil(err) {
+			finish(span, err)
+			return results
+		}
+		if err == nil && result.IsCacheHit() {
+			hits++
+		}
+	}
+	span.SetData("cache.hit", strconv.FormatBool(hits == len(results)))
+	span.SetData("cache.hit_count", strconv.Itoa(hits))
+	span.Status = sentry.SpanStatusOK
+
+	return results
+}
+
+// key returns the scrubbed key of a command, its first argument.
+func (c *Client) key(commands []string) string {
+	if len(commands) < 2 {
+		return ""
+	}
+
+	return scrub.String(c.scrubKey(commands[1]))
+}
+
+// finishLookup records the outcome of a cached command. A miss, be it of the
+// client side cache or of Redis, is not an error.
+func finishLookup(span *sentry.Span, result rueidis.RedisResult) {
+	err := result.Error()
+	switch {
+	case err == nil:
+		span.SetData("cache.hit", strconv.FormatBool(result.IsCacheHit()))
+		span.Status = sentry.SpanStatusOK
+	case rueidis.IsRedisNil(err):
+		span.SetData("cache.hit", "false")
+		span.Status = sentry.SpanStatusOK
+	default:
+		finish(span, err)
+	}
+}
+
+// finish sets the status of span after err. A nil reply is not an error.
+func finish(span *sentry.Span, err error) {
+	if err != nil && !rueidis.IsRedisNil(err) {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return
+	}
+
+	span.Status = sentry.SpanStatusOK
+}
+
+// commandName returns the upper cased name of a command, e.g. "GET".
+func commandName(commands []string) string {
+	if len(commands) == 0 {
+		return ""
+	}
+
+	return strings.ToUpper(commands[0])
+}
@@ -0,0 +1,306 @@
+// Package saramatracer provides a tracer implementation for IBM/sarama.
+//
+//	config := sarama.NewConfig()
+//	config.Producer.Interceptors = []sarama.ProducerInterceptor{saramatracer.NewSentryProducerInterceptor()}
+//
+//	// Setting the message Metadata to a context.Context carrying a span makes
+//	// the publish span a child of it.
+//	message := &sarama.ProducerMessage{
+//		Topic:    "orders",
+//		Value:    sarama.StringEncoder("hello"),
+//		Metadata: ctx,
+//	}
+//	_, _, err := producer.SendMessage(message)
+//
+//	handler := saramatracer.NewSentryConsumerGroupHandler(func(ctx context.Context, session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage) error {
+//		session.MarkMessage(message, "")
+//		return nil
+//	})
+//	err := consumerGroup.Consume(ctx, []string{"orders"}, handler)
+package saramatracer
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.queue.sarama"}
+
+// SetEnabled turns the spans of Sarama produces and consumes on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentrySaramaTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentrySaramaTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentrySaramaTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the topic.
+func WithSpanSampler(sampler func(operation, description string) bool) SentrySaramaTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithLagInterval sets how often consumer group handlers record the lag of
+// their claims as the "messaging.consumer.lag" gauge, 10 seconds by default.
+// Intervals of zero or less turn the gauge off.
+func WithLagInterval(interval time.Duration) SentrySaramaTracerOption {
+	return func(t *tracer) {
+		t.lagInterval = interval
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+	lagInterval time.Duration
+}
+
+func newTracer(opts ...SentrySaramaTracerOption) tracer {
+	t := tracer{
+		tags:        make(map[string]string),
+		lagInterval: 10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+func NewSentryProducerInterceptor(opts ...SentrySaramaTracerOption) sarama.ProducerInterceptor {
+	return &ProducerInterceptor{tracer: newTracer(opts...)}
+}
+
+type ProducerInterceptor struct {
+	tracer
+}
+
+// OnSend implements sarama.ProducerInterceptor.
+//
+// Sarama does not carry a context with the produced message, therefore the
+// span is parented to message.Metadata whenever it is a context.Context
+// carrying a span. Messages without one are sent untraced, rather than each
+// starting a transaction of its own. Interceptors are not told when the
+// message is acked, so the span only marks the moment the message was handed
+// to the producer, which has yet to pick its partition.
+func (p *ProducerInterceptor) OnSend(message *sarama.ProducerMessage) {
+	ctx, ok := message.Metadata.(context.Context)
+	if !ok || ctx == nil || sentry.SpanFromContext(ctx) == nil {
+		return
+	}
+
+	span := integration.StartSampledSpan(ctx, p.spanSampler, "queue.publish", message.Topic)
+	if span == nil {
+		return
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "kafka")
+	span.SetData(semconv.MessagingDestinationName.Key(), message.Topic)
+	if message.Value != nil {
+		messaging.SetBodySize(span, message.Value.Length())
+	}
+	p.setTags(span)
+
+	message.Headers = setHeader(message.Headers, sentry.SentryTraceHeader, span.ToSentryTrace())
+	message.Headers = setHeader(message.Headers, sentry.SentryBaggageHeader, span.ToBaggage())
+
+	span.Status = sentry.SpanStatusOK
+}
+
+// NewSentryConsumerInterceptor returns a consumer interceptor that records
+// nothing.
+//
+// Deprecated: interceptors are not able to hand a context over to the code
+// processing the message, so consumers are traced by
+// NewSentryConsumerGroupHandler only.
+func NewSentryConsumerInterceptor(opts ...SentrySaramaTracerOption) sarama.ConsumerInterceptor {
+	return &ConsumerInterceptor{tracer: newTracer(opts...)}
+}
+
+type ConsumerInterceptor struct {
+	tracer
+}
+
+// OnConsume implements sarama.ConsumerInterceptor. It does nothing, as the
+// "queue.process" transaction of the message is the one of
+// NewSentryConsumerGroupHandler.
+func (c *ConsumerInterceptor) OnConsume(message *sarama.ConsumerMessage) {}
+
+// startProcessSpan starts a "queue.process" transaction continued from the
+// trace context found in the message headers. The returned context has a
+// cloned hub bound to it.
+func (t tracer) startProcessSpan(ctx context.Context, message *sarama.ConsumerMessage) (context.Context, *sentry.Span) {
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier{
+		sentry.SentryTraceHeader:   getHeader(message.Headers, sentry.SentryTraceHeader),
+		sentry.SentryBaggageHeader: getHeader(message.Headers, sentry.SentryBaggageHeader),
+	})
+
+	span := integration.StartTransaction(ctx, t.spanSampler, "queue.process", message.Topic, continueTrace)
+	if span == nil {
+		return ctx, nil
+	}
+
+	span.SetData("messaging.system", "kafka")
+	span.SetData(semconv.MessagingDestinationName.Key(), message.Topic)
+	span.SetData("messaging.kafka.destination.partition", strconv.FormatInt(int64(message.Partition), 10))
+	span.SetData("messaging.kafka.message.offset", strconv.FormatInt(message.Offset, 10))
+	messaging.SetBodySize(span, len(message.Value))
+	messaging.SetReceiveLatency(span, message.Timestamp, time.Now())
+	t.setTags(span)
+
+	return span.Context(), span
+}
+
+// MessageHandler processes a single message claimed by a consumer group session.
+// The provided context carries the "queue.process" transaction of the message.
+type MessageHandler func(ctx context.Context, session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage) error
+
+func NewSentryConsumerGroupHandler(handler MessageHandler, opts ...SentrySaramaTracerOption) sarama.ConsumerGroupHandler {
+	return &ConsumerGroupHandler{
+		tracer:  newTracer(opts...),
+		handler: handler,
+	}
+}
+
+type ConsumerGroupHandler struct {
+	tracer
+	handler MessageHandler
+}
+
+// Setup implements sarama.ConsumerGroupHandler.
+func (h *ConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup implements sarama.ConsumerGroupHandler.
+func (h *ConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler.
+//
+// The lag of the claim, the messages between the last one processed and the
+// high water mark of the partition, is recorded on the span of every message
+// and periodically as a gauge, see WithLagInterval.
+func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var next atomic.Int64
+	next.Store(claim.InitialOffset())
+
+	if h.lagInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go h.reportLag(claim, &next, done)
+	}
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			err := h.process(session, message, claim.HighWaterMarkOffset()-message.Offset-1)
+			next.Store(message.Offset + 1)
+			if err != nil {
+				return err
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// reportLag records the lag of claim every lag interval until done is closed.
+// next is the offset of the next message to process, negative until known.
+func (h *ConsumerGroupHandler) reportLag(claim sarama.ConsumerGroupClaim, next *atomic.Int64, done <-chan struct{}) {
+	ticker := time.NewTicker(h.lagInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			offset, highWaterMark := next.Load(), claim.HighWaterMarkOffset()
+			if offset < 0 || highWaterMark <= 0 {
+				continue
+			}
+
+			messaging.RecordConsumerLag("kafka", claim.Topic(), claim.Partition(), highWaterMark-offset)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (h *ConsumerGroupHandler) process(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, lag int64) error {
+	ctx, span := h.startProcessSpan(session.Context(), message)
+	if span == nil {
+		return h.handler(ctx, session, message)
+	}
+	defer span.Finish()
+
+	messaging.SetConsumerLag(span, lag)
+
+	err := h.handler(span.Context(), session, message)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return err
+}
+
+func getHeader(headers []*sarama.RecordHeader, key string) string {
+	for _, header := range headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+func setHeader(headers []sarama.RecordHeader, key, value string) []sarama.RecordHeader {
+	for i := range headers {
+		if string(headers[i].Key) == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+
+	return append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
@@ -0,0 +1,273 @@
+// Package scrub removes personal data from what the integrations record, such
+// as SQL statements, cache keys, URLs and breadcrumb data, with rules
+// registered once for all of them.
+//
+//	scrub.Register(scrub.DefaultRules()...)
+//	scrub.RegisterKeys("national_id")
+//
+//	err := sentry.Init(sentry.ClientOptions{
+//		BeforeBreadcrumb:      scrub.BeforeBreadcrumb,
+//		BeforeSendTransaction: scrub.BeforeSendTransaction,
+//	})
+//
+// Rules replace matching parts of any value, keys mark values to be replaced
+// as a whole, e.g. the value of a "password" URL query parameter. Nothing is
+// scrubbed until rules or keys are registered.
+package scrub
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Filtered replaces values of sensitive keys.
+const Filtered = "[Filtered]"
+
+// Rule replaces every match of Pattern with Replacement, which may refer to
+// submatches as regexp.Regexp.ReplaceAllString does. Matches are only replaced
+// when Validate, if set, reports them valid, e.g. to tell card numbers from
+// other long numbers.
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+	Validate    func(match string) bool
+}
+
+var (
+	// Emails matches email addresses.
+	Emails = Rule{
+		Name:        "email",
+		Pattern:     regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`),
+		Replacement: "[email]",
+	}
+
+	// Tokens matches bearer tokens and JSON Web Tokens.
+	Tokens = Rule{
+		Name:        "token",
+		Pattern:     regexp.MustCompile(`(?i)bearer\s+[a-z0-9._~+/\-]+=*|eyJ[a-zA-Z0-9_\-]+\.[a-zA-Z0-9_\-]+\.[a-zA-Z0-9_\-]*`),
+		Replacement: "[token]",
+	}
+
+	// CardNumbers matches payment card numbers, optionally grouped by spaces
+	// or dashes, which pass the Luhn check. Other long numbers, such as IDs or
+	// timestamps, are kept.
+	CardNumbers = Rule{
+		Name:        "card_number",
+		Pattern:     regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		Replacement: "[card]",
+		Validate:    Luhn,
+	}
+)
+
+// DefaultRules returns the built-in rules: Emails, Tokens and CardNumbers.
+func DefaultRules() []Rule {
+	return []Rule{Emails, Tokens, CardNumbers}
+}
+
+// DefaultKeys are the keys whose values are replaced once RegisterKeys has
+// been called, along with the given keys.
+var DefaultKeys = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "authorization", "cookie", "session"}
+
+var (
+	mu    sync.RWMutex
+	rules []Rule
+	keys  []string
+)
+
+// Register adds rules applied to every scrubbed value.
+func Register(r ...Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rules = append(rules, r...)
+}
+
+// RegisterKeys marks values of DefaultKeys and of k as sensitive. Keys are
+// matched case-insensitively, and as substrings, so "password" also matches
+// "db_password".
+func RegisterKeys(k ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(keys) == 0 {
+		keys = append(keys, DefaultKeys...)
+	}
+
+	for _, key := range k {
+		keys = append(keys, strings.ToLower(key))
+	}
+}
+
+// Reset removes every registered rule and key.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rules = nil
+	keys = nil
+}
+
+// String applies the registered rules to s.
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, rule := range rules {
+		s = rule.apply(s)
+	}
+
+	return s
+}
+
+func (r Rule) apply(s string) string {
+	if r.Validate == nil {
+		return r.Pattern.ReplaceAllString(s, r.Replacement)
+	}
+
+	return r.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if !r.Validate(match) {
+			return match
+		}
+
+		return r.Pattern.ReplaceAllString(match, r.Replacement)
+	})
+}
+
+// Luhn reports whether the digits of number pass the Luhn checksum of payment
+// card numbers, ignoring any other character, such as group separators.
+func Luhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+
+	return digits > 0 && sum%10 == 0
+}
+
+// IsSensitiveKey reports whether values of key are to be replaced as a whole.
+func IsSensitiveKey(key string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	key = strings.ToLower(key)
+	for _, k := range keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Value scrubs value recorded under key, replacing it as a whole when key is
+// sensitive. Values other than strings are only replaced under sensitive
+// keys.
+func Value(key string, value interface{}) interface{} {
+	if IsSensitiveKey(key) {
+		return Filtered
+	}
+
+	switch v := value.(type) {
+	case string:
+		return String(v)
+	case map[string]interface{}:
+		return Map(v)
+	default:
+		return value
+	}
+}
+
+// Map returns a copy of data with every value scrubbed, e.g. breadcrumb data
+// or log attributes.
+func Map(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	scrubbed := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		scrubbed[k] = Value(k, v)
+	}
+
+	return scrubbed
+}
+
+// Query scrubs URL query values, replacing values of sensitive keys.
+func Query(values url.Values) url.Values {
+	scrubbed := make(url.Values, len(values))
+	for k, vs := range values {
+		copied := make([]string, len(vs))
+		for i, v := range vs {
+			if IsSensitiveKey(k) {
+				copied[i] = Filtered
+			} else {
+				copied[i] = String(v)
+			}
+		}
+		scrubbed[k] = copied
+	}
+
+	return scrubbed
+}
+
+// URL scrubs rawURL, dropping the password of its user info and scrubbing its
+// query. URLs that fail to parse are scrubbed as plain strings.
+func URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return String(rawURL)
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Filtered)
+	}
+	u.RawQuery = Query(u.Query()).Encode()
+
+	return String(u.String())
+}
+
+// BeforeBreadcrumb is a sentry.ClientOptions.BeforeBreadcrumb scrubbing the
+// message and data of every breadcrumb.
+func BeforeBreadcrumb(breadcrumb *sentry.Breadcrumb, hint *sentry.BreadcrumbHint) *sentry.Breadcrumb {
+	if breadcrumb == nil {
+		return nil
+	}
+
+	breadcrumb.Message = String(breadcrumb.Message)
+	breadcrumb.Data = Map(breadcrumb.Data)
+
+	return breadcrumb
+}
+
+// BeforeSendTransaction is a sentry.ClientOptions.BeforeSendTransaction
+// scrubbing the description and data of every span of the transaction.
+func BeforeSendTransaction(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	if event == nil {
+		return nil
+	}
+
+	for _, span := range event.Spans {
+		span.Description = String(span.Description)
+		span.Data = Map(span.Data)
+	}
+
+	return event
+}
@@ -0,0 +1,59 @@
+package scrub_test
+
+import (
+	"testing"
+
+	"github.com/aldy505/sentry-integration/scrub"
+)
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4242424242424242", true},
+		{"5500 0000 0000 0004", true},
+		{"3782-822463-10005", true},
+		{"4111111111111112", false},
+		{"1234567890123456", false},
+		{"1700000000000", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := scrub.Luhn(tt.number); got != tt.want {
+			t.Errorf("Luhn(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestCardNumbers(t *testing.T) {
+	scrub.Register(scrub.CardNumbers)
+	defer scrub.Reset()
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"card 4111 1111 1111 1111 declined", "card [card] declined"},
+		{"card=5500-0000-0000-0004", "card=[card]"},
+		{"order 1234567890123456", "order 1234567890123456"},
+		{"created at 1700000000000", "created at 1700000000000"},
+	}
+
+	for _, tt := range tests {
+		if got := scrub.String(tt.value); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBeforeSendTransactionDropped(t *testing.T) {
+	if event := scrub.BeforeSendTransaction(nil, nil); event != nil {
+		t.Errorf("BeforeSendTransaction(nil) = %v, want nil", event)
+	}
+	if breadcrumb := scrub.BeforeBreadcrumb(nil, nil); breadcrumb != nil {
+		t.Errorf("BeforeBreadcrumb(nil) = %v, want nil", breadcrumb)
+	}
+}
@@ -0,0 +1,130 @@
+// Package semconv maps the attributes recorded by the integrations to their
+// keys in a version of the OpenTelemetry semantic conventions, as keys such
+// as "db.statement" and "db.query.text" have been renamed over time.
+//
+//	config.Set(config.WithSemconvVersion(semconv.V1_26))
+//
+// Integrations record those attributes under Attribute.Key. Attributes that
+// have not been renamed, such as "messaging.system", are recorded as-is.
+package semconv
+
+import "sync/atomic"
+
+// Version is a version of the semantic conventions.
+type Version string
+
+const (
+	// V1_17 uses the "net.peer.*" attributes and the messaging attributes
+	// preceding their namespacing.
+	V1_17 Version = "1.17.0"
+	// V1_21 uses the "server.*" and "http.request.*" attributes.
+	V1_21 Version = "1.21.0"
+	// V1_26 also uses the stable database attributes, such as
+	// "db.query.text" and "db.namespace".
+	V1_26 Version = "1.26.0"
+
+	// Default is the version the integrations record unless configured
+	// otherwise.
+	Default = V1_21
+)
+
+// Attribute is an attribute whose key depends on the version.
+type Attribute int
+
+const (
+	DBStatement Attribute = iota
+	DBOperation
+	DBName
+	ServerAddress
+	ServerPort
+	HTTPRequestMethod
+	HTTPResponseStatusCode
+	MessagingDestinationName
+	MessagingMessageBodySize
+	MessagingMessageID
+	NetworkProtocolVersion
+
+	attributeCount
+)
+
+type keys [attributeCount]string
+
+var versions = map[Version]*keys{
+	V1_17: {
+		DBStatement:              "db.statement",
+		DBOperation:              "db.operation",
+		DBName:                   "db.name",
+		ServerAddress:            "net.peer.name",
+		ServerPort:               "net.peer.port",
+		HTTPRequestMethod:        "http.method",
+		HTTPResponseStatusCode:   "http.status_code",
+		MessagingDestinationName: "messaging.destination",
+		MessagingMessageBodySize: "messaging.message_payload_size_bytes",
+		MessagingMessageID:       "messaging.message_id",
+		NetworkProtocolVersion:   "http.flavor",
+	},
+	V1_21: {
+		DBStatement:              "db.statement",
+		DBOperation:              "db.operation",
+		DBName:                   "db.name",
+		ServerAddress:            "server.address",
+		ServerPort:               "server.port",
+		HTTPRequestMethod:        "http.request.method",
+		HTTPResponseStatusCode:   "http.response.status_code",
+		MessagingDestinationName: "messaging.destination.name",
+		MessagingMessageBodySize: "messaging.message.body.size",
+		MessagingMessageID:       "messaging.message.id",
+		NetworkProtocolVersion:   "network.protocol.version",
+	},
+	V1_26: {
+		DBStatement:              "db.query.text",
+		DBOperation:              "db.operation.name",
+		DBName:                   "db.namespace",
+		ServerAddress:            "server.address",
+		ServerPort:               "server.port",
+		HTTPRequestMethod:        "http.request.method",
+		HTTPResponseStatusCode:   "http.response.status_code",
+		MessagingDestinationName: "messaging.destination.name",
+		MessagingMessageBodySize: "messaging.message.body.size",
+		MessagingMessageID:       "messaging.message.id",
+		NetworkProtocolVersion:   "network.protocol.version",
+	},
+}
+
+var current atomic.Pointer[keys]
+
+func init() {
+	current.Store(versions[Default])
+}
+
+// Supported reports whether v is a known version.
+func Supported(v Version) bool {
+	_, ok := versions[v]
+	return ok
+}
+
+// Use selects the version keys are returned for. Unknown versions select
+// Default. It is called by config.Set, which should be preferred.
+func Use(v Version) {
+	k, ok := versions[v]
+	if !ok {
+		k = versions[Default]
+	}
+
+	current.Store(k)
+}
+
+// Key returns the key of a in the selected version.
+func (a Attribute) Key() string {
+	return current.Load()[a]
+}
+
+// Key returns the key of a in v, or in Default when v is unknown.
+func (v Version) Key(a Attribute) string {
+	k, ok := versions[v]
+	if !ok {
+		k = versions[Default]
+	}
+
+	return k[a]
+}
@@ -0,0 +1,231 @@
+// Package sentryintegrationtest provides utilities for testing code
+// instrumented by the integrations, recording events in memory instead of
+// sending them to Sentry.
+//
+//	func TestGetUser(t *testing.T) {
+//		recorder := sentryintegrationtest.NewRecorder(t)
+//		rdb.AddHook(redistracer.NewSentryRedisTracer())
+//
+//		ctx, finish := recorder.StartTransaction(context.Background(), "test")
+//		rdb.Get(ctx, "user:42")
+//		finish()
+//
+//		recorder.RequireSpan("db.redis", "GET", "db.system")
+//	}
+package sentryintegrationtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// Transport is a sentry.Transport keeping events in memory.
+type Transport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+// Configure implements sentry.Transport.
+func (t *Transport) Configure(options sentry.ClientOptions) {}
+
+// SendEvent implements sentry.Transport.
+func (t *Transport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, event)
+}
+
+// Flush implements sentry.Transport. Events are recorded as they are sent, so
+// there is nothing to wait for.
+func (t *Transport) Flush(timeout time.Duration) bool {
+	return true
+}
+
+// Events returns every event sent so far, transactions included.
+func (t *Transport) Events() []*sentry.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := make([]*sentry.Event, len(t.events))
+	copy(events, t.events)
+
+	return events
+}
+
+// Reset forgets every event sent so far.
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = nil
+}
+
+// Recorder records what is sent through its hub, and asserts on it.
+type Recorder struct {
+	Hub       *sentry.Hub
+	Transport *Transport
+
+	t testing.TB
+}
+
+// NewRecorder creates a hub sending to an in-memory Transport, with every
+// transaction sampled. options customize the client options, except for the
+// transport.
+func NewRecorder(t testing.TB, options ...func(*sentry.ClientOptions)) *Recorder {
+	t.Helper()
+
+	transport := &Transport{}
+	clientOptions := sentry.ClientOptions{
+		EnableTracing:    true,
+		TracesSampleRate: 1.0,
+	}
+
+	for _, option := range options {
+		option(&clientOptions)
+	}
+
+	clientOptions.Transport = transport
+
+	client, err := sentry.NewClient(clientOptions)
+	if err != nil {
+		t.Fatalf("sentryintegrationtest: creating client: %v", err)
+	}
+
+	return &Recorder{
+		Hub:       sentry.NewHub(client, sentry.NewScope()),
+		Transport: transport,
+		t:         t,
+	}
+}
+
+// Context returns ctx carrying the hub of the recorder.
+func (r *Recorder) Context(ctx context.Context) context.Context {
+	return sentry.SetHubOnContext(ctx, r.Hub)
+}
+
+// StartTransaction starts a transaction named name on the hub of the
+// recorder. Spans started out of the returned context are recorded once
+// finish is called.
+func (r *Recorder) StartTransaction(ctx context.Context, name string) (context.Context, func()) {
+	transaction := sentry.StartTransaction(r.Context(ctx), name)
+
+	return transaction.Context(), transaction.Finish
+}
+
+// Events returns every error and message event sent so far.
+func (r *Recorder) Events() []*sentry.Event {
+	var events []*sentry.Event
+	for _, event := range r.Transport.Events() {
+		if event.Type != "transaction" {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// Transactions returns every transaction sent so far.
+func (r *Recorder) Transactions() []*sentry.Event {
+	var transactions []*sentry.Event
+	for _, event := range r.Transport.Events() {
+		if event.Type == "transaction" {
+			transactions = append(transactions, event)
+		}
+	}
+
+	return transactions
+}
+
+// Spans returns the spans of every transaction sent so far, excluding the
+// transactions themselves.
+func (r *Recorder) Spans() []*sentry.Span {
+	var spans []*sentry.Span
+	for _, transaction := range r.Transactions() {
+		spans = append(spans, transaction.Spans...)
+	}
+
+	return spans
+}
+
+// FindSpan returns the first recorded span of op whose description contains
+// descContains and whose data holds every key of dataKeys, or nil.
+func (r *Recorder) FindSpan(op, descContains string, dataKeys ...string) *sentry.Span {
+spans:
+	for _, span := range r.Spans() {
+		if span.Op != op || !strings.Contains(span.Description, descContains) {
+			continue
+		}
+
+		for _, key := range dataKeys {
+			if _, ok := span.Data[key]; !ok {
+				continue spans
+			}
+		}
+
+		return span
+	}
+
+	return nil
+}
+
+// RequireSpan is like FindSpan, failing the test when no span matches.
+func (r *Recorder) RequireSpan(op, descContains string, dataKeys ...string) *sentry.Span {
+	r.t.Helper()
+
+	span := r.FindSpan(op, descContains, dataKeys...)
+	if span == nil {
+		r.t.Fatalf("sentryintegrationtest: no span of op %q with description containing %q and data %v, recorded:\n%s", op, descContains, dataKeys, r.describeSpans())
+	}
+
+	return span
+}
+
+// RequireNoSpan fails the test when a span of op has been recorded.
+func (r *Recorder) RequireNoSpan(op string) {
+	r.t.Helper()
+
+	if span := r.FindSpan(op, ""); span != nil {
+		r.t.Fatalf("sentryintegrationtest: unexpected span of op %q with description %q", op, span.Description)
+	}
+}
+
+// RequireEvent returns the first recorded event whose message or exception
+// value contains message, failing the test when there is none.
+func (r *Recorder) RequireEvent(message string) *sentry.Event {
+	r.t.Helper()
+
+	for _, event := range r.Events() {
+		if strings.Contains(event.Message, message) {
+			return event
+		}
+
+		for _, exception := range event.Exception {
+			if strings.Contains(exception.Value, message) {
+				return event
+			}
+		}
+	}
+
+	r.t.Fatalf("sentryintegrationtest: no event containing %q among %d events", message, len(r.Events()))
+	return nil
+}
+
+func (r *Recorder) describeSpans() string {
+	var b strings.Builder
+	for _, span := range r.Spans() {
+		fmt.Fprintf(&b, "\t%s %q %v\n", span.Op, span.Description, span.Data)
+	}
+
+	if b.Len() == 0 {
+		return "\t(none)"
+	}
+
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package sentryintegrationtest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aldy505/sentry-integration/sentryintegrationtest"
+	"github.com/getsentry/sentry-go"
+)
+
+func TestTransport(t *testing.T) {
+	transport := &sentryintegrationtest.Transport{}
+	transport.SendEvent(&sentry.Event{Message: "first"})
+	transport.SendEvent(&sentry.Event{Message: "second"})
+
+	events := transport.Events()
+	if len(events) != 2 || events[0].Message != "first" || events[1].Message != "second" {
+		t.Fatalf("Events() = %v, want the first and second events in order", events)
+	}
+
+	events[0] = nil
+	if transport.Events()[0] == nil {
+		t.Error("Events() returned the recorded slice instead of a copy")
+	}
+
+	if !transport.Flush(0) {
+		t.Error("Flush() = false, want true")
+	}
+
+	transport.Reset()
+	if events := transport.Events(); len(events) != 0 {
+		t.Errorf("Events() after Reset() = %v, want none", events)
+	}
+}
+
+func TestRecorderSpans(t *testing.T) {
+	recorder := sentryintegrationtest.NewRecorder(t)
+
+	ctx, finish := recorder.StartTransaction(context.Background(), "test")
+	span := sentry.StartSpan(ctx, "db.redis", sentry.WithDescription("GET user:42"))
+	span.SetData("db.system", "redis")
+	span.Finish()
+	finish()
+
+	if transactions := recorder.Transactions(); len(transactions) != 1 || transactions[0].Transaction != "test" {
+		t.Fatalf("Transactions() = %v, want the test transaction", transactions)
+	}
+	if spans := recorder.Spans(); len(spans) != 1 {
+		t.Fatalf("Spans() = %v, want the db.redis span only", spans)
+	}
+	if events := recorder.Events(); len(events) != 0 {
+		t.Errorf("Events() = %v, want no error event", events)
+	}
+
+	if got := recorder.RequireSpan("db.redis", "GET", "db.system"); got.Description != "GET user:42" {
+		t.Errorf("RequireSpan() description = %q, want %q", got.Description, "GET user:42")
+	}
+	if got := recorder.FindSpan("db.redis", "SET"); got != nil {
+		t.Errorf("FindSpan() of another description = %v, want nil", got)
+	}
+	if got := recorder.FindSpan("db.redis", "GET", "db.statement"); got != nil {
+		t.Errorf("FindSpan() of missing data = %v, want nil", got)
+	}
+	recorder.RequireNoSpan("http.client")
+}
+
+func TestRecorderEvents(t *testing.T) {
+	recorder := sentryintegrationtest.NewRecorder(t, func(options *sentry.ClientOptions) {
+		options.Environment = "test"
+	})
+
+	recorder.Hub.CaptureMessage("cache miss")
+	recorder.Hub.CaptureException(fmt.Errorf("connection refused"))
+
+	if events := recorder.Events(); len(events) != 2 {
+		t.Fatalf("Events() = %v, want 2 events", events)
+	}
+	if event := recorder.RequireEvent("cache"); event.Environment != "test" {
+		t.Errorf("RequireEvent() environment = %q, want the one of the options", event.Environment)
+	}
+	recorder.RequireEvent("refused")
+}
+
+// failingTB records the failures of the assertions instead of stopping the
+// test.
+type failingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (tb *failingTB) Helper() {}
+
+func (tb *failingTB) Fatalf(format string, args ...interface{}) {
+	tb.failures = append(tb.failures, fmt.Sprintf(format, args...))
+}
+
+func TestRecorderFailures(t *testing.T) {
+	tb := &failingTB{TB: t}
+	recorder := sentryintegrationtest.NewRecorder(tb)
+
+	ctx, finish := recorder.StartTransaction(context.Background(), "test")
+	sentry.StartSpan(ctx, "http.client", sentry.WithDescription("GET /")).Finish()
+	finish()
+
+	if span := recorder.RequireSpan("db.redis", ""); span != nil {
+		t.Errorf("RequireSpan() = %v, want nil", span)
+	}
+	recorder.RequireNoSpan("http.client")
+	recorder.RequireEvent("anything")
+
+	if len(tb.failures) != 3 {
+		t.Errorf("failures = %q, want one for each assertion", tb.failures)
+	}
+}
@@ -0,0 +1,131 @@
+package sentryintegration
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/getsentry/sentry-go"
+)
+
+var serializeIntegration = config.Integration{Origin: "auto.serialize"}
+
+type SerializeOption func(*serializer)
+
+// WithMinPayloadSize sets the size in bytes a payload must reach to be traced.
+// It defaults to 64 KiB, as smaller payloads are rarely worth a span.
+func WithMinPayloadSize(size int) SerializeOption {
+	return func(s *serializer) {
+		s.minSize = size
+	}
+}
+
+func WithSerializeTags(tags map[string]string) SerializeOption {
+	return func(s *serializer) {
+		for k, v := range tags {
+			s.tags[k] = v
+		}
+	}
+}
+
+type serializer struct {
+	minSize int
+	tags    map[string]string
+}
+
+// defaultSerializer is shared by the calls passing no options, sparing them the
+// allocation of their own.
+var defaultSerializer = &serializer{minSize: 64 << 10}
+
+func newSerializer(opts ...SerializeOption) *serializer {
+	if len(opts) == 0 {
+		return defaultSerializer
+	}
+
+	s := &serializer{
+		minSize: 64 << 10,
+		tags:    make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// record creates a span of op for a payload of size bytes, started at start
+// and finished now. Payloads below the minimum size, or serialized outside of
+// any span, are not recorded.
+func (s *serializer) record(ctx context.Context, op, format string, start time.Time, size int, err error) {
+	if size < s.minSize || sentry.SpanFromContext(ctx) == nil {
+		return
+	}
+
+	span := serializeIntegration.StartSpan(ctx, op, format)
+	if span == nil {
+		return
+	}
+	span.StartTime = start
+	span.SetData("serialize.format", format)
+	if span.Data == nil {
+		span.Data = make(map[string]interface{})
+	}
+	span.Data["serialize.size"] = size
+
+	for k, v := range s.tags {
+		span.SetTag(k, v)
+	}
+
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// TraceEncode encodes v with marshal, such as json.Marshal or xml.Marshal, as a
+// "serialize" span of the given format. As the size of the payload is only
+// known once encoded, the span is created after the fact, and only when the
+// payload reaches the minimum size.
+//
+//	body, err := sentryintegration.TraceEncode(ctx, "xml", invoice, xml.Marshal)
+func TraceEncode(ctx context.Context, format string, v any, marshal func(v any) ([]byte, error), opts ...SerializeOption) ([]byte, error) {
+	s := newSerializer(opts...)
+
+	start := time.Now()
+	data, err := marshal(v)
+	s.record(ctx, "serialize", format, start, len(data), err)
+
+	return data, err
+}
+
+// TraceDecode decodes data into v with unmarshal, such as json.Unmarshal or
+// xml.Unmarshal, as a "deserialize" span of the given format when data reaches
+// the minimum size.
+//
+//	var report Report
+//	err := sentryintegration.TraceDecode(ctx, "yaml", data, &report, yaml.Unmarshal)
+func TraceDecode(ctx context.Context, format string, data []byte, v any, unmarshal func(data []byte, v any) error, opts ...SerializeOption) error {
+	s := newSerializer(opts...)
+
+	start := time.Now()
+	err := unmarshal(data, v)
+	s.record(ctx, "deserialize", format, start, len(data), err)
+
+	return err
+}
+
+// TraceJSONMarshal is json.Marshal traced as a "serialize" span.
+func TraceJSONMarshal(ctx context.Context, v any, opts ...SerializeOption) ([]byte, error) {
+	return TraceEncode(ctx, "json", v, json.Marshal, opts...)
+}
+
+// TraceJSONUnmarshal is json.Unmarshal traced as a "deserialize" span.
+func TraceJSONUnmarshal(ctx context.Context, data []byte, v any, opts ...SerializeOption) error {
+	return TraceDecode(ctx, "json", data, v, json.Unmarshal, opts...)
+}
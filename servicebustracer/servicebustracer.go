@@ -0,0 +1,311 @@
+// Package servicebustracer provides a tracer implementation for the Azure
+// Service Bus client, azservicebus.
+//
+//	sender, err := client.NewSender("orders", nil)
+//	if err != nil {
+//		return err
+//	}
+//
+//	tracedSender := servicebustracer.NewSentrySender(sender, "orders")
+//	err = tracedSender.SendMessage(ctx, &azservicebus.Message{Body: body}, nil)
+//
+//	receiver, err := client.NewReceiverForQueue("orders", nil)
+//	if err != nil {
+//		return err
+//	}
+//
+//	tracedReceiver := servicebustracer.NewSentryReceiver(receiver, "orders")
+//	err = tracedReceiver.Consume(ctx, 10, func(ctx context.Context, message *azservicebus.ReceivedMessage) error {
+//		return processOrder(ctx, message.Body)
+//	})
+//
+// The trace context is propagated in the application properties of messages.
+package servicebustracer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.queue.servicebus"}
+
+// SetEnabled turns the spans of Service Bus sends and receives on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryServiceBusTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryServiceBusTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryServiceBusTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the entity path of the queue or topic.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryServiceBusTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	entityPath  string
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(entityPath string, opts ...SentryServiceBusTracerOption) *tracer {
+	t := &tracer{
+		entityPath: entityPath,
+		tags:       make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *tracer) setData(span *sentry.Span) {
+	span.SetData("messaging.system", "servicebus")
+	span.SetData(semconv.MessagingDestinationName.Key(), t.entityPath)
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+
+		var sbErr *azservicebus.Error
+		if errors.As(err, &sbErr) {
+			span.SetData("azure.servicebus.error_code", string(sbErr.Code))
+		}
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// injectTraceContext returns a copy of message carrying the trace context of
+// span in its application properties.
+func injectTraceContext(span *sentry.Span, message *azservicebus.Message) *azservicebus.Message {
+	properties := make(map[string]any, len(message.ApplicationProperties)+2)
+	for k, v := range message.ApplicationProperties {
+		properties[k] = v
+	}
+	properties[sentry.SentryTraceHeader] = span.ToSentryTrace()
+	if baggage := span.ToBaggage(); baggage != "" {
+		properties[sentry.SentryBaggageHeader] = baggage
+	}
+
+	copied := *message
+	copied.ApplicationProperties = properties
+	return &copied
+}
+
+func NewSentrySender(sender *azservicebus.Sender, entityPath string, opts ...SentryServiceBusTracerOption) *Sender {
+	return &Sender{
+		Sender: sender,
+		tracer: newTracer(entityPath, opts...),
+	}
+}
+
+// Sender wraps an azservicebus.Sender for a queue or topic, with its messages
+// sent within a "queue.publish" span.
+type Sender struct {
+	*azservicebus.Sender
+	tracer *tracer
+}
+
+func (s *Sender) SendMessage(ctx context.Context, message *azservicebus.Message, options *azservicebus.SendMessageOptions) error {
+	span := integration.StartSampledSpan(ctx, s.tracer.spanSampler, "queue.publish", s.tracer.entityPath)
+	if span == nil {
+		return s.Sender.SendMessage(ctx, message, options)
+	}
+
+	s.tracer.setData(span)
+	messaging.SetBodySize(span, len(message.Body))
+	if message.MessageID != nil {
+		span.SetData(semconv.MessagingMessageID.Key(), *message.MessageID)
+	}
+
+	err := s.Sender.SendMessage(span.Context(), injectTraceContext(span, message), options)
+	finish(span, err)
+
+	return err
+}
+
+func (s *Sender) ScheduleMessages(ctx context.Context, messages []*azservicebus.Message, scheduledEnqueueTime time.Time, options *azservicebus.ScheduleMessagesOptions) ([]int64, error) {
+	span := integration.StartSampledSpan(ctx, s.tracer.spanSampler, "queue.publish", s.tracer.entityPath)
+	if span == nil {
+		return s.Sender.ScheduleMessages(ctx, messages, scheduledEnqueueTime, options)
+	}
+
+	s.tracer.setData(span)
+	span.SetData("messaging.batch.message_count", strconv.Itoa(len(messages)))
+	span.SetData("azure.servicebus.scheduled_enqueue_time", scheduledEnqueueTime.Format(time.RFC3339))
+
+	injected := make([]*azservicebus.Message, len(messages))
+	for i, message := range messages {
+		injected[i] = injectTraceContext(span, message)
+	}
+
+	sequenceNumbers, err := s.Sender.ScheduleMessages(span.Context(), injected, scheduledEnqueueTime, options)
+	finish(span, err)
+
+	return sequenceNumbers, err
+}
+
+func NewSentryReceiver(receiver *azservicebus.Receiver, entityPath string, opts ...SentryServiceBusTracerOption) *Receiver {
+	return &Receiver{
+		Receiver: receiver,
+		tracer:   newTracer(entityPath, opts...),
+	}
+}
+
+// Receiver wraps an azservicebus.Receiver for a queue or subscription.
+type Receiver struct {
+	*azservicebus.Receiver
+	tracer *tracer
+}
+
+// MessageHandler processes a single message. The provided context carries the
+// "queue.process" transaction of the message.
+type MessageHandler func(ctx context.Context, message *azservicebus.ReceivedMessage) error
+
+// Consume receives up to maxMessages messages at a time until ctx is done.
+// Every message is handed to handler within a "queue.process" transaction,
+// then completed when handler returns without an error, or abandoned
+// otherwise.
+func (r *Receiver) Consume(ctx context.Context, maxMessages int, handler MessageHandler) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		messages, err := r.Receiver.ReceiveMessages(ctx, maxMessages, nil)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		for _, message := range messages {
+			if err := r.ProcessMessage(ctx, message, handler); err != nil {
+				_ = r.Receiver.AbandonMessage(ctx, message, nil)
+				continue
+			}
+
+			_ = r.Receiver.CompleteMessage(ctx, message, nil)
+		}
+	}
+}
+
+// ProcessMessage runs handler for a single received message, within a
+// "queue.process" transaction continued from the trace context found in its
+// application properties. It is useful for applications which own their
+// receive loop.
+func (r *Receiver) ProcessMessage(ctx context.Context, message *azservicebus.ReceivedMessage, handler MessageHandler) error {
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier{
+		sentry.SentryTraceHeader:   getProperty(message.ApplicationProperties, sentry.SentryTraceHeader),
+		sentry.SentryBaggageHeader: getProperty(message.ApplicationProperties, sentry.SentryBaggageHeader),
+	})
+
+	span := integration.StartTransaction(
+		ctx,
+		r.tracer.spanSampler,
+		"queue.process",
+		r.tracer.entityPath,
+		continueTrace,
+	)
+	if span == nil {
+		return handler(ctx, message)
+	}
+	defer span.Finish()
+
+	r.tracer.setData(span)
+	span.SetData(semconv.MessagingMessageID.Key(), message.MessageID)
+	messaging.SetBodySize(span, len(message.Body))
+	span.SetData("messaging.message.delivery_count", strconv.FormatUint(uint64(message.DeliveryCount), 10))
+	if message.DeliveryCount > 1 {
+		span.SetData("messaging.message.retry.count", strconv.FormatUint(uint64(message.DeliveryCount-1), 10))
+	}
+	if message.EnqueuedTime != nil {
+		messaging.SetReceiveLatency(span, *message.EnqueuedTime, time.Now())
+	}
+
+	err := handler(span.Context(), message)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return err
+}
+
+// RenewMessageLock implements azservicebus.Receiver.RenewMessageLock, recording
+// the renewal as a breadcrumb.
+func (r *Receiver) RenewMessageLock(ctx context.Context, message *azservicebus.ReceivedMessage, options *azservicebus.RenewMessageLockOptions) error {
+	err := r.Receiver.RenewMessageLock(ctx, message, options)
+
+	data := map[string]interface{}{
+		"entity":     r.tracer.entityPath,
+		"message_id": message.MessageID,
+	}
+	level := sentry.LevelInfo
+	if err != nil {
+		level = sentry.LevelError
+		data["error"] = err.Error()
+	} else if message.LockedUntil != nil {
+		data["locked_until"] = message.LockedUntil.Format(time.RFC3339)
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "servicebus.lock",
+		Message:  "Renewed message lock",
+		Data:     data,
+		Level:    level,
+	}, nil)
+
+	return err
+}
+
+func getProperty(properties map[string]any, key string) string {
+	value, _ := properties[key].(string)
+	return value
+}
@@ -0,0 +1,265 @@
+// Package sessions records release health for background workers, counting
+// every message or batch they handle as a session, so crash-free rates cover
+// consumers and not only HTTP traffic.
+//
+//	tracker := sessions.NewTracker()
+//	defer tracker.Close()
+//
+//	err := tracker.Track(ctx, func(ctx context.Context) error {
+//		return processOrder(ctx, msg)
+//	})
+//
+// Sessions ending with an error are recorded as errored, sessions ending with
+// a panic as crashed. They are aggregated by minute and sent as session
+// aggregates, which requires the client to have a release.
+package sessions
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aldy505/sentry-integration/internal/envelope"
+	"github.com/getsentry/sentry-go"
+)
+
+type Option func(*Tracker)
+
+// WithFlushInterval sets how often aggregated sessions are sent, every minute
+// by default.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(t *Tracker) {
+		if interval > 0 {
+			t.interval = interval
+		}
+	}
+}
+
+// WithHub sends sessions through the client of hub instead of the client of
+// sentry.CurrentHub. The release and environment of the sessions are those of
+// the client.
+func WithHub(hub *sentry.Hub) Option {
+	return func(t *Tracker) {
+		t.hub = hub
+	}
+}
+
+// WithoutCrashCapture leaves the panics of tracked functions to the caller,
+// instead of capturing them as exceptions before they are re-panicked.
+func WithoutCrashCapture() Option {
+	return func(t *Tracker) {
+		t.captureCrashes = false
+	}
+}
+
+// sessionStatus is how a session ended.
+type sessionStatus int
+
+const (
+	statusExited sessionStatus = iota
+	statusErrored
+	statusCrashed
+)
+
+// aggregate counts the sessions started within the same minute.
+type aggregate struct {
+	Started string `json:"started"`
+	Exited  int    `json:"exited,omitempty"`
+	Errored int    `json:"errored,omitempty"`
+	Crashed int    `json:"crashed,omitempty"`
+}
+
+// Tracker aggregates sessions, and sends them periodically. The zero value is
+// not usable, create one with NewTracker.
+type Tracker struct {
+	interval       time.Duration
+	hub            *sentry.Hub
+	captureCrashes bool
+
+	mu         sync.Mutex
+	aggregates map[time.Time]*aggregate
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewTracker returns a Tracker sending its sessions every flush interval,
+// until Close is called.
+func NewTracker(opts ...Option) *Tracker {
+	t := &Tracker{
+		interval:       time.Minute,
+		captureCrashes: true,
+		aggregates:     make(map[time.Time]*aggregate),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	go t.loop()
+
+	return t
+}
+
+func (t *Tracker) loop() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.Flush()
+		case <-t.stop:
+			t.Flush()
+			return
+		}
+	}
+}
+
+// Session is a unit of work of a worker, such as a message or a batch.
+type Session struct {
+	tracker *Tracker
+	started time.Time
+	once    sync.Once
+}
+
+// Start starts a session, to be ended with End.
+func (t *Tracker) Start() *Session {
+	return &Session{
+		tracker: t,
+		started: time.Now(),
+	}
+}
+
+// End ends the session as errored when err is not nil, or as exited. Only the
+// first call to End or Crash is recorded.
+func (s *Session) End(err error) {
+	if err != nil {
+		s.end(statusErrored)
+	} else {
+		s.end(statusExited)
+	}
+}
+
+// Crash ends the session as crashed, e.g. when the worker recovered from a
+// panic.
+func (s *Session) Crash() {
+	s.end(statusCrashed)
+}
+
+func (s *Session) end(status sessionStatus) {
+	s.once.Do(func() {
+		s.tracker.record(s.started, status)
+	})
+}
+
+// Track runs fn within a session, ended by the error it returns. A panic of fn
+// ends the session as crashed, and is captured before being re-panicked.
+func (t *Tracker) Track(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	session := t.Start()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			session.Crash()
+
+			if t.captureCrashes {
+				hub := sentry.GetHubFromContext(ctx)
+				if hub == nil {
+					hub = sentry.CurrentHub()
+				}
+				hub.RecoverWithContext(ctx, recovered)
+			}
+
+			panic(recovered)
+		}
+	}()
+
+	err = fn(ctx)
+	session.End(err)
+
+	return err
+}
+
+func (t *Tracker) record(started time.Time, status sessionStatus) {
+	minute := started.UTC().Truncate(time.Minute)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.aggregates[minute]
+	if !ok {
+		a = &aggregate{Started: minute.Format(time.RFC3339)}
+		t.aggregates[minute] = a
+	}
+
+	switch status {
+	case statusExited:
+		a.Exited++
+	case statusErrored:
+		a.Errored++
+	case statusCrashed:
+		a.Crashed++
+	}
+}
+
+// Flush sends every aggregated session. Sessions are dropped when the client
+// has no release, as Sentry would reject them anyway.
+func (t *Tracker) Flush() {
+	t.mu.Lock()
+	aggregates := make([]*aggregate, 0, len(t.aggregates))
+	for _, a := range t.aggregates {
+		aggregates = append(aggregates, a)
+	}
+	t.aggregates = make(map[time.Time]*aggregate)
+	t.mu.Unlock()
+
+	if len(aggregates) == 0 {
+		return
+	}
+
+	hub := t.hub
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	client := hub.Client()
+	if client == nil || client.Options().Release == "" {
+		return
+	}
+
+	sort.Slice(aggregates, func(i, j int) bool { return aggregates[i].Started < aggregates[j].Started })
+
+	attrs := map[string]string{"release": client.Options().Release}
+	if client.Options().Environment != "" {
+		attrs["environment"] = client.Options().Environment
+	}
+
+	payload, err := json.Marshal(struct {
+		Aggregates []*aggregate      `json:"aggregates"`
+		Attrs      map[string]string `json:"attrs"`
+	}{
+		Aggregates: aggregates,
+		Attrs:      attrs,
+	})
+	if err != nil {
+		return
+	}
+
+	_ = envelope.Send(hub, "sessions", payload)
+}
+
+// Close stops the flush loop, after sending every aggregated session.
+func (t *Tracker) Close() {
+	t.closeOnce.Do(func() {
+		close(t.stop)
+	})
+
+	<-t.done
+}
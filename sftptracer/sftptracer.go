@@ -0,0 +1,304 @@
+// Package sftptracer provides a tracer implementation for github.com/pkg/sftp.
+//
+//	client, err := sftp.NewClient(sshClient)
+//	if err != nil {
+//		return err
+//	}
+//
+//	sftpClient := sftptracer.NewSentryClient(client)
+//
+//	file, err := sftpClient.Open(ctx, "/outbound/report.csv")
+//	if err != nil {
+//		return err
+//	}
+//	defer file.Close()
+//
+//	_, err = io.Copy(dst, file)
+//
+// Files opened for reading are traced as a "file.read" span, and files opened
+// for writing as a "file.write" span, lasting until the file is closed and
+// recording the number of bytes transferred along with the throughput, in
+// bytes per second over the time the file was open. Walks are traced as a
+// "file.walk" span, lasting until the walk is over. Remote paths are scrubbed
+// before being recorded.
+package sftptracer
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/getsentry/sentry-go"
+	"github.com/kr/fs"
+	"github.com/pkg/sftp"
+)
+
+var integration = config.Integration{Origin: "auto.file.sftp"}
+
+// SetEnabled turns the spans of SFTP transfers on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentrySFTPTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentrySFTPTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentrySFTPTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of files for which sampler returns false,
+// given the "file.read", "file.write" or "file.walk" operation and the
+// scrubbed path.
+func WithSpanSampler(sampler func(operation, description string) bool) SentrySFTPTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+// WithPathScrubber sets a function applied to remote paths, after the
+// registered scrub rules, before they are recorded, e.g. to replace customer
+// IDs.
+func WithPathScrubber(scrubber func(path string) string) SentrySFTPTracerOption {
+	return func(t *tracer) {
+		t.pathScrubber = scrubber
+	}
+}
+
+type tracer struct {
+	pathScrubber func(path string) string
+	tags         map[string]string
+	spanSampler  func(operation, description string) bool
+}
+
+func (t *tracer) startSpan(ctx context.Context, op, path string) *sentry.Span {
+	path = scrub.String(path)
+	if t.pathScrubber != nil {
+		path = t.pathScrubber(path)
+	}
+
+	span := integration.StartSampledSpan(ctx, t.spanSampler, op, path)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("network.protocol.name", "sftp")
+	span.SetData("file.path", path)
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+func finish(span *sentry.Span, err error) {
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	span.Finish()
+}
+
+// Client wraps a sftp.Client, tracing the files opened and walks made through
+// it.
+type Client struct {
+	*sftp.Client
+	tracer *tracer
+}
+
+func NewSentryClient(client *sftp.Client, opts ...SentrySFTPTracerOption) *Client {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return &Client{
+		Client: client,
+		tracer: t,
+	}
+}
+
+// Open opens path for reading, as sftp.Client.Open does, within a "file.read"
+// span finished once the file is closed.
+func (c *Client) Open(ctx context.Context, path string) (*File, error) {
+	return c.OpenFile(ctx, path, os.O_RDONLY)
+}
+
+// Create creates or truncates path, as sftp.Client.Create does, within a
+// "file.write" span finished once the file is closed.
+func (c *Client) Create(ctx context.Context, path string) (*File, error) {
+	return c.OpenFile(ctx, path, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+// OpenFile opens path with flag, as sftp.Client.OpenFile does, within a
+// "file.write" span when opened for writing, or a "file.read" span otherwise.
+func (c *Client) OpenFile(ctx context.Context, path string, flag int) (*File, error) {
+	op := "file.read"
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		op = "file.write"
+	}
+
+	span := c.tracer.startSpan(ctx, op, path)
+	if span == nil {
+		file, err := c.Client.OpenFile(path, flag)
+		if err != nil {
+			return nil, err
+		}
+		return &File{File: file}, nil
+	}
+
+	file, err := c.Client.OpenFile(path, flag)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+
+	return &File{File: file, span: span, opened: time.Now()}, nil
+}
+
+// File wraps a sftp.File, recording the bytes read and written through it.
+type File struct {
+	*sftp.File
+	span   *sentry.Span
+	opened time.Time
+
+	read    atomic.Int64
+	written atomic.Int64
+}
+
+func (f *File) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.read.Add(int64(n))
+
+	return n, err
+}
+
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(b, off)
+	f.read.Add(int64(n))
+
+	return n, err
+}
+
+// WriteTo implements io.WriterTo, keeping the concurrent reads of sftp.File
+// used by io.Copy.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	n, err := f.File.WriteTo(w)
+	f.read.Add(n)
+
+	return n, err
+}
+
+func (f *File) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	f.written.Add(int64(n))
+
+	return n, err
+}
+
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	f.written.Add(int64(n))
+
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom, keeping the concurrent writes of
+// sftp.File used by io.Copy.
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	n, err := f.File.ReadFrom(r)
+	f.written.Add(n)
+
+	return n, err
+}
+
+func (f *File) Close() error {
+	err := f.File.Close()
+	if f.span == nil {
+		return err
+	}
+
+	read, written := f.read.Load(), f.written.Load()
+	f.span.SetData("file.bytes_read", strconv.FormatInt(read, 10))
+	f.span.SetData("file.bytes_written", strconv.FormatInt(written, 10))
+	if elapsed := time.Since(f.opened).Seconds(); elapsed > 0 {
+		throughput := float64(read+written) / elapsed
+		f.span.SetData("file.throughput", strconv.FormatFloat(throughput, 'f', 0, 64))
+	}
+	finish(f.span, err)
+	f.span = nil
+
+	return err
+}
+
+// Walk walks the file tree rooted at root, as sftp.Client.Walk does, within a
+// "file.walk" span finished once Step returns false.
+func (c *Client) Walk(ctx context.Context, root string) *Walker {
+	return &Walker{
+		Walker: c.Client.Walk(root),
+		span:   c.tracer.startSpan(ctx, "file.walk", root),
+	}
+}
+
+// Walker wraps a fs.Walker, recording the number of entries walked and of
+// errors met.
+type Walker struct {
+	*fs.Walker
+	span *sentry.Span
+
+	entries int64
+	errors  int64
+}
+
+func (w *Walker) Step() bool {
+	if !w.Walker.Step() {
+		w.finish()
+		return false
+	}
+
+	if w.Walker.Err() != nil {
+		w.errors++
+	} else {
+		w.entries++
+	}
+
+	return true
+}
+
+func (w *Walker) finish() {
+	if w.span == nil {
+		return
+	}
+
+	w.span.SetData("file.walk.entries", strconv.FormatInt(w.entries, 10))
+	w.span.SetData("file.walk.errors", strconv.FormatInt(w.errors, 10))
+	if w.errors > 0 {
+		w.span.Status = sentry.SpanStatusInternalError
+	} else {
+		w.span.Status = sentry.SpanStatusOK
+	}
+	w.span.Finish()
+	w.span = nil
+}
@@ -0,0 +1,153 @@
+// Package snstracer provides a tracer implementation for the AWS SDK v2 SNS client.
+//
+// The trace context is injected as "sentry-trace" and "baggage" message
+// attributes, which SQS subscribers (with raw message delivery enabled) and
+// Lambda functions receive as-is, so they can continue the trace.
+//
+//	client := snstracer.NewSentrySNSClient(sns.NewFromConfig(cfg))
+//
+//	_, err := client.Publish(ctx, &sns.PublishInput{
+//		TopicArn: aws.String(topicArn),
+//		Message:  aws.String("hello"),
+//	})
+package snstracer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/getsentry/sentry-go"
+)
+
+// maxMessageAttributes is the number of message attributes SNS forwards to SQS
+// subscribers. Injection needs two of them for sentry-trace and baggage.
+const maxMessageAttributes = 10
+
+// SNSClient is the subset of *sns.Client used by the tracer.
+type SNSClient interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+var integration = config.Integration{Origin: "auto.queue.sns"}
+
+// SetEnabled turns the spans of SNS publishes on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentrySNSTracerOption func(*Client)
+
+func WithTags(tags map[string]string) SentrySNSTracerOption {
+	return func(t *Client) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentrySNSTracerOption {
+	return func(t *Client) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of published messages for which sampler
+// returns false, given the "queue.publish" operation and the topic name.
+func WithSpanSampler(sampler func(operation, description string) bool) SentrySNSTracerOption {
+	return func(t *Client) {
+		t.spanSampler = sampler
+	}
+}
+
+func NewSentrySNSClient(client SNSClient, opts ...SentrySNSTracerOption) *Client {
+	c := &Client{
+		SNSClient: client,
+		tags:      make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type Client struct {
+	SNSClient
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// Publish wraps sns.Client.Publish with a "queue.publish" span, and injects the
+// trace context into the message attributes. Messages with too many attributes
+// to take the trace context are published as they are, and the span records
+// that the trace was not propagated.
+func (c *Client) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	topicArn := aws.ToString(params.TopicArn)
+	if topicArn == "" {
+		topicArn = aws.ToString(params.TargetArn)
+	}
+	topicName := topicNameFromArn(topicArn)
+
+	span := integration.StartSampledSpan(ctx, c.spanSampler, "queue.publish", topicName)
+	if span == nil {
+		return c.SNSClient.Publish(ctx, params, optFns...)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "aws_sns")
+	span.SetData(semconv.MessagingDestinationName.Key(), topicName)
+	span.SetData("aws.sns.topic_arn", topicArn)
+	messaging.SetBodySize(span, len(aws.ToString(params.Message)))
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	input := *params
+	if len(params.MessageAttributes) > maxMessageAttributes-2 {
+		span.SetData("messaging.trace_propagated", false)
+	} else {
+		attributes := make(map[string]types.MessageAttributeValue, len(params.MessageAttributes)+2)
+		for k, v := range params.MessageAttributes {
+			attributes[k] = v
+		}
+		attributes[sentry.SentryTraceHeader] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(span.ToSentryTrace())}
+		if baggage := span.ToBaggage(); baggage != "" {
+			attributes[sentry.SentryBaggageHeader] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(baggage)}
+		}
+
+		input.MessageAttributes = attributes
+		span.SetData("messaging.trace_propagated", true)
+	}
+
+	output, err := c.SNSClient.Publish(span.Context(), &input, optFns...)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return output, err
+	}
+
+	span.Status = sentry.SpanStatusOK
+	if output != nil && output.MessageId != nil {
+		span.SetData(semconv.MessagingMessageID.Key(), *output.MessageId)
+	}
+
+	return output, nil
+}
+
+func topicNameFromArn(arn string) string {
+	if i := strings.LastIndex(arn, ":"); i >= 0 {
+		return arn[i+1:]
+	}
+
+	return arn
+}
@@ -0,0 +1,383 @@
+// Package sqstracer provides a tracer implementation for the AWS SDK v2 SQS client.
+//
+//	client := sqstracer.NewSentrySQSClient(sqs.NewFromConfig(cfg))
+//
+//	_, err := client.SendMessage(ctx, &sqs.SendMessageInput{
+//		QueueUrl:    aws.String(queueURL),
+//		MessageBody: aws.String("hello"),
+//	})
+//
+//	err = client.Consume(ctx, &sqs.ReceiveMessageInput{
+//		QueueUrl:            aws.String(queueURL),
+//		MaxNumberOfMessages: 10,
+//		WaitTimeSeconds:     20,
+//	}, func(ctx context.Context, message types.Message) error {
+//		return processOrder(ctx, aws.ToString(message.Body))
+//	})
+package sqstracer
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	attributeApproximateReceiveCount = "ApproximateReceiveCount"
+	attributeSentTimestamp           = "SentTimestamp"
+
+	// maxMessageAttributes is the number of message attributes SQS accepts on
+	// a message. Injection needs two of them for sentry-trace and baggage.
+	maxMessageAttributes = 10
+)
+
+// SQSClient is the subset of *sqs.Client used by the tracer.
+type SQSClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+var integration = config.Integration{Origin: "auto.queue.sqs"}
+
+// SetEnabled turns the spans of SQS sends and receives on or off at runtime,
+// running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentrySQSTracerOption func(*Client)
+
+func WithTags(tags map[string]string) SentrySQSTracerOption {
+	return func(t *Client) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentrySQSTracerOption {
+	return func(t *Client) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the queue name.
+func WithSpanSampler(sampler func(operation, description string) bool) SentrySQSTracerOption {
+	return func(t *Client) {
+		t.spanSampler = sampler
+	}
+}
+
+func NewSentrySQSClient(client SQSClient, opts ...SentrySQSTracerOption) *Client {
+	c := &Client{
+		SQSClient: client,
+		tags:      make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type Client struct {
+	SQSClient
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// SendMessage wraps sqs.Client.SendMessage with a "queue.publish" span, and
+// injects the trace context into the message attributes. Messages with too
+// many attributes to take the trace context are sent as they are, and the span
+// records that the trace was not propagated.
+func (c *Client) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	queueURL := aws.ToString(params.QueueUrl)
+	queueName := queueNameFromURL(queueURL)
+
+	span := integration.StartSampledSpan(ctx, c.spanSampler, "queue.publish", queueName)
+	if span == nil {
+		return c.SQSClient.SendMessage(ctx, params, optFns...)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "aws_sqs")
+	span.SetData(semconv.MessagingDestinationName.Key(), queueName)
+	span.SetData("aws.sqs.queue_url", queueURL)
+	messaging.SetBodySize(span, len(aws.ToString(params.MessageBody)))
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	input := *params
+	attributes, propagated := injectAttributes(span, params.MessageAttributes)
+	input.MessageAttributes = attributes
+	span.SetData("messaging.trace_propagated", propagated)
+
+	output, err := c.SQSClient.SendMessage(span.Context(), &input, optFns...)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return output, err
+	}
+
+	span.Status = sentry.SpanStatusOK
+	if output != nil && output.MessageId != nil {
+		span.SetData(semconv.MessagingMessageID.Key(), *output.MessageId)
+	}
+
+	return output, nil
+}
+
+// SendMessageBatch wraps sqs.Client.SendMessageBatch with a "queue.publish"
+// span, and injects the trace context into the message attributes of every
+// entry that has room for it.
+func (c *Client) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	queueURL := aws.ToString(params.QueueUrl)
+	queueName := queueNameFromURL(queueURL)
+
+	span := integration.StartSampledSpan(ctx, c.spanSampler, "queue.publish", queueName)
+	if span == nil {
+		return c.SQSClient.SendMessageBatch(ctx, params, optFns...)
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "aws_sqs")
+	span.SetData(semconv.MessagingDestinationName.Key(), queueName)
+	span.SetData("aws.sqs.queue_url", queueURL)
+	span.SetData("messaging.batch.message_count", len(params.Entries))
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	input := *params
+	input.Entries = make([]types.SendMessageBatchRequestEntry, len(params.Entries))
+	allPropagated := true
+	for i, entry := range params.Entries {
+		attributes, propagated := injectAttributes(span, entry.MessageAttributes)
+		entry.MessageAttributes = attributes
+		input.Entries[i] = entry
+		allPropagated = allPropagated && propagated
+	}
+	span.SetData("messaging.trace_propagated", allPropagated)
+
+	output, err := c.SQSClient.SendMessageBatch(span.Context(), &input, optFns...)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return output, err
+	}
+
+	span.Status = sentry.SpanStatusOK
+	if output != nil && len(output.Failed) > 0 {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("aws.sqs.batch.failed_count", len(output.Failed))
+	}
+
+	return output, nil
+}
+
+// injectAttributes returns a copy of attributes carrying the trace context of
+// span, or attributes unchanged and false when SQS would reject the extra ones.
+func injectAttributes(span *sentry.Span, attributes map[string]types.MessageAttributeValue) (map[string]types.MessageAttributeValue, bool) {
+	if len(attributes) > maxMessageAttributes-2 {
+		return attributes, false
+	}
+
+	injected := make(map[string]types.MessageAttributeValue, len(attributes)+2)
+	for k, v := range attributes {
+		injected[k] = v
+	}
+	injected[sentry.SentryTraceHeader] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(span.ToSentryTrace())}
+	if baggage := span.ToBaggage(); baggage != "" {
+		injected[sentry.SentryBaggageHeader] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(baggage)}
+	}
+
+	return injected, true
+}
+
+// MessageHandler processes a single message. The provided context carries the
+// "queue.process" transaction of the message.
+type MessageHandler func(ctx context.Context, message types.Message) error
+
+// Consume receives messages from the queue until ctx is done. Every message is
+// handed to handler within a "queue.process" transaction continued from the
+// trace context found in the message attributes, and deleted from the queue
+// once handler returns without an error.
+func (c *Client) Consume(ctx context.Context, params *sqs.ReceiveMessageInput, handler MessageHandler, optFns ...func(*sqs.Options)) error {
+	input := *params
+	input.MessageAttributeNames = appendMissing(input.MessageAttributeNames, sentry.SentryTraceHeader, sentry.SentryBaggageHeader)
+	input.AttributeNames = appendMissingAttributeNames(input.AttributeNames, attributeApproximateReceiveCount, attributeSentTimestamp)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		output, err := c.SQSClient.ReceiveMessage(ctx, &input, optFns...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		for _, message := range output.Messages {
+			if err := c.ProcessMessage(ctx, &input, message, handler); err != nil {
+				continue
+			}
+
+			_, _ = c.SQSClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      input.QueueUrl,
+				ReceiptHandle: message.ReceiptHandle,
+			}, optFns...)
+		}
+	}
+}
+
+// ProcessMessage runs handler for a single message received with params, within
+// a "queue.process" transaction. It is useful for applications which own their
+// consumer loop.
+func (c *Client) ProcessMessage(ctx context.Context, params *sqs.ReceiveMessageInput, message types.Message, handler MessageHandler) error {
+	return c.process(ctx, params, message, handler, nil)
+}
+
+// process runs handler within the "queue.process" transaction of message, then
+// acknowledge, if any, once handler succeeded. A failed acknowledgement is
+// recorded on the transaction.
+func (c *Client) process(ctx context.Context, params *sqs.ReceiveMessageInput, message types.Message, handler MessageHandler, acknowledge func(ctx context.Context) error) error {
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier{
+		sentry.SentryTraceHeader:   getAttribute(message.MessageAttributes, sentry.SentryTraceHeader),
+		sentry.SentryBaggageHeader: getAttribute(message.MessageAttributes, sentry.SentryBaggageHeader),
+	})
+
+	queueURL := aws.ToString(params.QueueUrl)
+	queueName := queueNameFromURL(queueURL)
+
+	span := integration.StartTransaction(
+		ctx,
+		c.spanSampler,
+		"queue.process",
+		queueName,
+		continueTrace,
+	)
+	if span == nil {
+		if err := handler(ctx, message); err != nil {
+			return err
+		}
+		if acknowledge != nil {
+			return acknowledge(ctx)
+		}
+		return nil
+	}
+	defer span.Finish()
+
+	span.SetData("messaging.system", "aws_sqs")
+	span.SetData(semconv.MessagingDestinationName.Key(), queueName)
+	span.SetData("aws.sqs.queue_url", queueURL)
+	span.SetData(semconv.MessagingMessageID.Key(), aws.ToString(message.MessageId))
+	messaging.SetBodySize(span, len(aws.ToString(message.Body)))
+	if params.VisibilityTimeout > 0 {
+		span.SetData("aws.sqs.visibility_timeout", strconv.FormatInt(int64(params.VisibilityTimeout), 10))
+	}
+
+	if receiveCount, err := strconv.Atoi(message.Attributes[attributeApproximateReceiveCount]); err == nil {
+		span.SetData("aws.sqs.receive_count", strconv.Itoa(receiveCount))
+		if receiveCount > 0 {
+			span.SetData("messaging.message.retry.count", strconv.Itoa(receiveCount-1))
+		}
+	}
+
+	messaging.SetReceiveLatency(span, messaging.ParseUnixMilli(message.Attributes[attributeSentTimestamp]), time.Now())
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	err := handler(span.Context(), message)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return err
+	}
+
+	span.Status = sentry.SpanStatusOK
+	if acknowledge != nil {
+		if err := acknowledge(span.Context()); err != nil {
+			span.Status = sentry.SpanStatusInternalError
+			span.SetData("aws.sqs.delete_error", err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+func queueNameFromURL(queueURL string) string {
+	if i := strings.LastIndex(queueURL, "/"); i >= 0 {
+		return queueURL[i+1:]
+	}
+
+	return queueURL
+}
+
+func getAttribute(attributes map[string]types.MessageAttributeValue, key string) string {
+	if value, ok := attributes[key]; ok {
+		return aws.ToString(value.StringValue)
+	}
+
+	return ""
+}
+
+func appendMissing(values []string, wanted ...string) []string {
+	for _, want := range wanted {
+		found := false
+		for _, value := range values {
+			if value == want || value == "All" || value == ".*" {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			values = append(values, want)
+		}
+	}
+
+	return values
+}
+
+func appendMissingAttributeNames(values []types.QueueAttributeName, wanted ...string) []types.QueueAttributeName {
+	for _, want := range wanted {
+		found := false
+		for _, value := range values {
+			if string(value) == want || value == types.QueueAttributeNameAll {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			values = append(values, types.QueueAttributeName(want))
+		}
+	}
+
+	return values
+}
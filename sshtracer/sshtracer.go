@@ -0,0 +1,489 @@
+// Package sshtracer provides a tracer implementation for golang.org/x/crypto/ssh.
+//
+//	client, err := sshtracer.Dial(ctx, "tcp", "deploy.example.com:22", clientConfig)
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	session, err := client.NewSession(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer session.Close()
+//
+//	output, err := session.Output("systemctl restart app")
+//
+// Dialing is recorded as a "ssh.connect" span for the TCP connection, followed
+// by a "ssh.auth" span for the handshake, as x/crypto/ssh authenticates within
+// it. Every remote command is a "ssh.exec" span, from its start until it
+// exits, recording the exit code and the bytes sent to stdin and read from
+// stdout and stderr, whether through the Stdin, Stdout and Stderr fields of
+// the session or through its pipes. Commands are scrubbed before being
+// recorded.
+package sshtracer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/scrub"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"golang.org/x/crypto/ssh"
+)
+
+var integration = config.Integration{Origin: "auto.ssh"}
+
+// SetEnabled turns the spans of SSH connections and commands on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentrySSHTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentrySSHTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentrySSHTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans for which sampler returns false, given the
+// operation and the description, e.g. "SSH deploy.example.com" or the
+// scrubbed command.
+func WithSpanSampler(sampler func(operation, description string) bool) SentrySSHTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts []SentrySSHTracerOption) *tracer {
+	t := &tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+func (t *tracer) startSpan(ctx context.Context, operation, description, host, port string) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, t.spanSampler, operation, description)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData(semconv.ServerAddress.Key(), host)
+	if port != "" {
+		span.SetData(semconv.ServerPort.Key(), port)
+	}
+
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+
+	return span
+}
+
+// Client wraps a ssh.Client, making sessions which commands are traced.
+type Client struct {
+	*ssh.Client
+	tracer *tracer
+	host   string
+	port   string
+}
+
+// NewSentryClient wraps an already connected client of the server at addr.
+func NewSentryClient(client *ssh.Client, addr string, opts ...SentrySSHTracerOption) *Client {
+	host, port := splitAddr(addr)
+
+	return &Client{
+		Client: client,
+		tracer: newTracer(opts),
+		host:   host,
+		port:   port,
+	}
+}
+
+// Dial connects to the SSH server at addr, as ssh.Dial does, honouring the
+// cancellation of ctx while connecting.
+func Dial(ctx context.Context, network, addr string, clientConfig *ssh.ClientConfig, opts ...SentrySSHTracerOption) (*Client, error) {
+	t := newTracer(opts)
+	host, port := splitAddr(addr)
+	description := "SSH " + host
+
+	dialer := &net.Dialer{Timeout: clientConfig.Timeout}
+
+	span := t.startSpan(ctx, "ssh.connect", description, host, port)
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if span != nil {
+		span.SetData("network.transport", network)
+		finish(span, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	span = t.startSpan(ctx, "ssh.auth", description, host, port)
+	if span != nil {
+		span.SetData("ssh.user", clientConfig.User)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if span != nil {
+		if err == nil {
+			span.SetData("ssh.server_version", string(c.ServerVersion()))
+		}
+		finishAuth(span, err)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &Client{
+		Client: ssh.NewClient(c, chans, reqs),
+		tracer: t,
+		host:   host,
+		port:   port,
+	}, nil
+}
+
+// NewSession opens a session, which commands are traced as children of the
+// span of ctx.
+func (c *Client) NewSession(ctx context.Context) (*Session, error) {
+	session, err := c.Client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		Session: session,
+		ctx:     ctx,
+		client:  c,
+	}, nil
+}
+
+// Session wraps a ssh.Session. A session runs a single command, or shell,
+// traced from Start, or Shell, until Wait.
+type Session struct {
+	*ssh.Session
+	ctx    context.Context
+	client *Client
+
+	span                           *sentry.Span
+	stdinPipe, stdoutPipe, errPipe bool
+	// counts are the bytes of stdin, stdout and stderr.
+	counts [3]int64
+}
+
+func (s *Session) StdinPipe() (io.WriteCloser, error) {
+	pipe, err := s.Session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.stdinPipe = true
+
+	return &countingWriteCloser{WriteCloser: pipe, n: &s.counts[0]}, nil
+}
+
+func (s *Session) StdoutPipe() (io.Reader, error) {
+	pipe, err := s.Session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.stdoutPipe = true
+
+	return &countingReader{Reader: pipe, n: &s.counts[1]}, nil
+}
+
+func (s *Session) StderrPipe() (io.Reader, error) {
+	pipe, err := s.Session.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.errPipe = true
+
+	return &countingReader{Reader: pipe, n: &s.counts[2]}, nil
+}
+
+// Start starts cmd on the remote host, within a "ssh.exec" span finished by
+// Wait.
+func (s *Session) Start(cmd string) error {
+	s.start(cmd)
+
+	err := s.Session.Start(cmd)
+	if err != nil {
+		s.finish(err)
+	}
+
+	return err
+}
+
+// Shell starts a login shell on the remote host, within a "ssh.exec" span
+// finished by Wait.
+func (s *Session) Shell() error {
+	s.start("")
+
+	err := s.Session.Shell()
+	if err != nil {
+		s.finish(err)
+	}
+
+	return err
+}
+
+// Wait waits for the command, or shell, to exit, finishing its span.
+func (s *Session) Wait() error {
+	err := s.Session.Wait()
+	s.finish(err)
+
+	return err
+}
+
+// Run runs cmd on the remote host, as Start followed by Wait.
+func (s *Session) Run(cmd string) error {
+	if err := s.Start(cmd); err != nil {
+		return err
+	}
+
+	return s.Wait()
+}
+
+// Output runs cmd on the remote host and returns its standard output.
+func (s *Session) Output(cmd string) ([]byte, error) {
+	if s.Stdout != nil {
+		return nil, errors.New("ssh: Stdout already set")
+	}
+
+	var b bytes.Buffer
+	s.Stdout = &b
+	err := s.Run(cmd)
+
+	return b.Bytes(), err
+}
+
+// CombinedOutput runs cmd on the remote host and returns its combined
+// standard output and standard error.
+func (s *Session) CombinedOutput(cmd string) ([]byte, error) {
+	if s.Stdout != nil {
+		return nil, errors.New("ssh: Stdout already set")
+	}
+	if s.Stderr != nil {
+		return nil, errors.New("ssh: Stderr already set")
+	}
+
+	var b singleWriter
+	s.Stdout = &b
+	s.Stderr = &b
+	err := s.Run(cmd)
+
+	return b.Bytes(), err
+}
+
+// start starts the span of cmd, or of a shell when cmd is empty, counting the
+// bytes exchanged through the streams of the session not piped.
+func (s *Session) start(cmd string) {
+	description := "shell"
+	if cmd != "" {
+		description = scrub.String(cmd)
+	}
+
+	s.span = s.client.tracer.startSpan(s.ctx, "ssh.exec", description, s.client.host, s.client.port)
+	if s.span == nil {
+		return
+	}
+
+	if cmd != "" {
+		if executable, _, _ := strings.Cut(strings.TrimSpace(cmd), " "); executable != "" {
+			s.span.SetData("process.executable.name", executable)
+		}
+		s.span.SetData("process.command_line", description)
+	}
+
+	if s.Stdin != nil && !s.stdinPipe {
+		s.Stdin = &countingReader{Reader: s.Stdin, n: &s.counts[0]}
+	}
+	if !s.stdoutPipe {
+		s.Stdout = &countingWriter{w: orDiscard(s.Stdout), n: &s.counts[1]}
+	}
+	if !s.errPipe {
+		s.Stderr = &countingWriter{w: orDiscard(s.Stderr), n: &s.counts[2]}
+	}
+}
+
+// finish finishes the span of the command with its exit code and byte counts.
+func (s *Session) finish(err error) {
+	span := s.span
+	if span == nil {
+		return
+	}
+	s.span = nil
+
+	span.SetData("ssh.stdin.bytes", strconv.FormatInt(atomic.LoadInt64(&s.counts[0]), 10))
+	span.SetData("ssh.stdout.bytes", strconv.FormatInt(atomic.LoadInt64(&s.counts[1]), 10))
+	span.SetData("ssh.stderr.bytes", strconv.FormatInt(atomic.LoadInt64(&s.counts[2]), 10))
+
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	switch {
+	case err == nil:
+		span.SetData("process.exit_code", "0")
+		span.Status = sentry.SpanStatusOK
+	case errors.As(err, &exitErr):
+		span.SetData("process.exit_code", strconv.Itoa(exitErr.ExitStatus()))
+		if signal := exitErr.Signal(); signal != "" {
+			span.SetData("process.exit_signal", signal)
+		}
+		span.SetData("error", exitErr.Msg())
+		span.Status = sentry.SpanStatusInternalError
+	case errors.As(err, &missingErr):
+		span.Status = sentry.SpanStatusUnknown
+		span.SetData("error", err.Error())
+	default:
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	}
+
+	span.Finish()
+}
+
+// finish sets the status of the span of a dial after err, then finishes it.
+func finish(span *sentry.Span, err error) {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		span.Status = sentry.SpanStatusOK
+	case errors.Is(err, context.Canceled):
+		span.Status = sentry.SpanStatusCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		span.Status = sentry.SpanStatusDeadlineExceeded
+	default:
+		span.Status = sentry.SpanStatusUnavailable
+	}
+
+	if err != nil {
+		span.SetData("error", err.Error())
+	}
+
+	span.Finish()
+}
+
+// finishAuth sets the status of the span of a handshake after err, then
+// finishes it. x/crypto/ssh reports failed authentications only through the
+// message of its error.
+func finishAuth(span *sentry.Span, err error) {
+	switch {
+	case err == nil:
+		span.Status = sentry.SpanStatusOK
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		span.Status = sentry.SpanStatusUnauthenticated
+	case strings.Contains(err.Error(), "host key"):
+		span.Status = sentry.SpanStatusPermissionDenied
+	default:
+		span.Status = sentry.SpanStatusInternalError
+	}
+
+	if err != nil {
+		span.SetData("error", err.Error())
+	}
+
+	span.Finish()
+}
+
+// splitAddr returns the host and port of addr, or addr alone when it has no
+// port.
+func splitAddr(addr string) (string, string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, ""
+	}
+
+	return host, port
+}
+
+func orDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+
+	return w
+}
+
+type countingReader struct {
+	io.Reader
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+
+	return n, err
+}
+
+type countingWriteCloser struct {
+	io.WriteCloser
+	n *int64
+}
+
+func (w *countingWriteCloser) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+
+	return n, err
+}
+
+// singleWriter serializes the writes of both stdout and stderr to a buffer,
+// as ssh.Session.CombinedOutput does.
+type singleWriter struct {
+	b  bytes.Buffer
+	mu sync.Mutex
+}
+
+func (w *singleWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.b.Write(p)
+}
+
+func (w *singleWriter) Bytes() []byte {
+	return w.b.Bytes()
+}
@@ -0,0 +1,347 @@
+// Package stripetracer provides a tracer implementation for stripe-go, as a
+// stripe.Backend.
+//
+//	stripe.SetBackend(stripe.APIBackend, stripetracer.NewSentryBackend(stripe.GetBackend(stripe.APIBackend)))
+//
+//	params := &stripe.CustomerParams{Email: stripe.String("jane@example.com")}
+//	params.Context = ctx
+//	c, err := customer.New(params)
+//
+// Spans are only parented to the caller's span when the request parameters
+// carry its context, as stripe-go reads the context out of them.
+package stripetracer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/form"
+)
+
+// objectIDPattern matches Stripe object IDs within request paths, such as
+// "cus_NffrFeUfNV2Hib" or "pi_3MtwBwLkdIwHu7ix28a3tqPa".
+var objectIDPattern = regexp.MustCompile(`^[a-z]+(_[a-z]+)*_[0-9A-Za-z]{8,}$`)
+
+var integration = config.Integration{Origin: "auto.http.stripe"}
+
+// SetEnabled turns the spans of Stripe API calls on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryStripeTracerOption func(*Backend)
+
+func WithTags(tags map[string]string) SentryStripeTracerOption {
+	return func(b *Backend) {
+		for k, v := range tags {
+			b.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryStripeTracerOption {
+	return func(b *Backend) {
+		b.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of calls for which sampler returns false,
+// given the "http.client" operation and the "METHOD /v1/route" description.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryStripeTracerOption {
+	return func(b *Backend) {
+		b.spanSampler = sampler
+	}
+}
+
+// WithCaptureErrors captures Stripe errors of the given types as exceptions,
+// or every Stripe error when no type is given.
+func WithCaptureErrors(errorTypes ...stripe.ErrorType) SentryStripeTracerOption {
+	return func(b *Backend) {
+		b.captureErrors = true
+		b.captureErrorTypes = errorTypes
+	}
+}
+
+func NewSentryBackend(backend stripe.Backend, opts ...SentryStripeTracerOption) stripe.Backend {
+	b := &Backend{
+		Backend: backend,
+		tags:    make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+type Backend struct {
+	stripe.Backend
+
+	captureErrors     bool
+	captureErrorTypes []stripe.ErrorType
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// Call implements stripe.Backend.
+func (b *Backend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	var p *stripe.Params
+	if params != nil && !reflect.ValueOf(params).IsNil() {
+		p = params.GetParams()
+	}
+
+	return b.trace(method, path, p, v, func() error {
+		return b.Backend.Call(method, path, key, params, v)
+	})
+}
+
+// CallStreaming implements stripe.Backend.
+func (b *Backend) CallStreaming(method, path, key string, params stripe.ParamsContainer, v stripe.StreamingLastResponseSetter) error {
+	var p *stripe.Params
+	if params != nil && !reflect.ValueOf(params).IsNil() {
+		p = params.GetParams()
+	}
+
+	return b.trace(method, path, p, v, func() error {
+		return b.Backend.CallStreaming(method, path, key, params, v)
+	})
+}
+
+// CallRaw implements stripe.Backend.
+func (b *Backend) CallRaw(method, path, key string, body *form.Values, params *stripe.Params, v stripe.LastResponseSetter) error {
+	return b.trace(method, path, params, v, func() error {
+		return b.Backend.CallRaw(method, path, key, body, params, v)
+	})
+}
+
+// CallMultipart implements stripe.Backend.
+func (b *Backend) CallMultipart(method, path, key, boundary string, body *bytes.Buffer, params *stripe.Params, v stripe.LastResponseSetter) error {
+	return b.trace(method, path, params, v, func() error {
+		return b.Backend.CallMultipart(method, path, key, boundary, body, params, v)
+	})
+}
+
+func (b *Backend) trace(method, path string, params *stripe.Params, v interface{}, call func() error) error {
+	ctx := context.Background()
+	if params != nil && params.Context != nil {
+		ctx = params.Context
+	}
+
+	resource, route := normalizePath(path)
+	description := method + " " + route
+
+	span := integration.StartSampledSpan(ctx, b.spanSampler, "http.client", description)
+	if span == nil {
+		return call()
+	}
+	defer span.Finish()
+
+	span.SetData(semconv.HTTPRequestMethod.Key(), method)
+	span.SetData("stripe.resource", resource)
+	span.SetData("stripe.operation", operationName(method, path))
+	if params != nil {
+		span.SetData("stripe.idempotency_key.present", strconv.FormatBool(params.IdempotencyKey != nil))
+		if params.StripeAccount != nil {
+			span.SetData("stripe.connected_account", "true")
+		}
+
+		original := params.Context
+		params.Context = span.Context()
+		defer func() { params.Context = original }()
+	}
+
+	for k, v := range b.tags {
+		span.SetTag(k, v)
+	}
+
+	err := call()
+
+	if response := lastResponse(v); response != nil {
+		recordResponse(span, response)
+	}
+
+	if err == nil {
+		span.Status = sentry.SpanStatusOK
+		return nil
+	}
+
+	span.Status = sentry.SpanStatusInternalError
+	span.SetData("error", err.Error())
+
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		span.Status = spanStatus(stripeErr)
+		span.SetData("stripe.error.type", string(stripeErr.Type))
+		if stripeErr.Code != "" {
+			span.SetData("stripe.error.code", string(stripeErr.Code))
+		}
+		if stripeErr.DeclineCode != "" {
+			span.SetData("stripe.error.decline_code", string(stripeErr.DeclineCode))
+		}
+		if stripeErr.RequestID != "" {
+			span.SetData("stripe.request_id", stripeErr.RequestID)
+		}
+		if stripeErr.HTTPStatusCode != 0 {
+			span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(stripeErr.HTTPStatusCode))
+		}
+
+		if b.shouldCapture(stripeErr) {
+			hub := sentry.GetHubFromContext(ctx)
+			if hub == nil {
+				hub = sentry.CurrentHub()
+			}
+			hub.WithScope(func(scope *sentry.Scope) {
+				scope.SetTag("stripe.error.type", string(stripeErr.Type))
+				scope.SetContext("stripe", map[string]interface{}{
+					"operation":  description,
+					"code":       stripeErr.Code,
+					"request_id": stripeErr.RequestID,
+				})
+				hub.CaptureException(err)
+			})
+		}
+	}
+
+	return err
+}
+
+func (b *Backend) shouldCapture(err *stripe.Error) bool {
+	if !b.captureErrors {
+		return false
+	}
+	if len(b.captureErrorTypes) == 0 {
+		return true
+	}
+
+	for _, errorType := range b.captureErrorTypes {
+		if err.Type == errorType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// spanStatus maps a Stripe error to a span status, according to its type.
+func spanStatus(err *stripe.Error) sentry.SpanStatus {
+	if err.HTTPStatusCode == 429 {
+		return sentry.SpanStatusResourceExhausted
+	}
+
+	switch err.Type {
+	case stripe.ErrorTypeCard:
+		return sentry.SpanStatusFailedPrecondition
+	case stripe.ErrorTypeInvalidRequest:
+		if err.HTTPStatusCode == 404 {
+			return sentry.SpanStatusNotFound
+		}
+		return sentry.SpanStatusInvalidArgument
+	case stripe.ErrorTypeIdempotency:
+		return sentry.SpanStatusAborted
+	case stripe.ErrorTypeAPI:
+		return sentry.SpanStatusInternalError
+	}
+
+	if err.HTTPStatusCode != 0 {
+		return sentry.HTTPtoSpanStatus(err.HTTPStatusCode)
+	}
+
+	return sentry.SpanStatusInternalError
+}
+
+// lastResponse returns the API response stripe-go set on v, found in the
+// LastResponse field of its embedded stripe.APIResource.
+func lastResponse(v interface{}) *stripe.APIResponse {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return nil
+	}
+
+	value = value.Elem()
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	field := value.FieldByName("LastResponse")
+	if !field.IsValid() {
+		return nil
+	}
+
+	response, _ := field.Interface().(*stripe.APIResponse)
+	return response
+}
+
+func recordResponse(span *sentry.Span, response *stripe.APIResponse) {
+	span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(response.StatusCode))
+	if response.RequestID != "" {
+		span.SetData("stripe.request_id", response.RequestID)
+	}
+	if response.IdempotencyKey != "" {
+		span.SetData("stripe.idempotency_key.present", "true")
+	}
+
+	for name, values := range response.Header {
+		lower := strings.ToLower(name)
+		if strings.Contains(lower, "ratelimit") || lower == "retry-after" || lower == "stripe-should-retry" {
+			span.SetData("http.response.header."+lower, strings.Join(values, ","))
+		}
+	}
+}
+
+// normalizePath returns the resource of a request path, and the path with its
+// object IDs replaced by placeholders, e.g. "/v1/customers/{id}/sources".
+func normalizePath(path string) (resource string, route string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if i > 0 && objectIDPattern.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+
+	if len(segments) > 1 {
+		resource = segments[1]
+	}
+
+	return resource, "/" + strings.Join(segments, "/")
+}
+
+// operationName derives a CRUD style operation out of a request, e.g.
+// "customers.create" or "payment_intents.confirm".
+func operationName(method, path string) string {
+	resource, route := normalizePath(path)
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+
+	last := segments[len(segments)-1]
+	if len(segments) > 2 && last != "{id}" && segments[len(segments)-2] == "{id}" {
+		return resource + "." + last
+	}
+
+	switch method {
+	case "GET":
+		if last == "{id}" {
+			return resource + ".retrieve"
+		}
+		return resource + ".list"
+	case "POST":
+		if last == "{id}" {
+			return resource + ".update"
+		}
+		return resource + ".create"
+	case "DELETE":
+		return resource + ".delete"
+	default:
+		return resource + "." + strings.ToLower(method)
+	}
+}
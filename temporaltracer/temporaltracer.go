@@ -0,0 +1,350 @@
+// Package temporaltracer provides a tracer implementation for the Temporal Go SDK.
+//
+//	tracer := temporaltracer.NewSentryInterceptor()
+//
+//	c, err := client.Dial(client.Options{
+//		Interceptors: []interceptor.ClientInterceptor{tracer},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	w := worker.New(c, "orders", worker.Options{
+//		Interceptors: []interceptor.WorkerInterceptor{tracer},
+//	})
+//
+// Workflow spans are only created when the workflow code is not being replayed,
+// so a workflow produces a single span no matter how many times it is replayed.
+package temporaltracer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/getsentry/sentry-go"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/workflow"
+)
+
+var integration = config.Integration{Origin: "auto.function.temporal"}
+
+// SetEnabled turns the spans of Temporal workflows, activities and signals on
+// or off at runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryTemporalTracerOption func(*Interceptor)
+
+func WithTags(tags map[string]string) SentryTemporalTracerOption {
+	return func(t *Interceptor) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryTemporalTracerOption {
+	return func(t *Interceptor) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans for which sampler returns false, given the
+// operation and the workflow, signal or activity name. sampler must be
+// deterministic for workflows, as it runs within workflow code.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryTemporalTracerOption {
+	return func(t *Interceptor) {
+		t.spanSampler = sampler
+	}
+}
+
+func NewSentryInterceptor(opts ...SentryTemporalTracerOption) *Interceptor {
+	i := &Interceptor{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// Interceptor implements both interceptor.ClientInterceptor and
+// interceptor.WorkerInterceptor.
+type Interceptor struct {
+	interceptor.InterceptorBase
+
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func (i *Interceptor) setTags(span *sentry.Span) {
+	for k, v := range i.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// InterceptClient implements interceptor.ClientInterceptor.
+func (i *Interceptor) InterceptClient(next interceptor.ClientOutboundInterceptor) interceptor.ClientOutboundInterceptor {
+	return &clientOutbound{
+		ClientOutboundInterceptorBase: interceptor.ClientOutboundInterceptorBase{Next: next},
+		root:                          i,
+	}
+}
+
+// InterceptActivity implements interceptor.WorkerInterceptor.
+func (i *Interceptor) InterceptActivity(ctx context.Context, next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	return &activityInbound{
+		ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+// InterceptWorkflow implements interceptor.WorkerInterceptor.
+func (i *Interceptor) InterceptWorkflow(ctx workflow.Context, next interceptor.WorkflowInboundInterceptor) interceptor.WorkflowInboundInterceptor {
+	return &workflowInbound{
+		WorkflowInboundInterceptorBase: interceptor.WorkflowInboundInterceptorBase{Next: next},
+		root:                           i,
+	}
+}
+
+type clientOutbound struct {
+	interceptor.ClientOutboundInterceptorBase
+	root *Interceptor
+}
+
+func (c *clientOutbound) ExecuteWorkflow(ctx context.Context, in *interceptor.ClientExecuteWorkflowInput) (client.WorkflowRun, error) {
+	span := integration.StartSampledSpan(ctx, c.root.spanSampler, "temporal.start_workflow", in.WorkflowType)
+	if span == nil {
+		return c.Next.ExecuteWorkflow(ctx, in)
+	}
+	defer span.Finish()
+
+	span.SetData("temporal.workflow.type", in.WorkflowType)
+	if in.Options != nil {
+		span.SetData("temporal.workflow.id", in.Options.ID)
+		span.SetData("temporal.task_queue", in.Options.TaskQueue)
+	}
+	c.root.setTags(span)
+
+	writeHeader(interceptor.Header(ctx), span)
+
+	run, err := c.Next.ExecuteWorkflow(span.Context(), in)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+		return run, err
+	}
+
+	span.Status = sentry.SpanStatusOK
+	span.SetData("temporal.workflow.id", run.GetID())
+	span.SetData("temporal.run.id", run.GetRunID())
+
+	return run, nil
+}
+
+func (c *clientOutbound) SignalWorkflow(ctx context.Context, in *interceptor.ClientSignalWorkflowInput) error {
+	span := integration.StartSampledSpan(ctx, c.root.spanSampler, "temporal.signal_workflow", in.SignalName)
+	if span == nil {
+		return c.Next.SignalWorkflow(ctx, in)
+	}
+	defer span.Finish()
+
+	span.SetData("temporal.workflow.id", in.WorkflowID)
+	span.SetData("temporal.run.id", in.RunID)
+	span.SetData("temporal.signal.name", in.SignalName)
+	c.root.setTags(span)
+
+	writeHeader(interceptor.Header(ctx), span)
+
+	err := c.Next.SignalWorkflow(span.Context(), in)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return err
+}
+
+type activityInbound struct {
+	interceptor.ActivityInboundInterceptorBase
+	root *Interceptor
+}
+
+func (a *activityInbound) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	info := activity.GetInfo(ctx)
+	trace, baggage := readHeader(interceptor.Header(ctx))
+
+	ctx, continueTrace := propagation.Continue(ctx, propagation.MapCarrier{
+		sentry.SentryTraceHeader:   trace,
+		sentry.SentryBaggageHeader: baggage,
+	})
+	hub := sentry.GetHubFromContext(ctx)
+
+	span := integration.StartTransaction(ctx, a.root.spanSampler, "temporal.activity", info.ActivityType.Name, continueTrace)
+	if span == nil {
+		return a.Next.ExecuteActivity(ctx, in)
+	}
+	defer span.Finish()
+
+	span.SetData("temporal.activity.type", info.ActivityType.Name)
+	span.SetData("temporal.activity.id", info.ActivityID)
+	span.SetData("temporal.activity.attempt", strconv.FormatInt(int64(info.Attempt), 10))
+	span.SetData("temporal.workflow.id", info.WorkflowExecution.ID)
+	span.SetData("temporal.run.id", info.WorkflowExecution.RunID)
+	span.SetData("temporal.task_queue", info.TaskQueue)
+	if info.WorkflowType != nil {
+		span.SetData("temporal.workflow.type", info.WorkflowType.Name)
+	}
+	a.root.setTags(span)
+
+	ctx, unlabel := profiling.Label(span.Context(), span)
+	defer unlabel()
+
+	result, err := a.Next.ExecuteActivity(ctx, in)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+
+		hub.WithScope(func(scope *sentry.Scope) {
+			scope.SetTag("temporal.activity.type", info.ActivityType.Name)
+			scope.SetTag("temporal.workflow.id", info.WorkflowExecution.ID)
+			scope.SetTag("temporal.run.id", info.WorkflowExecution.RunID)
+			scope.SetContext("temporal", sentry.Context{
+				"activity_id":   info.ActivityID,
+				"attempt":       info.Attempt,
+				"task_queue":    info.TaskQueue,
+				"workflow_id":   info.WorkflowExecution.ID,
+				"run_id":        info.WorkflowExecution.RunID,
+				"activity_type": info.ActivityType.Name,
+			})
+			hub.CaptureException(err)
+		})
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return result, err
+}
+
+type workflowInbound struct {
+	interceptor.WorkflowInboundInterceptorBase
+	root *Interceptor
+	span *sentry.Span
+}
+
+func (w *workflowInbound) Init(outbound interceptor.WorkflowOutboundInterceptor) error {
+	return w.Next.Init(&workflowOutbound{
+		WorkflowOutboundInterceptorBase: interceptor.WorkflowOutboundInterceptorBase{Next: outbound},
+		inbound:                         w,
+	})
+}
+
+func (w *workflowInbound) ExecuteWorkflow(ctx workflow.Context, in *interceptor.ExecuteWorkflowInput) (interface{}, error) {
+	if workflow.IsReplaying(ctx) {
+		return w.Next.ExecuteWorkflow(ctx, in)
+	}
+
+	info := workflow.GetInfo(ctx)
+	trace, baggage := readHeader(interceptor.WorkflowHeader(ctx))
+
+	spanCtx, continueTrace := propagation.Continue(context.Background(), propagation.MapCarrier{
+		sentry.SentryTraceHeader:   trace,
+		sentry.SentryBaggageHeader: baggage,
+	})
+	span := integration.StartTransaction(spanCtx, w.root.spanSampler, "temporal.workflow", info.WorkflowType.Name, continueTrace)
+	if span == nil {
+		return w.Next.ExecuteWorkflow(ctx, in)
+	}
+	w.span = span
+	defer span.Finish()
+
+	span.SetData("temporal.workflow.type", info.WorkflowType.Name)
+	span.SetData("temporal.workflow.id", info.WorkflowExecution.ID)
+	span.SetData("temporal.run.id", info.WorkflowExecution.RunID)
+	span.SetData("temporal.task_queue", info.TaskQueueName)
+	span.SetData("temporal.workflow.attempt", strconv.FormatInt(int64(info.Attempt), 10))
+	w.root.setTags(span)
+
+	result, err := w.Next.ExecuteWorkflow(ctx, in)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return result, err
+}
+
+// workflowOutbound propagates the trace context of the workflow span to the
+// activities and child workflows it schedules.
+type workflowOutbound struct {
+	interceptor.WorkflowOutboundInterceptorBase
+	inbound *workflowInbound
+}
+
+func (w *workflowOutbound) ExecuteActivity(ctx workflow.Context, activityType string, args ...interface{}) workflow.Future {
+	if w.inbound.span != nil {
+		writeHeader(interceptor.WorkflowHeader(ctx), w.inbound.span)
+	}
+
+	return w.Next.ExecuteActivity(ctx, activityType, args...)
+}
+
+func (w *workflowOutbound) ExecuteLocalActivity(ctx workflow.Context, activityType string, args ...interface{}) workflow.Future {
+	if w.inbound.span != nil {
+		writeHeader(interceptor.WorkflowHeader(ctx), w.inbound.span)
+	}
+
+	return w.Next.ExecuteLocalActivity(ctx, activityType, args...)
+}
+
+func (w *workflowOutbound) ExecuteChildWorkflow(ctx workflow.Context, childWorkflowType string, args ...interface{}) workflow.ChildWorkflowFuture {
+	if w.inbound.span != nil {
+		writeHeader(interceptor.WorkflowHeader(ctx), w.inbound.span)
+	}
+
+	return w.Next.ExecuteChildWorkflow(ctx, childWorkflowType, args...)
+}
+
+func writeHeader(header map[string]*commonpb.Payload, span *sentry.Span) {
+	if header == nil {
+		return
+	}
+
+	dataConverter := converter.GetDefaultDataConverter()
+	if payload, err := dataConverter.ToPayload(span.ToSentryTrace()); err == nil {
+		header[sentry.SentryTraceHeader] = payload
+	}
+	if payload, err := dataConverter.ToPayload(span.ToBaggage()); err == nil {
+		header[sentry.SentryBaggageHeader] = payload
+	}
+}
+
+func readHeader(header map[string]*commonpb.Payload) (trace string, baggage string) {
+	if header == nil {
+		return "", ""
+	}
+
+	dataConverter := converter.GetDefaultDataConverter()
+	if payload, ok := header[sentry.SentryTraceHeader]; ok {
+		_ = dataConverter.FromPayload(payload, &trace)
+	}
+	if payload, ok := header[sentry.SentryBaggageHeader]; ok {
+		_ = dataConverter.FromPayload(payload, &baggage)
+	}
+
+	return trace, baggage
+}
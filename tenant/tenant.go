@@ -0,0 +1,146 @@
+// Package tenant routes the events and transactions of every request or
+// message to the Sentry project of its tenant, for platforms reporting to
+// per-customer projects.
+//
+//	router := tenant.NewRouter(func(tenantID string) (sentry.ClientOptions, bool) {
+//		dsn, ok := dsns[tenantID]
+//		return sentry.ClientOptions{Dsn: dsn, EnableTracing: true}, ok
+//	})
+//	defer router.Flush(2 * time.Second)
+//
+//	// Requests, before sentryhttp so it reuses the routed hub.
+//	handler := router.Middleware(func(r *http.Request) string {
+//		return r.Header.Get("X-Tenant-ID")
+//	})(sentryHandler.Handle(mux))
+//
+//	// Messages, carrying the tenant as a baggage entry set by producers with
+//	// propagation.AppendBaggage.
+//	router.RouteMessages(tenant.FromBaggage("tenant"))
+//
+// Integrations use the hub bound to the context, so everything recorded
+// within a request or message goes to the project of its tenant. Requests and
+// messages of tenants without a project use the current hub.
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/getsentry/sentry-go"
+)
+
+// Router holds a client for each tenant, created on first use.
+type Router struct {
+	options func(tenant string) (sentry.ClientOptions, bool)
+
+	mu   sync.Mutex
+	hubs map[string]*sentry.Hub
+}
+
+// NewRouter returns a router creating the client of a tenant with the options
+// options returns for it, or none when it returns false.
+func NewRouter(options func(tenant string) (sentry.ClientOptions, bool)) *Router {
+	return &Router{
+		options: options,
+		hubs:    make(map[string]*sentry.Hub),
+	}
+}
+
+// Hub returns the hub of tenant, tagged with it, or nil when tenant has no
+// project or its client could not be created. The hub is shared, callers
+// clone it before changing its scope. Only the hubs of tenants with a project
+// are kept, so the tenants of untrusted input, such as a request header,
+// cannot grow the router without bound.
+func (r *Router) Hub(tenant string) *sentry.Hub {
+	if tenant == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if hub, ok := r.hubs[tenant]; ok {
+		return hub
+	}
+
+	options, ok := r.options(tenant)
+	if !ok {
+		return nil
+	}
+
+	client, err := sentry.NewClient(options)
+	if err != nil {
+		return nil
+	}
+
+	scope := sentry.NewScope()
+	scope.SetTag("tenant", tenant)
+	hub := sentry.NewHub(client, scope)
+	r.hubs[tenant] = hub
+
+	return hub
+}
+
+// Bind returns ctx with a clone of the hub of tenant bound to it, or ctx
+// itself when tenant has no hub.
+func (r *Router) Bind(ctx context.Context, tenant string) context.Context {
+	hub := r.Hub(tenant)
+	if hub == nil {
+		return ctx
+	}
+
+	return sentry.SetHubOnContext(ctx, hub.Clone())
+}
+
+// Middleware binds the hub of the tenant extract returns for every request.
+func (r *Router) Middleware(extract func(request *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			ctx := r.Bind(request.Context(), extract(request))
+			next.ServeHTTP(w, request.WithContext(ctx))
+		})
+	}
+}
+
+// RouteMessages makes the message integrations process every message with
+// the hub of the tenant extract returns for its carrier, through
+// propagation.Continue. Carriers hold at least the "sentry-trace" and
+// "baggage" values of the message.
+func (r *Router) RouteMessages(extract func(carrier propagation.Carrier) string) {
+	propagation.SetHubRouter(func(carrier propagation.Carrier) *sentry.Hub {
+		return r.Hub(extract(carrier))
+	})
+}
+
+// FromBaggage extracts the tenant of a message from the key entry of its
+// baggage.
+func FromBaggage(key string) func(carrier propagation.Carrier) string {
+	return func(carrier propagation.Carrier) string {
+		tenant, _ := propagation.ParseBaggage(carrier.Get(sentry.SentryBaggageHeader)).Get(key)
+		return tenant
+	}
+}
+
+// Flush waits until the events of every tenant are sent, or timeout elapses.
+// It reports whether every event was sent in time.
+func (r *Router) Flush(timeout time.Duration) bool {
+	r.mu.Lock()
+	hubs := make([]*sentry.Hub, 0, len(r.hubs))
+	for _, hub := range r.hubs {
+		hubs = append(hubs, hub)
+	}
+	r.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	flushed := true
+	for _, hub := range hubs {
+		if !hub.Flush(time.Until(deadline)) {
+			flushed = false
+		}
+	}
+
+	return flushed
+}
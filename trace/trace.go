@@ -0,0 +1,69 @@
+// Package trace wraps functions of an application in spans, the way the
+// integrations wrap the calls of the libraries they instrument.
+//
+//	user, err := trace.Do(ctx, "function", "load user", func(ctx context.Context) (*User, error) {
+//		return users.Get(ctx, userID)
+//	})
+//
+// The function receives the context of its span, and the span status follows
+// the error it returns.
+package trace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/profiling"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "manual"}
+
+// Do calls fn within a span of op described by desc, a transaction when ctx
+// carries no span. A panic of fn is captured and recorded on the span before
+// being re-panicked.
+func Do[T any](ctx context.Context, op, desc string, fn func(ctx context.Context) (T, error), opts ...sentry.SpanOption) (result T, err error) {
+	span := integration.StartSampledSpan(ctx, nil, op, desc, opts...)
+	if span == nil {
+		return fn(ctx)
+	}
+	defer span.Finish()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			span.Status = sentry.SpanStatusInternalError
+			span.SetData("error", fmt.Sprintf("panic: %v", recovered))
+
+			hub := sentry.GetHubFromContext(ctx)
+			if hub == nil {
+				hub = sentry.CurrentHub()
+			}
+			hub.RecoverWithContext(span.Context(), recovered)
+
+			panic(recovered)
+		}
+	}()
+
+	ctx, unlabel := profiling.Label(span.Context(), span)
+	defer unlabel()
+
+	result, err = fn(ctx)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+	} else {
+		span.Status = sentry.SpanStatusOK
+	}
+
+	return result, err
+}
+
+// Run is Do for functions returning only an error.
+func Run(ctx context.Context, op, desc string, fn func(ctx context.Context) error, opts ...sentry.SpanOption) error {
+	_, err := Do(ctx, op, desc, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, opts...)
+
+	return err
+}
@@ -0,0 +1,299 @@
+// Package twiliotracer provides a tracer implementation for twilio-go, as a
+// client.BaseClient.
+//
+// twilio-go does not take a context on its API calls, so the traced client has
+// to be bound to the context of the caller before creating the REST client.
+//
+//	tracedClient := twiliotracer.NewSentryClient(&client.Client{
+//		Credentials: client.NewCredentials(accountSid, authToken),
+//	})
+//
+//	twilioClient := twilio.NewRestClientWithParams(twilio.ClientParams{
+//		Client: tracedClient.WithContext(ctx),
+//	})
+//
+//	message, err := twilioClient.Api.CreateMessage(params)
+//
+// Spans are named after the API resource and operation, e.g.
+// "Messages.create". The SID and status of created messages and calls are
+// recorded as breadcrumbs, and so are the status callbacks Twilio sends for
+// them when NewStatusCallbackHandler is used, so both can be correlated by SID.
+package twiliotracer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+	"github.com/twilio/twilio-go/client"
+)
+
+// sidPattern matches Twilio resource SIDs within request paths, such as
+// "AC0123456789abcdef0123456789abcdef".
+var sidPattern = regexp.MustCompile(`^[A-Z]{2}[0-9a-fA-F]{32}$`)
+
+var integration = config.Integration{Origin: "auto.http.twilio"}
+
+// SetEnabled turns the spans of Twilio API calls on or off at runtime, running
+// them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryTwilioTracerOption func(*Client)
+
+func WithTags(tags map[string]string) SentryTwilioTracerOption {
+	return func(c *Client) {
+		for k, v := range tags {
+			c.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryTwilioTracerOption {
+	return func(c *Client) {
+		c.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of requests for which sampler returns false,
+// given the "http.client" operation and the "Resource.operation" description.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryTwilioTracerOption {
+	return func(c *Client) {
+		c.spanSampler = sampler
+	}
+}
+
+func NewSentryClient(base client.BaseClient, opts ...SentryTwilioTracerOption) *Client {
+	c := &Client{
+		BaseClient: base,
+		ctx:        context.Background(),
+		tags:       make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Client wraps a client.BaseClient, tracing every request sent through it.
+type Client struct {
+	client.BaseClient
+	ctx         context.Context
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+// WithContext returns a copy of c whose requests are traced as children of the
+// span of ctx.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
+
+// SendRequest implements client.BaseClient.
+func (c *Client) SendRequest(method string, rawURL string, data url.Values, headers map[string]interface{}) (*http.Response, error) {
+	resource, operation := parseURL(method, rawURL)
+	description := resource + "." + operation
+
+	span := integration.StartSampledSpan(c.ctx, c.spanSampler, "http.client", description)
+	if span == nil {
+		return c.BaseClient.SendRequest(method, rawURL, data, headers)
+	}
+	defer span.Finish()
+
+	span.SetData(semconv.HTTPRequestMethod.Key(), method)
+	span.SetData("twilio.resource", resource)
+	span.SetData("twilio.operation", operation)
+	if u, err := url.Parse(rawURL); err == nil {
+		span.SetData(semconv.ServerAddress.Key(), u.Hostname())
+	}
+
+	for k, v := range c.tags {
+		span.SetTag(k, v)
+	}
+
+	response, err := c.BaseClient.SendRequest(method, rawURL, data, headers)
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		span.SetData("error", err.Error())
+
+		var restErr *client.TwilioRestError
+		if errors.As(err, &restErr) {
+			span.Status = spanStatus(restErr)
+			span.SetData("twilio.error_code", strconv.Itoa(restErr.Code))
+			span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(restErr.Status))
+		}
+
+		return response, err
+	}
+
+	span.Status = sentry.HTTPtoSpanStatus(response.StatusCode)
+	span.SetData(semconv.HTTPResponseStatusCode.Key(), strconv.Itoa(response.StatusCode))
+
+	if method == http.MethodPost && operation == "create" && (resource == "Messages" || resource == "Calls") {
+		recordCreated(span, response, resource)
+	}
+
+	return response, nil
+}
+
+// recordCreated records the SID and status of a created message or call, both
+// on the span and as a breadcrumb, for its status callbacks to be correlated
+// with. The response body is read and replaced with an in-memory copy.
+func recordCreated(span *sentry.Span, response *http.Response, resource string) {
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	var created struct {
+		Sid    string `json:"sid"`
+		Status string `json:"status"`
+	}
+	if json.Unmarshal(body, &created) != nil || created.Sid == "" {
+		return
+	}
+
+	span.SetData("twilio.sid", created.Sid)
+	span.SetData("twilio.status", created.Status)
+
+	sentry.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "twilio",
+		Message:  "Created " + strings.TrimSuffix(strings.ToLower(resource), "s") + " " + created.Sid,
+		Data: map[string]interface{}{
+			"sid":    created.Sid,
+			"status": created.Status,
+		},
+		Level: sentry.LevelInfo,
+	})
+}
+
+// spanStatus maps a Twilio error to a span status, by its error code when it is
+// a well-known one, or by its HTTP status otherwise.
+func spanStatus(err *client.TwilioRestError) sentry.SpanStatus {
+	switch err.Code {
+	case 20003:
+		return sentry.SpanStatusUnauthenticated
+	case 20404:
+		return sentry.SpanStatusNotFound
+	case 20429, 14107:
+		return sentry.SpanStatusResourceExhausted
+	case 21211, 21614, 21408:
+		return sentry.SpanStatusInvalidArgument
+	case 21610:
+		return sentry.SpanStatusFailedPrecondition
+	}
+
+	if err.Status != 0 {
+		return sentry.HTTPtoSpanStatus(err.Status)
+	}
+
+	return sentry.SpanStatusInternalError
+}
+
+// parseURL derives the resource and a CRUD style operation out of a request,
+// e.g. "Messages" and "create" for a POST to
+// "/2010-04-01/Accounts/{AccountSid}/Messages.json".
+func parseURL(method, rawURL string) (resource string, operation string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "unknown", strings.ToLower(method)
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	last := strings.TrimSuffix(segments[len(segments)-1], ".json")
+	bySid := sidPattern.MatchString(last)
+
+	resource = last
+	if bySid && len(segments) > 1 {
+		resource = segments[len(segments)-2]
+	}
+
+	switch method {
+	case http.MethodGet:
+		if bySid {
+			return resource, "fetch"
+		}
+		return resource, "list"
+	case http.MethodPost:
+		if bySid {
+			return resource, "update"
+		}
+		return resource, "create"
+	case http.MethodDelete:
+		return resource, "delete"
+	default:
+		return resource, strings.ToLower(method)
+	}
+}
+
+// NewStatusCallbackHandler returns a handler recording the message and call
+// status callbacks Twilio sends as breadcrumbs, before calling next.
+func NewStatusCallbackHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err == nil {
+			addStatusCallbackBreadcrumb(r)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func addStatusCallbackBreadcrumb(r *http.Request) {
+	data := map[string]interface{}{}
+
+	var message string
+	switch {
+	case r.PostForm.Get("MessageSid") != "":
+		sid, status := r.PostForm.Get("MessageSid"), r.PostForm.Get("MessageStatus")
+		data["sid"] = sid
+		data["status"] = status
+		message = "Message " + sid + " " + status
+	case r.PostForm.Get("CallSid") != "":
+		sid, status := r.PostForm.Get("CallSid"), r.PostForm.Get("CallStatus")
+		data["sid"] = sid
+		data["status"] = status
+		if duration := r.PostForm.Get("CallDuration"); duration != "" {
+			data["duration"] = duration
+		}
+		message = "Call " + sid + " " + status
+	default:
+		return
+	}
+
+	level := sentry.LevelInfo
+	if code := r.PostForm.Get("ErrorCode"); code != "" {
+		data["error_code"] = code
+		level = sentry.LevelError
+	}
+
+	hub := sentry.GetHubFromContext(r.Context())
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "twilio.status_callback",
+		Message:  message,
+		Data:     data,
+		Level:    level,
+	}, nil)
+}
@@ -0,0 +1,210 @@
+// Package watermilltracer provides a tracer implementation for Watermill routers
+// and publishers, regardless of the underlying Pub/Sub.
+//
+//	router, err := message.NewRouter(message.RouterConfig{}, logger)
+//	if err != nil {
+//		return err
+//	}
+//
+//	router.AddMiddleware(watermilltracer.NewSentryMiddleware())
+//	router.AddPublisherDecorators(watermilltracer.NewSentryPublisherDecorator())
+//
+//	// Publishers used outside of a router can be wrapped directly.
+//	publisher := watermilltracer.NewSentryPublisher(pub)
+//
+//	msg := message.NewMessage(watermill.NewUUID(), payload)
+//	msg.SetContext(ctx)
+//	err = publisher.Publish("orders", msg)
+package watermilltracer
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/aldy505/sentry-integration/config"
+	"github.com/aldy505/sentry-integration/messaging"
+	"github.com/aldy505/sentry-integration/propagation"
+	"github.com/aldy505/sentry-integration/semconv"
+	"github.com/getsentry/sentry-go"
+)
+
+var integration = config.Integration{Origin: "auto.queue.watermill"}
+
+// SetEnabled turns the spans of Watermill publishes and handlers on or off at
+// runtime, running them untraced while off.
+func SetEnabled(enabled bool) {
+	integration.SetEnabled(enabled)
+}
+
+type SentryWatermillTracerOption func(*tracer)
+
+func WithTags(tags map[string]string) SentryWatermillTracerOption {
+	return func(t *tracer) {
+		for k, v := range tags {
+			t.tags[k] = v
+		}
+	}
+}
+
+func WithTag(key, value string) SentryWatermillTracerOption {
+	return func(t *tracer) {
+		t.tags[key] = value
+	}
+}
+
+// WithSpanSampler drops the spans of messages for which sampler returns false,
+// given the operation and the handler name or topic.
+func WithSpanSampler(sampler func(operation, description string) bool) SentryWatermillTracerOption {
+	return func(t *tracer) {
+		t.spanSampler = sampler
+	}
+}
+
+type tracer struct {
+	tags        map[string]string
+	spanSampler func(operation, description string) bool
+}
+
+func newTracer(opts ...SentryWatermillTracerOption) tracer {
+	t := tracer{
+		tags: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	return t
+}
+
+func (t tracer) setTags(span *sentry.Span) {
+	for k, v := range t.tags {
+		span.SetTag(k, v)
+	}
+}
+
+// NewSentryMiddleware returns a router middleware that runs every handled message
+// within a "queue.process" transaction continued from the message metadata. The
+// message context carries the transaction, so messages produced by the handler
+// become part of the same trace.
+func NewSentryMiddleware(opts ...SentryWatermillTracerOption) message.HandlerMiddleware {
+	t := newTracer(opts...)
+
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx := msg.Context()
+			ctx, continueTrace := propagation.Continue(ctx, msg.Metadata)
+
+			topic := message.SubscribeTopicFromCtx(ctx)
+			name := message.HandlerNameFromCtx(ctx)
+			if name == "" {
+				name = topic
+			}
+
+			span := integration.StartTransaction(
+				ctx,
+				t.spanSampler,
+				"queue.process",
+				name,
+				continueTrace,
+			)
+			if span == nil {
+				return h(msg)
+			}
+			defer span.Finish()
+
+			span.SetData("messaging.system", "watermill")
+			span.SetData(semconv.MessagingDestinationName.Key(), topic)
+			span.SetData(semconv.MessagingMessageID.Key(), msg.UUID)
+			messaging.SetBodySize(span, len(msg.Payload))
+			if subscriber := message.SubscriberNameFromCtx(ctx); subscriber != "" {
+				span.SetData("messaging.watermill.subscriber", subscriber)
+			}
+			t.setTags(span)
+
+			msg.SetContext(span.Context())
+
+			produced, err := h(msg)
+			if err != nil {
+				span.Status = sentry.SpanStatusInternalError
+				span.SetData("error", err.Error())
+			} else {
+				span.Status = sentry.SpanStatusOK
+			}
+
+			return produced, err
+		}
+	}
+}
+
+// NewSentryPublisherDecorator returns a decorator to be used with
+// message.Router.AddPublisherDecorators.
+func NewSentryPublisherDecorator(opts ...SentryWatermillTracerOption) message.PublisherDecorator {
+	return func(pub message.Publisher) (message.Publisher, error) {
+		return NewSentryPublisher(pub, opts...), nil
+	}
+}
+
+func NewSentryPublisher(publisher message.Publisher, opts ...SentryWatermillTracerOption) message.Publisher {
+	return &Publisher{
+		Publisher: publisher,
+		tracer:    newTracer(opts...),
+	}
+}
+
+type Publisher struct {
+	message.Publisher
+	tracer
+}
+
+// Publish implements message.Publisher. A "queue.publish" span is created for
+// every message, as a child of the span carried by the message context.
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	spans := make([]*sentry.Span, 0, len(messages))
+	for _, msg := range messages {
+		span := p.startPublishSpan(msg.Context(), topic, msg)
+		if span == nil {
+			continue
+		}
+
+		spans = append(spans, span)
+	}
+
+	err := p.Publisher.Publish(topic, messages...)
+
+	for _, span := range spans {
+		if err != nil {
+			span.Status = sentry.SpanStatusInternalError
+			span.SetData("error", err.Error())
+		} else {
+			span.Status = sentry.SpanStatusOK
+		}
+
+		span.Finish()
+	}
+
+	return err
+}
+
+func (p *Publisher) startPublishSpan(ctx context.Context, topic string, msg *message.Message) *sentry.Span {
+	span := integration.StartSampledSpan(ctx, p.spanSampler, "queue.publish", topic)
+	if span == nil {
+		return nil
+	}
+
+	span.SetData("messaging.system", "watermill")
+	span.SetData(semconv.MessagingDestinationName.Key(), topic)
+	span.SetData(semconv.MessagingMessageID.Key(), msg.UUID)
+	messaging.SetBodySize(span, len(msg.Payload))
+	if publisher := message.PublisherNameFromCtx(ctx); publisher != "" {
+		span.SetData("messaging.watermill.publisher", publisher)
+	}
+	p.setTags(span)
+
+	if msg.Metadata == nil {
+		msg.Metadata = make(message.Metadata)
+	}
+	propagation.Inject(span, msg.Metadata)
+
+	return span
+}